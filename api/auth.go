@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// An identity of the wallet and the MSP that issued its certificate
+type walletIdentity struct {
+	Name  string `json:"identity"` // MSP directory under WALLET_DIR
+	MSPID string `json:"mspId"`
+}
+
+// Wallet identity each client may act as, keyed by the common name of the
+// client certificate it authenticates with
+type identityMap map[string]walletIdentity
+
+// Reads the identity map, failing unless every entry names a wallet identity
+// and its MSP ID and each wallet identity has a single MSP ID
+func loadIdentityMap(path string) (identityMap, error) {
+	mapJSON, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity map: %w", err)
+	}
+
+	var identities identityMap
+	err = json.Unmarshal(mapJSON, &identities)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity map %s: %w", path, err)
+	}
+
+	mspIDs := map[string]string{}
+	for principal, identity := range identities {
+		if identity.Name == "" || identity.MSPID == "" {
+			return nil, fmt.Errorf("invalid identity map %s: client %s needs an identity and its mspId", path, principal)
+		}
+		if mspID, ok := mspIDs[identity.Name]; ok && mspID != identity.MSPID {
+			return nil, fmt.Errorf("invalid identity map %s: identity %s is given MSP IDs %s and %s", path, identity.Name, mspID, identity.MSPID)
+		}
+		mspIDs[identity.Name] = identity.MSPID
+	}
+	return identities, nil
+}
+
+// A request made without authenticating, as opposed to by a client with no identity
+var errNoClientCertificate = errors.New("a client certificate issued by the client CA is required")
+
+// The wallet identity of the client that made a request, taken from its
+// verified TLS client certificate. Nothing the client sends in the request
+// itself chooses the identity.
+func (m identityMap) identityOf(r *http.Request) (walletIdentity, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return walletIdentity{}, errNoClientCertificate
+	}
+
+	principal := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	identity, ok := m[principal]
+	if !ok || identity.Name == "" {
+		return walletIdentity{}, fmt.Errorf("client %s is not mapped to a wallet identity", principal)
+	}
+	return identity, nil
+}
+
+// TLS configuration requiring every client to present a certificate issued by
+// the CA at clientCAPath
+func serverTLSConfig(clientCAPath string) (*tls.Config, error) {
+	caPEM, err := os.ReadFile(clientCAPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA certificate: %w", err)
+	}
+
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in %s", clientCAPath)
+	}
+
+	return &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+		MinVersion: tls.VersionTLS12,
+	}, nil
+}
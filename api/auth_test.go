@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIdentityOf(t *testing.T) {
+	teller := walletIdentity{Name: "hdfc-teller", MSPID: "HDFCMSP"}
+	identities := identityMap{"teller-1": teller}
+	verified := func(commonName string) *tls.ConnectionState {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+
+	tests := []struct {
+		name     string
+		tls      *tls.ConnectionState
+		header   string
+		identity walletIdentity
+		err      error
+	}{
+		{name: "mapped client", tls: verified("teller-1"), identity: teller},
+		{name: "header ignored", tls: verified("teller-1"), header: "admin", identity: teller},
+		{name: "plain connection", header: "admin", err: errNoClientCertificate},
+		{name: "unverified certificate", tls: &tls.ConnectionState{}, err: errNoClientCertificate},
+		{name: "unmapped client", tls: verified("teller-2")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/loans/L1", nil)
+			r.TLS = tt.tls
+			if tt.header != "" {
+				r.Header.Set("X-Identity", tt.header)
+			}
+
+			identity, err := identities.identityOf(r)
+			switch {
+			case tt.identity != walletIdentity{}:
+				if err != nil || identity != tt.identity {
+					t.Fatalf("identityOf = %+v, %v, want %+v", identity, err, tt.identity)
+				}
+			case tt.err != nil:
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("identityOf error = %v, want %v", err, tt.err)
+				}
+			default:
+				if err == nil || errors.Is(err, errNoClientCertificate) {
+					t.Fatalf("identityOf error = %v, want an unmapped client error", err)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadIdentityMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantErr string
+	}{
+		{name: "complete", json: `{"teller-1": {"identity": "hdfc-teller", "mspId": "HDFCMSP"}, "teller-2": {"identity": "hdfc-teller", "mspId": "HDFCMSP"}}`},
+		{name: "missing MSP ID", json: `{"teller-1": {"identity": "hdfc-teller"}}`, wantErr: "client teller-1 needs an identity and its mspId"},
+		{name: "missing identity", json: `{"teller-1": {"mspId": "HDFCMSP"}}`, wantErr: "client teller-1 needs an identity and its mspId"},
+		{name: "bare identity name", json: `{"teller-1": "hdfc-teller"}`, wantErr: "cannot unmarshal"},
+		{name: "conflicting MSP IDs", json: `{"a": {"identity": "teller", "mspId": "HDFCMSP"}, "b": {"identity": "teller", "mspId": "SBIMSP"}}`, wantErr: "identity teller is given MSP IDs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "identities.json")
+			if err := os.WriteFile(path, []byte(tt.json), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			identities, err := loadIdentityMap(path)
+			if tt.wantErr == "" {
+				if err != nil || identities["teller-2"].MSPID != "HDFCMSP" {
+					t.Fatalf("loadIdentityMap = %+v, %v", identities, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("loadIdentityMap error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
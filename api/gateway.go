@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"google.golang.org/grpc"
+
+	"github.com/TSChallenges/npci-blockchain-assignment-9-Jagadeeswargoud/internal/gateway"
+)
+
+type gatewayConfig struct {
+	PeerEndpoint  string
+	PeerHostAlias string
+	PeerTLSCert   string
+	WalletDir     string
+	Channel       string
+	Chaincode     string
+}
+
+// Shares one gRPC connection to the peer and keeps a gateway per identity
+type gatewayPool struct {
+	config     gatewayConfig
+	connection *grpc.ClientConn
+
+	mu       sync.Mutex
+	gateways map[string]*client.Gateway
+}
+
+func newGatewayPool(config gatewayConfig) (*gatewayPool, error) {
+	connection, err := gateway.NewConnection(config.PeerEndpoint, config.PeerTLSCert, config.PeerHostAlias)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gatewayPool{
+		config:     config,
+		connection: connection,
+		gateways:   map[string]*client.Gateway{},
+	}, nil
+}
+
+// Returns the lending contract as seen by a wallet identity
+func (p *gatewayPool) Contract(identity walletIdentity) (*client.Contract, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	gw, ok := p.gateways[identity.Name]
+	if !ok {
+		// Identity names are directory names, never paths
+		if identity.Name == "" || filepath.Base(identity.Name) != identity.Name {
+			return nil, fmt.Errorf("invalid identity %q", identity.Name)
+		}
+
+		var err error
+		gw, err = gateway.ConnectMSPDir(p.connection, identity.MSPID, filepath.Join(p.config.WalletDir, identity.Name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect as %s: %w", identity.Name, err)
+		}
+		p.gateways[identity.Name] = gw
+	}
+
+	return gw.GetNetwork(p.config.Channel).GetContract(p.config.Chaincode), nil
+}
+
+func (p *gatewayPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, gw := range p.gateways {
+		gw.Close()
+	}
+	p.connection.Close()
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// Request bodies of the state-changing endpoints. Amounts and rates are
+// json.Number so they reach the chaincode digit for digit, whether sent as
+// 1500.25 or "1500.25"
+
+type requestLoanBody struct {
+	LoanID       string      `json:"loanId"`
+	BorrowerID   string      `json:"borrowerId"`
+	Amount       json.Number `json:"amount"`
+	InterestRate json.Number `json:"interestRate"`
+	Duration     int         `json:"duration"`
+	Collateral   string      `json:"collateral"`
+	Product      string      `json:"product"`
+	PSLCategory  string      `json:"pslCategory"`
+	PriorLoanID  string      `json:"priorLoanId"`
+
+	// Personal data of the borrower, passed to the chaincode in the
+	// transient map so it stays out of the transaction
+	Borrower json.RawMessage `json:"borrower,omitempty"`
+}
+
+type approveLoanBody struct {
+	LenderID string `json:"lenderId"`
+}
+
+type disburseTrancheBody struct {
+	Amount json.Number `json:"amount"`
+}
+
+type repayLoanBody struct {
+	Amount           json.Number `json:"amount"`
+	PaymentReference string      `json:"paymentReference"`
+}
+
+type transactionResponse struct {
+	TransactionID string          `json:"transactionId"`
+	Result        json.RawMessage `json:"result,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Header carrying the client's idempotency key, forwarded to the chaincode as
+// its request ID so a retried request is not applied twice
+const idempotencyHeader = "Idempotency-Key"
+
+func newRouter(gateways *gatewayPool, identities identityMap) http.Handler {
+	h := &handlers{gateways: gateways, identities: identities}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/loans", h.requestLoan)
+	mux.HandleFunc("POST /api/loans/{loanID}/approve", h.approveLoan)
+	mux.HandleFunc("POST /api/loans/{loanID}/disburse", h.disburseLoan)
+	mux.HandleFunc("POST /api/loans/{loanID}/tranches", h.disburseTranche)
+	mux.HandleFunc("GET /api/loans/{loanID}/tranches", h.getTrancheInterest)
+	mux.HandleFunc("POST /api/loans/{loanID}/repay", h.repayLoan)
+	mux.HandleFunc("GET /api/loans/{loanID}", h.getLoan)
+	mux.HandleFunc("GET /api/loans/{loanID}/history", h.getLoanHistory)
+	mux.HandleFunc("GET /api/loans/{loanID}/audit", h.getAuditTrailPage)
+	mux.HandleFunc("GET /api/loans/{loanID}/statement", h.getStatement)
+	mux.HandleFunc("GET /api/loans/{loanID}/foreclosure", h.simulateForeclosure)
+	mux.HandleFunc("GET /api/simulations/schedule", h.simulateSchedule)
+	mux.HandleFunc("GET /api/lenders/{lenderID}/loans", h.getLoansByLender)
+	mux.HandleFunc("GET /api/lenders/{lenderID}/statement", h.getLenderStatement)
+	mux.HandleFunc("GET /api/lenders/{lenderID}/applications", h.getPendingApplications)
+	mux.HandleFunc("GET /api/lenders/{lenderID}/accrued-interest", h.getAccruedInterestReport)
+	mux.HandleFunc("GET /api/borrowers/{borrowerID}/loans", h.getLoansByBorrower)
+	mux.HandleFunc("GET /api/accounts/{account}/balance", h.getBalance)
+	mux.HandleFunc("GET /api/accounts/{account}/statement", h.getAccountStatement)
+	mux.HandleFunc("GET /api/accounts/{account}/tds", h.getTDSLedger)
+	mux.HandleFunc("GET /api/accounts/{account}/invoices", h.getInvoices)
+	mux.HandleFunc("GET /api/export/loans", h.exportLoans)
+	mux.HandleFunc("GET /api/export/accounts", h.exportAccounts)
+	return mux
+}
+
+type handlers struct {
+	gateways   *gatewayPool
+	identities identityMap
+}
+
+func (h *handlers) requestLoan(w http.ResponseWriter, r *http.Request) {
+	var body requestLoanBody
+	if !decodeBody(w, r, &body) {
+		return
+	}
+	if body.LoanID == "" || body.BorrowerID == "" {
+		writeError(w, http.StatusBadRequest, errors.New("loanId and borrowerId are required"))
+		return
+	}
+
+	var transient map[string][]byte
+	if len(body.Borrower) > 0 {
+		transient = map[string][]byte{"borrower_pii": body.Borrower}
+	}
+
+	h.submitTransient(w, r, transient, "RequestLoan",
+		body.LoanID,
+		body.BorrowerID,
+		body.Amount.String(),
+		body.InterestRate.String(),
+		strconv.Itoa(body.Duration),
+		body.Collateral,
+		body.Product,
+		body.PSLCategory,
+		body.PriorLoanID)
+}
+
+func (h *handlers) approveLoan(w http.ResponseWriter, r *http.Request) {
+	var body approveLoanBody
+	if !decodeBody(w, r, &body) {
+		return
+	}
+
+	h.submit(w, r, "ApproveLoan", r.PathValue("loanID"), body.LenderID)
+}
+
+func (h *handlers) disburseLoan(w http.ResponseWriter, r *http.Request) {
+	h.submit(w, r, "DisburseLoan", r.PathValue("loanID"))
+}
+
+func (h *handlers) disburseTranche(w http.ResponseWriter, r *http.Request) {
+	var body disburseTrancheBody
+	if !decodeBody(w, r, &body) {
+		return
+	}
+
+	h.submit(w, r, "DisburseTranche", r.PathValue("loanID"), body.Amount.String())
+}
+
+func (h *handlers) getTrancheInterest(w http.ResponseWriter, r *http.Request) {
+	h.evaluate(w, r, "GetTrancheInterest", r.PathValue("loanID"), r.URL.Query().Get("asOf"))
+}
+
+func (h *handlers) repayLoan(w http.ResponseWriter, r *http.Request) {
+	var body repayLoanBody
+	if !decodeBody(w, r, &body) {
+		return
+	}
+
+	h.submit(w, r, "RepayLoan", r.PathValue("loanID"), body.Amount.String(), body.PaymentReference)
+}
+
+func (h *handlers) getLoan(w http.ResponseWriter, r *http.Request) {
+	h.evaluate(w, r, "GetLoan", r.PathValue("loanID"))
+}
+
+func (h *handlers) getLoanHistory(w http.ResponseWriter, r *http.Request) {
+	pageSize, bookmark := pagination(r)
+	h.evaluate(w, r, "GetLoanHistory", r.PathValue("loanID"), pageSize, bookmark)
+}
+
+func (h *handlers) getAuditTrailPage(w http.ResponseWriter, r *http.Request) {
+	pageSize, bookmark := pagination(r)
+	h.evaluate(w, r, "GetAuditTrailPage", r.PathValue("loanID"), pageSize, bookmark)
+}
+
+func (h *handlers) getStatement(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	h.evaluate(w, r, "GetStatement", r.PathValue("loanID"), query.Get("from"), query.Get("to"))
+}
+
+func (h *handlers) simulateForeclosure(w http.ResponseWriter, r *http.Request) {
+	h.evaluate(w, r, "SimulateForeclosure", r.PathValue("loanID"), r.URL.Query().Get("asOf"))
+}
+
+func (h *handlers) simulateSchedule(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	compounding := query.Get("compounding")
+	if compounding == "" {
+		compounding = "0"
+	}
+	h.evaluate(w, r, "SimulateSchedule", query.Get("amount"), query.Get("rate"), query.Get("duration"), query.Get("method"), compounding)
+}
+
+func (h *handlers) getLoansByLender(w http.ResponseWriter, r *http.Request) {
+	pageSize, bookmark := pagination(r)
+	h.evaluate(w, r, "GetLoansByLender", r.PathValue("lenderID"), pageSize, bookmark)
+}
+
+func (h *handlers) getLenderStatement(w http.ResponseWriter, r *http.Request) {
+	h.evaluate(w, r, "GetLenderStatement", r.PathValue("lenderID"), r.URL.Query().Get("period"))
+}
+
+func (h *handlers) getPendingApplications(w http.ResponseWriter, r *http.Request) {
+	pageSize, bookmark := pagination(r)
+	h.evaluate(w, r, "GetPendingApplications", r.PathValue("lenderID"), pageSize, bookmark)
+}
+
+func (h *handlers) getAccruedInterestReport(w http.ResponseWriter, r *http.Request) {
+	h.evaluate(w, r, "GetAccruedInterestReport", r.PathValue("lenderID"), r.URL.Query().Get("asOf"))
+}
+
+func (h *handlers) getLoansByBorrower(w http.ResponseWriter, r *http.Request) {
+	pageSize, bookmark := pagination(r)
+	h.evaluate(w, r, "GetLoansByBorrower", r.PathValue("borrowerID"), pageSize, bookmark)
+}
+
+func (h *handlers) getBalance(w http.ResponseWriter, r *http.Request) {
+	h.evaluate(w, r, "GetBalance", r.PathValue("account"))
+}
+
+func (h *handlers) getAccountStatement(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	pageSize, bookmark := pagination(r)
+	h.evaluate(w, r, "GetAccountStatement", r.PathValue("account"), query.Get("from"), query.Get("to"), pageSize, bookmark)
+}
+
+func (h *handlers) getTDSLedger(w http.ResponseWriter, r *http.Request) {
+	pageSize, bookmark := pagination(r)
+	h.evaluate(w, r, "GetTDSLedger", r.PathValue("account"), r.URL.Query().Get("period"), pageSize, bookmark)
+}
+
+func (h *handlers) getInvoices(w http.ResponseWriter, r *http.Request) {
+	pageSize, bookmark := pagination(r)
+	h.evaluate(w, r, "GetInvoices", r.PathValue("account"), r.URL.Query().Get("period"), pageSize, bookmark)
+}
+
+func (h *handlers) exportLoans(w http.ResponseWriter, r *http.Request) {
+	cursor, limit := exportBatch(r)
+	h.evaluate(w, r, "ExportLoans", cursor, limit)
+}
+
+func (h *handlers) exportAccounts(w http.ResponseWriter, r *http.Request) {
+	cursor, limit := exportBatch(r)
+	h.evaluate(w, r, "ExportAccounts", cursor, limit)
+}
+
+// Endorses and commits a transaction, waiting for it to be committed
+func (h *handlers) submit(w http.ResponseWriter, r *http.Request, function string, args ...string) {
+	h.submitTransient(w, r, nil, function, args...)
+}
+
+// Submits a transaction like submit with private data in its transient map
+func (h *handlers) submitTransient(w http.ResponseWriter, r *http.Request, transient map[string][]byte, function string, args ...string) {
+	contract, ok := h.contract(w, r)
+	if !ok {
+		return
+	}
+
+	if requestID := r.Header.Get(idempotencyHeader); requestID != "" {
+		withID := map[string][]byte{"request_id": []byte(requestID)}
+		for key, value := range transient {
+			withID[key] = value
+		}
+		transient = withID
+	}
+
+	options := []client.ProposalOption{client.WithArguments(args...)}
+	if len(transient) > 0 {
+		options = append(options, client.WithTransient(transient))
+	}
+
+	result, commit, err := contract.SubmitAsync(function, options...)
+	if err != nil {
+		writeError(w, chaincodeStatus(err), err)
+		return
+	}
+
+	status, err := commit.Status()
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	if !status.Successful {
+		writeError(w, http.StatusConflict, fmt.Errorf("transaction %s failed to commit with status %d", status.TransactionID, int32(status.Code)))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, transactionResponse{
+		TransactionID: commit.TransactionID(),
+		Result:        asJSON(result),
+	})
+}
+
+// Runs a read-only query on the gateway peer
+func (h *handlers) evaluate(w http.ResponseWriter, r *http.Request, function string, args ...string) {
+	contract, ok := h.contract(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := contract.EvaluateTransaction(function, args...)
+	if err != nil {
+		writeError(w, chaincodeStatus(err), err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(asJSON(result))
+}
+
+func (h *handlers) contract(w http.ResponseWriter, r *http.Request) (*client.Contract, bool) {
+	identity, err := h.identities.identityOf(r)
+	if errors.Is(err, errNoClientCertificate) {
+		writeError(w, http.StatusUnauthorized, err)
+		return nil, false
+	}
+	if err != nil {
+		writeError(w, http.StatusForbidden, err)
+		return nil, false
+	}
+
+	contract, err := h.gateways.Contract(identity)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return nil, false
+	}
+	return contract, true
+}
+
+// Chaincode rejections are client errors, anything else is a gateway failure
+func chaincodeStatus(err error) int {
+	var endorseErr *client.EndorseError
+	if errors.As(err, &endorseErr) {
+		return http.StatusBadRequest
+	}
+	return http.StatusBadGateway
+}
+
+// Query parameters of a bulk export, batches default to 500 records
+func exportBatch(r *http.Request) (string, string) {
+	limit := r.URL.Query().Get("limit")
+	if limit == "" {
+		limit = "500"
+	}
+	return r.URL.Query().Get("cursor"), limit
+}
+
+func pagination(r *http.Request) (string, string) {
+	pageSize := r.URL.Query().Get("pageSize")
+	if pageSize == "" {
+		pageSize = "50"
+	}
+	return pageSize, r.URL.Query().Get("bookmark")
+}
+
+// Chaincode results are JSON, except bare strings and numbers which are wrapped
+func asJSON(result []byte) json.RawMessage {
+	if len(result) == 0 {
+		return nil
+	}
+	if json.Valid(result) {
+		return result
+	}
+	quoted, _ := json.Marshal(string(result))
+	return quoted
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, body interface{}) bool {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(body); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
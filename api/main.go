@@ -0,0 +1,73 @@
+// Command api serves a REST interface to the lending chaincode through the
+// Fabric Gateway, so frontends do not need any Fabric SDK code of their own.
+//
+// Configuration is read from the environment:
+//
+//	API_ADDR          listen address (default :8080)
+//	PEER_ENDPOINT     gateway peer endpoint (default localhost:7051)
+//	PEER_HOST_ALIAS   TLS server name override (default peer0.org1.example.com)
+//	PEER_TLS_CERT     path to the peer TLS CA certificate
+//	WALLET_DIR        directory holding one MSP directory per identity
+//	CHANNEL_NAME      channel name (default mychannel)
+//	CHAINCODE_NAME    chaincode name (default lending)
+//	API_TLS_CERT      server TLS certificate (default tls/server.crt)
+//	API_TLS_KEY       server TLS private key (default tls/server.key)
+//	API_CLIENT_CA     CA certificate issuing the client certificates (default tls/client-ca.crt)
+//	API_IDENTITIES    JSON map of client certificate common names to wallet identities (default identities.json)
+//
+// Clients authenticate with a TLS client certificate issued by API_CLIENT_CA.
+// Each request is submitted as the wallet identity API_IDENTITIES maps the
+// certificate's common name to, a directory under WALLET_DIR laid out like a
+// Fabric MSP (signcerts/ and keystore/). Clients without a mapping are refused.
+// Every mapping names the identity's MSP, as the chaincode authorizes callers
+// by it, and the service does not start while one is missing:
+//
+//	{"teller-1": {"identity": "hdfc-teller", "mspId": "HDFCMSP"}}
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+)
+
+func main() {
+	config := gatewayConfig{
+		PeerEndpoint:  env("PEER_ENDPOINT", "localhost:7051"),
+		PeerHostAlias: env("PEER_HOST_ALIAS", "peer0.org1.example.com"),
+		PeerTLSCert:   env("PEER_TLS_CERT", "organizations/peerOrganizations/org1.example.com/peers/peer0.org1.example.com/tls/ca.crt"),
+		WalletDir:     env("WALLET_DIR", "wallet"),
+		Channel:       env("CHANNEL_NAME", "mychannel"),
+		Chaincode:     env("CHAINCODE_NAME", "lending"),
+	}
+
+	identities, err := loadIdentityMap(env("API_IDENTITIES", "identities.json"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	tlsConfig, err := serverTLSConfig(env("API_CLIENT_CA", "tls/client-ca.crt"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	gateways, err := newGatewayPool(config)
+	if err != nil {
+		log.Fatalf("failed to set up gateway connection: %v", err)
+	}
+	defer gateways.Close()
+
+	server := &http.Server{
+		Addr:      env("API_ADDR", ":8080"),
+		Handler:   newRouter(gateways, identities),
+		TLSConfig: tlsConfig,
+	}
+	log.Printf("lending API listening on %s", server.Addr)
+	log.Fatal(server.ListenAndServeTLS(env("API_TLS_CERT", "tls/server.crt"), env("API_TLS_KEY", "tls/server.key")))
+}
+
+func env(name string, fallback string) string {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+	return fallback
+}
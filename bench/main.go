@@ -0,0 +1,233 @@
+// Command bench drives the hot paths of a deployed lending chaincode through
+// the Fabric Gateway and reports throughput, latency and how much the state
+// read back grows over the run.
+//
+// Two workloads are measured:
+//
+//	repay     RepayLoan of --amount on the ACTIVE loan --loan
+//	transfer  TransferTokens of --amount from --from to --to
+//
+// Each transaction carries a unique reference, so runs can be repeated
+// against the same accounts. State growth is measured on what the workload
+// appends to: the loan record (audit history, repayments) for repay and the
+// paying account's statement for the day for transfer.
+//
+// The same workloads run in process against an in-memory ledger through the
+// chaincode module's bench package, which isolates the chaincode's own cost
+// and reports the world state each transaction adds:
+//
+//	cd chaincode && go test -run '^$' -bench . . ./token
+//
+// Its tests fail when what a transaction adds grows with history. This
+// command adds endorsement, ordering and commit on a test network; run it as
+// an identity allowed to submit the workload (the borrower's operator for
+// repay, the paying account's operator for transfer).
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+
+	"github.com/TSChallenges/npci-blockchain-assignment-9-Jagadeeswargoud/internal/gateway"
+)
+
+// One workload: the transaction submitted for the n-th run and the query
+// whose payload size stands for the state it grows
+type workload struct {
+	function string
+	args     func(n int) []string
+	probe    func(contract *client.Contract) ([]byte, error)
+}
+
+// Outcome of a run
+type result struct {
+	submitted int
+	failed    int
+	elapsed   time.Duration
+	latencies []time.Duration
+}
+
+func main() {
+	var (
+		peerEndpoint  = flag.String("peer-endpoint", "localhost:7051", "gateway peer endpoint")
+		peerHostAlias = flag.String("peer-host-alias", "peer0.org1.example.com", "TLS server name of the peer")
+		tlsCert       = flag.String("tls-cert", "", "path to the peer TLS CA certificate")
+		mspID         = flag.String("msp-id", "", "MSP ID of the invoking identity, e.g. HDFCMSP")
+		mspDir        = flag.String("msp-dir", "", "MSP directory of the invoking identity")
+		channel       = flag.String("channel", "mychannel", "channel name")
+		chaincode     = flag.String("chaincode", "lending", "chaincode name")
+
+		mode        = flag.String("workload", "repay", "workload to run: repay or transfer")
+		count       = flag.Int("n", 100, "number of transactions to submit")
+		concurrency = flag.Int("concurrency", 8, "transactions in flight at once")
+		amount      = flag.String("amount", "1", "amount of each repayment or transfer")
+		loanID      = flag.String("loan", "", "loan repaid by the repay workload")
+		from        = flag.String("from", "", "account paying in the transfer workload")
+		to          = flag.String("to", "", "account paid in the transfer workload")
+	)
+	flag.Parse()
+
+	if *tlsCert == "" || *mspID == "" || *mspDir == "" {
+		log.Fatal("--tls-cert, --msp-id and --msp-dir are required")
+	}
+	if *count < 1 || *concurrency < 1 {
+		log.Fatal("--n and --concurrency must be at least 1")
+	}
+
+	run := fmt.Sprintf("BENCH-%d", time.Now().Unix())
+	var w workload
+	switch *mode {
+	case "repay":
+		if *loanID == "" {
+			log.Fatal("--loan is required for the repay workload")
+		}
+		w = workload{
+			function: "RepayLoan",
+			args: func(n int) []string {
+				return []string{*loanID, *amount, fmt.Sprintf("%s-%d", run, n)}
+			},
+			probe: func(contract *client.Contract) ([]byte, error) {
+				return contract.EvaluateTransaction("GetLoan", *loanID)
+			},
+		}
+	case "transfer":
+		if *from == "" || *to == "" {
+			log.Fatal("--from and --to are required for the transfer workload")
+		}
+		today := time.Now().UTC().Format("2006-01-02")
+		w = workload{
+			function: "TransferTokens",
+			args: func(n int) []string {
+				return []string{*from, *to, *amount, "SETTLEMENT", fmt.Sprintf("%s-%d", run, n)}
+			},
+			probe: func(contract *client.Contract) ([]byte, error) {
+				return contract.EvaluateTransaction("GetAccountStatement", *from, today, today, "100", "")
+			},
+		}
+	default:
+		log.Fatalf("unknown workload %s", *mode)
+	}
+
+	connection, err := gateway.NewConnection(*peerEndpoint, *tlsCert, *peerHostAlias)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer connection.Close()
+
+	gw, err := gateway.ConnectMSPDir(connection, *mspID, *mspDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer gw.Close()
+
+	contract := gw.GetNetwork(*channel).GetContract(*chaincode)
+
+	before, err := w.probe(contract)
+	if err != nil {
+		log.Fatalf("failed to read state before the run: %v", err)
+	}
+
+	res := runWorkload(contract, w, *count, *concurrency)
+
+	after, err := w.probe(contract)
+	if err != nil {
+		log.Fatalf("failed to read state after the run: %v", err)
+	}
+
+	report(os.Stdout, w.function, res, len(before), len(after))
+}
+
+// Submits count transactions of a workload, concurrency of them at a time,
+// each waiting for its commit
+func runWorkload(contract *client.Contract, w workload, count int, concurrency int) result {
+	var (
+		mu  sync.Mutex
+		res result
+		wg  sync.WaitGroup
+	)
+	runs := make(chan int)
+
+	start := time.Now()
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range runs {
+				submittedAt := time.Now()
+				err := submit(contract, w.function, w.args(n)...)
+				latency := time.Since(submittedAt)
+
+				mu.Lock()
+				res.submitted++
+				if err != nil {
+					res.failed++
+					log.Printf("%s %d failed: %v", w.function, n, err)
+				} else {
+					res.latencies = append(res.latencies, latency)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for n := 1; n <= count; n++ {
+		runs <- n
+	}
+	close(runs)
+	wg.Wait()
+	res.elapsed = time.Since(start)
+
+	return res
+}
+
+// Submits a transaction and waits for it to commit successfully
+func submit(contract *client.Contract, function string, args ...string) error {
+	_, commit, err := contract.SubmitAsync(function, client.WithArguments(args...))
+	if err != nil {
+		return err
+	}
+
+	status, err := commit.Status()
+	if err != nil {
+		return err
+	}
+	if !status.Successful {
+		return fmt.Errorf("transaction %s failed to commit with status %d", status.TransactionID, int32(status.Code))
+	}
+	return nil
+}
+
+func report(out io.Writer, function string, res result, sizeBefore int, sizeAfter int) {
+	committed := len(res.latencies)
+	fmt.Fprintf(out, "%s: %d submitted, %d committed, %d failed in %s\n",
+		function, res.submitted, committed, res.failed, res.elapsed.Round(time.Millisecond))
+	if committed > 0 {
+		sort.Slice(res.latencies, func(i, j int) bool { return res.latencies[i] < res.latencies[j] })
+		fmt.Fprintf(out, "throughput: %.1f tx/s\n", float64(committed)/res.elapsed.Seconds())
+		fmt.Fprintf(out, "latency: p50 %s, p95 %s, max %s\n",
+			percentile(res.latencies, 50), percentile(res.latencies, 95), res.latencies[committed-1])
+	}
+
+	growth := sizeAfter - sizeBefore
+	fmt.Fprintf(out, "state read back: %d bytes before, %d after, %+d bytes", sizeBefore, sizeAfter, growth)
+	if committed > 0 {
+		fmt.Fprintf(out, " (%.0f bytes/tx)", float64(growth)/float64(committed))
+	}
+	fmt.Fprintln(out)
+}
+
+// The p-th percentile of sorted latencies
+func percentile(sorted []time.Duration, p int) time.Duration {
+	index := (len(sorted)*p+99)/100 - 1
+	if index < 0 {
+		index = 0
+	}
+	return sorted[index].Round(time.Millisecond)
+}
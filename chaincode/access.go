@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// MSP of the regulator organization that administers the platform
+const regulatorMSP = "RBIMSP"
+
+func callerMSP(ctx contractapi.TransactionContextInterface) (string, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to read client MSP ID: %v", err)
+	}
+	return mspID, nil
+}
+
+func callerID(ctx contractapi.TransactionContextInterface) (string, error) {
+	id, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to read client identity: %v", err)
+	}
+	return id, nil
+}
+
+// Names the identity that submitted the transaction in the audit entries it
+// added, which end with its "(TxID: ...)", so the trail shows who made each
+// change rather than only the IDs passed as arguments, and gives each entry
+// an ID from nextRecordID. Entries of a transaction are the last ones of a
+// history, stamped entries are skipped.
+func stampAuditEntries(
+	ctx contractapi.TransactionContextInterface,
+	history []string,
+) error {
+	txID := ctx.GetStub().GetTxID()
+	suffix := fmt.Sprintf("(TxID: %s)", txID)
+	first := len(history)
+	for first > 0 && strings.HasSuffix(history[first-1], suffix) {
+		first--
+	}
+	if first == len(history) {
+		return nil
+	}
+
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return err
+	}
+	id, err := callerID(ctx)
+	if err != nil {
+		return err
+	}
+	for i := first; i < len(history); i++ {
+		entryID, err := nextRecordID(ctx)
+		if err != nil {
+			return err
+		}
+		history[i] = strings.TrimSuffix(history[i], suffix) +
+			fmt.Sprintf("(TxID: %s, Entry: %s, Submitter: %s %s)", txID, entryID, mspID, id)
+	}
+	return nil
+}
+
+// Certificate attributes read for attribute based access control
+const (
+	roleAttribute   = "role"   // e.g. loan_officer
+	branchAttribute = "branch" // e.g. MUM01
+)
+
+// Value of an attribute of the caller's certificate, empty when it has none
+func callerAttribute(ctx contractapi.TransactionContextInterface, name string) (string, error) {
+	value, found, err := ctx.GetClientIdentity().GetAttributeValue(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read client attribute %s: %v", name, err)
+	}
+	if !found {
+		return "", nil
+	}
+	return value, nil
+}
+
+// Fails unless the account is registered with the given type. Loan roles
+// follow account types: borrowers hold BORROWER accounts and only BANK
+// accounts lend.
+func (s *SmartContract) requireAccountType(
+	ctx contractapi.TransactionContextInterface,
+	accountID string,
+	accountType string,
+) (*token.Account, error) {
+	account, err := s.accountOf(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if account.Type != accountType {
+		return nil, fmt.Errorf("account %s is a %s account, %s required", accountID, account.Type, accountType)
+	}
+	return account, nil
+}
+
+// Fails unless lenderID is a BANK account operated by the caller's organization
+func (s *SmartContract) requireLender(
+	ctx contractapi.TransactionContextInterface,
+	lenderID string,
+) error {
+	lender, err := s.requireAccountType(ctx, lenderID, token.AccountBank)
+	if err != nil {
+		return err
+	}
+
+	return requireOperatorOf(ctx, lender)
+}
+
+// Fails unless the caller belongs to the organization operating the account,
+// accounts registered without an organization can be used by any caller
+func requireOperatorOf(
+	ctx contractapi.TransactionContextInterface,
+	account *token.Account,
+) error {
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return err
+	}
+	if account.OrgMSP != "" && account.OrgMSP != mspID {
+		return fmt.Errorf("caller from %s cannot act for account %s", mspID, account.AccountID)
+	}
+	return nil
+}
+
+// Fails unless the caller belongs to an organization allowed to publish
+// market rates, returning its MSP ID
+func requireOracle(
+	ctx contractapi.TransactionContextInterface,
+	config *LendingConfig,
+) (string, error) {
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, oracleMSP := range config.OracleMSPs {
+		if oracleMSP == mspID {
+			return mspID, nil
+		}
+	}
+	return "", fmt.Errorf("caller from %s is not authorized to publish rates", mspID)
+}
+
+// Fails unless the caller belongs to an organization allowed to run
+// scheduled jobs, returning its MSP ID
+func requireKeeper(
+	ctx contractapi.TransactionContextInterface,
+	config *LendingConfig,
+) (string, error) {
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, keeperMSP := range config.KeeperMSPs {
+		if keeperMSP == mspID {
+			return mspID, nil
+		}
+	}
+	return "", fmt.Errorf("caller from %s is not authorized to run scheduled jobs", mspID)
+}
+
+// Fails unless the caller is the regulator or belongs to a configured
+// dispute arbiter, returning its MSP ID
+func requireArbiter(
+	ctx contractapi.TransactionContextInterface,
+	config *LendingConfig,
+) (string, error) {
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return "", err
+	}
+	if mspID == regulatorMSP {
+		return mspID, nil
+	}
+	for _, arbiterMSP := range config.ArbiterMSPs {
+		if arbiterMSP == mspID {
+			return mspID, nil
+		}
+	}
+	return "", fmt.Errorf("caller from %s is not authorized to resolve disputes", mspID)
+}
+
+func requireRegulator(ctx contractapi.TransactionContextInterface) error {
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return err
+	}
+	if mspID != regulatorMSP {
+		return fmt.Errorf("caller from %s is not authorized, regulator access required", mspID)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"lending/token"
+)
+
+// Loan amounts are token.Amount decimals, exact to the paisa at any size.
+// Rates, ratios and weights are Decimal. Both are computed on big.Rat and
+// formatted once, when stored or returned.
+const (
+	rateScale     = 4  // places of a rate in percent, or of a ratio
+	weightScale   = 3  // places of a weight in grams
+	fractionScale = 12 // places of the part of a loan term run
+)
+
+const zeroAmount token.Amount = "0.00"
+
+// A decimal figure other than an amount: a rate in percent a year, a ratio
+// or a weight, "8.5000". Records written while these were float64 hold JSON
+// numbers, which still decode.
+type Decimal string
+
+var decimalPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// Parses a decimal parameter, rejecting more than places decimal places
+func parseDecimal(value string, places int) (*big.Rat, error) {
+	if !decimalPattern.MatchString(value) {
+		return nil, fmt.Errorf("invalid number %q, expected a decimal such as 8.25", value)
+	}
+	if dot := strings.IndexByte(value, '.'); dot >= 0 && len(value)-dot-1 > places {
+		return nil, fmt.Errorf("%s has more than %d decimal places", value, places)
+	}
+
+	number, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return nil, fmt.Errorf("invalid number %q", value)
+	}
+	return number, nil
+}
+
+// Parses a rate parameter in percent a year
+func parseRate(value string) (*big.Rat, error) {
+	return parseDecimal(value, rateScale)
+}
+
+// Parses an amount parameter, see token.ParseAmount
+func parseAmount(value string) (*big.Rat, error) {
+	return token.ParseAmount(value)
+}
+
+// Formats x with places decimal places, rounding half away from zero
+func newDecimal(x *big.Rat, places int) Decimal {
+	return Decimal(x.FloatString(places))
+}
+
+func newRate(x *big.Rat) Decimal {
+	return newDecimal(x, rateScale)
+}
+
+// The decimal as a big.Rat, zero when empty
+func (d Decimal) Rat() *big.Rat {
+	value, ok := new(big.Rat).SetString(string(d))
+	if !ok {
+		return new(big.Rat)
+	}
+	return value
+}
+
+// Accepts the JSON string form as well as numbers of records written before
+// rates were decimal strings
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var value string
+		err := json.Unmarshal(data, &value)
+		if err != nil {
+			return err
+		}
+		*d = Decimal(value)
+		return nil
+	}
+
+	var number json.Number
+	err := json.Unmarshal(data, &number)
+	if err != nil {
+		return err
+	}
+	*d = Decimal(number.String())
+	return nil
+}
+
+// ============== big.Rat arithmetic ==============
+
+func ratInt(n int64) *big.Rat {
+	return new(big.Rat).SetInt64(n)
+}
+
+func ratAdd(x *big.Rat, y *big.Rat) *big.Rat {
+	return new(big.Rat).Add(x, y)
+}
+
+func ratSub(x *big.Rat, y *big.Rat) *big.Rat {
+	return new(big.Rat).Sub(x, y)
+}
+
+func ratMul(x *big.Rat, y *big.Rat) *big.Rat {
+	return new(big.Rat).Mul(x, y)
+}
+
+// x divided by y, zero when y is zero
+func ratQuo(x *big.Rat, y *big.Rat) *big.Rat {
+	if y.Sign() == 0 {
+		return new(big.Rat)
+	}
+	return new(big.Rat).Quo(x, y)
+}
+
+func ratMin(x *big.Rat, y *big.Rat) *big.Rat {
+	if x.Cmp(y) <= 0 {
+		return x
+	}
+	return y
+}
+
+func ratMax(x *big.Rat, y *big.Rat) *big.Rat {
+	if x.Cmp(y) >= 0 {
+		return x
+	}
+	return y
+}
+
+// percent of x, the percentage being a rate such as 8.5
+func percentOf(x *big.Rat, percent *big.Rat) *big.Rat {
+	return ratQuo(ratMul(x, percent), ratInt(100))
+}
+
+// The amount of an omitempty field, empty when zero
+func optionalAmount(x *big.Rat) token.Amount {
+	if x.Sign() == 0 {
+		return ""
+	}
+	return token.NewAmount(x)
+}
+
+// Sum of amounts
+func amountSum(amounts ...token.Amount) *big.Rat {
+	total := new(big.Rat)
+	for _, amount := range amounts {
+		total.Add(total, amount.Rat())
+	}
+	return total
+}
+
+// Adds amounts to the amount at total
+func addAmounts(total *token.Amount, amounts ...token.Amount) {
+	*total = token.NewAmount(amountSum(append(amounts, *total)...))
+}
+
+// Fails unless a configured amount is empty, which reads as zero, or a
+// decimal amount of 0 or more
+func checkAmount(amount token.Amount) error {
+	if amount == "" {
+		return nil
+	}
+	value, err := token.ParseAmount(string(amount))
+	if err != nil {
+		return err
+	}
+	if value.Sign() < 0 {
+		return fmt.Errorf("amount %s must not be negative", amount)
+	}
+	return nil
+}
+
+// Fails unless a configured rate is empty, which reads as zero, or a decimal
+// between 0 and max
+func checkRate(rate Decimal, max int64) error {
+	if rate == "" {
+		return nil
+	}
+	value, err := parseRate(string(rate))
+	if err != nil {
+		return err
+	}
+	if value.Sign() < 0 || value.Cmp(ratInt(max)) > 0 {
+		return fmt.Errorf("rate %s must be between 0 and %d", rate, max)
+	}
+	return nil
+}
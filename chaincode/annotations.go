@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// An organization's internal notes on a loan, kept in the organization's
+// implicit private data collection so the channel only sees their hash
+type LoanAnnotation struct {
+	LoanID         string `json:"loanId"`
+	OrgMSP         string `json:"orgMsp"`
+	InternalRating string `json:"internalRating,omitempty" metadata:",optional"`
+	Remarks        string `json:"remarks,omitempty" metadata:",optional"`
+	BranchCode     string `json:"branchCode,omitempty" metadata:",optional"`
+	UpdatedBy      string `json:"updatedBy"` // enrollment ID of the caller
+	UpdatedAt      string `json:"updatedAt"`
+}
+
+// Transient field carrying an annotation
+const loanAnnotationTransient = "loan_annotation"
+
+// ============== Loan Annotations ==============
+
+// Store the caller's organization's annotation of a loan it is party to,
+// passed in the transient map under "loan_annotation". The annotation
+// replaces any earlier one and must be endorsed by the organization's own
+// peers, the only ones holding its implicit collection.
+func (s *SmartContract) PutLoanAnnotation(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+) error {
+	err := claimRequestID(ctx, "PutLoanAnnotation")
+	if err != nil {
+		return err
+	}
+
+	mspID, err := requirePeerOrg(ctx)
+	if err != nil {
+		return err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return err
+	}
+	party, err := s.isPartyTo(ctx, newLoanViewer(), loan)
+	if err != nil {
+		return err
+	}
+	if !party {
+		return fmt.Errorf("caller from %s is not party to loan %s", mspID, loanID)
+	}
+
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("failed to read transient data: %v", err)
+	}
+	annotationJSON, ok := transient[loanAnnotationTransient]
+	if !ok {
+		return fmt.Errorf("%s must be provided in the transient map", loanAnnotationTransient)
+	}
+
+	var annotation LoanAnnotation
+	err = json.Unmarshal(annotationJSON, &annotation)
+	if err != nil {
+		return fmt.Errorf("invalid loan annotation: %v", err)
+	}
+
+	updatedBy, err := callerOfficerID(ctx)
+	if err != nil {
+		return err
+	}
+	updatedAt, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	annotation.LoanID = loanID
+	annotation.OrgMSP = mspID
+	annotation.UpdatedBy = updatedBy
+	annotation.UpdatedAt = updatedAt.Format(time.RFC3339)
+
+	annotationJSON, err = json.Marshal(annotation)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutPrivateData(implicitCollection(mspID), loanID, annotationJSON)
+}
+
+// The caller's organization's annotation of a loan, evaluated on one of the
+// organization's peers
+func (s *SmartContract) GetLoanAnnotation(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+) (*LoanAnnotation, error) {
+	mspID, err := requirePeerOrg(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	annotationJSON, err := ctx.GetStub().GetPrivateData(implicitCollection(mspID), loanID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private data: %v", err)
+	}
+	if annotationJSON == nil {
+		return nil, fmt.Errorf("%s has no annotation of loan %s", mspID, loanID)
+	}
+
+	var annotation LoanAnnotation
+	err = json.Unmarshal(annotationJSON, &annotation)
+	if err != nil {
+		return nil, err
+	}
+
+	return &annotation, nil
+}
+
+// Implicit private data collection of an organization, defined by Fabric for
+// every organization on the channel
+func implicitCollection(mspID string) string {
+	return "_implicit_org_" + mspID
+}
+
+// Fails unless the caller belongs to the organization of the executing peer,
+// whose implicit collection is the only one it can read. The caller's
+// organization is returned.
+func requirePeerOrg(ctx contractapi.TransactionContextInterface) (string, error) {
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return "", err
+	}
+	peerMSP, err := shim.GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to read the peer's organization: %v", err)
+	}
+	if mspID != peerMSP {
+		return "", fmt.Errorf("caller from %s must use a peer of its own organization, not %s", mspID, peerMSP)
+	}
+	return mspID, nil
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// A loan application awaiting a lender, PENDING until approved or rejected
+// and APPROVED until disbursed. Ages are in whole hours, the stage age counts
+// from when the application entered its current status.
+type PendingApplication struct {
+	LoanID     string       `json:"loanId"`
+	BorrowerID string       `json:"borrowerId"`
+	LenderID   string       `json:"lenderId,omitempty" metadata:",optional"` // set once approved
+	Status     string       `json:"status"`
+	Amount     token.Amount `json:"amount"`
+	CreatedAt  string       `json:"createdAt"`  // RFC3339
+	StageSince string       `json:"stageSince"` // RFC3339
+	AgeHours   int          `json:"ageHours"`
+	StageHours int          `json:"stageHours"`
+	SLAHours   int          `json:"slaHours"` // turnaround allowed for the stage, 0 for none
+	Breached   bool         `json:"breached"`
+}
+
+// Applications are indexed from request until they leave PENDING and
+// APPROVED. A breach is recorded under the loan and stage once reported, so
+// it is reported once.
+const (
+	applicationLoanIndex = "application~loan"
+	slaBreachObjectType  = "slabreach"
+)
+
+// Application stages tracked against turnaround times
+var applicationStages = []string{"PENDING", "APPROVED"}
+
+// Takes a loan out of the application queue once it leaves PENDING and APPROVED
+func (s *SmartContract) dequeueApplication(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+) error {
+	err := s.deleteIndex(ctx, applicationLoanIndex, loan.LoanID)
+	if err != nil {
+		return err
+	}
+
+	for _, stage := range applicationStages {
+		breachKey, err := ctx.GetStub().CreateCompositeKey(slaBreachObjectType, []string{loan.LoanID, stage})
+		if err != nil {
+			return fmt.Errorf("failed to create record key: %v", err)
+		}
+		err = ctx.GetStub().DelState(breachKey)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ============== Application Queue ==============
+
+// A page of a lender's application queue
+type PendingApplicationPage struct {
+	Applications []*PendingApplication `json:"applications"`
+	Bookmark     string                `json:"bookmark"` // empty on the last page
+}
+
+// New breaches found by a CheckApplicationSLAs call, call again with Bookmark
+// until it is empty
+type SLABreachPage struct {
+	Breaches []*PendingApplication `json:"breaches"`
+	Bookmark string                `json:"bookmark"`
+}
+
+// Applications a lender can act on, the PENDING applications open to every
+// lender and the lender's own APPROVED loans awaiting disbursement, a page at
+// a time in loan ID order. Available to the regulator and the organization
+// operating the lender's account. Loans requested before the queue existed
+// are not listed.
+func (s *SmartContract) GetPendingApplications(
+	ctx contractapi.TransactionContextInterface,
+	lenderID string,
+	pageSize int32,
+	bookmark string,
+) (*PendingApplicationPage, error) {
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if mspID != regulatorMSP {
+		err = s.requireLender(ctx, lenderID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive")
+	}
+	bookmark, err = token.DecodeBookmark(bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(applicationLoanIndex, []string{}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	page := PendingApplicationPage{Applications: []*PendingApplication{}}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		loan, err := s.getLoan(ctx, keyParts[len(keyParts)-1])
+		if err != nil {
+			return nil, err
+		}
+		application, err := pendingApplication(config, now, loan)
+		if err != nil {
+			return nil, err
+		}
+		if application == nil || application.Status == "APPROVED" && application.LenderID != lenderID {
+			continue
+		}
+		page.Applications = append(page.Applications, application)
+	}
+
+	page.Bookmark = token.EncodeBookmark(nextBookmark(metadata.GetFetchedRecordsCount(), pageSize, metadata.GetBookmark()))
+	return &page, nil
+}
+
+// Report the applications of the next pageSize in the queue that have
+// exceeded their stage's turnaround time since the last check in an
+// ApplicationSLABreached event. Fabric keeps a single event per transaction,
+// so the event lists every new breach of the page. Keeper only.
+func (s *SmartContract) CheckApplicationSLAs(
+	ctx contractapi.TransactionContextInterface,
+	pageSize int,
+	bookmark string,
+) (*SLABreachPage, error) {
+	err := claimRequestID(ctx, "CheckApplicationSLAs")
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keeperMSP, err := requireKeeper(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	keeperID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	queue, next, err := s.applicationQueue(ctx, config, now, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	page := SLABreachPage{Breaches: []*PendingApplication{}, Bookmark: next}
+	for _, application := range queue {
+		if !application.Breached {
+			continue
+		}
+
+		key := []string{application.LoanID, application.Status}
+		reported, err := getRecord(ctx, slaBreachObjectType, key, &PendingApplication{})
+		if err != nil {
+			return nil, err
+		}
+		if reported {
+			continue
+		}
+		err = putRecord(ctx, slaBreachObjectType, key, application)
+		if err != nil {
+			return nil, err
+		}
+		page.Breaches = append(page.Breaches, application)
+	}
+	if len(page.Breaches) == 0 {
+		return &page, nil
+	}
+
+	return &page, emitEvent(ctx, eventApplicationSLABreached, ApplicationSLABreachedEventV2{
+		SchemaVersion: 2,
+		TxID:          ctx.GetStub().GetTxID(),
+		Timestamp:     now.Format(time.RFC3339),
+		SubmitterMSP:  keeperMSP,
+		SubmitterID:   keeperID,
+		Breaches:      page.Breaches,
+	})
+}
+
+// The queued applications of a page of the queue aged at now, oldest first,
+// and the bookmark of the next page
+func (s *SmartContract) applicationQueue(
+	ctx contractapi.TransactionContextInterface,
+	config *LendingConfig,
+	now time.Time,
+	pageSize int,
+	bookmark string,
+) ([]*PendingApplication, string, error) {
+	loans, next, err := s.getIndexedLoanBatch(ctx, applicationLoanIndex, []string{}, pageSize, bookmark)
+	if err != nil {
+		return nil, "", err
+	}
+
+	queue := []*PendingApplication{}
+	for _, loan := range loans {
+		application, err := pendingApplication(config, now, loan)
+		if err != nil {
+			return nil, "", err
+		}
+		if application != nil {
+			queue = append(queue, application)
+		}
+	}
+
+	sort.SliceStable(queue, func(i, j int) bool {
+		return queue[i].CreatedAt < queue[j].CreatedAt
+	})
+	return queue, next, nil
+}
+
+// A queued loan aged at now, nil once it has left the tracked stages
+func pendingApplication(
+	config *LendingConfig,
+	now time.Time,
+	loan *Loan,
+) (*PendingApplication, error) {
+	createdAt, ok := unixTime(loan.CreatedAt)
+	if !ok {
+		return nil, fmt.Errorf("loan %s has an invalid creation time", loan.LoanID)
+	}
+
+	application := &PendingApplication{
+		LoanID:     loan.LoanID,
+		BorrowerID: loan.BorrowerID,
+		LenderID:   loan.LenderID,
+		Status:     loan.Status,
+		Amount:     loan.Amount,
+		CreatedAt:  createdAt.Format(time.RFC3339),
+		AgeHours:   int(now.Sub(createdAt).Hours()),
+	}
+
+	stageSince := createdAt
+	switch loan.Status {
+	case "PENDING":
+		application.SLAHours = config.PendingSLAHours
+	case "APPROVED":
+		application.SLAHours = config.ApprovedSLAHours
+		if approvedAt, ok := approvalTime(loan); ok {
+			stageSince = approvedAt
+		}
+	default:
+		return nil, nil
+	}
+	application.StageSince = stageSince.Format(time.RFC3339)
+	application.StageHours = int(now.Sub(stageSince).Hours())
+	application.Breached = application.SLAHours > 0 && now.Sub(stageSince) > time.Duration(application.SLAHours)*time.Hour
+	return application, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ============== Approval Expiry ==============
+
+// When an APPROVED loan's approval lapses, zero if approvals never expire
+func approvalExpiry(loan *Loan, config *LendingConfig) (time.Time, bool) {
+	if config.ApprovalDays <= 0 {
+		return time.Time{}, false
+	}
+	approvedAt, ok := unixTime(loan.ApprovedAt)
+	if !ok {
+		return time.Time{}, false
+	}
+	return approvedAt.AddDate(0, 0, config.ApprovalDays), true
+}
+
+// Fails when the loan's approval has lapsed, so it cannot be disbursed
+func requireApprovalCurrent(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	config *LendingConfig,
+) error {
+	expiresAt, ok := approvalExpiry(loan, config)
+	if !ok {
+		return nil
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if now.After(expiresAt) {
+		return fmt.Errorf("approval of loan %s expired at %s", loan.LoanID, expiresAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// Expire the approval of a loan not disbursed within the configured number
+// of days. The loan becomes EXPIRED, and the lender's reserved funds and the
+// collateral registries charged at approval are released. Keeper only.
+func (s *SmartContract) ExpireApproval(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "ExpireApproval")
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, err = requireKeeper(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	if loan.Status != "APPROVED" {
+		return nil, fmt.Errorf("approval of loan %s cannot expire in current status: %s", loanID, loan.Status)
+	}
+
+	expiresAt, ok := approvalExpiry(loan, config)
+	if !ok {
+		return nil, fmt.Errorf("approvals do not expire")
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !now.After(expiresAt) {
+		return nil, fmt.Errorf("approval of loan %s is valid until %s", loanID, expiresAt.Format(time.RFC3339))
+	}
+
+	err = s.releaseCollateral(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.releaseReservation(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+	err = s.dequeueApplication(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+
+	loan.Status = "EXPIRED"
+	loan.ClosedAt = fmt.Sprintf("%d", now.Unix())
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Approval by %s expired undisbursed after %d days (TxID: %s)",
+			loan.LenderID,
+			config.ApprovalDays,
+			ctx.GetStub().GetTxID()))
+
+	err = s.putLoan(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := newLoanEventHeader(ctx, loanID, 2)
+	if err != nil {
+		return nil, err
+	}
+	return newLoanResult(ctx, loan).emit(ctx, eventLoanApprovalExpired, LoanApprovalExpiredEventV2{
+		LoanEventHeader: header,
+		BorrowerID:      loan.BorrowerID,
+		LenderID:        loan.LenderID,
+		Amount:          loan.Amount,
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Compact record kept for an archived loan, the full audit trail stays
+// retrievable from the key history of the loan on the blockchain
+type LoanArchive struct {
+	LoanID          string       `json:"loanId"`
+	BorrowerID      string       `json:"borrowerId"`
+	LenderID        string       `json:"lenderId"`
+	Amount          token.Amount `json:"amount"`
+	RepaymentDue    token.Amount `json:"repaymentDue"`
+	FinalStatus     string       `json:"finalStatus"`
+	ClosedAt        string       `json:"closedAt"`
+	ArchivedAt      string       `json:"archivedAt"`
+	ArchiveTxID     string       `json:"archiveTxId"`
+	AuditEntryCount int          `json:"auditEntryCount"`
+	AuditHash       string       `json:"auditHash"` // hex SHA-256 of the JSON encoded audit trail
+}
+
+const loanArchiveObjectType = "archive"
+
+// ============== Loan Archival ==============
+
+// Archive a closed loan past the retention window, moving its audit trail out
+// of the hot loan record into a compact summary
+func (s *SmartContract) ArchiveLoan(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "ArchiveLoan")
+	if err != nil {
+		return nil, err
+	}
+
+	err = requireRegulator(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Archived {
+		return nil, fmt.Errorf("loan %s is already archived", loanID)
+	}
+	if loan.Status != "REPAID" && loan.Status != "CANCELLED" {
+		return nil, fmt.Errorf("loan %s cannot be archived in current status: %s", loanID, loan.Status)
+	}
+
+	closedAt, ok := unixTime(loan.ClosedAt)
+	if !ok {
+		return nil, fmt.Errorf("loan %s has no closure date", loanID)
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if now.Before(closedAt.AddDate(0, 0, config.ArchiveAfterDays)) {
+		return nil, fmt.Errorf("loan %s is within its %d day retention window", loanID, config.ArchiveAfterDays)
+	}
+
+	auditJSON, err := json.Marshal(loan.AuditHistory)
+	if err != nil {
+		return nil, err
+	}
+	auditHash := sha256.Sum256(auditJSON)
+
+	archive := LoanArchive{
+		LoanID:          loan.LoanID,
+		BorrowerID:      loan.BorrowerID,
+		LenderID:        loan.LenderID,
+		Amount:          loan.Amount,
+		RepaymentDue:    loan.RepaymentDue,
+		FinalStatus:     loan.Status,
+		ClosedAt:        closedAt.Format(time.RFC3339),
+		ArchivedAt:      now.Format(time.RFC3339),
+		ArchiveTxID:     ctx.GetStub().GetTxID(),
+		AuditEntryCount: len(loan.AuditHistory),
+		AuditHash:       hex.EncodeToString(auditHash[:]),
+	}
+
+	archiveJSON, err := json.Marshal(archive)
+	if err != nil {
+		return nil, err
+	}
+	archiveKey, err := ctx.GetStub().CreateCompositeKey(loanArchiveObjectType, []string{loanID})
+	if err != nil {
+		return nil, err
+	}
+	err = ctx.GetStub().PutState(archiveKey, archiveJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	loan.Archived = true
+	loan.AuditHistory = []string{
+		fmt.Sprintf("Loan archived, %d audit entries moved to archive (TxID: %s)",
+			archive.AuditEntryCount,
+			ctx.GetStub().GetTxID()),
+	}
+
+	return s.putLoanResult(ctx, loan)
+}
+
+func (s *SmartContract) GetLoanArchive(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+) (*LoanArchive, error) {
+	archiveKey, err := ctx.GetStub().CreateCompositeKey(loanArchiveObjectType, []string{loanID})
+	if err != nil {
+		return nil, err
+	}
+
+	archiveJSON, err := ctx.GetStub().GetState(archiveKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if archiveJSON == nil {
+		return nil, fmt.Errorf("loan %s is not archived", loanID)
+	}
+
+	var archive LoanArchive
+	err = json.Unmarshal(archiveJSON, &archive)
+	if err != nil {
+		return nil, err
+	}
+
+	return &archive, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Evidence bundle of a loan for auditors. Digest is the SHA-256 of the
+// attestation's JSON with Digest left empty; evaluated through a peer, the
+// endorsement on the response signs it, so the response is archived whole.
+type LoanAttestation struct {
+	LoanID           string               `json:"loanId"`
+	Loan             *Loan                `json:"loan"`
+	StateHash        string               `json:"stateHash"` // hex SHA-256 of the stored loan, matches the latest history entry
+	History          []LedgerModification `json:"history"`   // writes of the loan key, oldest first
+	AuditChain       []string             `json:"auditChain"`
+	ArchiveAuditHash string               `json:"archiveAuditHash,omitempty" metadata:",optional"` // audit trail moved out by archival
+	AttestedFor      string               `json:"attestedFor"`                                     // MSP of the caller
+	GeneratedAt      string               `json:"generatedAt"`
+	TxID             string               `json:"txId"`
+	Digest           string               `json:"digest"`
+}
+
+// A write of a key in the ledger history, relatable to its block by TxID
+type LedgerModification struct {
+	TxID      string `json:"txId"`
+	Timestamp string `json:"timestamp"`
+	IsDelete  bool   `json:"isDelete"`
+	ValueHash string `json:"valueHash"` // hex SHA-256 of the value written
+}
+
+// ============== Auditor Attestation ==============
+
+// Export a loan's current state, the history of its ledger key and a hash
+// chain over its audit trail, in which each entry's hash covers the previous
+// one. Available to the regulator and the loan's parties.
+func (s *SmartContract) ExportAttestation(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+) (*LoanAttestation, error) {
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	viewer := newLoanViewer()
+	party, err := s.isPartyTo(ctx, viewer, loan)
+	if err != nil {
+		return nil, err
+	}
+	if !party {
+		return nil, fmt.Errorf("caller from %s is not a party to loan %s", viewer.mspID, loanID)
+	}
+
+	stored, err := ctx.GetStub().GetState(loanID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+
+	history, err := keyHistory(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	generatedAt, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	attestation := LoanAttestation{
+		LoanID:      loanID,
+		Loan:        loan,
+		StateHash:   hashHex(stored),
+		History:     history,
+		AuditChain:  auditChain(loan.AuditHistory),
+		AttestedFor: viewer.mspID,
+		GeneratedAt: generatedAt.Format(time.RFC3339),
+		TxID:        ctx.GetStub().GetTxID(),
+	}
+
+	if loan.Archived {
+		archive, err := s.GetLoanArchive(ctx, loanID)
+		if err != nil {
+			return nil, err
+		}
+		attestation.ArchiveAuditHash = archive.AuditHash
+	}
+
+	attestationJSON, err := json.Marshal(attestation)
+	if err != nil {
+		return nil, err
+	}
+	attestation.Digest = hashHex(attestationJSON)
+
+	return &attestation, nil
+}
+
+// Writes of a key, oldest first
+func keyHistory(
+	ctx contractapi.TransactionContextInterface,
+	key string,
+) ([]LedgerModification, error) {
+	iterator, err := ctx.GetStub().GetHistoryForKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history for %s: %v", key, err)
+	}
+	defer iterator.Close()
+
+	// The history iterator returns the newest write first
+	history := []LedgerModification{}
+	for iterator.HasNext() {
+		modification, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		history = append([]LedgerModification{{
+			TxID:      modification.TxId,
+			Timestamp: time.Unix(modification.GetTimestamp().GetSeconds(), 0).UTC().Format(time.RFC3339),
+			IsDelete:  modification.IsDelete,
+			ValueHash: hashHex(modification.Value),
+		}}, history...)
+	}
+
+	return history, nil
+}
+
+// Hash of each audit entry chained to the hash before it, so the last hash
+// commits to the whole trail
+func auditChain(entries []string) []string {
+	chain := make([]string, 0, len(entries))
+	previous := ""
+	for _, entry := range entries {
+		previous = hashHex([]byte(previous + entry))
+		chain = append(chain, previous)
+	}
+	return chain
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Largest loan an officer of an organization may approve alone, set by the
+// organization's credit administrators. Officers are named by the enrollment
+// ID of their certificates.
+type OfficerLimit struct {
+	OrgMSP    string       `json:"orgMsp"`
+	OfficerID string       `json:"officerId"`
+	Limit     token.Amount `json:"limit"`
+	SetBy     string       `json:"setBy"` // enrollment ID of the administrator
+	SetAt     string       `json:"setAt"`
+}
+
+// An approval above the approving officer's authority, held until a second
+// officer of the lender able to approve the amount does so
+type ApprovalEscalation struct {
+	LenderID    string       `json:"lenderId"`
+	MakerID     string       `json:"makerId"` // officer whose approval was escalated
+	MakerLimit  token.Amount `json:"makerLimit"`
+	EscalatedAt string       `json:"escalatedAt"`
+	Status      string       `json:"status"` // ESCALATED, APPROVED, REJECTED
+	CheckerID   string       `json:"checkerId,omitempty" metadata:",optional"`
+	DecidedAt   string       `json:"decidedAt,omitempty" metadata:",optional"`
+}
+
+// Escalation statuses
+const (
+	escalationPending  = "ESCALATED"
+	escalationApproved = "APPROVED"
+	escalationRejected = "REJECTED"
+)
+
+const officerLimitObjectType = "officerlimit"
+
+// Index of escalated approvals by lender
+const escalationLoanIndex = "escalation~loan"
+
+// Certificate attribute naming the identity, set by Fabric CA
+const enrollmentAttribute = "hf.EnrollmentID"
+
+// Role of the identities allowed to set officer limits
+const roleCreditAdmin = "credit_admin"
+
+// ============== Approval Authority ==============
+
+// Set the largest loan officerID of the caller's organization may approve
+// alone, called by an identity with the credit_admin role
+func (s *SmartContract) SetOfficerLimit(
+	ctx contractapi.TransactionContextInterface,
+	officerID string,
+	limit string,
+) error {
+	err := claimRequestID(ctx, "SetOfficerLimit")
+	if err != nil {
+		return err
+	}
+	value, err := parseAmount(limit)
+	if err != nil {
+		return err
+	}
+
+	mspID, adminID, err := requireCreditAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if value.Sign() < 0 {
+		return fmt.Errorf("approval limit must not be negative")
+	}
+
+	setAt, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	return putRecord(ctx, officerLimitObjectType, []string{mspID, officerID}, OfficerLimit{
+		OrgMSP:    mspID,
+		OfficerID: officerID,
+		Limit:     token.NewAmount(value),
+		SetBy:     adminID,
+		SetAt:     setAt.Format(time.RFC3339),
+	})
+}
+
+// Remove the limit of officerID of the caller's organization, leaving only
+// the limit of the officer's role
+func (s *SmartContract) RemoveOfficerLimit(
+	ctx contractapi.TransactionContextInterface,
+	officerID string,
+) error {
+	err := claimRequestID(ctx, "RemoveOfficerLimit")
+	if err != nil {
+		return err
+	}
+
+	mspID, _, err := requireCreditAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	exists, err := getRecord(ctx, officerLimitObjectType, []string{mspID, officerID}, &OfficerLimit{})
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("officer %s of %s has no approval limit", officerID, mspID)
+	}
+
+	limitKey, err := ctx.GetStub().CreateCompositeKey(officerLimitObjectType, []string{mspID, officerID})
+	if err != nil {
+		return fmt.Errorf("failed to create record key: %v", err)
+	}
+	return ctx.GetStub().DelState(limitKey)
+}
+
+func (s *SmartContract) GetOfficerLimit(
+	ctx contractapi.TransactionContextInterface,
+	orgMSP string,
+	officerID string,
+) (*OfficerLimit, error) {
+	var limit OfficerLimit
+	exists, err := getRecord(ctx, officerLimitObjectType, []string{orgMSP, officerID}, &limit)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("officer %s of %s has no approval limit", officerID, orgMSP)
+	}
+	return &limit, nil
+}
+
+// List a lender's loans whose approval was escalated and awaits a second
+// officer, a page at a time
+func (s *SmartContract) GetEscalatedApprovals(
+	ctx contractapi.TransactionContextInterface,
+	lenderID string,
+	pageSize int32,
+	bookmark string,
+) (*LoanPage, error) {
+	return s.getIndexedLoanPage(ctx, escalationLoanIndex, []string{lenderID}, pageSize, bookmark)
+}
+
+// Names the calling officer by the enrollment ID of its certificate, or by
+// its identity when the certificate has none
+func callerOfficerID(ctx contractapi.TransactionContextInterface) (string, error) {
+	officerID, err := callerAttribute(ctx, enrollmentAttribute)
+	if err != nil || officerID != "" {
+		return officerID, err
+	}
+	return callerID(ctx)
+}
+
+// The largest loan the caller may approve alone, the lower of its role's and
+// its own limit. Limited is false when neither is set.
+func approvalLimit(
+	ctx contractapi.TransactionContextInterface,
+	config *LendingConfig,
+) (limit token.Amount, limited bool, err error) {
+	role, err := callerAttribute(ctx, roleAttribute)
+	if err != nil {
+		return "", false, err
+	}
+	limit, limited = config.ApprovalLimits[role]
+
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	officerID, err := callerOfficerID(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	var officer OfficerLimit
+	exists, err := getRecord(ctx, officerLimitObjectType, []string{mspID, officerID}, &officer)
+	if err != nil {
+		return "", false, err
+	}
+	if exists && (!limited || officer.Limit.Rat().Cmp(limit.Rat()) < 0) {
+		limit, limited = officer.Limit, true
+	}
+
+	return limit, limited, nil
+}
+
+// Checks the caller's authority to approve the loan for lenderID. An approval
+// above it is escalated, returning true, unless the loan is already escalated,
+// in which case the caller must be another officer able to approve it.
+func (s *SmartContract) checkApprovalAuthority(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	lenderID string,
+	config *LendingConfig,
+) (bool, error) {
+	limit, limited, err := approvalLimit(ctx, config)
+	if err != nil {
+		return false, err
+	}
+	officerID, err := callerOfficerID(ctx)
+	if err != nil {
+		return false, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return false, err
+	}
+	exceeded := limited && loan.Amount.Rat().Cmp(limit.Rat()) > 0
+
+	escalation := loan.Escalation
+	if escalation == nil || escalation.Status != escalationPending {
+		if !exceeded {
+			return false, nil
+		}
+
+		loan.Escalation = &ApprovalEscalation{
+			LenderID:    lenderID,
+			MakerID:     officerID,
+			MakerLimit:  limit,
+			EscalatedAt: now.Format(time.RFC3339),
+			Status:      escalationPending,
+		}
+		loan.AuditHistory = append(loan.AuditHistory,
+			fmt.Sprintf("Approval by %s escalated, %s exceeds the officer's limit of %s (TxID: %s)",
+				lenderID,
+				loan.Amount,
+				limit,
+				ctx.GetStub().GetTxID()))
+		return true, s.putIndex(ctx, escalationLoanIndex, lenderID, loan.LoanID)
+	}
+
+	if lenderID != escalation.LenderID {
+		return false, fmt.Errorf("loan %s is escalated for approval by %s", loan.LoanID, escalation.LenderID)
+	}
+	if officerID == escalation.MakerID {
+		return false, fmt.Errorf("loan %s must be approved by an officer other than %s", loan.LoanID, officerID)
+	}
+	if exceeded {
+		return false, fmt.Errorf("officer %s can approve loans up to %s, loan is for %s", officerID, limit, loan.Amount)
+	}
+
+	escalation.Status = escalationApproved
+	escalation.CheckerID = officerID
+	escalation.DecidedAt = now.Format(time.RFC3339)
+	return false, s.deleteIndex(ctx, escalationLoanIndex, lenderID, loan.LoanID)
+}
+
+// Closes a pending escalation of a loan being rejected
+func (s *SmartContract) closeEscalation(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+) error {
+	escalation := loan.Escalation
+	if escalation == nil || escalation.Status != escalationPending {
+		return nil
+	}
+
+	officerID, err := callerOfficerID(ctx)
+	if err != nil {
+		return err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	escalation.Status = escalationRejected
+	escalation.CheckerID = officerID
+	escalation.DecidedAt = now.Format(time.RFC3339)
+	return s.deleteIndex(ctx, escalationLoanIndex, escalation.LenderID, loan.LoanID)
+}
+
+// Fails unless the caller has the credit_admin role, returning its
+// organization and enrollment ID
+func requireCreditAdmin(ctx contractapi.TransactionContextInterface) (string, string, error) {
+	role, err := callerAttribute(ctx, roleAttribute)
+	if err != nil {
+		return "", "", err
+	}
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	if role != roleCreditAdmin {
+		return "", "", fmt.Errorf("caller from %s is not authorized, %s role required", mspID, roleCreditAdmin)
+	}
+	adminID, err := callerOfficerID(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	return mspID, adminID, nil
+}
@@ -0,0 +1,108 @@
+// Package bench measures the chaincode's hot paths in process, against the
+// in-memory ledger of mockstub: transactions a second and how much world
+// state each transaction adds.
+//
+// The transactions are passed in by the caller, so one harness serves the
+// loan and token contracts: BenchmarkRepayLoan and BenchmarkTransferTokens
+// run through Benchmark, and the state growth tests through Run. The bench
+// command at the repository root submits the same workloads to a network
+// through the Fabric Gateway, adding endorsement, ordering and commit.
+package bench
+
+import (
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"lending/internal/mockstub"
+)
+
+// Size of the committed world state
+type StateSize struct {
+	Keys  int
+	Bytes int // of keys and values
+}
+
+func Size(stub *mockstub.Stub) StateSize {
+	keys, bytes := stub.StateSize()
+	return StateSize{Keys: keys, Bytes: bytes}
+}
+
+// Outcome of a run
+type Result struct {
+	Function  string
+	Committed int
+	Failed    int
+	Elapsed   time.Duration
+	Before    StateSize
+	After     StateSize
+}
+
+func (r Result) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Committed) / r.Elapsed.Seconds()
+}
+
+// Keys and bytes the committed transactions added to the state, each
+func (r Result) Growth() (keys float64, bytes float64) {
+	if r.Committed == 0 {
+		return 0, 0
+	}
+	return float64(r.After.Keys-r.Before.Keys) / float64(r.Committed),
+		float64(r.After.Bytes-r.Before.Bytes) / float64(r.Committed)
+}
+
+// Prints the result in the format of the gateway bench command
+func (r Result) Report(out io.Writer) {
+	fmt.Fprintf(out, "%s: %d committed, %d failed in %s\n",
+		r.Function, r.Committed, r.Failed, r.Elapsed.Round(time.Microsecond))
+	fmt.Fprintf(out, "throughput: %.1f tx/s\n", r.Throughput())
+
+	keys, bytes := r.Growth()
+	fmt.Fprintf(out, "state: %d keys, %d bytes before, %d keys, %d bytes after (%+.1f keys, %+.0f bytes/tx)\n",
+		r.Before.Keys, r.Before.Bytes, r.After.Keys, r.After.Bytes, keys, bytes)
+}
+
+// Runs count transactions one after another, tx submitting and committing
+// the n-th on stub, n counting from 1
+func Run(stub *mockstub.Stub, function string, count int, tx func(n int) error) Result {
+	res := Result{Function: function, Before: Size(stub)}
+
+	start := time.Now()
+	for n := 1; n <= count; n++ {
+		if tx(n) != nil {
+			res.Failed++
+			continue
+		}
+		res.Committed++
+	}
+	res.Elapsed = time.Since(start)
+
+	res.After = Size(stub)
+	return res
+}
+
+// Runs b.N transactions of a benchmark like Run, failing it on the first
+// error, and reports throughput and state growth next to the timings
+func Benchmark(b *testing.B, stub *mockstub.Stub, tx func(n int) error) {
+	b.Helper()
+	before := Size(stub)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 1; n <= b.N; n++ {
+		err := tx(n)
+		if err != nil {
+			b.Fatalf("transaction %d: %v", n, err)
+		}
+	}
+	b.StopTimer()
+
+	after := Size(stub)
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "tx/s")
+	b.ReportMetric(float64(after.Keys-before.Keys)/float64(b.N), "keys/op")
+	b.ReportMetric(float64(after.Bytes-before.Bytes)/float64(b.N), "state-B/op")
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// A benchmark rate quoted by one oracle identity. Each identity has a single
+// submission per benchmark, a new quote replaces its last one.
+type BenchmarkSubmission struct {
+	Benchmark    string  `json:"benchmark"`
+	Rate         Decimal `json:"rate"`
+	SubmitterMSP string  `json:"submitterMsp"`
+	SubmitterID  string  `json:"submitterId"`
+	SubmittedAt  string  `json:"submittedAt"` // RFC3339
+	TxID         string  `json:"txId"`
+}
+
+// The rate of a benchmark, the median of the recent submissions it lists, so
+// no single feeder decides it
+type BenchmarkFixing struct {
+	Benchmark   string                 `json:"benchmark"`
+	Rate        Decimal                `json:"rate"`
+	FixedAt     string                 `json:"fixedAt"` // RFC3339
+	TxID        string                 `json:"txId"`
+	Submissions []*BenchmarkSubmission `json:"submissions"`
+}
+
+// A page of a benchmark's fixings
+type BenchmarkFixingPage struct {
+	Fixings  []*BenchmarkFixing `json:"fixings"`
+	Bookmark string             `json:"bookmark"` // empty on the last page
+}
+
+// Submissions are stored by benchmark and submitting identity, fixings by
+// benchmark and the time they were taken
+const (
+	benchmarkSubmissionObjectType = "benchmarksubmission"
+	benchmarkFixingObjectType     = "benchmarkfixing"
+)
+
+// ============== Benchmark Rates ==============
+
+// Quote a benchmark rate, in percent a year. The benchmark is fixed again
+// from the recent submissions once enough identities have quoted it. Oracle
+// organizations only.
+func (s *SmartContract) SubmitBenchmarkRate(
+	ctx contractapi.TransactionContextInterface,
+	benchmark string,
+	rate string,
+) error {
+	err := claimRequestID(ctx, "SubmitBenchmarkRate")
+	if err != nil {
+		return err
+	}
+	value, err := parseRate(rate)
+	if err != nil {
+		return err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return err
+	}
+	mspID, err := requireOracle(ctx, config)
+	if err != nil {
+		return err
+	}
+	id, err := callerID(ctx)
+	if err != nil {
+		return err
+	}
+	if value.Sign() < 0 {
+		return fmt.Errorf("benchmark rate must not be negative")
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	submission := BenchmarkSubmission{
+		Benchmark:    benchmark,
+		Rate:         newRate(value),
+		SubmitterMSP: mspID,
+		SubmitterID:  id,
+		SubmittedAt:  now.Format(time.RFC3339),
+		TxID:         ctx.GetStub().GetTxID(),
+	}
+	err = putRecord(ctx, benchmarkSubmissionObjectType, []string{benchmark, mspID, id}, submission)
+	if err != nil {
+		return err
+	}
+
+	// Reads do not see this transaction's write, the new quote replaces the
+	// identity's last one here
+	fixing, err := benchmarkFixing(ctx, benchmark, config, now, &submission)
+	if err != nil || fixing == nil {
+		return err
+	}
+	return putRecord(ctx, benchmarkFixingObjectType, []string{benchmark, now.Format(indexInstantLayout), fixing.TxID}, fixing)
+}
+
+// The current fixing of a benchmark from its recent submissions
+func (s *SmartContract) GetBenchmarkRate(
+	ctx contractapi.TransactionContextInterface,
+	benchmark string,
+) (*BenchmarkFixing, error) {
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	fixing, err := benchmarkFixing(ctx, benchmark, config, now, nil)
+	if err != nil {
+		return nil, err
+	}
+	if fixing == nil {
+		return nil, fmt.Errorf("benchmark %s has fewer than %d recent submissions", benchmark, config.BenchmarkQuorum)
+	}
+	return fixing, nil
+}
+
+// Fixings of a benchmark taken in a period (YYYY-MM or YYYY-Qn), oldest
+// first, each with the submissions it was the median of, a page at a time
+func (s *SmartContract) GetBenchmarkHistory(
+	ctx contractapi.TransactionContextInterface,
+	benchmark string,
+	period string,
+	pageSize int32,
+	bookmark string,
+) (*BenchmarkFixingPage, error) {
+	start, end, err := parsePeriod(period)
+	if err != nil {
+		return nil, err
+	}
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive")
+	}
+	bookmark, err = token.DecodeBookmark(bookmark)
+	if err != nil {
+		return nil, err
+	}
+	// The first page starts at the period's first instant
+	if bookmark == "" {
+		bookmark, err = ctx.GetStub().CreateCompositeKey(benchmarkFixingObjectType, []string{benchmark, start.Format(indexInstantLayout)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create record key: %v", err)
+		}
+	}
+	endInstant := end.Format(indexInstantLayout)
+
+	iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(benchmarkFixingObjectType, []string{benchmark}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	page := BenchmarkFixingPage{Fixings: []*BenchmarkFixing{}}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+		if err != nil {
+			return nil, err
+		}
+		if keyParts[1] > endInstant {
+			return &page, nil
+		}
+
+		var fixing BenchmarkFixing
+		err = json.Unmarshal(entry.Value, &fixing)
+		if err != nil {
+			return nil, err
+		}
+		page.Fixings = append(page.Fixings, &fixing)
+	}
+
+	page.Bookmark = token.EncodeBookmark(nextBookmark(metadata.GetFetchedRecordsCount(), pageSize, metadata.GetBookmark()))
+	return &page, nil
+}
+
+// Fixes a benchmark at now from the submissions of the last BenchmarkHours,
+// nil when fewer identities than the quorum have quoted it. A submission of
+// the current transaction is passed in as latest.
+func benchmarkFixing(
+	ctx contractapi.TransactionContextInterface,
+	benchmark string,
+	config *LendingConfig,
+	now time.Time,
+	latest *BenchmarkSubmission,
+) (*BenchmarkFixing, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(benchmarkSubmissionObjectType, []string{benchmark})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	since := now.Add(-time.Duration(config.BenchmarkHours) * time.Hour)
+	submissions := []*BenchmarkSubmission{}
+	if latest != nil {
+		submissions = append(submissions, latest)
+	}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var submission BenchmarkSubmission
+		err = json.Unmarshal(entry.Value, &submission)
+		if err != nil {
+			return nil, err
+		}
+		if latest != nil && submission.SubmitterMSP == latest.SubmitterMSP && submission.SubmitterID == latest.SubmitterID {
+			continue
+		}
+		submittedAt, err := time.Parse(time.RFC3339, submission.SubmittedAt)
+		if err != nil || submittedAt.Before(since) {
+			continue
+		}
+		submissions = append(submissions, &submission)
+	}
+
+	quorum := config.BenchmarkQuorum
+	if quorum < 1 {
+		quorum = 1
+	}
+	if len(submissions) < quorum {
+		return nil, nil
+	}
+
+	sort.SliceStable(submissions, func(i, j int) bool {
+		return submissions[i].Rate.Rat().Cmp(submissions[j].Rate.Rat()) < 0
+	})
+	middle := len(submissions) / 2
+	rate := submissions[middle].Rate.Rat()
+	if len(submissions)%2 == 0 {
+		rate = ratQuo(ratAdd(submissions[middle-1].Rate.Rat(), rate), ratInt(2))
+	}
+
+	return &BenchmarkFixing{
+		Benchmark:   benchmark,
+		Rate:        newRate(rate),
+		FixedAt:     now.Format(time.RFC3339),
+		TxID:        ctx.GetStub().GetTxID(),
+		Submissions: submissions,
+	}, nil
+}
+
+// ============== Floating Rates ==============
+
+// Link a pending loan's rate to a benchmark, the loan is priced at the
+// benchmark's fixing plus spread now and again when its funds are disbursed
+func (s *SmartContract) SetFloatingRate(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	benchmark string,
+	spread string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "SetFloatingRate")
+	if err != nil {
+		return nil, err
+	}
+	value, err := parseRate(spread)
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Status != "PENDING" {
+		return nil, fmt.Errorf("rate of loan %s cannot be changed in current status: %s", loanID, loan.Status)
+	}
+
+	borrower, err := s.accountOf(ctx, loan.BorrowerID)
+	if err != nil {
+		return nil, err
+	}
+	err = requireOperatorOf(ctx, borrower)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	loan.Benchmark = benchmark
+	loan.Spread = newRate(value)
+	err = repriceFloatingRate(ctx, loan, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.putLoanResult(ctx, loan)
+}
+
+// Prices a floating rate loan at its benchmark's current fixing plus its
+// spread. The repayment due of a loan not yet disbursed follows the rate,
+// tranches already disbursed keep the rate they were priced at.
+func repriceFloatingRate(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	config *LendingConfig,
+) error {
+	if loan.Benchmark == "" {
+		return nil
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	fixing, err := benchmarkFixing(ctx, loan.Benchmark, config, now, nil)
+	if err != nil {
+		return err
+	}
+	if fixing == nil {
+		return fmt.Errorf("benchmark %s has fewer than %d recent submissions", loan.Benchmark, config.BenchmarkQuorum)
+	}
+
+	loan.InterestRate = newRate(config.Rounding.round(ratAdd(fixing.Rate.Rat(), loan.Spread.Rat())))
+	if _, disbursed := disbursementTime(loan); !disbursed {
+		loan.RepaymentDue = repaymentDue(loan, config.Rounding)
+		loan.RemainingBalance = loan.RepaymentDue
+	}
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Rate set to %s%%, %s fixing of %s%% from %d submissions plus spread of %s%% (TxID: %s)",
+			loan.InterestRate,
+			loan.Benchmark,
+			fixing.Rate,
+			len(fixing.Submissions),
+			loan.Spread,
+			ctx.GetStub().GetTxID()))
+	return nil
+}
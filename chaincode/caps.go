@@ -0,0 +1,356 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// System-wide ceilings on sanctioned credit, set by the regulator. Zero
+// leaves a ceiling off.
+type LendingCaps struct {
+	TotalOutstanding token.Amount            `json:"totalOutstanding"` // across every lender and product
+	Sectors          map[string]token.Amount `json:"sectors"`          // by loan product
+}
+
+// Credit sanctioned and not yet closed in a sector, TOTAL for all sectors.
+// Loans count from approval until repaid, cancelled or expired, a defaulted
+// loan stays outstanding.
+type CreditExposure struct {
+	Sector      string       `json:"sector"`
+	Outstanding token.Amount `json:"outstanding"`
+	Loans       int          `json:"loans"`
+	Cap         token.Amount `json:"cap,omitempty" metadata:",optional"`
+}
+
+// An approval refused for taking sanctioned credit past a ceiling
+type CapBreach struct {
+	LoanID      string       `json:"loanId"`
+	LenderID    string       `json:"lenderId"`
+	Sector      string       `json:"sector"`
+	Cap         token.Amount `json:"cap"`
+	Outstanding token.Amount `json:"outstanding"`
+	Requested   token.Amount `json:"requested"`
+	AttemptedAt string       `json:"attemptedAt"`
+	TxID        string       `json:"txId"`
+}
+
+// A page of sector exposures
+type CreditExposurePage struct {
+	Exposures []*CreditExposure `json:"exposures"`
+	Bookmark  string            `json:"bookmark"` // empty on the last page
+}
+
+// A page of refused approvals
+type CapBreachPage struct {
+	Breaches []*CapBreach `json:"breaches"`
+	Bookmark string       `json:"bookmark"` // empty on the last page
+}
+
+// A loan counted in the exposure of its sector
+type exposureEntry struct {
+	LoanID string       `json:"loanId"`
+	Sector string       `json:"sector"`
+	Amount token.Amount `json:"amount"`
+}
+
+// Exposure counters are stored by sector, the loans counted in them by loan
+// ID, and refused approvals by the transaction attempting them
+const (
+	creditExposureObjectType = "exposure"
+	exposureEntryObjectType  = "exposureentry"
+	capBreachObjectType      = "capbreach"
+	exposureTotal            = "TOTAL"
+)
+
+// Fails unless the ceilings are usable
+func (c LendingCaps) validate() error {
+	err := checkAmount(c.TotalOutstanding)
+	if err != nil {
+		return fmt.Errorf("invalid lending cap: %v", err)
+	}
+	for _, limit := range c.Sectors {
+		err = checkAmount(limit)
+		if err != nil {
+			return fmt.Errorf("invalid lending cap: %v", err)
+		}
+	}
+	return nil
+}
+
+// Ceilings a loan's approval is checked against, by sector
+func (c LendingCaps) applicable(loan *Loan) map[string]token.Amount {
+	limits := map[string]token.Amount{}
+	if c.TotalOutstanding.Rat().Sign() > 0 {
+		limits[exposureTotal] = c.TotalOutstanding
+	}
+	if limit := c.Sectors[loan.Product]; loan.Product != "" && limit.Rat().Sign() > 0 {
+		limits[loan.Product] = limit
+	}
+	return limits
+}
+
+func getCreditExposure(
+	ctx contractapi.TransactionContextInterface,
+	sector string,
+) (*CreditExposure, error) {
+	exposure := CreditExposure{Sector: sector}
+	_, err := getRecord(ctx, creditExposureObjectType, []string{sector}, &exposure)
+	if err != nil {
+		return nil, err
+	}
+	return &exposure, nil
+}
+
+// Checks an approval against the regulator's ceilings. Each ceiling the loan
+// would take sanctioned credit past is recorded as a breach and returned as
+// a failed rule, the caller rejects the loan.
+func (s *SmartContract) checkLendingCaps(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	lenderID string,
+	config *LendingConfig,
+) ([]string, error) {
+	limits := config.Caps.applicable(loan)
+	sectors := make([]string, 0, len(limits))
+	for sector := range limits {
+		sectors = append(sectors, sector)
+	}
+	sort.Strings(sectors)
+
+	attemptedAt, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	failed := []string{}
+	for _, sector := range sectors {
+		exposure, err := getCreditExposure(ctx, sector)
+		if err != nil {
+			return nil, err
+		}
+		if amountSum(exposure.Outstanding, loan.Amount).Cmp(limits[sector].Rat()) <= 0 {
+			continue
+		}
+
+		breach := CapBreach{
+			LoanID:      loan.LoanID,
+			LenderID:    lenderID,
+			Sector:      sector,
+			Cap:         limits[sector],
+			Outstanding: exposure.Outstanding,
+			Requested:   loan.Amount,
+			AttemptedAt: attemptedAt.Format(time.RFC3339),
+			TxID:        ctx.GetStub().GetTxID(),
+		}
+		err = putRecord(ctx, capBreachObjectType, []string{breach.AttemptedAt, breach.TxID, sector}, breach)
+		if err != nil {
+			return nil, err
+		}
+		failed = append(failed, fmt.Sprintf("LENDING_CAP_%s", sector))
+	}
+
+	return failed, nil
+}
+
+// Counts an approved loan in the exposure of the total and its sector
+func (s *SmartContract) addExposure(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	rounding RoundingPolicy,
+) error {
+	entry := exposureEntry{LoanID: loan.LoanID, Sector: loan.Product, Amount: loan.Amount}
+	err := putRecord(ctx, exposureEntryObjectType, []string{loan.LoanID}, entry)
+	if err != nil {
+		return err
+	}
+	return adjustExposure(ctx, entry.Sector, entry.Amount.Rat(), 1, rounding)
+}
+
+// Takes a closed loan out of the exposure counters, loans approved before
+// they existed were never counted
+func (s *SmartContract) releaseExposure(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+) error {
+	var entry exposureEntry
+	exists, err := getRecord(ctx, exposureEntryObjectType, []string{loan.LoanID}, &entry)
+	if err != nil || !exists {
+		return err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return err
+	}
+	err = adjustExposure(ctx, entry.Sector, new(big.Rat).Neg(entry.Amount.Rat()), -1, config.Rounding)
+	if err != nil {
+		return err
+	}
+
+	entryKey, err := ctx.GetStub().CreateCompositeKey(exposureEntryObjectType, []string{loan.LoanID})
+	if err != nil {
+		return fmt.Errorf("failed to create record key: %v", err)
+	}
+	return ctx.GetStub().DelState(entryKey)
+}
+
+// Reduces the credit a loan counts for in the exposure counters, when part
+// of its sanctioned amount is cancelled
+func (s *SmartContract) reduceExposure(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	value *big.Rat,
+	rounding RoundingPolicy,
+) error {
+	var entry exposureEntry
+	exists, err := getRecord(ctx, exposureEntryObjectType, []string{loan.LoanID}, &entry)
+	if err != nil || !exists {
+		return err
+	}
+
+	entry.Amount = rounding.amount(ratSub(entry.Amount.Rat(), value))
+	err = putRecord(ctx, exposureEntryObjectType, []string{loan.LoanID}, entry)
+	if err != nil {
+		return err
+	}
+	return adjustExposure(ctx, entry.Sector, new(big.Rat).Neg(value), 0, rounding)
+}
+
+// Moves the total and sector counters by value and a count of loans
+func adjustExposure(
+	ctx contractapi.TransactionContextInterface,
+	sector string,
+	value *big.Rat,
+	loans int,
+	rounding RoundingPolicy,
+) error {
+	sectors := []string{exposureTotal}
+	if sector != "" {
+		sectors = append(sectors, sector)
+	}
+
+	for _, sector := range sectors {
+		exposure, err := getCreditExposure(ctx, sector)
+		if err != nil {
+			return err
+		}
+		exposure.Outstanding = rounding.amount(ratAdd(exposure.Outstanding.Rat(), value))
+		exposure.Loans += loans
+		err = putRecord(ctx, creditExposureObjectType, []string{sector}, exposure)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ============== Lending Caps ==============
+
+// Sanctioned credit outstanding in total and by sector against the
+// regulator's ceilings, a page of sectors at a time with the total first on
+// the first page
+func (s *SmartContract) GetCreditExposure(
+	ctx contractapi.TransactionContextInterface,
+	pageSize int32,
+	bookmark string,
+) (*CreditExposurePage, error) {
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive")
+	}
+
+	page := CreditExposurePage{Exposures: []*CreditExposure{}}
+	if bookmark == "" {
+		total, err := getCreditExposure(ctx, exposureTotal)
+		if err != nil {
+			return nil, err
+		}
+		total.Cap = config.Caps.TotalOutstanding
+		page.Exposures = append(page.Exposures, total)
+	}
+	bookmark, err = token.DecodeBookmark(bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(creditExposureObjectType, []string{}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		exposure := &CreditExposure{}
+		err = json.Unmarshal(entry.Value, exposure)
+		if err != nil {
+			return nil, err
+		}
+		if exposure.Sector == exposureTotal {
+			continue
+		}
+		exposure.Cap = config.Caps.Sectors[exposure.Sector]
+		page.Exposures = append(page.Exposures, exposure)
+	}
+
+	page.Bookmark = token.EncodeBookmark(nextBookmark(metadata.GetFetchedRecordsCount(), pageSize, metadata.GetBookmark()))
+	return &page, nil
+}
+
+// Approvals refused for breaching a lending cap, oldest first, a page at a
+// time. Regulator only.
+func (s *SmartContract) GetCapBreaches(
+	ctx contractapi.TransactionContextInterface,
+	pageSize int32,
+	bookmark string,
+) (*CapBreachPage, error) {
+	err := requireRegulator(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive")
+	}
+	bookmark, err = token.DecodeBookmark(bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(capBreachObjectType, []string{}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	page := CapBreachPage{Breaches: []*CapBreach{}}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var breach CapBreach
+		err = json.Unmarshal(entry.Value, &breach)
+		if err != nil {
+			return nil, err
+		}
+		page.Breaches = append(page.Breaches, &breach)
+	}
+
+	page.Bookmark = token.EncodeBookmark(nextBookmark(metadata.GetFetchedRecordsCount(), pageSize, metadata.GetBookmark()))
+	return &page, nil
+}
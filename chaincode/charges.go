@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// A charge debited to a loan on top of its contractual interest, stored under
+// the loan and keyed by its charge ID
+type LoanCharge struct {
+	ChargeID    string       `json:"chargeId"`
+	LoanID      string       `json:"loanId"`
+	Type        string       `json:"type"` // PENAL, COMMITMENT
+	Amount      token.Amount `json:"amount"`
+	Description string       `json:"description"`
+	ChargedAt   string       `json:"chargedAt"`
+}
+
+const chargeObjectType = "charge"
+
+// Charge types
+const chargePenal = "PENAL"
+
+func (s *SmartContract) recordCharge(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	chargeType string,
+	amount token.Amount,
+	description string,
+) error {
+	chargedAt, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	chargeID, err := nextRecordID(ctx)
+	if err != nil {
+		return err
+	}
+
+	charge := LoanCharge{
+		ChargeID:    chargeID,
+		LoanID:      loan.LoanID,
+		Type:        chargeType,
+		Amount:      amount,
+		Description: description,
+		ChargedAt:   chargedAt.Format(time.RFC3339),
+	}
+	return putRecord(ctx, chargeObjectType, []string{loan.LoanID, charge.ChargeID}, charge)
+}
+
+// All charges debited to a loan
+func (s *SmartContract) getCharges(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+) ([]*LoanCharge, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(chargeObjectType, []string{loanID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	charges := []*LoanCharge{}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var charge LoanCharge
+		err = json.Unmarshal(entry.Value, &charge)
+		if err != nil {
+			return nil, err
+		}
+		charges = append(charges, &charge)
+	}
+
+	return charges, nil
+}
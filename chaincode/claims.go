@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Unique, transferable claim on a loan's repayments, minted to the lender at
+// disbursement. Repayments go to the claim's owner, so a loan is sold by
+// transferring its claim while LenderID stays the originating lender.
+type LoanClaim struct {
+	LoanID       string   `json:"loanId"` // doubles as the claim's token ID
+	Owner        string   `json:"owner"`  // account receiving the loan's repayments
+	MintedAt     string   `json:"mintedAt"`
+	AuditHistory []string `json:"auditHistory"`
+}
+
+// A page of the claims an account owns
+type LoanClaimPage struct {
+	Claims   []*LoanClaim `json:"claims"`
+	Bookmark string       `json:"bookmark"` // empty on the last page
+}
+
+const loanClaimObjectType = "loanClaim"
+
+// Index of loan claims by owning account
+const ownerClaimIndex = "owner~claim"
+
+// Mints the loan's claim to its lender
+func (s *SmartContract) mintClaim(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+) error {
+	mintedAt, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	claim := LoanClaim{
+		LoanID:   loan.LoanID,
+		Owner:    loan.LenderID,
+		MintedAt: mintedAt.Format(time.RFC3339),
+		AuditHistory: []string{
+			fmt.Sprintf("Claim minted to %s (TxID: %s)",
+				loan.LenderID,
+				ctx.GetStub().GetTxID()),
+		},
+	}
+
+	err = stampAuditEntries(ctx, claim.AuditHistory)
+	if err != nil {
+		return err
+	}
+	err = putRecord(ctx, loanClaimObjectType, []string{loan.LoanID}, claim)
+	if err != nil {
+		return err
+	}
+
+	return s.putIndex(ctx, ownerClaimIndex, claim.Owner, claim.LoanID)
+}
+
+// Account the loan's repayments are paid to, the lender for loans disbursed
+// before claims were minted
+func (s *SmartContract) payeeOf(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+) (string, error) {
+	var claim LoanClaim
+	exists, err := getRecord(ctx, loanClaimObjectType, []string{loan.LoanID}, &claim)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return loan.LenderID, nil
+	}
+	return claim.Owner, nil
+}
+
+// ============== Loan Claim Functions ==============
+
+// Transfer a loan's claim to another account, called by the organization
+// operating the current owner's account. Later repayments go to the new owner.
+func (s *SmartContract) TransferLoanClaim(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	newOwner string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "TransferLoanClaim")
+	if err != nil {
+		return nil, err
+	}
+
+	claim, err := s.GetLoanClaim(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	_, fractioned, err := s.participationsOf(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	if fractioned {
+		return nil, fmt.Errorf("claim on loan %s is held as participation units, transfer units instead", loanID)
+	}
+	if newOwner == claim.Owner {
+		return nil, fmt.Errorf("claim on loan %s is already owned by %s", loanID, newOwner)
+	}
+
+	// Read without pending repayments, a transfer must not conflict with them
+	loan, err := s.readLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	if loan.Status != "ACTIVE" && loan.Status != "DEFAULTED" {
+		return nil, fmt.Errorf("claim on loan %s cannot be transferred in current status: %s", loanID, loan.Status)
+	}
+
+	owner, err := s.accountOf(ctx, claim.Owner)
+	if err != nil {
+		return nil, err
+	}
+	err = requireOperatorOf(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.accountOf(ctx, newOwner)
+	if err != nil {
+		return nil, err
+	}
+	err = token.ScreenParties(ctx, newOwner)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.deleteIndex(ctx, ownerClaimIndex, claim.Owner, loanID)
+	if err != nil {
+		return nil, err
+	}
+	err = s.putIndex(ctx, ownerClaimIndex, newOwner, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	previousOwner := claim.Owner
+	claim.Owner = newOwner
+	claim.AuditHistory = append(claim.AuditHistory,
+		fmt.Sprintf("Claim transferred from %s to %s (TxID: %s)",
+			previousOwner,
+			newOwner,
+			ctx.GetStub().GetTxID()))
+
+	err = stampAuditEntries(ctx, claim.AuditHistory)
+	if err != nil {
+		return nil, err
+	}
+	err = putRecord(ctx, loanClaimObjectType, []string{loanID}, claim)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := newLoanEventHeader(ctx, loanID, 1)
+	if err != nil {
+		return nil, err
+	}
+	// The loan was read without its pending repayments, so is its result
+	return newLoanResult(ctx, loan).emit(ctx, eventLoanClaimTransferred, LoanClaimTransferredEventV1{
+		LoanEventHeader: header,
+		From:            previousOwner,
+		To:              newOwner,
+	})
+}
+
+// ============== Loan Claim Queries ==============
+
+func (s *SmartContract) GetLoanClaim(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+) (*LoanClaim, error) {
+	var claim LoanClaim
+	exists, err := getRecord(ctx, loanClaimObjectType, []string{loanID}, &claim)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("loan %s has no claim", loanID)
+	}
+
+	return &claim, nil
+}
+
+// Claims owned by an account, a page at a time in loan ID order
+func (s *SmartContract) GetClaimsByOwner(
+	ctx contractapi.TransactionContextInterface,
+	owner string,
+	pageSize int32,
+	bookmark string,
+) (*LoanClaimPage, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive")
+	}
+	bookmark, err := token.DecodeBookmark(bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(ownerClaimIndex, []string{owner}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	page := LoanClaimPage{Claims: []*LoanClaim{}}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		claim, err := s.GetLoanClaim(ctx, keyParts[1])
+		if err != nil {
+			return nil, err
+		}
+		page.Claims = append(page.Claims, claim)
+	}
+
+	page.Bookmark = token.EncodeBookmark(nextBookmark(metadata.GetFetchedRecordsCount(), pageSize, metadata.GetBookmark()))
+	return &page, nil
+}
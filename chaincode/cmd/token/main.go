@@ -0,0 +1,26 @@
+// Command token runs the token ledger as a standalone chaincode
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+func main() {
+	contract := &token.TokenContract{}
+	contract.TransactionContextHandler = new(token.TransactionContext)
+	contract.BeforeTransaction = token.ValidateArguments
+
+	chaincode, err := contractapi.NewChaincode(contract)
+	if err != nil {
+		fmt.Printf("Error creating token chaincode: %s", err.Error())
+		return
+	}
+
+	if err := chaincode.Start(); err != nil {
+		fmt.Printf("Error starting token chaincode: %s", err.Error())
+	}
+}
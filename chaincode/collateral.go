@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Types loans are indexed under by their collateral. OTHER is also the free
+// text collateral description given with the loan request.
+const (
+	collateralGold       = "GOLD"
+	collateralVehicle    = "VEHICLE"
+	collateralProperty   = "PROPERTY"
+	collateralInvoice    = "INVOICE"
+	collateralFD         = "FD"
+	collateralSecurities = "SECURITIES"
+	collateralOther      = "OTHER"
+)
+
+// Indexes of loans by the type of their collateral, and by the identifier of
+// the pledged asset: registration number of a vehicle, property ID, invoice
+// ID, collateral registry ID or the free text description. Gold pledged by
+// weight is not identified.
+const (
+	collateralTypeIndex = "collateraltype~loan"
+	collateralIDIndex   = "collateralid~loan"
+)
+
+// Loan statuses in which a loan still holds its collateral
+var collateralHeldStatuses = map[string]bool{
+	"PENDING":   true,
+	"APPROVED":  true,
+	"SETTLING":  true,
+	"ACTIVE":    true,
+	"DEFAULTED": true,
+}
+
+// Indexes a loan under a collateral type and asset, dropping the asset it
+// replaces. previousID and collateralID are empty for unidentified assets.
+func (s *SmartContract) indexCollateral(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	collateralType string,
+	previousID string,
+	collateralID string,
+) error {
+	err := s.putIndex(ctx, collateralTypeIndex, collateralType, loanID)
+	if err != nil {
+		return err
+	}
+
+	if previousID != "" && previousID != collateralID {
+		err = s.deleteIndex(ctx, collateralIDIndex, previousID, loanID)
+		if err != nil {
+			return err
+		}
+	}
+	if collateralID == "" {
+		return nil
+	}
+	return s.putIndex(ctx, collateralIDIndex, collateralID, loanID)
+}
+
+// ============== Collateral Queries ==============
+
+// List loans secured by a type of collateral, GOLD, VEHICLE, PROPERTY, INVOICE,
+// FD, SECURITIES or OTHER, a page at a time. Loans pledged before collateral was indexed are
+// not listed.
+func (s *SmartContract) GetLoansByCollateralType(
+	ctx contractapi.TransactionContextInterface,
+	collateralType string,
+	pageSize int32,
+	bookmark string,
+) (*LoanPage, error) {
+	return s.getIndexedLoanPage(ctx, collateralTypeIndex, []string{collateralType}, pageSize, bookmark)
+}
+
+// Find the loan a pledged asset secures, the loan still holding it or else
+// the last one to have held it
+func (s *SmartContract) GetLoanByCollateralID(
+	ctx contractapi.TransactionContextInterface,
+	collateralID string,
+) (*Loan, error) {
+	if collateralID == "" {
+		return nil, fmt.Errorf("collateral ID is required")
+	}
+
+	loans, err := s.getIndexedLoans(ctx, collateralIDIndex, collateralID)
+	if err != nil {
+		return nil, err
+	}
+	if len(loans) == 0 {
+		return nil, fmt.Errorf("no loan is secured by collateral %s", collateralID)
+	}
+
+	found := loans[0]
+	for _, loan := range loans[1:] {
+		held, foundHeld := collateralHeldStatuses[loan.Status], collateralHeldStatuses[found.Status]
+		if held != foundHeld {
+			if held {
+				found = loan
+			}
+			continue
+		}
+
+		createdAt, _ := unixTime(loan.CreatedAt)
+		foundCreatedAt, _ := unixTime(found.CreatedAt)
+		if createdAt.After(foundCreatedAt) {
+			found = loan
+		}
+	}
+
+	return s.viewLoan(ctx, newLoanViewer(), found)
+}
@@ -0,0 +1,616 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Asset registered once by its owner, valued and pledged to loans through
+// encumbrances independently of any one loan
+type CollateralAsset struct {
+	CollateralID string       `json:"collateralId"`
+	Type         string       `json:"type"` // GOLD, VEHICLE, PROPERTY, FD, SECURITIES or OTHER
+	OwnerID      string       `json:"ownerId"`
+	Description  string       `json:"description"`
+	Value        token.Amount `json:"value"`    // at the last valuation, 0 until valued
+	ValuedAt     string       `json:"valuedAt"` // RFC3339, empty until valued
+	ValuedBy     string       `json:"valuedBy"` // MSP ID of the valuer
+	RegisteredAt string       `json:"registeredAt"`
+}
+
+// A page of the assets an account owns
+type CollateralAssetPage struct {
+	Assets   []*CollateralAsset `json:"assets"`
+	Bookmark string             `json:"bookmark"` // empty on the last page
+}
+
+// Charge of a lender on a registered asset for a loan, an asset has at most
+// one ACTIVE encumbrance
+type Encumbrance struct {
+	CollateralID string `json:"collateralId"`
+	LoanID       string `json:"loanId"`
+	LenderID     string `json:"lenderId"`
+	Status       string `json:"status"` // ACTIVE, RELEASED, LIQUIDATED
+	CreatedAt    string `json:"createdAt"`
+	ReleasedAt   string `json:"releasedAt"`
+}
+
+// A page of the encumbrances recorded on an asset
+type EncumbrancePage struct {
+	Encumbrances []*Encumbrance `json:"encumbrances"`
+	Bookmark     string         `json:"bookmark"` // empty on the last page
+}
+
+// Registered asset pledged against a loan
+type CollateralPledge struct {
+	CollateralID string       `json:"collateralId"`
+	Type         string       `json:"type"`
+	Status       string       `json:"status"`                                  // PLEDGED, ENCUMBERED, RELEASED, LIQUIDATED
+	Value        token.Amount `json:"value"`                                   // registry valuation when last checked
+	Proceeds     token.Amount `json:"proceeds,omitempty" metadata:",optional"` // recovered when liquidated
+}
+
+const (
+	collateralAssetObjectType = "collateral"
+	encumbranceObjectType     = "encumbrance"
+	ownerCollateralIndex      = "owner~collateral"
+)
+
+var registryCollateralTypes = map[string]bool{
+	collateralGold:       true,
+	collateralVehicle:    true,
+	collateralProperty:   true,
+	collateralFD:         true,
+	collateralSecurities: true,
+	collateralOther:      true,
+}
+
+// ============== Collateral Registry ==============
+
+// Register an asset in the collateral registry, called by the organization
+// operating the owner's account
+func (s *SmartContract) RegisterCollateral(
+	ctx contractapi.TransactionContextInterface,
+	collateralID string,
+	collateralType string,
+	ownerID string,
+	description string,
+) error {
+	err := claimRequestID(ctx, "RegisterCollateral")
+	if err != nil {
+		return err
+	}
+
+	if collateralID == "" {
+		return fmt.Errorf("collateral ID is required")
+	}
+	if !registryCollateralTypes[collateralType] {
+		return fmt.Errorf("unknown collateral type %s", collateralType)
+	}
+
+	owner, err := s.accountOf(ctx, ownerID)
+	if err != nil {
+		return err
+	}
+	err = requireOperatorOf(ctx, owner)
+	if err != nil {
+		return err
+	}
+
+	var existing CollateralAsset
+	exists, err := getRecord(ctx, collateralAssetObjectType, []string{collateralID}, &existing)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("collateral %s already exists", collateralID)
+	}
+
+	registeredAt, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = s.putIndex(ctx, ownerCollateralIndex, ownerID, collateralID)
+	if err != nil {
+		return err
+	}
+
+	return putRecord(ctx, collateralAssetObjectType, []string{collateralID}, CollateralAsset{
+		CollateralID: collateralID,
+		Type:         collateralType,
+		OwnerID:      ownerID,
+		Description:  description,
+		RegisteredAt: registeredAt.Format(time.RFC3339),
+	})
+}
+
+// Record the current value of a registered asset, oracle organizations only
+func (s *SmartContract) ValueCollateral(
+	ctx contractapi.TransactionContextInterface,
+	collateralID string,
+	value string,
+) error {
+	err := claimRequestID(ctx, "ValueCollateral")
+	if err != nil {
+		return err
+	}
+	valuation, err := parseAmount(value)
+	if err != nil {
+		return err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return err
+	}
+	mspID, err := requireOracle(ctx, config)
+	if err != nil {
+		return err
+	}
+	if valuation.Sign() <= 0 {
+		return fmt.Errorf("collateral value must be positive")
+	}
+
+	asset, err := s.GetCollateral(ctx, collateralID)
+	if err != nil {
+		return err
+	}
+
+	valuedAt, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	asset.Value = config.Rounding.amount(valuation)
+	asset.ValuedAt = valuedAt.Format(time.RFC3339)
+	asset.ValuedBy = mspID
+	return putRecord(ctx, collateralAssetObjectType, []string{collateralID}, asset)
+}
+
+func (s *SmartContract) GetCollateral(
+	ctx contractapi.TransactionContextInterface,
+	collateralID string,
+) (*CollateralAsset, error) {
+	var asset CollateralAsset
+	exists, err := getRecord(ctx, collateralAssetObjectType, []string{collateralID}, &asset)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("collateral %s does not exist", collateralID)
+	}
+	return &asset, nil
+}
+
+// List the assets an account owns in the registry, a page at a time in
+// collateral ID order
+func (s *SmartContract) GetCollateralByOwner(
+	ctx contractapi.TransactionContextInterface,
+	ownerID string,
+	pageSize int32,
+	bookmark string,
+) (*CollateralAssetPage, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive")
+	}
+	bookmark, err := token.DecodeBookmark(bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(ownerCollateralIndex, []string{ownerID}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	page := CollateralAssetPage{Assets: []*CollateralAsset{}}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		asset, err := s.GetCollateral(ctx, keyParts[1])
+		if err != nil {
+			return nil, err
+		}
+		page.Assets = append(page.Assets, asset)
+	}
+
+	page.Bookmark = token.EncodeBookmark(nextBookmark(metadata.GetFetchedRecordsCount(), pageSize, metadata.GetBookmark()))
+	return &page, nil
+}
+
+// The encumbrances ever recorded on an asset, active and released, a page at
+// a time
+func (s *SmartContract) GetEncumbrances(
+	ctx contractapi.TransactionContextInterface,
+	collateralID string,
+	pageSize int32,
+	bookmark string,
+) (*EncumbrancePage, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive")
+	}
+	bookmark, err := token.DecodeBookmark(bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(encumbranceObjectType, []string{collateralID}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	page := EncumbrancePage{Encumbrances: []*Encumbrance{}}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var encumbrance Encumbrance
+		err = json.Unmarshal(entry.Value, &encumbrance)
+		if err != nil {
+			return nil, err
+		}
+		page.Encumbrances = append(page.Encumbrances, &encumbrance)
+	}
+
+	page.Bookmark = token.EncodeBookmark(nextBookmark(metadata.GetFetchedRecordsCount(), pageSize, metadata.GetBookmark()))
+	return &page, nil
+}
+
+// Pledge a registered asset of the borrower against a pending loan, it is
+// encumbered to the lender when the loan is approved
+func (s *SmartContract) PledgeCollateral(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	collateralID string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "PledgeCollateral")
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Status != "PENDING" {
+		return nil, fmt.Errorf("collateral of loan %s cannot change in current status: %s", loanID, loan.Status)
+	}
+
+	asset, err := s.GetCollateral(ctx, collateralID)
+	if err != nil {
+		return nil, err
+	}
+	if asset.OwnerID != loan.BorrowerID {
+		return nil, fmt.Errorf("collateral %s is not owned by borrower %s", collateralID, loan.BorrowerID)
+	}
+	for _, pledge := range loan.Pledges {
+		if pledge.CollateralID == collateralID {
+			return nil, fmt.Errorf("collateral %s is already pledged to loan %s", collateralID, loanID)
+		}
+	}
+	err = s.checkCollateralFree(ctx, collateralID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.indexCollateral(ctx, loanID, asset.Type, "", collateralID)
+	if err != nil {
+		return nil, err
+	}
+
+	loan.Pledges = append(loan.Pledges, &CollateralPledge{
+		CollateralID: collateralID,
+		Type:         asset.Type,
+		Status:       "PLEDGED",
+		Value:        asset.Value,
+	})
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Collateral %s pledged (TxID: %s)",
+			collateralID,
+			ctx.GetStub().GetTxID()))
+
+	return s.putLoanResult(ctx, loan)
+}
+
+// Fails if the asset is encumbered for a loan
+func (s *SmartContract) checkCollateralFree(
+	ctx contractapi.TransactionContextInterface,
+	collateralID string,
+) error {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(encumbranceObjectType, []string{collateralID})
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return err
+		}
+
+		var encumbrance Encumbrance
+		err = json.Unmarshal(entry.Value, &encumbrance)
+		if err != nil {
+			return err
+		}
+		if encumbrance.Status == "ACTIVE" {
+			return fmt.Errorf("collateral %s is encumbered to %s for loan %s",
+				collateralID, encumbrance.LenderID, encumbrance.LoanID)
+		}
+	}
+	return nil
+}
+
+// Encumbers the pledged assets of an approved loan to its lender, failing if
+// any of them is encumbered for another loan
+func (s *SmartContract) encumberCollateral(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+) error {
+	createdAt, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, pledge := range loan.Pledges {
+		if pledge.Status != "PLEDGED" {
+			continue
+		}
+
+		err = s.checkCollateralFree(ctx, pledge.CollateralID)
+		if err != nil {
+			return err
+		}
+
+		err = putRecord(ctx, encumbranceObjectType, []string{pledge.CollateralID, loan.LoanID}, Encumbrance{
+			CollateralID: pledge.CollateralID,
+			LoanID:       loan.LoanID,
+			LenderID:     loan.LenderID,
+			Status:       "ACTIVE",
+			CreatedAt:    createdAt.Format(time.RFC3339),
+		})
+		if err != nil {
+			return err
+		}
+		pledge.Status = "ENCUMBERED"
+	}
+
+	return nil
+}
+
+// Releases the encumbrances of a closed loan's assets
+func (s *SmartContract) releaseEncumbrances(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+) error {
+	for _, pledge := range loan.Pledges {
+		if pledge.Status != "ENCUMBERED" {
+			continue
+		}
+
+		err := s.closeEncumbrance(ctx, loan, pledge, "RELEASED")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ends the encumbrance of a pledged asset, RELEASED to the borrower or
+// LIQUIDATED by the lender
+func (s *SmartContract) closeEncumbrance(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	pledge *CollateralPledge,
+	status string,
+) error {
+	var encumbrance Encumbrance
+	exists, err := getRecord(ctx, encumbranceObjectType, []string{pledge.CollateralID, loan.LoanID}, &encumbrance)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("encumbrance of loan %s on collateral %s does not exist", loan.LoanID, pledge.CollateralID)
+	}
+
+	releasedAt, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	encumbrance.Status = status
+	encumbrance.ReleasedAt = releasedAt.Format(time.RFC3339)
+	err = putRecord(ctx, encumbranceObjectType, []string{encumbrance.CollateralID, encumbrance.LoanID}, encumbrance)
+	if err != nil {
+		return err
+	}
+
+	pledge.Status = status
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Encumbrance on collateral %s %s (TxID: %s)",
+			encumbrance.CollateralID,
+			strings.ToLower(status),
+			ctx.GetStub().GetTxID()))
+	return nil
+}
+
+// ============== Collateral Items ==============
+
+// Release one asset of an ACTIVE loan back to the borrower, called by the
+// lender once the assets left cover the remaining balance within the
+// configured loan to value
+func (s *SmartContract) ReleaseCollateralItem(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	collateralID string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "ReleaseCollateralItem")
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	err = s.requireLender(ctx, loan.LenderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Status != "ACTIVE" {
+		return nil, fmt.Errorf("collateral of loan %s cannot be released in current status: %s", loanID, loan.Status)
+	}
+	pledge, err := encumberedPledge(loan, collateralID)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	remaining, err := s.pledgedValue(ctx, loan, collateralID)
+	if err != nil {
+		return nil, err
+	}
+	if loan.RemainingBalance.Rat().Cmp(percentOf(remaining, config.CollateralLTV.Rat())) > 0 {
+		return nil, fmt.Errorf("remaining balance %s would exceed %s%% of the %s of collateral left",
+			loan.RemainingBalance, config.CollateralLTV, token.FormatAmount(remaining))
+	}
+
+	err = s.closeEncumbrance(ctx, loan, pledge, "RELEASED")
+	if err != nil {
+		return nil, err
+	}
+
+	return s.putLoanResult(ctx, loan)
+}
+
+// Record the sale of one asset of a DEFAULTED loan by its lender, applying
+// the proceeds to the remaining balance. Any excess is due to the borrower.
+func (s *SmartContract) LiquidateCollateral(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	collateralID string,
+	proceeds string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "LiquidateCollateral")
+	if err != nil {
+		return nil, err
+	}
+	received, err := parseAmount(proceeds)
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	err = s.requireLender(ctx, loan.LenderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Status != "DEFAULTED" {
+		return nil, fmt.Errorf("collateral of loan %s cannot be liquidated in current status: %s", loanID, loan.Status)
+	}
+	err = requireNoOpenDispute(loan)
+	if err != nil {
+		return nil, err
+	}
+	if received.Sign() < 0 {
+		return nil, fmt.Errorf("proceeds must not be negative")
+	}
+	pledge, err := encumberedPledge(loan, collateralID)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.closeEncumbrance(ctx, loan, pledge, "LIQUIDATED")
+	if err != nil {
+		return nil, err
+	}
+	pledge.Proceeds = config.Rounding.amount(received)
+	remaining := ratSub(loan.RemainingBalance.Rat(), pledge.Proceeds.Rat())
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Collateral %s liquidated for %s (TxID: %s)",
+			collateralID,
+			pledge.Proceeds,
+			ctx.GetStub().GetTxID()))
+	if remaining.Sign() < 0 {
+		loan.AuditHistory = append(loan.AuditHistory,
+			fmt.Sprintf("Liquidation exceeded the balance by %s, excess due to the borrower (TxID: %s)",
+				token.FormatAmount(new(big.Rat).Neg(remaining)),
+				ctx.GetStub().GetTxID()))
+		remaining = new(big.Rat)
+	}
+	loan.RemainingBalance = token.NewAmount(remaining)
+
+	return s.putLoanResult(ctx, loan)
+}
+
+func encumberedPledge(loan *Loan, collateralID string) (*CollateralPledge, error) {
+	for _, pledge := range loan.Pledges {
+		if pledge.CollateralID == collateralID {
+			if pledge.Status != "ENCUMBERED" {
+				return nil, fmt.Errorf("collateral %s of loan %s is %s", collateralID, loan.LoanID, pledge.Status)
+			}
+			return pledge, nil
+		}
+	}
+	return nil, fmt.Errorf("collateral %s is not pledged to loan %s", collateralID, loan.LoanID)
+}
+
+// Sums the current registry valuations of the loan's pledged and encumbered
+// assets other than excluded, refreshing the values kept on the pledges
+func (s *SmartContract) pledgedValue(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	excluded string,
+) (*big.Rat, error) {
+	total := new(big.Rat)
+	for _, pledge := range loan.Pledges {
+		if pledge.Status != "PLEDGED" && pledge.Status != "ENCUMBERED" {
+			continue
+		}
+
+		asset, err := s.GetCollateral(ctx, pledge.CollateralID)
+		if err != nil {
+			return nil, err
+		}
+		pledge.Value = asset.Value
+		if pledge.CollateralID != excluded {
+			total.Add(total, asset.Value.Rat())
+		}
+	}
+	return total, nil
+}
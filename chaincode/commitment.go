@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// A borrower's request to cancel part of the undrawn commitment of a loan
+// disbursed in tranches, kept on the loan until the next one is requested
+type CommitmentCancellation struct {
+	Amount         token.Amount `json:"amount"`
+	RequestedAt    string       `json:"requestedAt"`
+	RequestedBy    string       `json:"requestedBy"` // MSP ID of the borrower's organization
+	Status         string       `json:"status"`      // REQUESTED, ACKNOWLEDGED
+	AcknowledgedAt string       `json:"acknowledgedAt,omitempty" metadata:",optional"`
+}
+
+// Cancellation statuses
+const (
+	cancellationRequested    = "REQUESTED"
+	cancellationAcknowledged = "ACKNOWLEDGED"
+)
+
+// Charge type of the fee on a loan's undrawn commitment
+const chargeCommitment = "COMMITMENT"
+
+// ============== Undrawn Commitment ==============
+
+// Request to cancel amount of the sanctioned but undrawn principal of an
+// ACTIVE loan disbursed in tranches, called by the organization operating the
+// borrower's account. The commitment is reduced when the lender acknowledges.
+func (s *SmartContract) CancelUndrawnCommitment(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	amount string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "CancelUndrawnCommitment")
+	if err != nil {
+		return nil, err
+	}
+	value, err := parseAmount(amount)
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	borrower, err := s.accountOf(ctx, loan.BorrowerID)
+	if err != nil {
+		return nil, err
+	}
+	err = requireOperatorOf(ctx, borrower)
+	if err != nil {
+		return nil, err
+	}
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Status != "ACTIVE" || len(loan.Tranches) == 0 {
+		return nil, fmt.Errorf("commitment of loan %s cannot be cancelled in current status: %s", loanID, loan.Status)
+	}
+	if loan.Cancellation != nil && loan.Cancellation.Status == cancellationRequested {
+		return nil, fmt.Errorf("loan %s already has a cancellation of %s requested", loanID, loan.Cancellation.Amount)
+	}
+
+	undrawn := ratSub(loan.Amount.Rat(), trancheTotal(loan))
+	if value.Sign() <= 0 {
+		return nil, fmt.Errorf("cancellation amount must be positive")
+	}
+	if value.Cmp(undrawn) > 0 {
+		return nil, fmt.Errorf("cancellation of %s exceeds the %s undrawn on loan %s", token.FormatAmount(value), token.FormatAmount(undrawn), loanID)
+	}
+
+	requestedAt, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	loan.Cancellation = &CommitmentCancellation{
+		Amount:      token.NewAmount(value),
+		RequestedAt: requestedAt.Format(time.RFC3339),
+		RequestedBy: mspID,
+		Status:      cancellationRequested,
+	}
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Cancellation of %s of undrawn commitment requested (TxID: %s)",
+			loan.Cancellation.Amount,
+			ctx.GetStub().GetTxID()))
+
+	return s.putLoanResult(ctx, loan)
+}
+
+// Acknowledge the requested cancellation, called by the organization
+// operating the lender's account. The commitment fee is charged up to now,
+// the sanctioned amount is reduced and the cancelled funds are released from
+// the lender's reservation and the lending cap exposure.
+func (s *SmartContract) AcknowledgeCommitmentCancellation(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "AcknowledgeCommitmentCancellation")
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	err = s.requireLender(ctx, loan.LenderID)
+	if err != nil {
+		return nil, err
+	}
+
+	cancellation := loan.Cancellation
+	if cancellation == nil || cancellation.Status != cancellationRequested {
+		return nil, fmt.Errorf("loan %s has no commitment cancellation requested", loanID)
+	}
+	if loan.Status != "ACTIVE" {
+		return nil, fmt.Errorf("commitment of loan %s cannot be cancelled in current status: %s", loanID, loan.Status)
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rounding := config.Rounding
+
+	// Tranches drawn since the request may have left less to cancel
+	undrawn := ratSub(loan.Amount.Rat(), trancheTotal(loan))
+	if cancellation.Amount.Rat().Cmp(undrawn) > 0 {
+		return nil, fmt.Errorf("cancellation of %s exceeds the %s undrawn on loan %s", cancellation.Amount, token.FormatAmount(undrawn), loanID)
+	}
+
+	err = s.chargeCommitmentFee(ctx, loan, config)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.drawReservation(ctx, loan, cancellation.Amount.Rat())
+	if err != nil {
+		return nil, err
+	}
+	err = s.reduceExposure(ctx, loan, cancellation.Amount.Rat(), rounding)
+	if err != nil {
+		return nil, err
+	}
+
+	acknowledgedAt, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	loan.Amount = rounding.amount(ratSub(loan.Amount.Rat(), cancellation.Amount.Rat()))
+	cancellation.Status = cancellationAcknowledged
+	cancellation.AcknowledgedAt = acknowledgedAt.Format(time.RFC3339)
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Undrawn commitment of %s cancelled, sanctioned amount reduced to %s (TxID: %s)",
+			cancellation.Amount,
+			loan.Amount,
+			ctx.GetStub().GetTxID()))
+
+	return s.putLoanResult(ctx, loan)
+}
+
+// Charges the commitment fee on a tranche loan's undrawn principal since the
+// first tranche or the last charge, in whole days. Called whenever the
+// undrawn principal is about to change.
+func (s *SmartContract) chargeCommitmentFee(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	config *LendingConfig,
+) error {
+	if len(loan.Tranches) == 0 {
+		return nil
+	}
+	rounding := config.Rounding
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	chargedFrom := loan.CommitmentFrom
+	if chargedFrom == "" {
+		chargedFrom = loan.Tranches[0].DisbursedAt
+	}
+	from, err := time.Parse(time.RFC3339, chargedFrom)
+	if err != nil {
+		return fmt.Errorf("loan %s has an invalid commitment fee date %s", loan.LoanID, chargedFrom)
+	}
+	days := int(now.Sub(from).Hours() / 24)
+	loan.CommitmentFrom = from.AddDate(0, 0, days).Format(time.RFC3339)
+
+	undrawn := ratSub(loan.Amount.Rat(), trancheTotal(loan))
+	fee := rounding.round(ratMul(percentOf(undrawn, config.CommitmentRate.Rat()), big.NewRat(int64(days), 365)))
+	if fee.Sign() <= 0 {
+		return nil
+	}
+
+	description := fmt.Sprintf("Commitment fee of %s on %s undrawn for %d days", token.FormatAmount(fee), token.FormatAmount(undrawn), days)
+	err = s.recordCharge(ctx, loan, chargeCommitment, token.NewAmount(fee), description)
+	if err != nil {
+		return err
+	}
+	loan.CommitmentFees = rounding.amount(ratAdd(loan.CommitmentFees.Rat(), fee))
+	loan.RepaymentDue = rounding.amount(ratAdd(loan.RepaymentDue.Rat(), fee))
+	loan.RemainingBalance = rounding.amount(ratAdd(loan.RemainingBalance.Rat(), fee))
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("%s (TxID: %s)",
+			description,
+			ctx.GetStub().GetTxID()))
+	return nil
+}
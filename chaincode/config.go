@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Platform wide parameters, administered by the regulator
+type LendingConfig struct {
+	CreditPolicy     CreditPolicy            `json:"creditPolicy"`
+	Products         map[string]LoanProduct  `json:"products"`
+	PSLTargets       map[string]Decimal      `json:"pslTargets"`       // percent of the quarter's disbursements, TOTAL for overall PSL
+	Provisioning     map[string]Decimal      `json:"provisioning"`     // percent of outstanding by asset classification
+	ArchiveAfterDays int                     `json:"archiveAfterDays"` // retention window before a closed loan can be archived
+	TokenChaincode   string                  `json:"tokenChaincode"`   // settle through this chaincode, empty for the embedded token ledger
+	SettlementMSPs   []string                `json:"settlementMsps"`   // organizations allowed to confirm cross-channel settlements
+	OracleMSPs       []string                `json:"oracleMsps"`       // organizations allowed to publish market rates
+	BenchmarkQuorum  int                     `json:"benchmarkQuorum"`  // oracle identities whose recent quotes fix a benchmark
+	BenchmarkHours   int                     `json:"benchmarkHours"`   // hours a benchmark quote counts towards fixings
+	GoldLTV          Decimal                 `json:"goldLtv"`          // maximum loan to value of gold collateral, percent
+	CollateralLTV    Decimal                 `json:"collateralLtv"`    // maximum loan to value of the assets pledged from the collateral registry, percent
+	RequireAAConsent bool                    `json:"requireAaConsent"` // credit evaluation needs a valid Account Aggregator consent
+	CoolingOffDays   int                     `json:"coolingOffDays"`   // days after disbursement a borrower may cancel the loan
+	ApprovalDays     int                     `json:"approvalDays"`     // days an approval stays valid for disbursement, 0 for no limit
+	PendingSLAHours  int                     `json:"pendingSlaHours"`  // turnaround for deciding an application, 0 for none
+	ApprovedSLAHours int                     `json:"approvedSlaHours"` // turnaround from approval to disbursement, 0 for none
+	Rounding         RoundingPolicy          `json:"rounding"`         // applied to every computed amount
+	ArbiterMSPs      []string                `json:"arbiterMsps"`      // organizations besides the regulator allowed to resolve disputes
+	ApprovalLimits   map[string]token.Amount `json:"approvalLimits"`   // largest loan each role certificate attribute may approve
+	Velocity         VelocityPolicy          `json:"velocity"`         // limits on how fast borrowers may apply
+	KeeperMSPs       []string                `json:"keeperMsps"`       // organizations allowed to run scheduled jobs
+	PenalRate        Decimal                 `json:"penalRate"`        // percent a year charged on overdue balances, 0 for none
+	CommitmentRate   Decimal                 `json:"commitmentRate"`   // percent a year charged on the undrawn principal of tranche loans, 0 for none
+	DefaultDPD       int                     `json:"defaultDpd"`       // days past due before a loan may be marked as defaulted
+	TDSRate          Decimal                 `json:"tdsRate"`          // percent of repayment interest withheld as tax, 0 for none
+	TaxAccount       string                  `json:"taxAccount"`       // account withheld tax is paid to
+	Fees             FeeSchedule             `json:"fees"`             // charged at disbursement
+	Caps             LendingCaps             `json:"caps"`             // system-wide ceilings on sanctioned credit
+}
+
+// Key the configuration is stored under
+const configObjectType = "config"
+
+func defaultConfig() LendingConfig {
+	return LendingConfig{
+		CreditPolicy: CreditPolicy{
+			NoActiveDefaults: true,
+		},
+		Products: map[string]LoanProduct{
+			"AGRI":      {PSLCategories: []string{pslAgriculture}},
+			"MSME":      {PSLCategories: []string{pslMSME}},
+			"EDUCATION": {PSLCategories: []string{pslEducation}, PSLMaxAmount: "2000000.00"},
+			"HOME":      {PSLCategories: []string{pslHousing}, PSLMaxAmount: "3500000.00"},
+			"VEHICLE":   {PSLCategories: []string{}},
+			"PERSONAL":  {PSLCategories: []string{}},
+		},
+		PSLTargets: map[string]Decimal{
+			pslTotal:       "40.0000",
+			pslAgriculture: "18.0000",
+			pslMSME:        "7.5000",
+		},
+		Provisioning: map[string]Decimal{
+			assetStandard:    "0.4000",
+			assetSMA0:        "0.4000",
+			assetSMA1:        "0.4000",
+			assetSMA2:        "0.4000",
+			assetSubstandard: "15.0000",
+			assetDoubtful:    "40.0000",
+			assetLoss:        "100.0000",
+		},
+		ArchiveAfterDays: 365,
+		SettlementMSPs:   []string{regulatorMSP},
+		OracleMSPs:       []string{regulatorMSP},
+		BenchmarkQuorum:  3,
+		BenchmarkHours:   24,
+		GoldLTV:          "75.0000",
+		CollateralLTV:    "75.0000",
+		RequireAAConsent: true,
+		CoolingOffDays:   3,
+		Rounding:         RoundingPolicy{Mode: roundHalfEven, Places: 2},
+		ArbiterMSPs:      []string{},
+		ApprovalLimits:   map[string]token.Amount{},
+		Velocity:         VelocityPolicy{MaxRequestsPerDay: 5, MinDaysAfterDefault: 90},
+		KeeperMSPs:       []string{regulatorMSP},
+		Fees:             FeeSchedule{GSTRate: "18.0000"},
+		Caps:             LendingCaps{Sectors: map[string]token.Amount{}},
+	}
+}
+
+// ============== Configuration Functions ==============
+
+func (s *SmartContract) GetConfig(
+	ctx contractapi.TransactionContextInterface,
+) (*LendingConfig, error) {
+	configKey, err := ctx.GetStub().CreateCompositeKey(configObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+
+	configJSON, err := ctx.GetStub().GetState(configKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+
+	config := defaultConfig()
+	if configJSON == nil {
+		return &config, nil
+	}
+
+	err = json.Unmarshal(configJSON, &config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// Update the configuration, fields missing from configJSON keep their current value
+func (s *SmartContract) UpdateConfig(
+	ctx contractapi.TransactionContextInterface,
+	configJSON string,
+) error {
+	err := claimRequestID(ctx, "UpdateConfig")
+	if err != nil {
+		return err
+	}
+
+	err = requireRegulator(ctx)
+	if err != nil {
+		return err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal([]byte(configJSON), config)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %v", err)
+	}
+	err = config.Rounding.validate()
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %v", err)
+	}
+	err = config.validateFigures()
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %v", err)
+	}
+	err = config.validateTDS()
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %v", err)
+	}
+	err = config.Fees.validate()
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %v", err)
+	}
+	err = config.Caps.validate()
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %v", err)
+	}
+
+	updatedJSON, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	configKey, err := ctx.GetStub().CreateCompositeKey(configObjectType, []string{})
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(configKey, updatedJSON)
+}
+
+// Fails unless the percentages and amounts not validated with their section
+// are decimals of 0 or more, percentages at most 100
+func (c *LendingConfig) validateFigures() error {
+	rates := []Decimal{c.GoldLTV, c.CollateralLTV, c.PenalRate, c.CommitmentRate}
+	for _, rate := range c.PSLTargets {
+		rates = append(rates, rate)
+	}
+	for _, rate := range c.Provisioning {
+		rates = append(rates, rate)
+	}
+	for _, rate := range rates {
+		err := checkRate(rate, 100)
+		if err != nil {
+			return err
+		}
+	}
+
+	amounts := []token.Amount{}
+	for _, limit := range c.ApprovalLimits {
+		amounts = append(amounts, limit)
+	}
+	for _, product := range c.Products {
+		amounts = append(amounts, product.PSLMaxAmount)
+	}
+	for _, amount := range amounts {
+		err := checkAmount(amount)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
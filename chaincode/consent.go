@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Reference to an Account Aggregator consent artifact under which the lender
+// fetches the borrower's financial data. The artifact itself stays with the AA.
+type ConsentArtifact struct {
+	ConsentID   string `json:"consentId"`
+	ConsentHash string `json:"consentHash"` // hash of the signed artifact
+	ValidFrom   string `json:"validFrom"`   // RFC3339
+	ValidUntil  string `json:"validUntil"`  // RFC3339
+	AttachedAt  string `json:"attachedAt"`
+}
+
+// ============== Account Aggregator Consent ==============
+
+// Attach the borrower's AA consent to a pending loan application, called by
+// the organization operating the borrower's account
+func (s *SmartContract) AttachConsent(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	consentID string,
+	consentHash string,
+	validFrom string,
+	validUntil string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "AttachConsent")
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Status != "PENDING" {
+		return nil, fmt.Errorf("consent cannot be attached to loan %s in current status: %s", loanID, loan.Status)
+	}
+	if consentID == "" || consentHash == "" {
+		return nil, fmt.Errorf("consent ID and hash are required")
+	}
+
+	from, err := time.Parse(time.RFC3339, validFrom)
+	if err != nil {
+		return nil, fmt.Errorf("invalid consent start %s: %v", validFrom, err)
+	}
+	until, err := time.Parse(time.RFC3339, validUntil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid consent expiry %s: %v", validUntil, err)
+	}
+	if !until.After(from) {
+		return nil, fmt.Errorf("consent must expire after it starts")
+	}
+
+	borrower, err := s.accountOf(ctx, loan.BorrowerID)
+	if err != nil {
+		return nil, err
+	}
+	err = requireOperatorOf(ctx, borrower)
+	if err != nil {
+		return nil, err
+	}
+
+	attachedAt, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	loan.Consent = &ConsentArtifact{
+		ConsentID:   consentID,
+		ConsentHash: consentHash,
+		ValidFrom:   from.UTC().Format(time.RFC3339),
+		ValidUntil:  until.UTC().Format(time.RFC3339),
+		AttachedAt:  attachedAt.Format(time.RFC3339),
+	}
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("AA consent %s attached, valid until %s (TxID: %s)",
+			consentID,
+			loan.Consent.ValidUntil,
+			ctx.GetStub().GetTxID()))
+
+	return s.putLoanResult(ctx, loan)
+}
+
+// Fails unless the loan carries a consent valid at the transaction time
+func requireValidConsent(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+) error {
+	if loan.Consent == nil {
+		return fmt.Errorf("loan %s has no Account Aggregator consent", loan.LoanID)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	from, err := time.Parse(time.RFC3339, loan.Consent.ValidFrom)
+	if err != nil {
+		return err
+	}
+	until, err := time.Parse(time.RFC3339, loan.Consent.ValidUntil)
+	if err != nil {
+		return err
+	}
+	if now.Before(from) || !now.Before(until) {
+		return fmt.Errorf("consent %s of loan %s is not valid at %s", loan.Consent.ConsentID, loan.LoanID, now.Format(time.RFC3339))
+	}
+
+	return nil
+}
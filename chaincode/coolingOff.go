@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// ============== Cooling-Off Cancellation ==============
+
+// Cancel a disbursed loan within the configured cooling-off period. The
+// borrower returns the principal with interest for the days it was held,
+// less anything already repaid, and the loan is closed as CANCELLED.
+func (s *SmartContract) CancelWithinCoolingOff(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "CancelWithinCoolingOff")
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Status != "ACTIVE" {
+		return nil, fmt.Errorf("loan %s cannot be cancelled in current status: %s", loanID, loan.Status)
+	}
+
+	borrower, err := s.accountOf(ctx, loan.BorrowerID)
+	if err != nil {
+		return nil, err
+	}
+	err = requireOperatorOf(ctx, borrower)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	disbursedAt, ok := disbursementTime(loan)
+	if !ok {
+		return nil, fmt.Errorf("loan %s has no disbursement date", loanID)
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if now.After(disbursedAt.AddDate(0, 0, config.CoolingOffDays)) {
+		return nil, fmt.Errorf("loan %s is past its %d day cooling-off period", loanID, config.CoolingOffDays)
+	}
+
+	payoff := prepaymentPayoff(loan, now, config.Rounding)
+
+	if payoff.Sign() > 0 {
+		// Little can have been repaid within the period, so the interest
+		// accrued so far is taken as the interest part of the payoff
+		interest := ratMin(payoff, interestAccrued(loan, now, config.Rounding))
+		_, err = s.payLoanHolders(ctx, loan, loan.BorrowerID, payoff, interest, token.ReasonCoolingOff, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	loan.Status = "CANCELLED"
+	loan.RemainingBalance = zeroAmount
+	loan.ClosedAt = fmt.Sprintf("%d", now.Unix())
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Loan cancelled within cooling-off period, %s returned (TxID: %s)",
+			token.FormatAmount(payoff),
+			ctx.GetStub().GetTxID()))
+
+	err = s.releaseCollateral(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.putLoan(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+
+	return newLoanResult(ctx, loan), nil
+}
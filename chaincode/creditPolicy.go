@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Rules checked before a loan can be approved, a zero value disables a rule
+type CreditPolicy struct {
+	MinCreditScore    int     `json:"minCreditScore"`
+	MaxDebtToExposure Decimal `json:"maxDebtToExposure"` // outstanding debt incl. the new loan / exposure limit
+	MinKYCTier        int     `json:"minKycTier"`
+	NoActiveDefaults  bool    `json:"noActiveDefaults"`
+}
+
+type PolicyRuleResult struct {
+	Rule   string `json:"rule"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+}
+
+type BorrowerProfile struct {
+	BorrowerID    string       `json:"borrowerId"`
+	CreditScore   int          `json:"creditScore"`
+	KYCTier       int          `json:"kycTier"`
+	ExposureLimit token.Amount `json:"exposureLimit"`
+}
+
+const borrowerProfileObjectType = "profile"
+
+// ============== Borrower Profile Functions ==============
+
+func (s *SmartContract) SetBorrowerProfile(
+	ctx contractapi.TransactionContextInterface,
+	borrowerID string,
+	creditScore int,
+	kycTier int,
+	exposureLimit string,
+) error {
+	err := claimRequestID(ctx, "SetBorrowerProfile")
+	if err != nil {
+		return err
+	}
+	limit, err := parseAmount(exposureLimit)
+	if err != nil {
+		return err
+	}
+
+	err = requireRegulator(ctx)
+	if err != nil {
+		return err
+	}
+
+	profile := BorrowerProfile{
+		BorrowerID:    borrowerID,
+		CreditScore:   creditScore,
+		KYCTier:       kycTier,
+		ExposureLimit: token.NewAmount(limit),
+	}
+
+	profileJSON, err := json.Marshal(profile)
+	if err != nil {
+		return err
+	}
+
+	profileKey, err := ctx.GetStub().CreateCompositeKey(borrowerProfileObjectType, []string{borrowerID})
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(profileKey, profileJSON)
+}
+
+func (s *SmartContract) GetBorrowerProfile(
+	ctx contractapi.TransactionContextInterface,
+	borrowerID string,
+) (*BorrowerProfile, error) {
+	profileKey, err := ctx.GetStub().CreateCompositeKey(borrowerProfileObjectType, []string{borrowerID})
+	if err != nil {
+		return nil, err
+	}
+
+	profileJSON, err := ctx.GetStub().GetState(profileKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if profileJSON == nil {
+		return nil, fmt.Errorf("borrower profile %s does not exist", borrowerID)
+	}
+
+	var profile BorrowerProfile
+	err = json.Unmarshal(profileJSON, &profile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &profile, nil
+}
+
+// ============== Credit Policy Evaluation ==============
+
+// Evaluates every enabled rule of the configured policy against the loan's borrower
+func (s *SmartContract) evaluateCreditPolicy(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+) ([]PolicyRuleResult, error) {
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	policy := config.CreditPolicy
+
+	// Exposure and defaults cover every account of the same physical borrower
+	linked, err := s.linkedBorrowers(ctx, loan.BorrowerID)
+	if err != nil {
+		return nil, err
+	}
+
+	borrowerLoans := []*Loan{}
+	for _, borrowerID := range linked {
+		loans, err := s.getIndexedLoans(ctx, borrowerLoanIndex, borrowerID)
+		if err != nil {
+			return nil, err
+		}
+		borrowerLoans = append(borrowerLoans, loans...)
+	}
+
+	// Profile is only required by the rules that read from it
+	profile, profileErr := s.linkedProfile(ctx, loan.BorrowerID, linked)
+
+	results := []PolicyRuleResult{}
+
+	// Gold loans must stay within the gold loan to value norm
+	if loan.Gold != nil {
+		result := PolicyRuleResult{Rule: "GOLD_LTV"}
+		rate, err := s.GetGoldRate(ctx)
+		if err != nil {
+			result.Detail = err.Error()
+		} else {
+			result.Passed = valueGold(loan, rate, config.GoldLTV, loan.Amount)
+			result.Detail = fmt.Sprintf("loan %s against gold valued %s, maximum LTV %s%%", loan.Amount, loan.Gold.Value, config.GoldLTV)
+		}
+		results = append(results, result)
+	}
+
+	// Registry assets are valued together, their total must cover the loan
+	if len(loan.Pledges) > 0 {
+		result := PolicyRuleResult{Rule: "COLLATERAL_LTV"}
+		value, err := s.pledgedValue(ctx, loan, "")
+		if err != nil {
+			result.Detail = err.Error()
+		} else {
+			result.Passed = loan.Amount.Rat().Cmp(percentOf(value, config.CollateralLTV.Rat())) <= 0
+			result.Detail = fmt.Sprintf("loan %s against collateral valued %s, maximum LTV %s%%", loan.Amount, token.FormatAmount(value), config.CollateralLTV)
+		}
+		results = append(results, result)
+	}
+
+	if policy.MinCreditScore > 0 {
+		result := PolicyRuleResult{Rule: "MIN_CREDIT_SCORE"}
+		if profileErr != nil {
+			result.Detail = profileErr.Error()
+		} else {
+			result.Passed = profile.CreditScore >= policy.MinCreditScore
+			result.Detail = fmt.Sprintf("credit score %d, minimum %d", profile.CreditScore, policy.MinCreditScore)
+		}
+		results = append(results, result)
+	}
+
+	if policy.MaxDebtToExposure.Rat().Sign() > 0 {
+		result := PolicyRuleResult{Rule: "MAX_DEBT_TO_EXPOSURE"}
+		if profileErr != nil {
+			result.Detail = profileErr.Error()
+		} else if profile.ExposureLimit.Rat().Sign() <= 0 {
+			result.Detail = fmt.Sprintf("borrower %s has no exposure limit", loan.BorrowerID)
+		} else {
+			debt := loan.Amount.Rat()
+			for _, other := range borrowerLoans {
+				if other.LoanID != loan.LoanID && isOutstanding(other) {
+					debt = ratAdd(debt, other.RemainingBalance.Rat())
+				}
+			}
+			ratio := ratQuo(debt, profile.ExposureLimit.Rat())
+			result.Passed = ratio.Cmp(policy.MaxDebtToExposure.Rat()) <= 0
+			result.Detail = fmt.Sprintf("debt to exposure %s, maximum %s", ratio.FloatString(rateScale), policy.MaxDebtToExposure)
+		}
+		results = append(results, result)
+	}
+
+	if policy.MinKYCTier > 0 {
+		result := PolicyRuleResult{Rule: "MIN_KYC_TIER"}
+		if profileErr != nil {
+			result.Detail = profileErr.Error()
+		} else {
+			result.Passed = profile.KYCTier >= policy.MinKYCTier
+			result.Detail = fmt.Sprintf("KYC tier %d, minimum %d", profile.KYCTier, policy.MinKYCTier)
+		}
+		results = append(results, result)
+	}
+
+	if policy.NoActiveDefaults {
+		defaulted := []string{}
+		for _, other := range borrowerLoans {
+			if other.Status == "DEFAULTED" {
+				defaulted = append(defaulted, other.LoanID)
+			}
+		}
+		result := PolicyRuleResult{Rule: "NO_ACTIVE_DEFAULTS", Passed: len(defaulted) == 0}
+		if result.Passed {
+			result.Detail = "no defaulted loans"
+		} else {
+			result.Detail = "defaulted loans: " + strings.Join(defaulted, ", ")
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// The borrower's profile scored at the lowest credit score of its linked
+// accounts, so a poor record under another account ID is not escaped
+func (s *SmartContract) linkedProfile(
+	ctx contractapi.TransactionContextInterface,
+	borrowerID string,
+	linked []string,
+) (*BorrowerProfile, error) {
+	profile, err := s.GetBorrowerProfile(ctx, borrowerID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, linkedID := range linked {
+		if linkedID == borrowerID {
+			continue
+		}
+		var linkedProfile BorrowerProfile
+		exists, err := getRecord(ctx, borrowerProfileObjectType, []string{linkedID}, &linkedProfile)
+		if err != nil {
+			return nil, err
+		}
+		if exists && linkedProfile.CreditScore < profile.CreditScore {
+			profile.CreditScore = linkedProfile.CreditScore
+		}
+	}
+
+	return profile, nil
+}
+
+// Loans that still carry borrower debt
+func isOutstanding(loan *Loan) bool {
+	return loan.Status == "APPROVED" || loan.Status == "ACTIVE" || loan.Status == "DEFAULTED"
+}
+
+func failedRules(results []PolicyRuleResult) []string {
+	failed := []string{}
+	for _, result := range results {
+		if !result.Passed {
+			failed = append(failed, result.Rule)
+		}
+	}
+	return failed
+}
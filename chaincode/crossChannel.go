@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Instruction for a loan's cash leg to be settled on another channel. The loan
+// stays SETTLING until a settlement organization confirms it.
+type SettlementInstruction struct {
+	CorrelationID  string       `json:"correlationId"`
+	LoanID         string       `json:"loanId"`
+	Channel        string       `json:"channel"`
+	From           string       `json:"from"`
+	To             string       `json:"to"`
+	Amount         token.Amount `json:"amount"`
+	Status         string       `json:"status"` // PENDING, CONFIRMED
+	CreatedAt      string       `json:"createdAt"`
+	ConfirmedAt    string       `json:"confirmedAt"`
+	ExternalTxID   string       `json:"externalTxId"` // settling transaction on the other channel
+	ConfirmedBy    string       `json:"confirmedBy"`
+	ConfirmedByMSP string       `json:"confirmedByMsp"`
+}
+
+const settlementObjectType = "settlement"
+
+// ============== Cross-Channel Settlement ==============
+
+// Disburse an approved loan whose funds move on another channel. Returns the
+// correlation ID the settlement confirmation must quote.
+func (s *SmartContract) DisburseLoanCrossChannel(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	settlementChannel string,
+) (string, error) {
+	err := claimRequestID(ctx, "DisburseLoanCrossChannel")
+	if err != nil {
+		return "", err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return "", err
+	}
+
+	if loan.Status != "APPROVED" {
+		return "", fmt.Errorf("loan %s cannot be disbursed in current status: %s", loanID, loan.Status)
+	}
+	if settlementChannel == "" || settlementChannel == ctx.GetStub().GetChannelID() {
+		return "", fmt.Errorf("settlement channel must differ from the current channel")
+	}
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+	err = requireApprovalCurrent(ctx, loan, config)
+	if err != nil {
+		return "", err
+	}
+	err = repriceFloatingRate(ctx, loan, config)
+	if err != nil {
+		return "", err
+	}
+
+	createdAt, err := txTime(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	instruction := SettlementInstruction{
+		CorrelationID: ctx.GetStub().GetTxID(),
+		LoanID:        loanID,
+		Channel:       settlementChannel,
+		From:          loan.LenderID,
+		To:            loan.BorrowerID,
+		Amount:        loan.Amount,
+		Status:        "PENDING",
+		CreatedAt:     createdAt.Format(time.RFC3339),
+	}
+
+	err = s.putSettlementInstruction(ctx, &instruction)
+	if err != nil {
+		return "", err
+	}
+
+	// The funds move on the settlement channel, those reserved here are freed
+	_, err = s.releaseReservation(ctx, loan)
+	if err != nil {
+		return "", err
+	}
+	err = s.dequeueApplication(ctx, loan)
+	if err != nil {
+		return "", err
+	}
+
+	loan.Status = "SETTLING"
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Settlement instruction %s issued on channel %s (TxID: %s)",
+			instruction.CorrelationID,
+			settlementChannel,
+			ctx.GetStub().GetTxID()))
+
+	err = s.putLoan(ctx, loan)
+	if err != nil {
+		return "", err
+	}
+
+	return instruction.CorrelationID, nil
+}
+
+// Confirm a cross-channel settlement, submitted by a settlement organization,
+// which activates the loan
+func (s *SmartContract) ConfirmSettlement(
+	ctx contractapi.TransactionContextInterface,
+	correlationID string,
+	externalTxID string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "ConfirmSettlement")
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	authorized := false
+	for _, settlementMSP := range config.SettlementMSPs {
+		if settlementMSP == mspID {
+			authorized = true
+		}
+	}
+	if !authorized {
+		return nil, fmt.Errorf("caller from %s is not authorized to confirm settlements", mspID)
+	}
+
+	instruction, err := s.GetSettlementInstruction(ctx, correlationID)
+	if err != nil {
+		return nil, err
+	}
+	if instruction.Status != "PENDING" {
+		return nil, fmt.Errorf("settlement %s is already %s", correlationID, instruction.Status)
+	}
+
+	loan, err := s.getLoan(ctx, instruction.LoanID)
+	if err != nil {
+		return nil, err
+	}
+	if loan.Status != "SETTLING" {
+		return nil, fmt.Errorf("loan %s is not awaiting settlement, current status: %s", loan.LoanID, loan.Status)
+	}
+
+	confirmedAt, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	confirmedBy, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	instruction.Status = "CONFIRMED"
+	instruction.ConfirmedAt = confirmedAt.Format(time.RFC3339)
+	instruction.ExternalTxID = externalTxID
+	instruction.ConfirmedBy = confirmedBy
+	instruction.ConfirmedByMSP = mspID
+
+	err = s.putSettlementInstruction(ctx, instruction)
+	if err != nil {
+		return nil, err
+	}
+
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Loan disbursed, settlement %s confirmed by %s with external tx %s (TxID: %s)",
+			correlationID,
+			mspID,
+			externalTxID,
+			ctx.GetStub().GetTxID()))
+
+	return s.activateLoan(ctx, loan, nil)
+}
+
+func (s *SmartContract) GetSettlementInstruction(
+	ctx contractapi.TransactionContextInterface,
+	correlationID string,
+) (*SettlementInstruction, error) {
+	instructionKey, err := ctx.GetStub().CreateCompositeKey(settlementObjectType, []string{correlationID})
+	if err != nil {
+		return nil, err
+	}
+
+	instructionJSON, err := ctx.GetStub().GetState(instructionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if instructionJSON == nil {
+		return nil, fmt.Errorf("settlement %s does not exist", correlationID)
+	}
+
+	var instruction SettlementInstruction
+	err = json.Unmarshal(instructionJSON, &instruction)
+	if err != nil {
+		return nil, err
+	}
+
+	return &instruction, nil
+}
+
+func (s *SmartContract) putSettlementInstruction(
+	ctx contractapi.TransactionContextInterface,
+	instruction *SettlementInstruction,
+) error {
+	instructionJSON, err := json.Marshal(instruction)
+	if err != nil {
+		return err
+	}
+
+	instructionKey, err := ctx.GetStub().CreateCompositeKey(settlementObjectType, []string{instruction.CorrelationID})
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(instructionKey, instructionJSON)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// A borrower's dispute of a loan, kept on the loan until the next one is raised
+type LoanDispute struct {
+	Reason      string `json:"reason"`
+	RaisedAt    string `json:"raisedAt"`
+	RaisedBy    string `json:"raisedBy"` // MSP ID of the borrower's organization
+	Status      string `json:"status"`   // OPEN, RESPONDED, RESOLVED
+	Response    string `json:"response,omitempty" metadata:",optional"`
+	RespondedAt string `json:"respondedAt,omitempty" metadata:",optional"`
+	Outcome     string `json:"outcome,omitempty" metadata:",optional"` // UPHELD, DISMISSED
+	Resolution  string `json:"resolution,omitempty" metadata:",optional"`
+	ResolvedBy  string `json:"resolvedBy,omitempty" metadata:",optional"`
+	ResolvedAt  string `json:"resolvedAt,omitempty" metadata:",optional"`
+}
+
+// Dispute statuses and outcomes
+const (
+	disputeOpen      = "OPEN"
+	disputeResponded = "RESPONDED"
+	disputeResolved  = "RESOLVED"
+
+	disputeUpheld    = "UPHELD"
+	disputeDismissed = "DISMISSED"
+)
+
+// Index of loans with an unresolved dispute
+const openDisputeIndex = "dispute~loan"
+
+// ============== Dispute Functions ==============
+
+// Raise a dispute on an active or defaulted loan, called by the organization
+// operating the borrower's account. Until it is resolved the loan cannot be
+// marked as defaulted nor its collateral enforced.
+func (s *SmartContract) RaiseDispute(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	reason string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "RaiseDispute")
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Status != "ACTIVE" && loan.Status != "DEFAULTED" {
+		return nil, fmt.Errorf("loan %s cannot be disputed in current status: %s", loanID, loan.Status)
+	}
+	if reason == "" {
+		return nil, fmt.Errorf("dispute reason is required")
+	}
+	if disputeUnresolved(loan) {
+		return nil, fmt.Errorf("loan %s already has an open dispute", loanID)
+	}
+
+	borrower, err := s.accountOf(ctx, loan.BorrowerID)
+	if err != nil {
+		return nil, err
+	}
+	err = requireOperatorOf(ctx, borrower)
+	if err != nil {
+		return nil, err
+	}
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	raisedAt, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	loan.Dispute = &LoanDispute{
+		Reason:   reason,
+		RaisedAt: raisedAt.Format(time.RFC3339),
+		RaisedBy: mspID,
+		Status:   disputeOpen,
+	}
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Dispute raised by %s: %s (TxID: %s)",
+			mspID,
+			reason,
+			ctx.GetStub().GetTxID()))
+
+	err = s.putIndex(ctx, openDisputeIndex, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.putLoanResult(ctx, loan)
+}
+
+// Record the lender's response to an open dispute, called by the
+// organization operating the lender's account
+func (s *SmartContract) RespondToDispute(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	response string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "RespondToDispute")
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !disputeUnresolved(loan) {
+		return nil, fmt.Errorf("loan %s has no open dispute", loanID)
+	}
+	if response == "" {
+		return nil, fmt.Errorf("dispute response is required")
+	}
+
+	err = s.requireLender(ctx, loan.LenderID)
+	if err != nil {
+		return nil, err
+	}
+
+	respondedAt, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	loan.Dispute.Status = disputeResponded
+	loan.Dispute.Response = response
+	loan.Dispute.RespondedAt = respondedAt.Format(time.RFC3339)
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Lender responded to dispute: %s (TxID: %s)",
+			response,
+			ctx.GetStub().GetTxID()))
+
+	return s.putLoanResult(ctx, loan)
+}
+
+// Resolve a loan's dispute as UPHELD or DISMISSED, called by the regulator
+// or a configured arbiter. Resolution lifts the freeze on the loan, any
+// correction an upheld dispute calls for is made by its own transaction.
+func (s *SmartContract) ResolveDispute(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	outcome string,
+	resolution string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "ResolveDispute")
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mspID, err := requireArbiter(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if outcome != disputeUpheld && outcome != disputeDismissed {
+		return nil, fmt.Errorf("invalid dispute outcome %s, must be %s or %s", outcome, disputeUpheld, disputeDismissed)
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !disputeUnresolved(loan) {
+		return nil, fmt.Errorf("loan %s has no open dispute", loanID)
+	}
+
+	resolvedAt, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	loan.Dispute.Status = disputeResolved
+	loan.Dispute.Outcome = outcome
+	loan.Dispute.Resolution = resolution
+	loan.Dispute.ResolvedBy = mspID
+	loan.Dispute.ResolvedAt = resolvedAt.Format(time.RFC3339)
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Dispute %s by %s: %s (TxID: %s)",
+			outcome,
+			mspID,
+			resolution,
+			ctx.GetStub().GetTxID()))
+
+	err = s.deleteIndex(ctx, openDisputeIndex, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.putLoanResult(ctx, loan)
+}
+
+// ============== Dispute Queries ==============
+
+// List loans with an unresolved dispute, a page at a time
+func (s *SmartContract) GetDisputedLoans(
+	ctx contractapi.TransactionContextInterface,
+	pageSize int32,
+	bookmark string,
+) (*LoanPage, error) {
+	return s.getIndexedLoanPage(ctx, openDisputeIndex, []string{}, pageSize, bookmark)
+}
+
+func disputeUnresolved(loan *Loan) bool {
+	return loan.Dispute != nil && loan.Dispute.Status != disputeResolved
+}
+
+// Fails while the loan is under dispute, guarding the transactions that
+// enforce against the borrower
+func requireNoOpenDispute(loan *Loan) error {
+	if disputeUnresolved(loan) {
+		return fmt.Errorf("loan %s is under dispute since %s", loan.LoanID, loan.Dispute.RaisedAt)
+	}
+	return nil
+}
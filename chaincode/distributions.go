@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Interest of a loan received in one month and paid out to its unit holders
+type IncomeDistribution struct {
+	LoanID         string                `json:"loanId"`
+	Period         string                `json:"period"` // YYYY-MM
+	Interest       token.Amount          `json:"interest"`
+	Payments       []DistributionPayment `json:"payments"`
+	DistributedAt  string                `json:"distributedAt"`
+	DistributedBy  string                `json:"distributedBy"`
+	RepaymentCount int                   `json:"repaymentCount"`
+	TxID           string                `json:"txId"`
+}
+
+// A page of a loan's distributions
+type DistributionPage struct {
+	Distributions []*IncomeDistribution `json:"distributions"`
+	Bookmark      string                `json:"bookmark"` // empty on the last page
+}
+
+// A unit holder's share of a distribution, the issuer's share stays with it
+type DistributionPayment struct {
+	Holder string       `json:"holder"`
+	Units  int          `json:"units"`
+	Amount token.Amount `json:"amount"`
+}
+
+const distributionObjectType = "distribution"
+
+// ============== Income Distribution ==============
+
+// Pay the interest a PERIODIC participation loan received in period (YYYY-MM)
+// to its unit holders pro rata, by the units held when distributing. Called
+// by the organization operating the issuer's account once the period is over,
+// each period is distributed once.
+func (s *SmartContract) DistributeIncome(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	period string,
+) (*IncomeDistribution, error) {
+	err := claimRequestID(ctx, "DistributeIncome")
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := s.GetParticipations(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	if table.Distribution != distributePeriodic {
+		return nil, fmt.Errorf("loan %s pays its unit holders as it is repaid, there is no income to distribute", loanID)
+	}
+
+	issuer, err := s.accountOf(ctx, table.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	err = requireOperatorOf(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	start, err := time.Parse(indexMonthLayout, period)
+	if err != nil {
+		return nil, fmt.Errorf("invalid period %s, expected YYYY-MM", period)
+	}
+	end := start.AddDate(0, 1, 0)
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if now.Before(end) {
+		return nil, fmt.Errorf("period %s has not ended", period)
+	}
+
+	var existing IncomeDistribution
+	exists, err := getRecord(ctx, distributionObjectType, []string{loanID, period}, &existing)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, fmt.Errorf("income of loan %s for %s was distributed by transaction %s", loanID, period, existing.TxID)
+	}
+
+	// Interest received before the units were issued belonged to the issuer alone
+	issuedAt, err := time.Parse(time.RFC3339, table.IssuedAt)
+	if err != nil {
+		return nil, err
+	}
+	if issuedAt.After(start) {
+		start = issuedAt
+	}
+
+	interest, count, err := s.interestReceived(ctx, loanID, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	distribution := IncomeDistribution{
+		LoanID:         loanID,
+		Period:         period,
+		Interest:       token.NewAmount(interest),
+		Payments:       []DistributionPayment{},
+		DistributedAt:  now.Format(time.RFC3339),
+		DistributedBy:  table.Issuer,
+		RepaymentCount: count,
+		TxID:           ctx.GetStub().GetTxID(),
+	}
+
+	for _, share := range table.split(interest) {
+		distribution.Payments = append(distribution.Payments, DistributionPayment{
+			Holder: share.Holder,
+			Units:  table.Holdings[share.Holder],
+			Amount: token.NewAmount(share.Amount),
+		})
+		if share.Holder == table.Issuer || share.Amount.Sign() == 0 {
+			continue
+		}
+		_, err = s.settle(ctx, table.Issuer, share.Holder, share.Amount, token.ReasonDistribution, loanID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = putRecord(ctx, distributionObjectType, []string{loanID, period}, distribution)
+	if err != nil {
+		return nil, err
+	}
+
+	return &distribution, nil
+}
+
+// Distributions of a loan's income, oldest period first, a page at a time
+func (s *SmartContract) GetDistributionHistory(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	pageSize int32,
+	bookmark string,
+) (*DistributionPage, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive")
+	}
+	bookmark, err := token.DecodeBookmark(bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(distributionObjectType, []string{loanID}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	page := DistributionPage{Distributions: []*IncomeDistribution{}}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var distribution IncomeDistribution
+		err = json.Unmarshal(entry.Value, &distribution)
+		if err != nil {
+			return nil, err
+		}
+		page.Distributions = append(page.Distributions, &distribution)
+	}
+
+	page.Bookmark = token.EncodeBookmark(nextBookmark(metadata.GetFetchedRecordsCount(), pageSize, metadata.GetBookmark()))
+	return &page, nil
+}
+
+// Interest part of the loan's repayments paid in [start, end), from their
+// receipts, and the number of those repayments
+func (s *SmartContract) interestReceived(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	start time.Time,
+	end time.Time,
+) (*big.Rat, int, error) {
+	repayments, err := s.getRepayments(ctx, loanID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	interest := new(big.Rat)
+	count := 0
+	for _, repayment := range repayments {
+		paidAt, err := time.Parse(time.RFC3339, repayment.PaidAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		if paidAt.Before(start) || !paidAt.Before(end) {
+			continue
+		}
+
+		receipt, err := s.GetReceipt(ctx, repayment.RepaymentID)
+		if err != nil {
+			return nil, 0, err
+		}
+		interest.Add(interest, receipt.Components.Interest.Rat())
+		count++
+	}
+
+	return config.Rounding.round(interest), count, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// An ACTIVE loan whose repayment falls due soon, for borrower reminders
+type UpcomingDue struct {
+	LoanID       string       `json:"loanId"`
+	BorrowerID   string       `json:"borrowerId"`
+	LenderID     string       `json:"lenderId"`
+	DueDate      string       `json:"dueDate"`
+	DaysUntilDue int          `json:"daysUntilDue"` // whole UTC days, 0 when due today
+	AmountDue    token.Amount `json:"amountDue"`    // remaining balance
+}
+
+// Dues found by a NotifyUpcomingDues call, call again with Bookmark until it
+// is empty
+type UpcomingDuePage struct {
+	Dues     []*UpcomingDue `json:"dues"`
+	Bookmark string         `json:"bookmark"`
+}
+
+// ============== Due Reminders ==============
+
+// Find the ACTIVE loans of the next pageSize due date index entries falling
+// due within daysAhead days of the transaction date and emit them in a
+// LoanDuesUpcoming event for the notification service. Fabric keeps a single
+// event per transaction, so the event lists a due per loan of the page.
+// Keeper only. Loans disbursed before the due date index existed are not
+// found.
+func (s *SmartContract) NotifyUpcomingDues(
+	ctx contractapi.TransactionContextInterface,
+	daysAhead int,
+	pageSize int,
+	bookmark string,
+) (*UpcomingDuePage, error) {
+	err := claimRequestID(ctx, "NotifyUpcomingDues")
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keeperMSP, err := requireKeeper(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	keeperID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if daysAhead < 0 {
+		return nil, fmt.Errorf("days ahead must not be negative")
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	until := today.AddDate(0, 0, daysAhead+1).Add(-time.Second)
+
+	page, err := s.upcomingDues(ctx, today, until, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+	if len(page.Dues) == 0 {
+		return page, nil
+	}
+
+	return page, emitEvent(ctx, eventLoanDuesUpcoming, LoanDuesUpcomingEventV2{
+		SchemaVersion: 2,
+		TxID:          ctx.GetStub().GetTxID(),
+		Timestamp:     now.Format(time.RFC3339),
+		SubmitterMSP:  keeperMSP,
+		SubmitterID:   keeperID,
+		DaysAhead:     daysAhead,
+		Dues:          page.Dues,
+	})
+}
+
+// Walks up to pageSize entries of the month buckets of the due date index
+// from today to until. The bookmark is that of getIndexedLoanBatch, whose
+// first attribute is the month; a bookmark of a month alone starts at that
+// month's first entry. Entries due before today are skipped by key.
+func (s *SmartContract) upcomingDues(
+	ctx contractapi.TransactionContextInterface,
+	today time.Time,
+	until time.Time,
+	pageSize int,
+	bookmark string,
+) (*UpcomingDuePage, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive")
+	}
+	startInstant := today.Format(indexInstantLayout)
+	endInstant := until.Format(indexInstantLayout)
+
+	month := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if bookmark == "" {
+		bookmark = month.Format(indexMonthLayout) + "|" + startInstant
+	} else {
+		var err error
+		month, err = time.Parse(indexMonthLayout, strings.SplitN(bookmark, "|", 2)[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid bookmark %s", bookmark)
+		}
+	}
+
+	page := UpcomingDuePage{Dues: []*UpcomingDue{}}
+	read := 0
+	for !month.After(until) {
+		if read == pageSize {
+			page.Bookmark = month.Format(indexMonthLayout)
+			return &page, nil
+		}
+		loans, next, err := s.getIndexedLoanBatch(ctx, dueLoanIndex, []string{month.Format(indexMonthLayout)}, pageSize-read, bookmark)
+		if err != nil {
+			return nil, err
+		}
+		read += len(loans)
+
+		for _, loan := range loans {
+			if loan.Status != "ACTIVE" || loan.RemainingBalance.Rat().Sign() <= 0 {
+				continue
+			}
+			dueDate, err := time.Parse(time.RFC3339, loan.DueDate)
+			if err != nil {
+				return nil, fmt.Errorf("invalid due date %s of loan %s: %v", loan.DueDate, loan.LoanID, err)
+			}
+			dueDate = dueDate.UTC()
+			instant := dueDate.Format(indexInstantLayout)
+			if instant < startInstant || instant > endInstant {
+				continue
+			}
+
+			dueDay := time.Date(dueDate.Year(), dueDate.Month(), dueDate.Day(), 0, 0, 0, 0, time.UTC)
+			page.Dues = append(page.Dues, &UpcomingDue{
+				LoanID:       loan.LoanID,
+				BorrowerID:   loan.BorrowerID,
+				LenderID:     loan.LenderID,
+				DueDate:      loan.DueDate,
+				DaysUntilDue: int(dueDay.Sub(today).Hours() / 24),
+				AmountDue:    loan.RemainingBalance,
+			})
+		}
+		if next != "" {
+			page.Bookmark = next
+			return &page, nil
+		}
+
+		month = month.AddDate(0, 1, 0)
+		bookmark = ""
+	}
+
+	return &page, nil
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Chaincode event names, suffixed with the version of their payload schema.
+//
+// Compatibility rules for the payloads below:
+//   - a published version only gains new optional fields, existing fields are
+//     never removed, renamed or retyped, so decoding with an older struct keeps
+//     working across chaincode upgrades
+//   - any other change is published as a new struct (LoanApprovedEventV2) under
+//     a new event name, and consumers opt in by listening for it
+//
+// Version 2 of the events carrying amounts or rates has them as exact decimal
+// strings, "1500.25" and "8.5000", where version 1 had JSON numbers.
+//
+// Fabric keeps a single event per transaction, each transaction emits the event
+// of its final loan state change. Token movements settling a loan ride along in
+// that event's Transfer field instead of a TokenTransfer.v1 event.
+const (
+	eventLoanRequested = "LoanRequested.v2"
+	eventLoanApproved  = "LoanApproved.v2"
+	eventLoanRejected  = "LoanRejected.v1"
+	eventLoanDisbursed = "LoanDisbursed.v2"
+	eventLoanRepaid    = "LoanRepaid.v2"
+	eventLoanDefaulted = "LoanDefaulted.v2"
+
+	eventLoanApprovalExpired   = "LoanApprovalExpired.v2"
+	eventLoanTrancheDisbursed  = "LoanTrancheDisbursed.v2"
+	eventLoanClaimTransferred  = "LoanClaimTransferred.v1"
+	eventLoanNovated           = "LoanNovated.v2"
+	eventLoanApprovalEscalated = "LoanApprovalEscalated.v2"
+	eventLoanDuesUpcoming      = "LoanDuesUpcoming.v2"
+	eventLoanRateReset         = "LoanRateReset.v2"
+	eventDayProcessed          = "DayProcessed.v2"
+
+	eventApplicationSLABreached = "ApplicationSLABreached.v2"
+	eventReportGenerated        = "ReportGenerated.v1"
+)
+
+// Fields common to every loan event payload
+type LoanEventHeader struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	LoanID        string `json:"loanId"`
+	TxID          string `json:"txId"`
+	Timestamp     string `json:"timestamp"`    // RFC3339 transaction time
+	SubmitterMSP  string `json:"submitterMsp"` // organization of the identity that submitted the transaction
+	SubmitterID   string `json:"submitterId"`  // client identity that submitted the transaction
+}
+
+// LoanRequested.v2
+type LoanRequestedEventV2 struct {
+	LoanEventHeader
+	BorrowerID   string       `json:"borrowerId"`
+	Amount       token.Amount `json:"amount"`
+	InterestRate Decimal      `json:"interestRate"`
+	Duration     int          `json:"duration"`
+	Product      string       `json:"product,omitempty"`
+}
+
+// LoanApproved.v2
+type LoanApprovedEventV2 struct {
+	LoanEventHeader
+	BorrowerID string       `json:"borrowerId"`
+	LenderID   string       `json:"lenderId"`
+	Amount     token.Amount `json:"amount"`
+}
+
+// LoanRejected.v1, FailedRules lists the credit policy rules that did not pass
+type LoanRejectedEventV1 struct {
+	LoanEventHeader
+	BorrowerID  string   `json:"borrowerId"`
+	LenderID    string   `json:"lenderId"`
+	FailedRules []string `json:"failedRules"`
+	ReasonCode  string   `json:"reasonCode,omitempty"`
+}
+
+// LoanDisbursed.v2
+type LoanDisbursedEventV2 struct {
+	LoanEventHeader
+	BorrowerID string              `json:"borrowerId"`
+	LenderID   string              `json:"lenderId"`
+	Amount     token.Amount        `json:"amount"`
+	DueDate    string              `json:"dueDate"`
+	Transfer   *token.TokenEventV1 `json:"transfer,omitempty"` // absent when settled on another channel
+}
+
+// LoanRepaid.v2, emitted for every repayment, Closed is set by the final one
+type LoanRepaidEventV2 struct {
+	LoanEventHeader
+	ReceiptID        string              `json:"receiptId"` // also the repayment ID
+	Amount           token.Amount        `json:"amount"`
+	PaymentReference string              `json:"paymentReference"`
+	RemainingBalance token.Amount        `json:"remainingBalance"`
+	Closed           bool                `json:"closed"`
+	Rebate           token.Amount        `json:"rebate,omitempty"`   // unaccrued interest waived on early closure
+	Withheld         token.Amount        `json:"withheld,omitempty"` // TDS paid to the tax account
+	Transfer         *token.TokenEventV1 `json:"transfer,omitempty"`
+}
+
+// LoanDefaulted.v2
+type LoanDefaultedEventV2 struct {
+	LoanEventHeader
+	BorrowerID       string       `json:"borrowerId"`
+	LenderID         string       `json:"lenderId"`
+	RemainingBalance token.Amount `json:"remainingBalance"`
+	ReasonCode       string       `json:"reasonCode,omitempty"`
+	DaysPastDue      int          `json:"daysPastDue,omitempty"`
+}
+
+// LoanApprovalExpired.v2
+type LoanApprovalExpiredEventV2 struct {
+	LoanEventHeader
+	BorrowerID string       `json:"borrowerId"`
+	LenderID   string       `json:"lenderId"`
+	Amount     token.Amount `json:"amount"`
+}
+
+// LoanTrancheDisbursed.v2, Tranche numbers the tranches of the loan from 1
+type LoanTrancheDisbursedEventV2 struct {
+	LoanEventHeader
+	BorrowerID   string              `json:"borrowerId"`
+	LenderID     string              `json:"lenderId"`
+	Tranche      int                 `json:"tranche"`
+	TrancheID    string              `json:"trancheId"`
+	Amount       token.Amount        `json:"amount"`
+	Disbursed    token.Amount        `json:"disbursed"`
+	Sanctioned   token.Amount        `json:"sanctioned"`
+	BlendedRate  Decimal             `json:"blendedRate"`
+	RepaymentDue token.Amount        `json:"repaymentDue"`
+	DueDate      string              `json:"dueDate"`
+	Transfer     *token.TokenEventV1 `json:"transfer,omitempty"`
+}
+
+// LoanClaimTransferred.v1, From and To are the previous and new claim owners
+type LoanClaimTransferredEventV1 struct {
+	LoanEventHeader
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// LoanNovated.v2, the loan's obligation moved from one borrower to another
+type LoanNovatedEventV2 struct {
+	LoanEventHeader
+	FromBorrowerID   string       `json:"fromBorrowerId"`
+	ToBorrowerID     string       `json:"toBorrowerId"`
+	LenderID         string       `json:"lenderId"`
+	RemainingBalance token.Amount `json:"remainingBalance"`
+}
+
+// Emitted instead of LoanApproved.v2 when the approval exceeds the officer's
+// authority and waits for a second officer
+type LoanApprovalEscalatedEventV2 struct {
+	LoanEventHeader
+	LenderID   string       `json:"lenderId"`
+	Amount     token.Amount `json:"amount"`
+	MakerID    string       `json:"makerId"`
+	MakerLimit token.Amount `json:"makerLimit"`
+}
+
+// LoanRateReset.v2, a floating rate loan repriced at its benchmark's fixing,
+// the installments changing and the maturity kept
+type LoanRateResetEventV2 struct {
+	LoanEventHeader
+	BorrowerID       string       `json:"borrowerId"`
+	LenderID         string       `json:"lenderId"`
+	Benchmark        string       `json:"benchmark"`
+	OldRate          Decimal      `json:"oldRate"`
+	NewRate          Decimal      `json:"newRate"`
+	OldInstallment   token.Amount `json:"oldInstallment"`
+	NewInstallment   token.Amount `json:"newInstallment"`
+	RemainingBalance token.Amount `json:"remainingBalance"`
+	Maturity         string       `json:"maturity"`
+}
+
+// LoanDuesUpcoming.v2, one entry per loan falling due within DaysAhead days
+type LoanDuesUpcomingEventV2 struct {
+	SchemaVersion int            `json:"schemaVersion"`
+	TxID          string         `json:"txId"`
+	Timestamp     string         `json:"timestamp"`
+	SubmitterMSP  string         `json:"submitterMsp"`
+	SubmitterID   string         `json:"submitterId"`
+	DaysAhead     int            `json:"daysAhead"`
+	Dues          []*UpcomingDue `json:"dues"`
+}
+
+// DayProcessed.v2, the outcome of a page of daily servicing
+type DayProcessedEventV2 struct {
+	SchemaVersion int                  `json:"schemaVersion"`
+	TxID          string               `json:"txId"`
+	Timestamp     string               `json:"timestamp"`
+	SubmitterMSP  string               `json:"submitterMsp"`
+	SubmitterID   string               `json:"submitterId"`
+	AsOfDate      string               `json:"asOfDate"`
+	Processed     int                  `json:"processed"`
+	Overdue       int                  `json:"overdue"`
+	PenalCharged  token.Amount         `json:"penalCharged"`
+	Collections   []*MandateCollection `json:"collections"`
+}
+
+// ApplicationSLABreached.v2, the applications newly past their stage's turnaround time
+type ApplicationSLABreachedEventV2 struct {
+	SchemaVersion int                   `json:"schemaVersion"`
+	TxID          string                `json:"txId"`
+	Timestamp     string                `json:"timestamp"`
+	SubmitterMSP  string                `json:"submitterMsp"`
+	SubmitterID   string                `json:"submitterId"`
+	Breaches      []*PendingApplication `json:"breaches"`
+}
+
+// ReportGenerated.v1, ReportHash is the hex SHA-256 of the JSON the report
+// function returned, Parameters its arguments by name
+type ReportGeneratedEventV1 struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	TxID          string            `json:"txId"`
+	Timestamp     string            `json:"timestamp"`
+	SubmitterMSP  string            `json:"submitterMsp"`
+	SubmitterID   string            `json:"submitterId"`
+	Report        string            `json:"report"` // name of the report function
+	Parameters    map[string]string `json:"parameters"`
+	ReportHash    string            `json:"reportHash"`
+}
+
+// Header of a loan event payload of the given schema version
+func newLoanEventHeader(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	version int,
+) (LoanEventHeader, error) {
+	timestamp, err := txTime(ctx)
+	if err != nil {
+		return LoanEventHeader{}, err
+	}
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return LoanEventHeader{}, err
+	}
+	id, err := callerID(ctx)
+	if err != nil {
+		return LoanEventHeader{}, err
+	}
+
+	return LoanEventHeader{
+		SchemaVersion: version,
+		LoanID:        loanID,
+		TxID:          ctx.GetStub().GetTxID(),
+		Timestamp:     timestamp.Format(time.RFC3339),
+		SubmitterMSP:  mspID,
+		SubmitterID:   id,
+	}, nil
+}
+
+func emitEvent(
+	ctx contractapi.TransactionContextInterface,
+	name string,
+	payload interface{},
+) error {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().SetEvent(name, payloadJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event %s: %v", name, err)
+	}
+	return nil
+}
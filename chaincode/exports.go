@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// A batch of exported loans in the order they were requested. Cursor names
+// the loan the next batch starts from, empty after the last.
+type LoanExport struct {
+	Loans  []*Loan `json:"loans"`
+	Cursor string  `json:"cursor"`
+}
+
+// ============== Bulk Export ==============
+
+// Export up to limit loans in the order they were requested, ties broken by
+// loan ID, starting from cursor, empty for the first batch. Loans are read
+// through the request date index by key range, so a nightly export neither
+// needs rich queries nor reorders between runs, and loans requested since
+// come after every earlier one. Loans are shown as the caller may see them.
+func (s *SmartContract) ExportLoans(
+	ctx contractapi.TransactionContextInterface,
+	cursor string,
+	limit int32,
+) (*LoanExport, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be positive")
+	}
+
+	bookmark := ""
+	if cursor != "" {
+		key, err := loanExportKey(ctx, cursor)
+		if err != nil {
+			return nil, err
+		}
+		bookmark = key
+	}
+
+	iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(createdLoanIndex, []string{}, limit, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	export := LoanExport{Loans: []*Loan{}}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		loan, err := s.getLoan(ctx, keyParts[len(keyParts)-1])
+		if err != nil {
+			return nil, err
+		}
+		export.Loans = append(export.Loans, loan)
+	}
+
+	err = s.viewLoans(ctx, export.Loans)
+	if err != nil {
+		return nil, err
+	}
+
+	// The bookmark is the index key of the next loan
+	next := nextBookmark(metadata.GetFetchedRecordsCount(), limit, metadata.GetBookmark())
+	if next != "" {
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(next)
+		if err != nil || len(keyParts) != 3 {
+			return nil, fmt.Errorf("invalid bookmark returned by the state database")
+		}
+		export.Cursor = keyParts[1] + "/" + keyParts[2]
+	}
+	return &export, nil
+}
+
+// Index key of the loan an export cursor, the request instant and loan ID
+// separated by a slash, starts from
+func loanExportKey(
+	ctx contractapi.TransactionContextInterface,
+	cursor string,
+) (string, error) {
+	instant, loanID, ok := strings.Cut(cursor, "/")
+	if !ok || loanID == "" {
+		return "", fmt.Errorf("invalid cursor %s", cursor)
+	}
+	at, err := time.Parse(indexInstantLayout, instant)
+	if err != nil {
+		return "", fmt.Errorf("invalid cursor %s", cursor)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(createdLoanIndex, []string{at.Format(indexMonthLayout), instant, loanID})
+	if err != nil {
+		return "", fmt.Errorf("invalid cursor %s: %v", cursor, err)
+	}
+	return key, nil
+}
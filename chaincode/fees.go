@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Fees charged when a loan is disbursed, as percentages of its principal
+type FeeSchedule struct {
+	ProcessingRate  Decimal `json:"processingRate"`  // charged to the borrower by the lender, deducted from the disbursement
+	PlatformRate    Decimal `json:"platformRate"`    // charged to the lender by the platform
+	PlatformAccount string  `json:"platformAccount"` // account platform fees are paid to
+	GSTRate         Decimal `json:"gstRate"`         // levied on top of each fee
+}
+
+// Tax invoice of a fee collected for a loan. GST is split into CGST and SGST
+// when supplier and recipient are registered in the same state, by the
+// gstState metadata of their accounts, and is IGST otherwise.
+type FeeInvoice struct {
+	InvoiceNumber string       `json:"invoiceNumber"`
+	Type          string       `json:"type"` // PROCESSING, PLATFORM
+	LoanID        string       `json:"loanId"`
+	Supplier      string       `json:"supplier"`  // account the fee is paid to
+	Recipient     string       `json:"recipient"` // account paying the fee
+	TaxableValue  token.Amount `json:"taxableValue"`
+	GSTRate       Decimal      `json:"gstRate"`
+	CGST          token.Amount `json:"cgst"`
+	SGST          token.Amount `json:"sgst"`
+	IGST          token.Amount `json:"igst"`
+	Total         token.Amount `json:"total"`
+	IssuedAt      string       `json:"issuedAt"`
+	TxID          string       `json:"txId"`
+}
+
+// Fee types
+const (
+	feeProcessing = "PROCESSING"
+	feePlatform   = "PLATFORM"
+)
+
+// A page of the fee invoices of an account
+type FeeInvoicePage struct {
+	Invoices []*FeeInvoice `json:"invoices"`
+	Bookmark string        `json:"bookmark"` // empty on the last page
+}
+
+// Fee invoices are stored under their loan, one of each type, and indexed by
+// either party under the month and instant they were issued, so a period is
+// read in order
+const (
+	feeInvoiceObjectType = "feeinvoice"
+	accountInvoiceIndex  = "account~month~instant~feeinvoice"
+)
+
+// Account metadata key holding the state an account is registered for GST in
+const gstStateMetadata = "gstState"
+
+// Fails unless the fee schedule is usable
+func (f FeeSchedule) validate() error {
+	for _, rate := range []Decimal{f.ProcessingRate, f.PlatformRate, f.GSTRate} {
+		if checkRate(rate, 100) != nil {
+			return fmt.Errorf("fee and GST rates must be decimals between 0 and 100")
+		}
+	}
+	if f.PlatformRate.Rat().Sign() > 0 && f.PlatformAccount == "" {
+		return fmt.Errorf("a platform account is required to charge platform fees")
+	}
+	return nil
+}
+
+// Prices a fee on the loan's principal and issues its invoice, nothing is
+// issued for a zero rate. The caller moves the invoice total.
+func (s *SmartContract) issueFeeInvoice(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	feeType string,
+	rate Decimal,
+	supplier string,
+	recipient string,
+	config *LendingConfig,
+) (*FeeInvoice, error) {
+	if rate.Rat().Sign() <= 0 {
+		return nil, nil
+	}
+	rounding := config.Rounding
+
+	issuedAt, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	invoice := FeeInvoice{
+		InvoiceNumber: fmt.Sprintf("%s-%s", feeType, loan.LoanID),
+		Type:          feeType,
+		LoanID:        loan.LoanID,
+		Supplier:      supplier,
+		Recipient:     recipient,
+		TaxableValue:  rounding.amount(percentOf(loan.Amount.Rat(), rate.Rat())),
+		GSTRate:       config.Fees.GSTRate,
+		IssuedAt:      issuedAt.Format(time.RFC3339),
+		TxID:          ctx.GetStub().GetTxID(),
+	}
+
+	intraState, err := s.sameGSTState(ctx, supplier, recipient)
+	if err != nil {
+		return nil, err
+	}
+	invoice.CGST, invoice.SGST, invoice.IGST = zeroAmount, zeroAmount, zeroAmount
+	gst := percentOf(invoice.TaxableValue.Rat(), invoice.GSTRate.Rat())
+	if intraState {
+		invoice.CGST = rounding.amount(ratQuo(gst, ratInt(2)))
+		invoice.SGST = invoice.CGST
+	} else {
+		invoice.IGST = rounding.amount(gst)
+	}
+	invoice.Total = token.NewAmount(amountSum(invoice.TaxableValue, invoice.CGST, invoice.SGST, invoice.IGST))
+
+	err = putRecord(ctx, feeInvoiceObjectType, []string{loan.LoanID, feeType}, invoice)
+	if err != nil {
+		return nil, err
+	}
+	for _, account := range []string{supplier, recipient} {
+		err = s.putIndex(ctx, accountInvoiceIndex, account,
+			issuedAt.Format(indexMonthLayout), issuedAt.Format(indexInstantLayout), loan.LoanID, feeType)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("%s fee of %s plus GST of %s invoiced to %s as %s (TxID: %s)",
+			feeType,
+			invoice.TaxableValue,
+			token.NewAmount(ratSub(invoice.Total.Rat(), invoice.TaxableValue.Rat())),
+			recipient,
+			invoice.InvoiceNumber,
+			ctx.GetStub().GetTxID()))
+	return &invoice, nil
+}
+
+func (s *SmartContract) sameGSTState(
+	ctx contractapi.TransactionContextInterface,
+	supplier string,
+	recipient string,
+) (bool, error) {
+	supplierAccount, err := s.accountOf(ctx, supplier)
+	if err != nil {
+		return false, err
+	}
+	recipientAccount, err := s.accountOf(ctx, recipient)
+	if err != nil {
+		return false, err
+	}
+
+	state := supplierAccount.Metadata[gstStateMetadata]
+	return state != "" && state == recipientAccount.Metadata[gstStateMetadata], nil
+}
+
+// Fee invoices issued for a loan
+func (s *SmartContract) getFeeInvoices(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+) ([]*FeeInvoice, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(feeInvoiceObjectType, []string{loanID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	invoices := []*FeeInvoice{}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var invoice FeeInvoice
+		err = json.Unmarshal(entry.Value, &invoice)
+		if err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, &invoice)
+	}
+
+	return invoices, nil
+}
+
+// ============== Fee Invoices ==============
+
+// Fee invoices an account issued or received in a period (YYYY-MM or
+// YYYY-Qn), oldest first, a page at a time. Trade invoices financed by loans
+// are read with GetInvoice. Available to the regulator and the organization
+// operating the account.
+func (s *SmartContract) GetInvoices(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+	period string,
+	pageSize int32,
+	bookmark string,
+) (*FeeInvoicePage, error) {
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if mspID != regulatorMSP {
+		holder, err := s.accountOf(ctx, account)
+		if err != nil {
+			return nil, err
+		}
+		err = requireOperatorOf(ctx, holder)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive")
+	}
+
+	start, end, err := parsePeriod(period)
+	if err != nil {
+		return nil, err
+	}
+
+	// The bookmark is the month being read and the index bookmark within it
+	bookmark, err = token.DecodeBookmark(bookmark)
+	if err != nil {
+		return nil, err
+	}
+	month := start
+	monthBookmark := ""
+	if bookmark != "" {
+		parts := strings.SplitN(bookmark, "|", 2)
+		month, err = time.Parse(indexMonthLayout, parts[0])
+		if err != nil || len(parts) != 2 || month.Before(start) || month.After(end) {
+			return nil, fmt.Errorf("invalid bookmark for period %s", period)
+		}
+		monthBookmark = parts[1]
+	}
+
+	page := FeeInvoicePage{Invoices: []*FeeInvoice{}}
+	for !month.After(end) {
+		remaining := pageSize - int32(len(page.Invoices))
+		if remaining == 0 {
+			page.Bookmark = token.EncodeBookmark(month.Format(indexMonthLayout) + "|" + monthBookmark)
+			break
+		}
+
+		iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(
+			accountInvoiceIndex, []string{account, month.Format(indexMonthLayout)}, remaining, monthBookmark)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read from world state: %v", err)
+		}
+
+		for iterator.HasNext() {
+			entry, err := iterator.Next()
+			if err != nil {
+				iterator.Close()
+				return nil, err
+			}
+			_, keyParts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+			if err != nil {
+				iterator.Close()
+				return nil, err
+			}
+
+			var invoice FeeInvoice
+			exists, err := getRecord(ctx, feeInvoiceObjectType, keyParts[3:], &invoice)
+			if err != nil {
+				iterator.Close()
+				return nil, err
+			}
+			if !exists {
+				iterator.Close()
+				return nil, fmt.Errorf("fee invoice %s-%s does not exist", keyParts[4], keyParts[3])
+			}
+			page.Invoices = append(page.Invoices, &invoice)
+		}
+		iterator.Close()
+
+		// A full page leaves the rest of this month for the next call
+		if metadata.GetFetchedRecordsCount() == remaining && metadata.GetBookmark() != "" {
+			monthBookmark = metadata.GetBookmark()
+			continue
+		}
+		month = month.AddDate(0, 1, 0)
+		monthBookmark = ""
+	}
+
+	return &page, nil
+}
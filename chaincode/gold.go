@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Gold pledged against a loan
+type GoldCollateral struct {
+	WeightGrams Decimal      `json:"weightGrams"`
+	Purity      Decimal      `json:"purity"`   // karats, 24 for fine gold
+	Value       token.Amount `json:"value"`    // at the last valuation
+	ValuedAt    string       `json:"valuedAt"` // RFC3339
+	LTVBreached bool         `json:"ltvBreached"`
+}
+
+// Price of one gram of 24 karat gold, published by an oracle organization.
+// Kept apart from the configuration so rate updates do not conflict with
+// transactions reading it.
+type GoldRate struct {
+	RatePerGram token.Amount `json:"ratePerGram"`
+	PublishedBy string       `json:"publishedBy"`
+	PublishedAt string       `json:"publishedAt"`
+}
+
+const (
+	goldRateObjectType = "goldRate"
+	goldLoanIndex      = "gold~loan"
+)
+
+// ============== Gold Loans ==============
+
+// Pledge gold against a pending loan, its loan to value is checked at approval
+func (s *SmartContract) SetGoldCollateral(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	weightGrams string,
+	purity string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "SetGoldCollateral")
+	if err != nil {
+		return nil, err
+	}
+	weight, err := parseDecimal(weightGrams, weightScale)
+	if err != nil {
+		return nil, err
+	}
+	karats, err := parseRate(purity)
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Status != "PENDING" {
+		return nil, fmt.Errorf("collateral of loan %s cannot change in current status: %s", loanID, loan.Status)
+	}
+	if weight.Sign() <= 0 {
+		return nil, fmt.Errorf("gold weight must be positive")
+	}
+	if karats.Sign() <= 0 || karats.Cmp(ratInt(24)) > 0 {
+		return nil, fmt.Errorf("gold purity must be between 0 and 24 karats")
+	}
+
+	loan.Gold = &GoldCollateral{WeightGrams: newDecimal(weight, weightScale), Purity: newRate(karats)}
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Gold collateral of %s g at %s karat pledged (TxID: %s)",
+			loan.Gold.WeightGrams,
+			loan.Gold.Purity,
+			ctx.GetStub().GetTxID()))
+
+	err = s.putIndex(ctx, goldLoanIndex, loanID)
+	if err != nil {
+		return nil, err
+	}
+	err = s.indexCollateral(ctx, loanID, collateralGold, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	return s.putLoanResult(ctx, loan)
+}
+
+// Publish the gold rate and revalue outstanding gold loans, flagging those
+// beyond the configured loan to value. Oracle organizations only.
+func (s *SmartContract) SetGoldRate(
+	ctx contractapi.TransactionContextInterface,
+	ratePerGram string,
+) error {
+	err := claimRequestID(ctx, "SetGoldRate")
+	if err != nil {
+		return err
+	}
+	price, err := parseAmount(ratePerGram)
+	if err != nil {
+		return err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	mspID, err := requireOracle(ctx, config)
+	if err != nil {
+		return err
+	}
+	if price.Sign() <= 0 {
+		return fmt.Errorf("gold rate must be positive")
+	}
+
+	publishedAt, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	rate := GoldRate{
+		RatePerGram: token.NewAmount(price),
+		PublishedBy: mspID,
+		PublishedAt: publishedAt.Format(time.RFC3339),
+	}
+	err = putRecord(ctx, goldRateObjectType, []string{}, rate)
+	if err != nil {
+		return err
+	}
+
+	loans, err := s.getIndexedLoans(ctx, goldLoanIndex)
+	if err != nil {
+		return err
+	}
+
+	for _, loan := range loans {
+		if !isOutstanding(loan) || loan.Gold == nil {
+			continue
+		}
+
+		breached := !valueGold(loan, &rate, config.GoldLTV, loan.RemainingBalance)
+		if breached != loan.Gold.LTVBreached {
+			loan.AuditHistory = append(loan.AuditHistory,
+				fmt.Sprintf("Gold revalued at %s, loan to value breached: %t (TxID: %s)",
+					loan.Gold.Value,
+					breached,
+					ctx.GetStub().GetTxID()))
+		}
+		loan.Gold.LTVBreached = breached
+
+		err = s.putLoan(ctx, loan)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *SmartContract) GetGoldRate(
+	ctx contractapi.TransactionContextInterface,
+) (*GoldRate, error) {
+	var rate GoldRate
+	exists, err := getRecord(ctx, goldRateObjectType, []string{}, &rate)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("gold rate has not been published")
+	}
+	return &rate, nil
+}
+
+// Values the loan's gold at the rate, reporting whether exposure stays within
+// the maximum loan to value
+func valueGold(loan *Loan, rate *GoldRate, maxLTV Decimal, exposure token.Amount) bool {
+	fineGrams := ratQuo(ratMul(loan.Gold.WeightGrams.Rat(), loan.Gold.Purity.Rat()), ratInt(24))
+	loan.Gold.Value = token.NewAmount(ratMul(fineGrams, rate.RatePerGram.Rat()))
+	loan.Gold.ValuedAt = rate.PublishedAt
+	return exposure.Rat().Cmp(percentOf(loan.Gold.Value.Rat(), maxLTV.Rat())) <= 0
+}
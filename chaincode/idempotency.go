@@ -0,0 +1,20 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Request IDs are claimed in the token package's records, so the loan and
+// token functions of a deployment share one set per organization and
+// GetProcessedRequest is served by the embedded token contract
+
+// Records the request ID the client attached to this transaction, failing if
+// it was already processed. Transactions without a request ID are not tracked.
+func claimRequestID(
+	ctx contractapi.TransactionContextInterface,
+	function string,
+) error {
+	return token.ClaimRequestID(ctx, function)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Transactions that only read the ledger, by name prefix, and need not claim
+// a request ID
+var queryPrefixes = []string{"Get", "Export", "Verify", "Simulate", "Generate", "Check", "LoanExists", "Ping", "Reconcile"}
+
+// Write transactions named like queries
+var checkWrites = map[string]bool{"CheckApplicationSLAs": true}
+
+// Every write transaction claims the client's request ID under its own name,
+// so a resubmitted request fails instead of applying twice
+func TestWritesClaimRequestID(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fset := token.NewFileSet()
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || !isContractMethod(fn) {
+				continue
+			}
+
+			var claimed []string
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok || len(call.Args) != 2 {
+					return true
+				}
+				if ident, ok := call.Fun.(*ast.Ident); ok && ident.Name == "claimRequestID" {
+					function := "?"
+					if lit, ok := call.Args[1].(*ast.BasicLit); ok {
+						function, _ = strconv.Unquote(lit.Value)
+					}
+					claimed = append(claimed, function)
+				}
+				return true
+			})
+
+			method := fn.Name.Name
+			switch {
+			case len(claimed) > 1:
+				t.Errorf("%s claims a request ID %d times", method, len(claimed))
+			case len(claimed) == 1 && claimed[0] != method:
+				t.Errorf("%s claims its request ID as %s", method, claimed[0])
+			case len(claimed) == 0 && !isQuery(method):
+				t.Errorf("%s writes without claiming a request ID", method)
+			}
+		}
+	}
+}
+
+func isContractMethod(fn *ast.FuncDecl) bool {
+	if fn.Recv == nil || len(fn.Recv.List) != 1 || !fn.Name.IsExported() {
+		return false
+	}
+	star, ok := fn.Recv.List[0].Type.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	ident, ok := star.X.(*ast.Ident)
+	return ok && ident.Name == "SmartContract"
+}
+
+func isQuery(method string) bool {
+	if checkWrites[method] {
+		return false
+	}
+	for _, prefix := range queryPrefixes {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// A request resubmitted with the same request ID is refused, here by one of
+// the transactions that used to apply it twice
+func TestReplayedRequest(t *testing.T) {
+	l := newTestLedger(t)
+	l.borrower("B1", "100")
+	l.disbursedLoan("L1", "B1", "1000")
+
+	l.stub.Transient = map[string][]byte{"request_id": []byte("tag-1")}
+	defer func() { l.stub.Transient = nil }()
+	l.must(hdfc, func(ctx *TransactionContext) error {
+		_, err := l.contract.SetLoanTag(ctx, "L1", "priority", "high")
+		return err
+	})
+	err := l.submit(hdfc, func(ctx *TransactionContext) error {
+		_, err := l.contract.SetLoanTag(ctx, "L1", "priority", "low")
+		return err
+	})
+	if err == nil || !strings.Contains(err.Error(), "request tag-1 was already processed by SetLoanTag") {
+		t.Fatalf("replayed SetLoanTag: got %v", err)
+	}
+
+	// Another organization's request IDs are its own
+	l.must(sbi, func(ctx *TransactionContext) error {
+		_, err := l.contract.SetLoanTag(ctx, "L1", "region", "south")
+		return err
+	})
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// National ID kinds a borrower can be resolved by
+const (
+	idTypePAN     = "PAN"
+	idTypeAadhaar = "AADHAAR"
+)
+
+// Borrower accounts resolved to one national ID. Only a salted hash of the ID
+// is kept, computed off-chain as HMAC-SHA256 under the consortium's salt, so
+// raw PAN and Aadhaar numbers never reach the ledger.
+type BorrowerIdentity struct {
+	IDType      string   `json:"idType"`
+	IDHash      string   `json:"idHash"`
+	BorrowerIDs []string `json:"borrowerIds"`
+}
+
+// A page of the borrowers linked to a borrower
+type LinkedBorrowerPage struct {
+	BorrowerIDs []string `json:"borrowerIds"`
+	Bookmark    string   `json:"bookmark"` // empty on the last page
+}
+
+const (
+	identityObjectType    = "identity"
+	borrowerIdentityIndex = "borrower~identity"
+)
+
+// ============== Borrower Identity Resolution ==============
+
+// Link a borrower account to the salted hash of its holder's PAN or Aadhaar,
+// called by the organization operating the account after KYC
+func (s *SmartContract) LinkBorrowerIdentity(
+	ctx contractapi.TransactionContextInterface,
+	borrowerID string,
+	idType string,
+	idHash string,
+) error {
+	err := claimRequestID(ctx, "LinkBorrowerIdentity")
+	if err != nil {
+		return err
+	}
+
+	if idType != idTypePAN && idType != idTypeAadhaar {
+		return fmt.Errorf("unknown ID type %s", idType)
+	}
+	if len(idHash) != 64 {
+		return fmt.Errorf("ID hash must be a hex encoded SHA-256 digest")
+	}
+
+	borrower, err := s.requireAccountType(ctx, borrowerID, token.AccountBorrower)
+	if err != nil {
+		return err
+	}
+	err = requireOperatorOf(ctx, borrower)
+	if err != nil {
+		return err
+	}
+
+	identity := BorrowerIdentity{IDType: idType, IDHash: idHash, BorrowerIDs: []string{}}
+	_, err = getRecord(ctx, identityObjectType, []string{idType, idHash}, &identity)
+	if err != nil {
+		return err
+	}
+	for _, linked := range identity.BorrowerIDs {
+		if linked == borrowerID {
+			return nil
+		}
+	}
+	identity.BorrowerIDs = append(identity.BorrowerIDs, borrowerID)
+
+	err = putRecord(ctx, identityObjectType, []string{idType, idHash}, identity)
+	if err != nil {
+		return err
+	}
+
+	return s.putIndex(ctx, borrowerIdentityIndex, borrowerID, idType, idHash)
+}
+
+// Borrower accounts sharing a national ID with the borrower, found through a
+// page of its linked IDs, including itself on the first page
+func (s *SmartContract) GetLinkedBorrowers(
+	ctx contractapi.TransactionContextInterface,
+	borrowerID string,
+	pageSize int32,
+	bookmark string,
+) (*LinkedBorrowerPage, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive")
+	}
+	linked := map[string]bool{}
+	if bookmark == "" {
+		linked[borrowerID] = true
+	}
+	bookmark, err := token.DecodeBookmark(bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(borrowerIdentityIndex, []string{borrowerID}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	err = addLinkedBorrowers(ctx, iterator, linked)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LinkedBorrowerPage{
+		BorrowerIDs: sortedKeys(linked),
+		Bookmark:    token.EncodeBookmark(nextBookmark(metadata.GetFetchedRecordsCount(), pageSize, metadata.GetBookmark())),
+	}, nil
+}
+
+// Every borrower account sharing a national ID with the borrower, including
+// itself. A borrower has a handful of IDs, so this reads them all at once.
+func (s *SmartContract) linkedBorrowers(
+	ctx contractapi.TransactionContextInterface,
+	borrowerID string,
+) ([]string, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(borrowerIdentityIndex, []string{borrowerID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	linked := map[string]bool{borrowerID: true}
+	err = addLinkedBorrowers(ctx, iterator, linked)
+	if err != nil {
+		return nil, err
+	}
+	return sortedKeys(linked), nil
+}
+
+// Adds the borrowers resolved to the identities of borrower~identity entries
+func addLinkedBorrowers(
+	ctx contractapi.TransactionContextInterface,
+	iterator shim.StateQueryIteratorInterface,
+	linked map[string]bool,
+) error {
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return err
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+		if err != nil {
+			return err
+		}
+
+		var identity BorrowerIdentity
+		_, err = getRecord(ctx, identityObjectType, keyParts[1:], &identity)
+		if err != nil {
+			return err
+		}
+		for _, id := range identity.BorrowerIDs {
+			linked[id] = true
+		}
+	}
+	return nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := []string{}
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Version of the chaincode, set at build time with
+// -ldflags "-X main.chaincodeVersion=<version>"
+var chaincodeVersion = "dev"
+
+// Capabilities clients can test for before calling the functions behind them.
+// A name is never reused for a changed behavior.
+var contractFeatures = []string{
+	"aa-consent",
+	"account-statements",
+	"aml-screening",
+	"application-sla",
+	"approval-limits",
+	"approval-escalation",
+	"approval-expiry",
+	"archival",
+	"attestation",
+	"balance-migration",
+	"benchmark-rates",
+	"borrower-velocity",
+	"bulk-export",
+	"cash-margin",
+	"collateral-index",
+	"collateral-registry",
+	"collateral-substitution",
+	"commitment-cancellation",
+	"cooling-off",
+	"credit-policy",
+	"cross-channel-settlement",
+	"daily-servicing",
+	"debit-limits",
+	"disputes",
+	"due-reminders",
+	"evidence-based-default",
+	"fee-invoices",
+	"funds-holds",
+	"funds-reservation",
+	"gold-collateral",
+	"idempotent-requests",
+	"income-distribution",
+	"input-validation",
+	"interest-accrual",
+	"interest-methods",
+	"invariants",
+	"invoice-financing",
+	"lender-statements",
+	"lending-caps",
+	"loan-annotations",
+	"loan-claims",
+	"loan-masking",
+	"loan-novation",
+	"loan-tags",
+	"moratorium",
+	"multi-collateral",
+	"negative-list",
+	"participations",
+	"prepayment",
+	"private-data",
+	"property-collateral",
+	"psl",
+	"rate-resets",
+	"receipts",
+	"reconciliation",
+	"report-hashes",
+	"regulatory-returns",
+	"repayment-mandates",
+	"restructuring",
+	"simulation",
+	"snapshots",
+	"statements",
+	"submitter-audit",
+	"subvention",
+	"tds-withholding",
+	"token-deltas",
+	"transfer-reasons",
+	"tranche-disbursement",
+	"vehicle-collateral",
+}
+
+// What a deployment of the chaincode supports and how it is configured
+type ContractInfo struct {
+	Version     string        `json:"version"`
+	Features    []string      `json:"features"`
+	Events      []string      `json:"events"`      // event names, suffixed with their payload schema version
+	TokenLedger string        `json:"tokenLedger"` // token chaincode settled through, empty for the embedded ledger
+	Config      LendingConfig `json:"config"`
+}
+
+// ============== Contract Info ==============
+
+// Describe the chaincode version, its features, the versions of its event
+// schemas and the configured parameters, so clients can adapt to mixed-version
+// deployments
+func (s *SmartContract) GetContractInfo(
+	ctx contractapi.TransactionContextInterface,
+) (*ContractInfo, error) {
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ContractInfo{
+		Version:  chaincodeVersion,
+		Features: contractFeatures,
+		Events: []string{
+			eventLoanRequested,
+			eventLoanApproved,
+			eventLoanRejected,
+			eventLoanDisbursed,
+			eventLoanRepaid,
+			eventLoanDefaulted,
+			eventLoanApprovalExpired,
+			eventLoanTrancheDisbursed,
+			eventLoanClaimTransferred,
+			eventLoanNovated,
+			eventLoanApprovalEscalated,
+			eventLoanDuesUpcoming,
+			eventLoanRateReset,
+			eventDayProcessed,
+			eventApplicationSLABreached,
+			eventReportGenerated,
+			token.EventTransfer,
+			token.EventMint,
+			token.EventBurn,
+			token.EventEscrow,
+			token.EventHold,
+			token.EventAMLCase,
+		},
+		TokenLedger: config.TokenChaincode,
+		Config:      *config,
+	}, nil
+}
+
+// Answer of Ping, echoing the proposal it was evaluated for
+type PingResponse struct {
+	Version   string `json:"version"`
+	ChannelID string `json:"channelId"`
+	TxID      string `json:"txId"`
+	Timestamp string `json:"timestamp"` // RFC3339 proposal timestamp, as set by the client
+	CallerMSP string `json:"callerMsp"`
+}
+
+// Health check for monitoring, evaluate it on a peer to check its chaincode
+// container responds. Reads and writes no state.
+func (s *SmartContract) Ping(
+	ctx contractapi.TransactionContextInterface,
+) (*PingResponse, error) {
+	timestamp, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PingResponse{
+		Version:   chaincodeVersion,
+		ChannelID: ctx.GetStub().GetChannelID(),
+		TxID:      ctx.GetStub().GetTxID(),
+		Timestamp: timestamp.Format(time.RFC3339),
+		CallerMSP: mspID,
+	}, nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Interest methods. FLAT charges the rate once over the whole term and is
+// assumed for loans saved without a method, SIMPLE and COMPOUND read the rate
+// as annual.
+const (
+	interestFlat     = "FLAT"
+	interestSimple   = "SIMPLE"
+	interestCompound = "COMPOUND"
+)
+
+// One month of a loan's repayment schedule
+type ScheduleInstallment struct {
+	Installment int          `json:"installment"`
+	DueDate     string       `json:"dueDate"` // RFC3339
+	Principal   token.Amount `json:"principal"`
+	Interest    token.Amount `json:"interest"`
+	Total       token.Amount `json:"total"`
+}
+
+// ============== Interest ==============
+
+// Choose how a pending loan's interest is computed, compoundingFrequency is
+// the number of compounding periods a year and only applies to COMPOUND
+func (s *SmartContract) SetInterestMethod(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	method string,
+	compoundingFrequency int,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "SetInterestMethod")
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkInterestMethod(method, compoundingFrequency)
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Status != "PENDING" {
+		return nil, fmt.Errorf("interest method of loan %s cannot be changed in current status: %s", loanID, loan.Status)
+	}
+
+	borrower, err := s.accountOf(ctx, loan.BorrowerID)
+	if err != nil {
+		return nil, err
+	}
+	err = requireOperatorOf(ctx, borrower)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	loan.InterestMethod = method
+	loan.CompoundingFrequency = compoundingFrequency
+	loan.RepaymentDue = repaymentDue(loan, config.Rounding)
+	loan.RemainingBalance = loan.RepaymentDue
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Interest method set to %s, repayment due %s (TxID: %s)",
+			method,
+			loan.RepaymentDue,
+			ctx.GetStub().GetTxID()))
+
+	return s.putLoanResult(ctx, loan)
+}
+
+// Monthly schedule of a loan, principal in equal parts with the interest
+// accruing over each month. The last installment absorbs the rounding, so the
+// installments add up to the loan's repayment due.
+func (s *SmartContract) GetRepaymentSchedule(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+) ([]ScheduleInstallment, error) {
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	start, ok := disbursementTime(loan)
+	if !ok {
+		start, ok = unixTime(loan.CreatedAt)
+		if !ok {
+			return nil, fmt.Errorf("loan %s has an invalid creation time", loanID)
+		}
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return repaymentSchedule(loan, start, config.Rounding), nil
+}
+
+// Monthly installments of a loan from start, the last absorbing the rounding
+func repaymentSchedule(loan *Loan, start time.Time, rounding RoundingPolicy) []ScheduleInstallment {
+	schedule := []ScheduleInstallment{}
+	principal := disbursedPrincipal(loan)
+	principalPaid, interestPaid := new(big.Rat), new(big.Rat)
+	for installment := 1; installment <= loan.Duration; installment++ {
+		fraction := big.NewRat(int64(installment), int64(loan.Duration))
+		principalPart := rounding.round(ratSub(ratMul(principal, fraction), principalPaid))
+		interestPart := rounding.round(ratSub(interestOver(loan, fraction), interestPaid))
+		row := ScheduleInstallment{
+			Installment: installment,
+			DueDate:     start.AddDate(0, installment, 0).Format(time.RFC3339),
+			Principal:   token.NewAmount(principalPart),
+			Interest:    token.NewAmount(interestPart),
+			Total:       token.NewAmount(ratAdd(principalPart, interestPart)),
+		}
+		principalPaid.Add(principalPaid, principalPart)
+		interestPaid.Add(interestPaid, interestPart)
+
+		schedule = append(schedule, row)
+	}
+
+	return schedule
+}
+
+// Fails unless method is an interest method and compoundingFrequency suits it
+func checkInterestMethod(method string, compoundingFrequency int) error {
+	switch method {
+	case interestFlat, interestSimple:
+		if compoundingFrequency != 0 {
+			return fmt.Errorf("compounding frequency only applies to %s interest", interestCompound)
+		}
+	case interestCompound:
+		if compoundingFrequency != 1 && compoundingFrequency != 2 && compoundingFrequency != 4 && compoundingFrequency != 12 {
+			return fmt.Errorf("compounding frequency must be 1, 2, 4 or 12 periods a year")
+		}
+	default:
+		return fmt.Errorf("unknown interest method %s", method)
+	}
+	return nil
+}
+
+// Total the borrower repays over the full term, for the tranches disbursed
+// so far of a loan disbursed in tranches
+func repaymentDue(loan *Loan, rounding RoundingPolicy) token.Amount {
+	return rounding.amount(ratAdd(disbursedPrincipal(loan), rounding.round(interestOver(loan, ratInt(1)))))
+}
+
+// Interest the borrower owes for the time from disbursement to asOf
+func interestAccrued(loan *Loan, asOf time.Time, rounding RoundingPolicy) *big.Rat {
+	return rounding.round(interestOver(loan, termElapsed(loan, asOf)))
+}
+
+// Interest the borrower owes over a fraction of the loan term, each tranche
+// of a loan disbursed in tranches accruing from its own disbursement and each
+// reset of a floating rate applying from the part of the term run at it
+func interestOver(loan *Loan, fraction *big.Rat) *big.Rat {
+	if len(loan.Tranches) > 0 {
+		return trancheInterestOver(loan, fraction)
+	}
+
+	rate := loan.InterestRate.Rat()
+	if len(loan.RateResets) > 0 {
+		rate = loan.RateResets[0].PriorRate.Rat()
+	}
+	between := func(from *big.Rat, to *big.Rat) *big.Rat {
+		net := ratSub(rate, loan.SubventionRate.Rat())
+		return ratSub(interestAt(loan, net, to), interestAt(loan, net, from))
+	}
+
+	interest, from := new(big.Rat), new(big.Rat)
+	for _, reset := range loan.RateResets {
+		elapsed := reset.Elapsed.Rat()
+		if elapsed.Cmp(fraction) >= 0 {
+			break
+		}
+		interest.Add(interest, between(from, elapsed))
+		from, rate = elapsed, reset.Rate.Rat()
+	}
+	return interest.Add(interest, between(from, fraction))
+}
+
+// Interest at ratePercent over a fraction of the loan term
+func interestAt(loan *Loan, ratePercent *big.Rat, fraction *big.Rat) *big.Rat {
+	return interestOn(loan, loan.Amount.Rat(), ratePercent, fraction)
+}
+
+// Interest on principal at ratePercent over a fraction of the loan term.
+// Compound interest compounds over the whole periods run and accrues simple
+// interest over the part of a period after them.
+func interestOn(loan *Loan, principal *big.Rat, ratePercent *big.Rat, fraction *big.Rat) *big.Rat {
+	rate := ratQuo(ratePercent, ratInt(100))
+	years := ratMul(big.NewRat(int64(loan.Duration), 12), fraction)
+
+	switch loan.InterestMethod {
+	case interestSimple:
+		return ratMul(principal, ratMul(rate, years))
+	case interestCompound:
+		periods := ratInt(int64(loan.CompoundingFrequency))
+		periodRate := ratQuo(rate, periods)
+		run := ratMul(periods, years)
+		whole := new(big.Int).Quo(run.Num(), run.Denom())
+		broken := ratSub(run, new(big.Rat).SetInt(whole))
+
+		growth := ratPow(ratAdd(ratInt(1), periodRate), int(whole.Int64()))
+		growth = ratMul(growth, ratAdd(ratInt(1), ratMul(periodRate, broken)))
+		return ratMul(principal, ratSub(growth, ratInt(1)))
+	default:
+		return ratMul(principal, ratMul(rate, fraction))
+	}
+}
+
+// Places intermediate powers are rounded to, far below a paisa on any amount
+// while keeping the numbers small
+const powPlaces = 30
+
+// x to the power n, n at least 0
+func ratPow(x *big.Rat, n int) *big.Rat {
+	precision := RoundingPolicy{Mode: roundHalfEven, Places: powPlaces}
+	result, base := ratInt(1), new(big.Rat).Set(x)
+	for ; n > 0; n >>= 1 {
+		if n&1 == 1 {
+			result = precision.round(ratMul(result, base))
+		}
+		base = precision.round(ratMul(base, base))
+	}
+	return result
+}
+
+// Fraction of the term from disbursement to the due date elapsed at asOf,
+// 0 for a loan not yet disbursed
+func termElapsed(loan *Loan, asOf time.Time) *big.Rat {
+	disbursedAt, ok := disbursementTime(loan)
+	if !ok || asOf.Before(disbursedAt) {
+		return new(big.Rat)
+	}
+	dueDate, err := time.Parse(time.RFC3339, loan.DueDate)
+	if err != nil {
+		return new(big.Rat)
+	}
+
+	term := dueDate.Sub(disbursedAt)
+	if term <= 0 || asOf.After(dueDate) {
+		return ratInt(1)
+	}
+	return big.NewRat(int64(asOf.Sub(disbursedAt)), int64(term))
+}
@@ -0,0 +1,62 @@
+package mockstub
+
+import (
+	"crypto/x509"
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+)
+
+// Client identity invoking a transaction, without a certificate behind it
+type Identity struct {
+	ID         string
+	MSPID      string
+	Attributes map[string]string
+}
+
+var _ cid.ClientIdentity = Identity{}
+
+// A member of mspID with the given ID and no attributes
+func NewIdentity(mspID string, id string) Identity {
+	return Identity{ID: id, MSPID: mspID}
+}
+
+// Copy of the identity with an attribute set
+func (id Identity) With(name string, value string) Identity {
+	attributes := map[string]string{name: value}
+	for existing, value := range id.Attributes {
+		if existing != name {
+			attributes[existing] = value
+		}
+	}
+	id.Attributes = attributes
+	return id
+}
+
+func (id Identity) GetID() (string, error) {
+	return id.ID, nil
+}
+
+func (id Identity) GetMSPID() (string, error) {
+	return id.MSPID, nil
+}
+
+func (id Identity) GetAttributeValue(name string) (string, bool, error) {
+	value, found := id.Attributes[name]
+	return value, found, nil
+}
+
+func (id Identity) AssertAttributeValue(name string, value string) error {
+	actual, found := id.Attributes[name]
+	if !found {
+		return fmt.Errorf("attribute '%s' was not found", name)
+	}
+	if actual != value {
+		return fmt.Errorf("attribute '%s' equals '%s', not '%s'", name, actual, value)
+	}
+	return nil
+}
+
+func (id Identity) GetX509Certificate() (*x509.Certificate, error) {
+	return nil, nil
+}
@@ -0,0 +1,443 @@
+// Package mockstub is an in-memory peer for running chaincode functions in
+// tests and benchmarks without a network.
+//
+// Its Stub keeps the world state a peer would commit and applies the same
+// rules the chaincode relies on: reads return the state as of the start of
+// the transaction rather than its own writes, range queries refuse composite
+// keys and a transaction may not write once it ran a paginated query. Writes
+// are buffered until Commit, which also records them in the key's history.
+// The keys and ranges a transaction read are kept with its writes, so tests
+// can tell whether two transactions endorsed at once would conflict.
+package mockstub
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+const compositeKeyNamespace = "\x00"
+
+// In-memory ChaincodeStubInterface. Set TxID, Now and Transient before each
+// transaction and call Commit or Rollback after it.
+type Stub struct {
+	TxID      string
+	ChannelID string
+	Now       time.Time
+	Transient map[string][]byte
+
+	// Proposal the client signed, nil for none. A chaincode called by another
+	// sees the proposal of the transaction it is part of.
+	Proposal *peer.SignedProposal
+
+	// Answers InvokeChaincode; without it chaincode calls fail
+	Invoke func(chaincodeName string, args [][]byte, channel string) peer.Response
+
+	// Last event set by the transaction, cleared by Commit and Rollback
+	EventName    string
+	EventPayload []byte
+
+	state     map[string][]byte
+	history   map[string][]*queryresult.KeyModification // newest first
+	writes    map[string][]byte                         // nil for a delete
+	reads     map[string]bool
+	ranges    []KeyRange
+	private   map[string][]byte // by collection and key
+	paginated bool
+}
+
+var _ shim.ChaincodeStubInterface = (*Stub)(nil)
+
+// An empty ledger on channel "mychannel"
+func New() *Stub {
+	return &Stub{
+		ChannelID: "mychannel",
+		Now:       time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		state:     map[string][]byte{},
+		history:   map[string][]*queryresult.KeyModification{},
+		writes:    map[string][]byte{},
+		reads:     map[string]bool{},
+		private:   map[string][]byte{},
+	}
+}
+
+// ============== Transactions ==============
+
+// Applies the transaction's writes to the world state and key histories
+func (s *Stub) Commit() {
+	keys := make([]string, 0, len(s.writes))
+	for key := range s.writes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	ts := &timestamp.Timestamp{Seconds: s.Now.Unix(), Nanos: int32(s.Now.Nanosecond())}
+	for _, key := range keys {
+		value := s.writes[key]
+		if value == nil {
+			delete(s.state, key)
+		} else {
+			s.state[key] = value
+		}
+		s.history[key] = append([]*queryresult.KeyModification{{
+			TxId:      s.TxID,
+			Value:     value,
+			Timestamp: ts,
+			IsDelete:  value == nil,
+		}}, s.history[key]...)
+	}
+	s.Rollback()
+}
+
+// Discards the transaction's writes and event, as for a failed endorsement
+func (s *Stub) Rollback() {
+	s.writes = map[string][]byte{}
+	s.reads = map[string]bool{}
+	s.ranges = nil
+	s.paginated = false
+	s.EventName = ""
+	s.EventPayload = nil
+}
+
+// Committed value of a key, nil if absent
+func (s *Stub) Committed(key string) []byte {
+	return s.state[key]
+}
+
+// Keys in the committed world state and the bytes of those keys and their
+// values, as a peer would store them
+func (s *Stub) StateSize() (keys int, bytes int) {
+	for key, value := range s.state {
+		bytes += len(key) + len(value)
+	}
+	return len(s.state), bytes
+}
+
+// ============== Transaction details ==============
+
+func (s *Stub) GetTxID() string {
+	return s.TxID
+}
+
+func (s *Stub) GetChannelID() string {
+	return s.ChannelID
+}
+
+func (s *Stub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return &timestamp.Timestamp{Seconds: s.Now.Unix(), Nanos: int32(s.Now.Nanosecond())}, nil
+}
+
+func (s *Stub) GetTransient() (map[string][]byte, error) {
+	return s.Transient, nil
+}
+
+// Functions are called directly rather than dispatched from arguments
+func (s *Stub) GetArgs() [][]byte {
+	return nil
+}
+
+func (s *Stub) GetStringArgs() []string {
+	return nil
+}
+
+func (s *Stub) GetFunctionAndParameters() (string, []string) {
+	return "", nil
+}
+
+func (s *Stub) GetArgsSlice() ([]byte, error) {
+	return nil, nil
+}
+
+func (s *Stub) GetCreator() ([]byte, error) {
+	return nil, nil
+}
+
+func (s *Stub) GetBinding() ([]byte, error) {
+	return nil, nil
+}
+
+func (s *Stub) GetDecorations() map[string][]byte {
+	return nil
+}
+
+func (s *Stub) GetSignedProposal() (*peer.SignedProposal, error) {
+	return s.Proposal, nil
+}
+
+func (s *Stub) SetEvent(name string, payload []byte) error {
+	if name == "" {
+		return fmt.Errorf("event name can not be empty string")
+	}
+	s.EventName = name
+	s.EventPayload = payload
+	return nil
+}
+
+func (s *Stub) InvokeChaincode(chaincodeName string, args [][]byte, channel string) peer.Response {
+	if s.Invoke == nil {
+		return shim.Error(fmt.Sprintf("chaincode %s is not installed", chaincodeName))
+	}
+	return s.Invoke(chaincodeName, args, channel)
+}
+
+// ============== World state ==============
+
+func (s *Stub) GetState(key string) ([]byte, error) {
+	s.reads[key] = true
+	return s.state[key], nil
+}
+
+func (s *Stub) PutState(key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("key must not be an empty string")
+	}
+	if s.paginated {
+		return fmt.Errorf("transaction has already performed a paginated query. Writes are not allowed")
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	s.writes[key] = value
+	return nil
+}
+
+func (s *Stub) DelState(key string) error {
+	if s.paginated {
+		return fmt.Errorf("transaction has already performed a paginated query. Writes are not allowed")
+	}
+	s.writes[key] = nil
+	return nil
+}
+
+func (s *Stub) SetStateValidationParameter(key string, ep []byte) error {
+	return nil
+}
+
+func (s *Stub) GetStateValidationParameter(key string) ([]byte, error) {
+	return nil, nil
+}
+
+func (s *Stub) GetStateByRange(startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	for _, key := range []string{startKey, endKey} {
+		if strings.HasPrefix(key, compositeKeyNamespace) {
+			return nil, fmt.Errorf("first character of the key [%s] contains a null character which is not allowed", key)
+		}
+	}
+	return s.rangeOf(startKey, endKey), nil
+}
+
+func (s *Stub) GetStateByRangeWithPagination(
+	startKey, endKey string,
+	pageSize int32,
+	bookmark string,
+) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	iterator, err := s.GetStateByRange(startKey, endKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	iterator, metadata := s.page(iterator.(*Iterator), pageSize, bookmark)
+	return iterator, metadata, nil
+}
+
+func (s *Stub) GetStateByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	prefix, err := s.CreateCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+	return s.rangeOf(prefix, prefix+string(utf8.MaxRune)), nil
+}
+
+func (s *Stub) GetStateByPartialCompositeKeyWithPagination(
+	objectType string,
+	keys []string,
+	pageSize int32,
+	bookmark string,
+) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	iterator, err := s.GetStateByPartialCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	iterator, metadata := s.page(iterator.(*Iterator), pageSize, bookmark)
+	return iterator, metadata, nil
+}
+
+func (s *Stub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return shim.CreateCompositeKey(objectType, attributes)
+}
+
+func (s *Stub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	if !strings.HasPrefix(compositeKey, compositeKeyNamespace) {
+		return "", nil, fmt.Errorf("%q is not a composite key", compositeKey)
+	}
+	parts := strings.Split(strings.TrimSuffix(compositeKey[1:], "\x00"), "\x00")
+	return parts[0], parts[1:], nil
+}
+
+// Rich queries need CouchDB, which the mock does not emulate, as with a peer
+// running LevelDB
+func (s *Stub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	return nil, fmt.Errorf("ExecuteQuery not supported for leveldb")
+}
+
+func (s *Stub) GetQueryResultWithPagination(
+	query string,
+	pageSize int32,
+	bookmark string,
+) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	return nil, nil, fmt.Errorf("ExecuteQuery not supported for leveldb")
+}
+
+func (s *Stub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	return &HistoryIterator{modifications: s.history[key]}, nil
+}
+
+// Committed keys from startKey up to but excluding endKey, in key order. An
+// empty endKey has no upper bound.
+func (s *Stub) rangeOf(startKey, endKey string) *Iterator {
+	s.ranges = append(s.ranges, KeyRange{Start: startKey, End: endKey})
+	iterator := &Iterator{}
+	for key, value := range s.state {
+		if key >= startKey && (endKey == "" || key < endKey) {
+			iterator.entries = append(iterator.entries, &queryresult.KV{Key: key, Value: value})
+		}
+	}
+	sort.Slice(iterator.entries, func(i, j int) bool {
+		return iterator.entries[i].Key < iterator.entries[j].Key
+	})
+	return iterator
+}
+
+// Page of up to pageSize entries starting at the bookmark, which is the key
+// the page starts from. The returned bookmark is the key of the next entry,
+// empty after the last page.
+func (s *Stub) page(all *Iterator, pageSize int32, bookmark string) (*Iterator, *peer.QueryResponseMetadata) {
+	s.paginated = true
+
+	entries := all.entries
+	if bookmark != "" {
+		start := sort.Search(len(entries), func(i int) bool { return entries[i].Key >= bookmark })
+		entries = entries[start:]
+	}
+
+	next := ""
+	if pageSize > 0 && len(entries) > int(pageSize) {
+		next = entries[pageSize].Key
+		entries = entries[:pageSize]
+	}
+	return &Iterator{entries: entries}, &peer.QueryResponseMetadata{
+		FetchedRecordsCount: int32(len(entries)),
+		Bookmark:            next,
+	}
+}
+
+// ============== Private data ==============
+
+func privateKey(collection, key string) string {
+	return collection + "\x00" + key
+}
+
+func (s *Stub) GetPrivateData(collection, key string) ([]byte, error) {
+	return s.private[privateKey(collection, key)], nil
+}
+
+func (s *Stub) GetPrivateDataHash(collection, key string) ([]byte, error) {
+	value, ok := s.private[privateKey(collection, key)]
+	if !ok {
+		return nil, nil
+	}
+	hash := sha256.Sum256(value)
+	return hash[:], nil
+}
+
+// Private writes are not visible to other organizations, so they apply
+// immediately rather than at Commit
+func (s *Stub) PutPrivateData(collection string, key string, value []byte) error {
+	s.private[privateKey(collection, key)] = value
+	return nil
+}
+
+func (s *Stub) DelPrivateData(collection, key string) error {
+	delete(s.private, privateKey(collection, key))
+	return nil
+}
+
+func (s *Stub) PurgePrivateData(collection, key string) error {
+	return s.DelPrivateData(collection, key)
+}
+
+func (s *Stub) SetPrivateDataValidationParameter(collection, key string, ep []byte) error {
+	return nil
+}
+
+func (s *Stub) GetPrivateDataValidationParameter(collection, key string) ([]byte, error) {
+	return nil, nil
+}
+
+func (s *Stub) GetPrivateDataByRange(collection, startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	return nil, fmt.Errorf("private data range queries are not supported")
+}
+
+func (s *Stub) GetPrivateDataByPartialCompositeKey(
+	collection, objectType string,
+	keys []string,
+) (shim.StateQueryIteratorInterface, error) {
+	return nil, fmt.Errorf("private data range queries are not supported")
+}
+
+func (s *Stub) GetPrivateDataQueryResult(collection, query string) (shim.StateQueryIteratorInterface, error) {
+	return nil, fmt.Errorf("private data queries are not supported")
+}
+
+// ============== Iterators ==============
+
+// Iterator over a snapshot of world state entries
+type Iterator struct {
+	entries []*queryresult.KV
+}
+
+func (it *Iterator) HasNext() bool {
+	return len(it.entries) > 0
+}
+
+func (it *Iterator) Next() (*queryresult.KV, error) {
+	if len(it.entries) == 0 {
+		return nil, fmt.Errorf("no more entries")
+	}
+	entry := it.entries[0]
+	it.entries = it.entries[1:]
+	return entry, nil
+}
+
+func (it *Iterator) Close() error {
+	return nil
+}
+
+// Iterator over a key's history, newest write first
+type HistoryIterator struct {
+	modifications []*queryresult.KeyModification
+}
+
+func (it *HistoryIterator) HasNext() bool {
+	return len(it.modifications) > 0
+}
+
+func (it *HistoryIterator) Next() (*queryresult.KeyModification, error) {
+	if len(it.modifications) == 0 {
+		return nil, fmt.Errorf("no more history")
+	}
+	modification := it.modifications[0]
+	it.modifications = it.modifications[1:]
+	return modification, nil
+}
+
+func (it *HistoryIterator) Close() error {
+	return nil
+}
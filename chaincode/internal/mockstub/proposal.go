@@ -0,0 +1,34 @@
+package mockstub
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// Unsigned proposal invoking a chaincode function with args, holding only the
+// invocation a chaincode can inspect
+func NewProposal(chaincodeName string, function string, args ...string) *peer.SignedProposal {
+	input := [][]byte{[]byte(function)}
+	for _, arg := range args {
+		input = append(input, []byte(arg))
+	}
+
+	invocation, err := proto.Marshal(&peer.ChaincodeInvocationSpec{
+		ChaincodeSpec: &peer.ChaincodeSpec{
+			ChaincodeId: &peer.ChaincodeID{Name: chaincodeName},
+			Input:       &peer.ChaincodeInput{Args: input},
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+	payload, err := proto.Marshal(&peer.ChaincodeProposalPayload{Input: invocation})
+	if err != nil {
+		panic(err)
+	}
+	proposal, err := proto.Marshal(&peer.Proposal{Payload: payload})
+	if err != nil {
+		panic(err)
+	}
+	return &peer.SignedProposal{ProposalBytes: proposal}
+}
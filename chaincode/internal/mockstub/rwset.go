@@ -0,0 +1,57 @@
+package mockstub
+
+import (
+	"sort"
+)
+
+// Keys from Start up to but excluding End, an empty End has no upper bound
+type KeyRange struct {
+	Start string
+	End   string
+}
+
+func (r KeyRange) contains(key string) bool {
+	return key >= r.Start && (r.End == "" || key < r.End)
+}
+
+// What a transaction read and wrote
+type ReadWriteSet struct {
+	Reads  []string
+	Ranges []KeyRange
+	Writes []string
+}
+
+// Read-write set of the running transaction, take it before Commit
+func (s *Stub) ReadWriteSet() *ReadWriteSet {
+	set := &ReadWriteSet{Ranges: append([]KeyRange(nil), s.ranges...)}
+	for key := range s.reads {
+		set.Reads = append(set.Reads, key)
+	}
+	for key := range s.writes {
+		set.Writes = append(set.Writes, key)
+	}
+	sort.Strings(set.Reads)
+	sort.Strings(set.Writes)
+	return set
+}
+
+// Keys written by committed that this transaction read, directly or within a
+// range. Endorsed against the same state, this transaction would fail MVCC
+// validation if committed was ordered first and any are returned.
+func (set *ReadWriteSet) ConflictsWith(committed *ReadWriteSet) []string {
+	conflicts := []string{}
+	reads := map[string]bool{}
+	for _, key := range set.Reads {
+		reads[key] = true
+	}
+	for _, key := range committed.Writes {
+		conflict := reads[key]
+		for _, r := range set.Ranges {
+			conflict = conflict || r.contains(key)
+		}
+		if conflict {
+			conflicts = append(conflicts, key)
+		}
+	}
+	return conflicts
+}
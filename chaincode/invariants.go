@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Result of checking the ledger's invariants, for monitoring to alert on
+type InvariantReport struct {
+	CheckedAt       string               `json:"checkedAt"`
+	Holds           bool                 `json:"holds"`
+	AccountsChecked int                  `json:"accountsChecked"`
+	LoansChecked    int                  `json:"loansChecked"`
+	Violations      []InvariantViolation `json:"violations"`
+}
+
+type InvariantViolation struct {
+	Invariant string `json:"invariant"` // SUPPLY_CONSERVED, NON_NEGATIVE_BALANCE, SCHEDULE_RESIDUAL
+	Subject   string `json:"subject"`   // account or loan ID, empty for the ledger as a whole
+	Expected  string `json:"expected"`
+	Actual    string `json:"actual"`
+}
+
+const (
+	invariantSupplyConserved    = "SUPPLY_CONSERVED"
+	invariantNonNegativeBalance = "NON_NEGATIVE_BALANCE"
+	invariantScheduleResidual   = "SCHEDULE_RESIDUAL"
+)
+
+// ============== Invariants ==============
+
+// Check that account balances and escrows add up to the tokens issued, no
+// balance is negative, and every ACTIVE loan's remaining balance is its
+// repayment due less its repayments and rebates. Regulator only.
+func (s *SmartContract) VerifyInvariants(
+	ctx contractapi.TransactionContextInterface,
+) (*InvariantReport, error) {
+	err := requireRegulator(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	checkedAt, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report := InvariantReport{
+		CheckedAt:  checkedAt.Format(time.RFC3339),
+		Violations: []InvariantViolation{},
+	}
+
+	balances, err := s.accountBalances(ctx)
+	if err != nil {
+		return nil, err
+	}
+	total := new(big.Rat)
+	for _, balance := range balances {
+		report.AccountsChecked++
+		total.Add(total, balance.Balance.Rat())
+		if balance.Balance.Rat().Sign() < 0 {
+			report.Violations = append(report.Violations, InvariantViolation{
+				Invariant: invariantNonNegativeBalance,
+				Subject:   balance.AccountID,
+				Expected:  "0.00",
+				Actual:    string(balance.Balance),
+			})
+		}
+	}
+
+	supply, err := s.tokenSupply(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Ledgers initialized before the supply was tracked cannot be checked
+	if supply.Tracked {
+		held := new(big.Rat).Add(total, supply.Escrow.Rat())
+		if held.Cmp(supply.Issued.Rat()) != 0 {
+			report.Violations = append(report.Violations, InvariantViolation{
+				Invariant: invariantSupplyConserved,
+				Expected:  string(supply.Issued),
+				Actual:    token.FormatAmount(held),
+			})
+		}
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	loans, err := s.getIndexedLoans(ctx, borrowerLoanIndex)
+	if err != nil {
+		return nil, err
+	}
+	for _, loan := range loans {
+		if loan.Status != "ACTIVE" {
+			continue
+		}
+		report.LoansChecked++
+
+		repayments, err := s.getRepayments(ctx, loan.LoanID)
+		if err != nil {
+			return nil, err
+		}
+		residual := loan.RepaymentDue.Rat()
+		for _, repayment := range repayments {
+			residual.Sub(residual, amountSum(repayment.Amount, repayment.Rebate))
+		}
+		residual = config.Rounding.round(residual)
+
+		// Balances are rounded at each repayment, allow for a unit of rounding per repayment
+		unit := new(big.Rat).SetFrac(big.NewInt(1), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(config.Rounding.Places)), nil))
+		tolerance := ratMul(ratInt(int64(len(repayments))), unit)
+		if new(big.Rat).Abs(ratSub(residual, loan.RemainingBalance.Rat())).Cmp(tolerance) > 0 {
+			report.Violations = append(report.Violations, InvariantViolation{
+				Invariant: invariantScheduleResidual,
+				Subject:   loan.LoanID,
+				Expected:  token.FormatAmount(residual),
+				Actual:    string(loan.RemainingBalance),
+			})
+		}
+	}
+
+	report.Holds = len(report.Violations) == 0
+	return &report, nil
+}
+
+// Token supply, from the token chaincode when one is configured
+func (s *SmartContract) tokenSupply(
+	ctx contractapi.TransactionContextInterface,
+) (*token.TokenSupply, error) {
+	tokenChaincode, err := s.tokenChaincode(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if tokenChaincode == "" {
+		return s.GetTotalSupply(ctx)
+	}
+
+	payload, err := s.invokeToken(ctx, tokenChaincode, "GetTotalSupply")
+	if err != nil {
+		return nil, err
+	}
+
+	var supply token.TokenSupply
+	err = json.Unmarshal(payload, &supply)
+	if err != nil {
+		return nil, fmt.Errorf("invalid supply returned by %s: %v", tokenChaincode, err)
+	}
+
+	return &supply, nil
+}
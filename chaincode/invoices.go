@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// A trade invoice raised by a seller on a buyer, financeable once
+type Invoice struct {
+	InvoiceID   string       `json:"invoiceId"`
+	InvoiceHash string       `json:"invoiceHash"` // hash of the invoice document, unique across the network
+	SellerID    string       `json:"sellerId"`
+	BuyerID     string       `json:"buyerId"`
+	Amount      token.Amount `json:"amount"`
+	DueDate     string       `json:"dueDate"`
+	Status      string       `json:"status"` // REGISTERED, FINANCED
+	LoanID      string       `json:"loanId"`
+}
+
+const (
+	invoiceObjectType = "invoice"
+	invoiceHashIndex  = "invoicehash~invoice"
+)
+
+// ============== Invoice Financing ==============
+
+// Register an invoice, called by the seller's organization. An invoice whose
+// document hash is already registered is rejected.
+func (s *SmartContract) RegisterInvoice(
+	ctx contractapi.TransactionContextInterface,
+	invoiceID string,
+	invoiceHash string,
+	sellerID string,
+	buyerID string,
+	amount string,
+	dueDate string,
+) error {
+	err := claimRequestID(ctx, "RegisterInvoice")
+	if err != nil {
+		return err
+	}
+	value, err := parseAmount(amount)
+	if err != nil {
+		return err
+	}
+
+	if invoiceHash == "" {
+		return fmt.Errorf("invoice hash is required")
+	}
+	if value.Sign() <= 0 {
+		return fmt.Errorf("invoice amount must be positive")
+	}
+	if _, err := time.Parse("2006-01-02", dueDate); err != nil {
+		return fmt.Errorf("invalid due date %s, expected YYYY-MM-DD", dueDate)
+	}
+
+	seller, err := s.accountOf(ctx, sellerID)
+	if err != nil {
+		return err
+	}
+	err = requireOperatorOf(ctx, seller)
+	if err != nil {
+		return err
+	}
+	_, err = s.accountOf(ctx, buyerID)
+	if err != nil {
+		return err
+	}
+
+	var existing Invoice
+	exists, err := getRecord(ctx, invoiceObjectType, []string{invoiceID}, &existing)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("invoice %s already exists", invoiceID)
+	}
+
+	duplicates, err := ctx.GetStub().GetStateByPartialCompositeKey(invoiceHashIndex, []string{invoiceHash})
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer duplicates.Close()
+	if duplicates.HasNext() {
+		return fmt.Errorf("an invoice with hash %s is already registered", invoiceHash)
+	}
+
+	err = s.putIndex(ctx, invoiceHashIndex, invoiceHash, invoiceID)
+	if err != nil {
+		return err
+	}
+
+	return putRecord(ctx, invoiceObjectType, []string{invoiceID}, Invoice{
+		InvoiceID:   invoiceID,
+		InvoiceHash: invoiceHash,
+		SellerID:    sellerID,
+		BuyerID:     buyerID,
+		Amount:      token.NewAmount(value),
+		DueDate:     dueDate,
+		Status:      "REGISTERED",
+	})
+}
+
+func (s *SmartContract) GetInvoice(
+	ctx contractapi.TransactionContextInterface,
+	invoiceID string,
+) (*Invoice, error) {
+	var invoice Invoice
+	exists, err := getRecord(ctx, invoiceObjectType, []string{invoiceID}, &invoice)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("invoice %s does not exist", invoiceID)
+	}
+	return &invoice, nil
+}
+
+// Request a loan to the invoice's seller financed against the invoice, for at
+// most its amount
+func (s *SmartContract) RequestInvoiceLoan(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	invoiceID string,
+	amount string,
+	interestRate string,
+	duration int,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "RequestInvoiceLoan")
+	if err != nil {
+		return nil, err
+	}
+	value, err := parseAmount(amount)
+	if err != nil {
+		return nil, err
+	}
+	rate, err := parseRate(interestRate)
+	if err != nil {
+		return nil, err
+	}
+
+	invoice, err := s.GetInvoice(ctx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	if invoice.Status != "REGISTERED" {
+		return nil, fmt.Errorf("invoice %s is already financed by loan %s", invoiceID, invoice.LoanID)
+	}
+	if value.Cmp(invoice.Amount.Rat()) > 0 {
+		return nil, fmt.Errorf("amount %s exceeds the invoice amount of %s", token.FormatAmount(value), invoice.Amount)
+	}
+
+	loan, err := s.newLoan(ctx, loanID, invoice.SellerID, value, rate, duration, "Invoice "+invoiceID, "", "")
+	if err != nil {
+		return nil, err
+	}
+	loan.InvoiceID = invoiceID
+
+	invoice.Status = "FINANCED"
+	invoice.LoanID = loanID
+	err = putRecord(ctx, invoiceObjectType, []string{invoiceID}, invoice)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.openLoan(ctx, loan)
+}
+
+// Repay an invoice financing loan from the invoice buyer's account, called by
+// the buyer's organization
+func (s *SmartContract) RepayInvoiceLoan(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	amount string,
+	paymentReference string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "RepayInvoiceLoan")
+	if err != nil {
+		return nil, err
+	}
+	value, err := parseAmount(amount)
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.readLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	if loan.InvoiceID == "" {
+		return nil, fmt.Errorf("loan %s is not an invoice financing loan", loanID)
+	}
+
+	invoice, err := s.GetInvoice(ctx, loan.InvoiceID)
+	if err != nil {
+		return nil, err
+	}
+	buyer, err := s.accountOf(ctx, invoice.BuyerID)
+	if err != nil {
+		return nil, err
+	}
+	err = requireOperatorOf(ctx, buyer)
+	if err != nil {
+		return nil, err
+	}
+
+	repaymentID, err := nextRecordID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.repay(ctx, loan, invoice.BuyerID, value, new(big.Rat), paymentReference, repaymentID)
+}
+
+// Frees the invoice of a loan that will not be disbursed so it can be financed again
+func (s *SmartContract) releaseInvoice(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+) error {
+	if loan.InvoiceID == "" {
+		return nil
+	}
+
+	invoice, err := s.GetInvoice(ctx, loan.InvoiceID)
+	if err != nil {
+		return err
+	}
+	if invoice.LoanID != loan.LoanID {
+		return nil
+	}
+
+	invoice.Status = "REGISTERED"
+	invoice.LoanID = ""
+	return putRecord(ctx, invoiceObjectType, []string{invoice.InvoiceID}, invoice)
+}
@@ -3,108 +3,283 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	
+	"math/big"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
 )
 
 type Loan struct {
-	LoanID           string    `json:"loanId"`
-	BorrowerID       string    `json:"borrowerId"`
-	LenderID         string    `json:"lenderId"`
-	Amount           float64   `json:"amount"`
-	InterestRate     float64   `json:"interestRate"`
-	Duration         int       `json:"duration"`
-	Status           string    `json:"status"` // PENDING, APPROVED, ACTIVE, REPAID, DEFAULTED
-	DisbursementDate string    `json:"disbursementDate"`
-	RepaymentDue     float64   `json:"repaymentDue"`
-	RemainingBalance float64   `json:"remainingBalance"`
-	Collateral       string    `json:"collateral"`
-	Defaulted        bool      `json:"defaulted"`
-	AuditHistory     []string  `json:"auditHistory"`
-	CreatedAt        string    `json:"createdAt"`
-	DueDate          string    `json:"dueDate"`
-}
-
-type TokenBalance struct {
-	Account string  `json:"account"`
-	Balance float64 `json:"balance"`
+	DocType              string                  `json:"docType,omitempty" metadata:",optional"`
+	LoanID               string                  `json:"loanId"`
+	BorrowerID           string                  `json:"borrowerId"`
+	LenderID             string                  `json:"lenderId"`
+	Amount               token.Amount            `json:"amount"`
+	InterestRate         Decimal                 `json:"interestRate"`
+	Duration             int                     `json:"duration"`
+	Status               string                  `json:"status"` // PENDING, APPROVED, SETTLING, ACTIVE, REPAID, DEFAULTED, REJECTED, CANCELLED
+	DisbursementDate     string                  `json:"disbursementDate"`
+	RepaymentDue         token.Amount            `json:"repaymentDue"`
+	RemainingBalance     token.Amount            `json:"remainingBalance"`
+	Collateral           string                  `json:"collateral"`
+	Defaulted            bool                    `json:"defaulted"`
+	AuditHistory         []string                `json:"auditHistory"`
+	CreatedAt            string                  `json:"createdAt"`
+	DueDate              string                  `json:"dueDate"`
+	PolicyResults        []PolicyRuleResult      `json:"policyResults,omitempty" metadata:",optional"`
+	ApprovedAt           string                  `json:"approvedAt,omitempty" metadata:",optional"`
+	Product              string                  `json:"product,omitempty" metadata:",optional"`
+	PSLCategory          string                  `json:"pslCategory,omitempty" metadata:",optional"` // AGRICULTURE, MSME, EDUCATION, HOUSING
+	Metadata             map[string]string       `json:"metadata,omitempty" metadata:",optional"`
+	ClosedAt             string                  `json:"closedAt,omitempty" metadata:",optional"`
+	DefaultedAt          string                  `json:"defaultedAt,omitempty" metadata:",optional"`
+	DefaultedBalance     token.Amount            `json:"defaultedBalance,omitempty" metadata:",optional"` // remaining balance written off at default
+	DefaultReason        string                  `json:"defaultReason,omitempty" metadata:",optional"`    // reason code given when defaulted
+	Reserved             token.Amount            `json:"reserved,omitempty" metadata:",optional"`         // lender funds earmarked from approval until disbursement
+	Archived             bool                    `json:"archived,omitempty" metadata:",optional"`
+	SchemeID             string                  `json:"schemeId,omitempty" metadata:",optional"`
+	SubventionRate       Decimal                 `json:"subventionRate,omitempty" metadata:",optional"` // interest points borne by the scheme
+	SubventionClaimed    token.Amount            `json:"subventionClaimed,omitempty" metadata:",optional"`
+	InvoiceID            string                  `json:"invoiceId,omitempty" metadata:",optional"` // set for invoice financing loans
+	Gold                 *GoldCollateral         `json:"gold,omitempty" metadata:",optional"`
+	Vehicle              *VehicleCollateral      `json:"vehicle,omitempty" metadata:",optional"`
+	Property             *PropertyCollateral     `json:"property,omitempty" metadata:",optional"`
+	Pledges              []*CollateralPledge     `json:"pledges,omitempty" metadata:",optional"`      // assets of the collateral registry
+	Substitution         *CollateralSubstitution `json:"substitution,omitempty" metadata:",optional"` // latest proposal to swap a registry asset
+	Novation             *LoanNovation           `json:"novation,omitempty" metadata:",optional"`     // latest proposal to transfer the loan to another borrower
+	Escalation           *ApprovalEscalation     `json:"escalation,omitempty" metadata:",optional"`   // approval above the approving officer's authority
+	Consent              *ConsentArtifact        `json:"consent,omitempty" metadata:",optional"`
+	RejectionReason      string                  `json:"rejectionReason,omitempty" metadata:",optional"`
+	PriorApplicationID   string                  `json:"priorApplicationId,omitempty" metadata:",optional"`   // rejected application this one re-applies for
+	InterestMethod       string                  `json:"interestMethod,omitempty" metadata:",optional"`       // FLAT, SIMPLE, COMPOUND
+	CompoundingFrequency int                     `json:"compoundingFrequency,omitempty" metadata:",optional"` // compounding periods a year
+	Dispute              *LoanDispute            `json:"dispute,omitempty" metadata:",optional"`
+	AmountBand           string                  `json:"amountBand,omitempty" metadata:",optional"` // principal range, in place of amounts when Redacted
+	Redacted             bool                    `json:"redacted,omitempty" metadata:",optional"`   // view for a caller not party to the loan
+	Branch               string                  `json:"branch,omitempty" metadata:",optional"`     // branch certificate attribute of the requesting identity
+	Mandate              *RepaymentMandate       `json:"mandate,omitempty" metadata:",optional"`
+	Margin               token.Amount            `json:"margin,omitempty" metadata:",optional"` // cash margin earmarked in the borrower's account
+	Restructurings       []*LoanRestructuring    `json:"restructurings,omitempty" metadata:",optional"`
+	RateResets           []*RateReset            `json:"rateResets,omitempty" metadata:",optional"`
+	AccruedInterest      token.Amount            `json:"accruedInterest,omitempty" metadata:",optional"`  // as of ProcessedThrough
+	DaysPastDue          int                     `json:"daysPastDue,omitempty" metadata:",optional"`      // as of ProcessedThrough
+	AssetClass           string                  `json:"assetClass,omitempty" metadata:",optional"`       // as of ProcessedThrough
+	PenalCharges         token.Amount            `json:"penalCharges,omitempty" metadata:",optional"`     // charged on the overdue balance, included in RepaymentDue
+	ProcessedThrough     string                  `json:"processedThrough,omitempty" metadata:",optional"` // last day run by ProcessDay, YYYY-MM-DD
+	Tranches             []*Tranche              `json:"tranches,omitempty" metadata:",optional"`         // disbursed so far, for loans disbursed in tranches
+	BlendedRate          Decimal                 `json:"blendedRate,omitempty" metadata:",optional"`      // tranche rates weighted by principal and time out
+	Benchmark            string                  `json:"benchmark,omitempty" metadata:",optional"`        // floating rate loans, priced at its fixing plus Spread
+	Spread               Decimal                 `json:"spread,omitempty" metadata:",optional"`
+	Cancellation         *CommitmentCancellation `json:"cancellation,omitempty" metadata:",optional"`     // latest request to cancel undrawn commitment
+	CommitmentFees       token.Amount            `json:"commitmentFees,omitempty" metadata:",optional"`   // charged on undrawn tranches, included in RepaymentDue
+	CommitmentFrom       string                  `json:"commitmentFrom,omitempty" metadata:",optional"`   // RFC3339, commitment fee charged up to
+	BorrowerDataHash     string                  `json:"borrowerDataHash,omitempty" metadata:",optional"` // SHA-256 of the personal data given with the application, kept in borrowerPIICollection
+
+	// Keys of the pending repayments folded in when the loan was read, removed when it is saved
+	pendingRepayments []string
+}
+
+// A page of a loan's audit entries, Start is the position of the first
+type AuditTrailPage struct {
+	LoanID   string   `json:"loanId"`
+	Start    int      `json:"start"`
+	Total    int      `json:"total"`
+	Entries  []string `json:"entries"`
+	Bookmark string   `json:"bookmark"` // empty on the last page
 }
 
+// The token functions are embedded so a single chaincode deployment keeps
+// exposing them alongside the loan functions
 type SmartContract struct {
-	contractapi.Contract
+	token.TokenContract
 }
 
-// Initialize ledger with token balances
-func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface) error {
-	balances := []TokenBalance{
-		{Account: "RBI", Balance: 1000000},
-		{Account: "HDFC", Balance: 500000},
-		{Account: "SBI", Balance: 500000},
+// Request a new loan. Personal data of the borrower goes in the transient map
+// under "borrower_pii", never in the loan: it is kept in the borrower's
+// private data and the loan records only its hash.
+func (s *SmartContract) RequestLoan(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	borrowerID string,
+	amount string,
+	interestRate string,
+	duration int,
+	collateral string,
+	product string,
+	pslCategory string,
+	priorLoanID string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "RequestLoan")
+	if err != nil {
+		return nil, err
+	}
+	value, err := parseAmount(amount)
+	if err != nil {
+		return nil, err
+	}
+	rate, err := parseRate(interestRate)
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.newLoan(ctx, loanID, borrowerID, value, rate, duration, collateral, product, pslCategory)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, balance := range balances {
-		balanceJSON, err := json.Marshal(balance)
-		if err != nil {
-			return err
-		}
-		err = ctx.GetStub().PutState(balance.Account, balanceJSON)
+	if priorLoanID != "" {
+		err = s.linkPriorApplication(ctx, loan, priorLoanID)
 		if err != nil {
-			return fmt.Errorf("failed to put to world state: %v", err)
+			return nil, err
 		}
 	}
 
-	return nil
+	return s.openLoan(ctx, loan)
 }
 
-// Request a new loan
-func (s *SmartContract) RequestLoan(
+// Validates a loan request and builds the PENDING loan
+func (s *SmartContract) newLoan(
 	ctx contractapi.TransactionContextInterface,
 	loanID string,
 	borrowerID string,
-	amount float64,
-	interestRate float64,
+	amount *big.Rat,
+	interestRate *big.Rat,
 	duration int,
 	collateral string,
-) error {
+	product string,
+	pslCategory string,
+) (*Loan, error) {
 	exists, err := s.LoanExists(ctx, loanID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if exists {
-		return fmt.Errorf("loan %s already exists", loanID)
+		return nil, fmt.Errorf("loan %s already exists", loanID)
+	}
+
+	_, err = s.requireAccountType(ctx, borrowerID, token.AccountBorrower)
+	if err != nil {
+		return nil, err
+	}
+	err = token.ScreenParties(ctx, borrowerID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.validatePSLCategory(ctx, product, pslCategory, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.checkVelocity(ctx, borrowerID, config.Velocity)
+	if err != nil {
+		return nil, err
+	}
+
+	branch, err := callerAttribute(ctx, branchAttribute)
+	if err != nil {
+		return nil, err
+	}
+
+	borrowerDataHash, err := s.applicationPII(ctx, borrowerID)
+	if err != nil {
+		return nil, err
 	}
 
 	txTime, _ := ctx.GetStub().GetTxTimestamp()
 	dueDate := time.Unix(txTime.GetSeconds(), 0).AddDate(0, duration, 0)
 
 	loan := Loan{
-		LoanID:       loanID,
-		BorrowerID:   borrowerID,
-		Amount:       amount,
-		InterestRate: interestRate,
-		Duration:     duration,
-		Status:       "PENDING",
-		RepaymentDue: amount * (1 + interestRate/100),
-		RemainingBalance: amount * (1 + interestRate/100),
-		Collateral:   collateral,
-		Defaulted:    false,
-		CreatedAt:    fmt.Sprintf("%d", txTime.GetSeconds()),
-		DueDate:      dueDate.Format(time.RFC3339),
+		LoanID:           loanID,
+		BorrowerID:       borrowerID,
+		Amount:           token.NewAmount(amount),
+		InterestRate:     newRate(interestRate),
+		InterestMethod:   interestFlat,
+		Duration:         duration,
+		Status:           "PENDING",
+		Collateral:       collateral,
+		Product:          product,
+		PSLCategory:      pslCategory,
+		Branch:           branch,
+		BorrowerDataHash: borrowerDataHash,
+		Defaulted:        false,
+		CreatedAt:        fmt.Sprintf("%d", txTime.GetSeconds()),
+		DueDate:          dueDate.Format(time.RFC3339),
 		AuditHistory: []string{
-			fmt.Sprintf("Loan requested by %s (TxID: %s)", 
-				borrowerID, 
+			fmt.Sprintf("Loan requested by %s (TxID: %s)",
+				borrowerID,
 				ctx.GetStub().GetTxID()),
 		},
 	}
+	loan.RepaymentDue = repaymentDue(&loan, config.Rounding)
+	loan.RemainingBalance = loan.RepaymentDue
 
-	loanJSON, err := json.Marshal(loan)
+	return &loan, nil
+}
+
+// Saves and indexes a new loan
+func (s *SmartContract) openLoan(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+) (*LoanResult, error) {
+	createdAt, ok := unixTime(loan.CreatedAt)
+	if !ok {
+		return nil, fmt.Errorf("loan %s has an invalid creation time", loan.LoanID)
+	}
+
+	err := s.putIndex(ctx, borrowerLoanIndex, loan.BorrowerID, loan.LoanID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	err = s.putDateIndex(ctx, createdLoanIndex, createdAt, loan.LoanID)
+	if err != nil {
+		return nil, err
+	}
+	err = s.putIndex(ctx, applicationLoanIndex, loan.LoanID)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Collateral != "" {
+		err = s.indexCollateral(ctx, loan.LoanID, collateralOther, "", loan.Collateral)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if loan.InvoiceID != "" {
+		err = s.indexCollateral(ctx, loan.LoanID, collateralInvoice, "", loan.InvoiceID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.putLoan(ctx, loan)
+	if err != nil {
+		return nil, err
 	}
 
-	return ctx.GetStub().PutState(loanID, loanJSON)
+	header, err := newLoanEventHeader(ctx, loan.LoanID, 2)
+	if err != nil {
+		return nil, err
+	}
+	return newLoanResult(ctx, loan).emit(ctx, eventLoanRequested, LoanRequestedEventV2{
+		LoanEventHeader: header,
+		BorrowerID:      loan.BorrowerID,
+		Amount:          loan.Amount,
+		InterestRate:    loan.InterestRate,
+		Duration:        loan.Duration,
+		Product:         loan.Product,
+	})
 }
 
 // Approve a loan request
@@ -112,239 +287,873 @@ func (s *SmartContract) ApproveLoan(
 	ctx contractapi.TransactionContextInterface,
 	loanID string,
 	lenderID string,
-) error {
-	loan, err := s.GetLoan(ctx, loanID)
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "ApproveLoan")
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
 	}
 
 	if loan.Status != "PENDING" {
-		return fmt.Errorf("loan %s cannot be approved in current status: %s", loanID, loan.Status)
+		return nil, fmt.Errorf("loan %s cannot be approved in current status: %s", loanID, loan.Status)
 	}
 
-	// Check lender balance
-	lenderBalance, err := s.GetBalance(ctx, lenderID)
+	err = s.requireLender(ctx, lenderID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	err = token.ScreenParties(ctx, loan.BorrowerID, lenderID)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if config.RequireAAConsent {
+		err = requireValidConsent(ctx, loan)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Approvals above the officer's authority wait for a second officer
+	escalated, err := s.checkApprovalAuthority(ctx, loan, lenderID, config)
+	if err != nil {
+		return nil, err
+	}
+	if escalated {
+		err = s.putLoan(ctx, loan)
+		if err != nil {
+			return nil, err
+		}
+
+		header, err := newLoanEventHeader(ctx, loanID, 2)
+		if err != nil {
+			return nil, err
+		}
+		return newLoanResult(ctx, loan).emit(ctx, eventLoanApprovalEscalated, LoanApprovalEscalatedEventV2{
+			LoanEventHeader: header,
+			LenderID:        lenderID,
+			Amount:          loan.Amount,
+			MakerID:         loan.Escalation.MakerID,
+			MakerLimit:      loan.Escalation.MakerLimit,
+		})
+	}
+
+	// Run the credit policy, a failing loan is rejected with the results kept on it
+	loan.PolicyResults, err = s.evaluateCreditPolicy(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+	if failed := failedRules(loan.PolicyResults); len(failed) > 0 {
+		return s.rejectLoan(ctx, loan, lenderID, rejectCreditPolicy, failed)
+	}
+
+	// Approvals past the regulator's ceilings are rejected, the breach is kept
+	breached, err := s.checkLendingCaps(ctx, loan, lenderID, config)
+	if err != nil {
+		return nil, err
 	}
-	if lenderBalance < loan.Amount {
-		return fmt.Errorf("lender %s has insufficient funds", lenderID)
+	if len(breached) > 0 {
+		return s.rejectLoan(ctx, loan, lenderID, rejectLendingCap, breached)
+	}
+
+	approvedAt, err := txTime(ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	// Update loan status
 	loan.LenderID = lenderID
 	loan.Status = "APPROVED"
-	loan.AuditHistory = append(loan.AuditHistory, 
-		fmt.Sprintf("Loan approved by %s (TxID: %s)", 
-			lenderID, 
+	loan.ApprovedAt = fmt.Sprintf("%d", approvedAt.Unix())
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Loan approved by %s (TxID: %s)",
+			lenderID,
 			ctx.GetStub().GetTxID()))
 
-	loanJSON, err := json.Marshal(loan)
+	err = s.reserveFunds(ctx, loan, lenderID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	err = s.addExposure(ctx, loan, config.Rounding)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.putIndex(ctx, lenderLoanIndex, lenderID, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.hypothecateVehicle(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.createLien(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.encumberCollateral(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.putLoan(ctx, loan)
+	if err != nil {
+		return nil, err
 	}
 
-	return ctx.GetStub().PutState(loanID, loanJSON)
+	header, err := newLoanEventHeader(ctx, loanID, 2)
+	if err != nil {
+		return nil, err
+	}
+	return newLoanResult(ctx, loan).emit(ctx, eventLoanApproved, LoanApprovedEventV2{
+		LoanEventHeader: header,
+		BorrowerID:      loan.BorrowerID,
+		LenderID:        lenderID,
+		Amount:          loan.Amount,
+	})
 }
 
 // Disburse loan amount to borrower
 func (s *SmartContract) DisburseLoan(
 	ctx contractapi.TransactionContextInterface,
 	loanID string,
-) error {
-	loan, err := s.GetLoan(ctx, loanID)
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "DisburseLoan")
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
 	}
 
 	if loan.Status != "APPROVED" {
-		return fmt.Errorf("loan %s cannot be disbursed in current status: %s", loanID, loan.Status)
+		return nil, fmt.Errorf("loan %s cannot be disbursed in current status: %s", loanID, loan.Status)
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = requireApprovalCurrent(ctx, loan, config)
+	if err != nil {
+		return nil, err
+	}
+	err = repriceFloatingRate(ctx, loan, config)
+	if err != nil {
+		return nil, err
+	}
+
+	// The processing fee is deducted from the funds, a transaction moves tokens
+	// between two accounts once
+	processingFee, err := s.issueFeeInvoice(ctx, loan, feeProcessing, config.Fees.ProcessingRate, loan.LenderID, loan.BorrowerID, config)
+	if err != nil {
+		return nil, err
+	}
+	disbursed := loan.Amount.Rat()
+	if processingFee != nil {
+		disbursed = config.Rounding.round(ratSub(disbursed, processingFee.Total.Rat()))
+		if disbursed.Sign() <= 0 {
+			return nil, fmt.Errorf("processing fee of %s leaves nothing to disburse", processingFee.Total)
+		}
+	}
+
+	// Transfer tokens from lender to borrower, out of the funds reserved at approval
+	reserved, err := s.releaseReservation(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+	transfer, err := s.settleFrom(ctx, loan.LenderID, loan.BorrowerID, disbursed, token.ReasonDisbursement, loanID, reserved)
+	if err != nil {
+		return nil, err
+	}
+
+	platformFee, err := s.issueFeeInvoice(ctx, loan, feePlatform, config.Fees.PlatformRate, config.Fees.PlatformAccount, loan.LenderID, config)
+	if err != nil {
+		return nil, err
+	}
+	if platformFee != nil {
+		_, err = s.settleFrom(ctx, loan.LenderID, config.Fees.PlatformAccount, platformFee.Total.Rat(), token.ReasonPlatformFee, loanID, reserved)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Loan disbursed (TxID: %s)",
+			ctx.GetStub().GetTxID()))
+
+	return s.activateLoan(ctx, loan, transfer)
+}
+
+// Records a loan's funds as disbursed and makes it ACTIVE, transfer is the
+// disbursing token movement when it happened on this channel
+func (s *SmartContract) activateLoan(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	transfer *token.TokenEventV1,
+) (*LoanResult, error) {
+	err := s.startTerm(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.putLoan(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.withSchedule(ctx, loan, newLoanResult(ctx, loan))
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := newLoanEventHeader(ctx, loan.LoanID, 2)
+	if err != nil {
+		return nil, err
 	}
+	return result.emit(ctx, eventLoanDisbursed, LoanDisbursedEventV2{
+		LoanEventHeader: header,
+		BorrowerID:      loan.BorrowerID,
+		LenderID:        loan.LenderID,
+		Amount:          loan.Amount,
+		DueDate:         loan.DueDate,
+		Transfer:        transfer,
+	})
+}
 
-	// Transfer tokens from lender to borrower
-	err = s.TransferTokens(ctx, loan.LenderID, loan.BorrowerID, loan.Amount)
+// Makes a loan ACTIVE from the transaction's time, indexing its disbursement
+// and due dates and minting the lender's claim. The caller saves the loan.
+func (s *SmartContract) startTerm(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+) error {
+	disbursedAt, err := txTime(ctx)
 	if err != nil {
 		return err
 	}
 
-	// Update loan status
 	loan.Status = "ACTIVE"
-	txTime, _ := ctx.GetStub().GetTxTimestamp()
-	loan.DisbursementDate = fmt.Sprintf("%d", txTime.GetSeconds())
-	loan.AuditHistory = append(loan.AuditHistory, 
-		fmt.Sprintf("Loan disbursed (TxID: %s)", 
-			ctx.GetStub().GetTxID()))
+	loan.DisbursementDate = fmt.Sprintf("%d", disbursedAt.Unix())
 
-	loanJSON, err := json.Marshal(loan)
+	err = s.dequeueApplication(ctx, loan)
+	if err != nil {
+		return err
+	}
+
+	err = s.putDateIndex(ctx, disbursedLoanIndex, disbursedAt, loan.LoanID)
+	if err != nil {
+		return err
+	}
+	err = s.putIndex(ctx, activeLoanIndex, loan.LoanID)
+	if err != nil {
+		return err
+	}
+	dueDate, err := time.Parse(time.RFC3339, loan.DueDate)
+	if err != nil {
+		return fmt.Errorf("invalid due date %s: %v", loan.DueDate, err)
+	}
+	err = s.putDateIndex(ctx, dueLoanIndex, dueDate, loan.LoanID)
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(loanID, loanJSON)
+	return s.mintClaim(ctx, loan)
 }
 
-// Repay loan amount
+// Repay loan amount, paymentReference is the UPI transaction ID or RTGS/NEFT
+// UTR of the payment in the bank's core system. The repayment is recorded
+// under its own key, reading and writing no key another repayment of the
+// loan writes, so concurrent repayments of a loan do not conflict. It is
+// folded into the loan when the loan is read and saved by the next loan
+// transaction or ConsolidateRepayments, so the amount is bounded by the
+// balance as last saved and the result's balance is net of this repayment
+// only. Repayments pending beside it can together pay more than is owed, the
+// excess is recorded as due to the borrower when they are folded.
 func (s *SmartContract) RepayLoan(
 	ctx contractapi.TransactionContextInterface,
 	loanID string,
-	amount float64,
-) error {
-	loan, err := s.GetLoan(ctx, loanID)
+	amount string,
+	paymentReference string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "RepayLoan")
 	if err != nil {
-		return err
+		return nil, err
+	}
+	value, err := parseAmount(amount)
+	if err != nil {
+		return nil, err
+	}
+
+	// The stored loan is read without its pending repayments, reading those
+	// would conflict with every other repayment in flight
+	loan, err := s.readLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	repaymentID, err := nextRecordID(ctx)
+	if err != nil {
+		return nil, err
 	}
+	return s.repay(ctx, loan, loan.BorrowerID, value, new(big.Rat), paymentReference, repaymentID)
+}
+
+// Moves a repayment from the payer to the lender and records it against the
+// loan, rebate is the interest waived when the payment closes the loan early.
+// The repayment and its receipt are identified by repaymentID, assigned by
+// nextRecordID.
+func (s *SmartContract) repay(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	payer string,
+	amount *big.Rat,
+	rebate *big.Rat,
+	paymentReference string,
+	repaymentID string,
+) (*LoanResult, error) {
+	return s.repayFrom(ctx, loan, payer, amount, rebate, paymentReference, repaymentID, "")
+}
 
+// Repays drawing on the payer's earmark under reserved, if set
+func (s *SmartContract) repayFrom(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	payer string,
+	amount *big.Rat,
+	rebate *big.Rat,
+	paymentReference string,
+	repaymentID string,
+	reserved string,
+) (*LoanResult, error) {
 	if loan.Status != "ACTIVE" {
-		return fmt.Errorf("loan %s cannot be repaid in current status: %s", loanID, loan.Status)
+		return nil, fmt.Errorf("loan %s cannot be repaid in current status: %s", loan.LoanID, loan.Status)
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	outstanding := loan.RemainingBalance.Rat()
+	if amount.Cmp(outstanding) > 0 {
+		return nil, fmt.Errorf("repayment amount exceeds remaining balance of %s", loan.RemainingBalance)
 	}
 
-	// Check if repayment exceeds remaining balance
-	if amount > loan.RemainingBalance {
-		return fmt.Errorf("repayment amount exceeds remaining balance")
+	// Transfer tokens from the payer to the holders of the loan, less the tax
+	// withheld from the interest
+	interest := repaymentInterest(loan, amount, rebate, config.Rounding)
+	withheld := taxWithheld(interest, config)
+	// A prepayment priced at nothing closes the loan on its rebate alone, the
+	// ledger moves no zero amounts
+	var transfer *token.TokenEventV1
+	if paid := ratSub(amount, withheld); paid.Sign() > 0 {
+		transfer, err = s.payLoanHolders(ctx, loan, payer, paid, ratSub(interest, withheld), token.ReasonRepayment, reserved)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if withheld.Sign() > 0 {
+		err = s.withholdTax(ctx, loan, repaymentID, payer, interest, withheld, paymentReference, config, reserved)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// Transfer tokens from borrower to lender
-	err = s.TransferTokens(ctx, loan.BorrowerID, loan.LenderID, amount)
+	err = s.recordRepayment(ctx, loan, repaymentID, amount, rebate, paymentReference)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Update loan status
-	loan.RemainingBalance -= amount
-	if loan.RemainingBalance <= 0 {
-		loan.Status = "REPAID"
-	}
-	
-	loan.AuditHistory = append(loan.AuditHistory, 
-		fmt.Sprintf("Repayment of %f (TxID: %s)", 
-			amount, 
-			ctx.GetStub().GetTxID()))
+	err = s.issueReceipt(ctx, loan, repaymentID, payer, amount, rebate, paymentReference)
+	if err != nil {
+		return nil, err
+	}
 
-	loanJSON, err := json.Marshal(loan)
+	header, err := newLoanEventHeader(ctx, loan.LoanID, 2)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	event := LoanRepaidEventV2{
+		LoanEventHeader:  header,
+		ReceiptID:        repaymentID,
+		Amount:           token.NewAmount(amount),
+		PaymentReference: paymentReference,
+		RemainingBalance: config.Rounding.amount(ratSub(outstanding, ratAdd(amount, rebate))),
+		Closed:           ratAdd(amount, rebate).Cmp(outstanding) >= 0,
+		Rebate:           optionalAmount(rebate),
+		Withheld:         optionalAmount(withheld),
+		Transfer:         transfer,
+	}
+
+	// The loan is saved as repaid once the repayment is folded in, the result
+	// shows it as GetLoan will
+	result := newLoanResult(ctx, loan)
+	result.ReceiptID = repaymentID
+	result.RemainingBalance = event.RemainingBalance
+	if event.Closed {
+		result.Status = "REPAID"
 	}
+	return result.emit(ctx, eventLoanRepaid, event)
+}
 
-	return ctx.GetStub().PutState(loanID, loanJSON)
+// Reasons a loan can be marked as defaulted for
+var defaultReasonCodes = map[string]bool{
+	"NON_PAYMENT": true,
+	"WILFUL":      true, // wilful defaulter, able to pay but not paying
+	"FRAUD":       true,
+	"INSOLVENCY":  true,
+	"DECEASED":    true,
 }
 
-// Mark loan as defaulted
+// Mark an ACTIVE loan as defaulted for one of the default reason codes,
+// called by the organization operating the lender's account or by the
+// regulator. The loan must be past its due date by at least the configured
+// days past due.
 func (s *SmartContract) MarkAsDefaulted(
 	ctx contractapi.TransactionContextInterface,
 	loanID string,
-) error {
-	loan, err := s.GetLoan(ctx, loanID)
+	reasonCode string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "MarkAsDefaulted")
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if mspID != regulatorMSP {
+		err = s.requireLender(ctx, loan.LenderID)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if loan.Status != "ACTIVE" {
-		return fmt.Errorf("loan %s cannot be defaulted in current status: %s", loanID, loan.Status)
+		return nil, fmt.Errorf("loan %s cannot be defaulted in current status: %s", loanID, loan.Status)
+	}
+	if !defaultReasonCodes[reasonCode] {
+		return nil, fmt.Errorf("unknown default reason code %s", reasonCode)
+	}
+	err = requireNoOpenDispute(loan)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defaultedAt, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dueDate, err := time.Parse(time.RFC3339, loan.DueDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid due date %s of loan %s: %v", loan.DueDate, loanID, err)
+	}
+	daysPast := daysPastDue(loan, defaultedAt)
+	if !defaultedAt.After(dueDate) || daysPast < config.DefaultDPD {
+		return nil, fmt.Errorf("loan %s is %d days past due, %d required to default it", loanID, daysPast, config.DefaultDPD)
+	}
+
+	err = s.recordDefault(ctx, loan.BorrowerID)
+	if err != nil {
+		return nil, err
 	}
 
 	// Update loan status
+	// The undrawn part of a loan disbursed in tranches will not be lent
+	_, err = s.releaseReservation(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+
 	loan.Status = "DEFAULTED"
 	loan.Defaulted = true
-	loan.AuditHistory = append(loan.AuditHistory, 
-		fmt.Sprintf("Loan marked as defaulted (TxID: %s)", 
+	loan.DefaultedAt = fmt.Sprintf("%d", defaultedAt.Unix())
+	loan.DefaultedBalance = loan.RemainingBalance
+	loan.DefaultReason = reasonCode
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Loan marked as defaulted by %s for %s, %d days past due (TxID: %s)",
+			mspID,
+			reasonCode,
+			daysPast,
 			ctx.GetStub().GetTxID()))
 
-	loanJSON, err := json.Marshal(loan)
+	err = s.putLoan(ctx, loan)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return ctx.GetStub().PutState(loanID, loanJSON)
+	header, err := newLoanEventHeader(ctx, loanID, 2)
+	if err != nil {
+		return nil, err
+	}
+	return newLoanResult(ctx, loan).emit(ctx, eventLoanDefaulted, LoanDefaultedEventV2{
+		LoanEventHeader:  header,
+		BorrowerID:       loan.BorrowerID,
+		LenderID:         loan.LenderID,
+		RemainingBalance: loan.RemainingBalance,
+		ReasonCode:       reasonCode,
+		DaysPastDue:      daysPast,
+	})
 }
 
-// ============== Token Functions (ERC20-like) ==============
+// ============== Helper Functions ==============
+
+// Document type of loan records, used by CouchDB selectors and indexes
+const loanDocType = "loan"
+
+// Composite key indexes of loans by the lender that approved them, by borrower,
+// by the month and instant they were requested, disbursed and fall due, and
+// of the ACTIVE loans daily servicing walks
+const (
+	lenderLoanIndex    = "lender~loan"
+	borrowerLoanIndex  = "borrower~loan"
+	createdLoanIndex   = "created~loan"
+	disbursedLoanIndex = "disbursed~loan"
+	dueLoanIndex       = "due~loan"
+	tagLoanIndex       = "tag~loan"
+	activeLoanIndex    = "active~loan"
+)
+
+// Index of repayments by external payment reference
+const paymentReferenceIndex = "payref~repayment"
 
-func (s *SmartContract) GetBalance(
+func (s *SmartContract) putLoan(
 	ctx contractapi.TransactionContextInterface,
-	account string,
-) (float64, error) {
-	balanceJSON, err := ctx.GetStub().GetState(account)
+	loan *Loan,
+) error {
+	// Collateral registries follow the loan, a closed loan releases its charges
+	if loan.Status == "REPAID" {
+		err := s.releaseCollateral(ctx, loan)
+		if err != nil {
+			return err
+		}
+	}
+	// Daily servicing walks the loans still ACTIVE
+	if loan.Status != "ACTIVE" && loan.DisbursementDate != "" {
+		err := s.deleteIndex(ctx, activeLoanIndex, loan.LoanID)
+		if err != nil {
+			return err
+		}
+	}
+	// A closed loan no longer counts against the lending caps
+	if loan.Status == "REPAID" || loan.Status == "CANCELLED" || loan.Status == "EXPIRED" {
+		err := s.releaseExposure(ctx, loan)
+		if err != nil {
+			return err
+		}
+		err = s.releaseMargin(ctx, loan)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := stampAuditEntries(ctx, loan.AuditHistory)
 	if err != nil {
-		return 0, fmt.Errorf("failed to read from world state: %v", err)
+		return err
 	}
-	if balanceJSON == nil {
-		return 0, fmt.Errorf("account %s does not exist", account)
+
+	loan.DocType = loanDocType
+	loanJSON, err := json.Marshal(loan)
+	if err != nil {
+		return err
 	}
 
-	var balance TokenBalance
-	err = json.Unmarshal(balanceJSON, &balance)
+	err = ctx.GetStub().PutState(loan.LoanID, loanJSON)
 	if err != nil {
-		return 0, err
+		return err
+	}
+
+	// The saved loan includes the repayments folded in on read
+	for _, pendingKey := range loan.pendingRepayments {
+		err = ctx.GetStub().DelState(pendingKey)
+		if err != nil {
+			return err
+		}
 	}
+	loan.pendingRepayments = nil
 
-	return balance.Balance, nil
+	return nil
 }
 
-func (s *SmartContract) TransferTokens(
+func (s *SmartContract) releaseCollateral(
 	ctx contractapi.TransactionContextInterface,
-	from string,
-	to string,
-	amount float64,
+	loan *Loan,
 ) error {
-	// Get sender balance
-	fromBalance, err := s.GetBalance(ctx, from)
+	err := s.releaseHypothecation(ctx, loan)
 	if err != nil {
 		return err
 	}
 
-	// Check sufficient funds
-	if fromBalance < amount {
-		return fmt.Errorf("insufficient funds in account %s", from)
+	err = s.releaseLien(ctx, loan)
+	if err != nil {
+		return err
 	}
 
-	// Get recipient balance
-	toBalance, err := s.GetBalance(ctx, to)
+	return s.releaseEncumbrances(ctx, loan)
+}
+
+func (s *SmartContract) putIndex(
+	ctx contractapi.TransactionContextInterface,
+	index string,
+	attributes ...string,
+) error {
+	indexKey, err := ctx.GetStub().CreateCompositeKey(index, attributes)
 	if err != nil {
-		// If recipient doesn't exist, create with 0 balance
-		if err.Error() == fmt.Sprintf("account %s does not exist", to) {
-			toBalance = 0
-		} else {
-			return err
-		}
+		return fmt.Errorf("failed to create index key: %v", err)
 	}
 
-	// Update balances
-	fromBalance -= amount
-	toBalance += amount
+	// Index entries only need the key, the value is a placeholder
+	return ctx.GetStub().PutState(indexKey, []byte{0x00})
+}
 
-	// Save new balances
-	err = s.UpdateBalance(ctx, from, fromBalance)
+func (s *SmartContract) deleteIndex(
+	ctx contractapi.TransactionContextInterface,
+	index string,
+	attributes ...string,
+) error {
+	indexKey, err := ctx.GetStub().CreateCompositeKey(index, attributes)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to create index key: %v", err)
 	}
 
-	err = s.UpdateBalance(ctx, to, toBalance)
+	return ctx.GetStub().DelState(indexKey)
+}
+
+// Stores a record as JSON under a composite key
+func putRecord(
+	ctx contractapi.TransactionContextInterface,
+	objectType string,
+	attributes []string,
+	record interface{},
+) error {
+	recordJSON, err := json.Marshal(record)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	recordKey, err := ctx.GetStub().CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return fmt.Errorf("failed to create record key: %v", err)
+	}
+
+	return ctx.GetStub().PutState(recordKey, recordJSON)
 }
 
-func (s *SmartContract) UpdateBalance(
+// Loads the JSON record under a composite key into record, reporting whether it exists
+func getRecord(
 	ctx contractapi.TransactionContextInterface,
-	account string,
-	newBalance float64,
-) error {
-	balance := TokenBalance{
-		Account: account,
-		Balance: newBalance,
+	objectType string,
+	attributes []string,
+	record interface{},
+) (bool, error) {
+	recordKey, err := ctx.GetStub().CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return false, fmt.Errorf("failed to create record key: %v", err)
 	}
 
-	balanceJSON, err := json.Marshal(balance)
+	recordJSON, err := ctx.GetStub().GetState(recordKey)
 	if err != nil {
-		return err
+		return false, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if recordJSON == nil {
+		return false, nil
 	}
 
-	return ctx.GetStub().PutState(account, balanceJSON)
+	return true, json.Unmarshal(recordJSON, record)
 }
 
-// ============== Helper Functions ==============
+// Returns the loans whose index entries match the given leading attributes.
+// Transactions that write state cannot use paginated queries, so they use this
+// rather than forEachIndexedLoan.
+func (s *SmartContract) getIndexedLoans(
+	ctx contractapi.TransactionContextInterface,
+	index string,
+	attributes ...string,
+) ([]*Loan, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(index, attributes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	loans := []*Loan{}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		loan, err := s.getLoan(ctx, keyParts[len(keyParts)-1])
+		if err != nil {
+			return nil, err
+		}
+		loans = append(loans, loan)
+	}
+
+	return loans, nil
+}
+
+// Up to pageSize loans whose index entries match the given leading attributes
+// and follow the bookmark, in key order, for transactions that write state.
+// The peer refuses writes after a paginated query, so entries up to the
+// bookmark are skipped by key without reading their loans. The returned
+// bookmark joins the attributes of the last entry's key with "|", arguments
+// cannot carry the NULs of a composite key, and is empty once the index is
+// exhausted.
+func (s *SmartContract) getIndexedLoanBatch(
+	ctx contractapi.TransactionContextInterface,
+	index string,
+	attributes []string,
+	pageSize int,
+	bookmark string,
+) ([]*Loan, string, error) {
+	if pageSize <= 0 {
+		return nil, "", fmt.Errorf("page size must be positive")
+	}
+	after := ""
+	if bookmark != "" {
+		var err error
+		after, err = ctx.GetStub().CreateCompositeKey(index, strings.Split(bookmark, "|"))
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid bookmark %s", bookmark)
+		}
+	}
+
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(index, attributes)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	loans := []*Loan{}
+	next := ""
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, "", err
+		}
+		if entry.Key <= after {
+			continue
+		}
+		if len(loans) == pageSize {
+			return loans, next, nil
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+		if err != nil {
+			return nil, "", err
+		}
+		loan, err := s.getLoan(ctx, keyParts[len(keyParts)-1])
+		if err != nil {
+			return nil, "", err
+		}
+		loans = append(loans, loan)
+		next = strings.Join(keyParts, "|")
+	}
+
+	return loans, "", nil
+}
+
+// Page size used when a query walks an index to completion
+const indexPageSize = 100
+
+// Calls visit for every loan in an index, reading the index page by page so
+// large portfolios are never held in a single query response
+func (s *SmartContract) forEachIndexedLoan(
+	ctx contractapi.TransactionContextInterface,
+	index string,
+	attributes []string,
+	visit func(loan *Loan) error,
+) error {
+	bookmark := ""
+	for {
+		iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(index, attributes, indexPageSize, bookmark)
+		if err != nil {
+			return fmt.Errorf("failed to read from world state: %v", err)
+		}
+
+		for iterator.HasNext() {
+			entry, err := iterator.Next()
+			if err != nil {
+				iterator.Close()
+				return err
+			}
+
+			_, keyParts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+			if err != nil {
+				iterator.Close()
+				return err
+			}
+
+			loan, err := s.getLoan(ctx, keyParts[len(keyParts)-1])
+			if err != nil {
+				iterator.Close()
+				return err
+			}
+
+			err = visit(loan)
+			if err != nil {
+				iterator.Close()
+				return err
+			}
+		}
+		iterator.Close()
+
+		if metadata.GetFetchedRecordsCount() < indexPageSize || metadata.GetBookmark() == "" {
+			return nil
+		}
+		bookmark = metadata.GetBookmark()
+	}
+}
+
+func txTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+	return time.Unix(txTimestamp.GetSeconds(), 0).UTC(), nil
+}
+
+// Days a loan with an outstanding balance has been past its due date
+func daysPastDue(loan *Loan, asOf time.Time) int {
+	if loan.RemainingBalance.Rat().Sign() <= 0 || loan.DueDate == "" {
+		return 0
+	}
+
+	dueDate, err := time.Parse(time.RFC3339, loan.DueDate)
+	if err != nil || !asOf.After(dueDate) {
+		return 0
+	}
+
+	return int(asOf.Sub(dueDate).Hours() / 24)
+}
 
 func (s *SmartContract) LoanExists(
 	ctx contractapi.TransactionContextInterface,
@@ -357,9 +1166,41 @@ func (s *SmartContract) LoanExists(
 	return loanJSON != nil, nil
 }
 
+// Loan with its pending repayments applied, redacted for callers not party to it
 func (s *SmartContract) GetLoan(
 	ctx contractapi.TransactionContextInterface,
 	loanID string,
+) (*Loan, error) {
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.viewLoan(ctx, newLoanViewer(), loan)
+}
+
+// Loan with its pending repayments applied
+func (s *SmartContract) getLoan(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+) (*Loan, error) {
+	loan, err := s.readLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.applyPendingRepayments(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+
+	return loan, nil
+}
+
+// Loan as last saved, without pending repayments
+func (s *SmartContract) readLoan(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
 ) (*Loan, error) {
 	loanJSON, err := ctx.GetStub().GetState(loanID)
 	if err != nil {
@@ -378,22 +1219,69 @@ func (s *SmartContract) GetLoan(
 	return &loan, nil
 }
 
+// A loan's audit entries oldest first, pageSize at a time, see
+// GetAuditTrailPage
 func (s *SmartContract) GetLoanHistory(
 	ctx contractapi.TransactionContextInterface,
 	loanID string,
-) ([]string, error) {
+	pageSize int,
+	bookmark string,
+) (*AuditTrailPage, error) {
+	return s.GetAuditTrailPage(ctx, loanID, pageSize, bookmark)
+}
+
+// List a loan's audit entries oldest first, pageSize at a time. The bookmark
+// is the position of the next entry, entries are only ever appended so it
+// stays valid until the loan is archived.
+func (s *SmartContract) GetAuditTrailPage(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	pageSize int,
+	bookmark string,
+) (*AuditTrailPage, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive")
+	}
+	start := 0
+	if bookmark != "" {
+		var err error
+		start, err = strconv.Atoi(bookmark)
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("invalid bookmark %s", bookmark)
+		}
+	}
+
 	loan, err := s.GetLoan(ctx, loanID)
 	if err != nil {
 		return nil, err
 	}
-	return loan.AuditHistory, nil
+	total := len(loan.AuditHistory)
+	if start > total {
+		return nil, fmt.Errorf("bookmark %s is past the %d audit entries of loan %s", bookmark, total, loanID)
+	}
+
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+	page := AuditTrailPage{
+		LoanID:  loanID,
+		Start:   start,
+		Total:   total,
+		Entries: loan.AuditHistory[start:end],
+	}
+	if end < total {
+		page.Bookmark = strconv.Itoa(end)
+	}
+
+	return &page, nil
 }
 
 func (s *SmartContract) CheckLoanStatus(
 	ctx contractapi.TransactionContextInterface,
 	loanID string,
 ) (string, error) {
-	loan, err := s.GetLoan(ctx, loanID)
+	loan, err := s.getLoan(ctx, loanID)
 	if err != nil {
 		return "", err
 	}
@@ -404,28 +1292,49 @@ func (s *SmartContract) AddCollateral(
 	ctx contractapi.TransactionContextInterface,
 	loanID string,
 	collateral string,
-) error {
-	loan, err := s.GetLoan(ctx, loanID)
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "AddCollateral")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	loan.Collateral = collateral
-	loan.AuditHistory = append(loan.AuditHistory, 
-		fmt.Sprintf("Collateral added: %s (TxID: %s)", 
-			collateral, 
-			ctx.GetStub().GetTxID()))
-
-	loanJSON, err := json.Marshal(loan)
+	loan, err := s.getLoan(ctx, loanID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return ctx.GetStub().PutState(loanID, loanJSON)
+	if collateral != "" {
+		err = s.indexCollateral(ctx, loanID, collateralOther, loan.Collateral, collateral)
+		if err != nil {
+			return nil, err
+		}
+	} else if loan.Collateral != "" {
+		// Clearing the description drops the loan from the OTHER collateral
+		err = s.deleteIndex(ctx, collateralTypeIndex, collateralOther, loanID)
+		if err != nil {
+			return nil, err
+		}
+		err = s.deleteIndex(ctx, collateralIDIndex, loan.Collateral, loanID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	loan.Collateral = collateral
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Collateral added: %s (TxID: %s)",
+			collateral,
+			ctx.GetStub().GetTxID()))
+
+	return s.putLoanResult(ctx, loan)
 }
 
 func main() {
-	chaincode, err := contractapi.NewChaincode(&SmartContract{})
+	contract := &SmartContract{}
+	contract.TransactionContextHandler = new(TransactionContext)
+	contract.BeforeTransaction = validateArguments
+
+	chaincode, err := contractapi.NewChaincode(contract)
 	if err != nil {
 		fmt.Printf("Error creating lending chaincode: %s", err.Error())
 		return
@@ -434,4 +1343,4 @@ func main() {
 	if err := chaincode.Start(); err != nil {
 		fmt.Printf("Error starting lending chaincode: %s", err.Error())
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"lending/bench"
+)
+
+// Repayments of an active loan, each committed before the next, so the cost
+// includes what every repayment adds to the loan's state
+func BenchmarkRepayLoan(b *testing.B) {
+	l := newTestLedger(b)
+	l.borrower("B1", "400000")
+	l.disbursedLoan("L1", "B1", "400000")
+
+	bench.Benchmark(b, l.stub, l.repayment("L1"))
+}
+
+// What a repayment adds to the state stays the same as repayments pile up,
+// rather than growing with the loan's history
+func TestRepayLoanStateGrowth(t *testing.T) {
+	l := newTestLedger(t)
+	l.borrower("B1", "400000")
+	l.disbursedLoan("L1", "B1", "400000")
+
+	repay := l.repayment("L1")
+	first := bench.Run(l.stub, "RepayLoan", 50, repay)
+	later := bench.Run(l.stub, "RepayLoan", 50, func(n int) error { return repay(50 + n) })
+	if testing.Verbose() {
+		first.Report(os.Stdout)
+		later.Report(os.Stdout)
+	}
+
+	if first.Failed+later.Failed > 0 {
+		t.Fatalf("%d repayments failed", first.Failed+later.Failed)
+	}
+	firstKeys, firstBytes := first.Growth()
+	laterKeys, laterBytes := later.Growth()
+	if laterKeys > firstKeys || laterBytes > firstBytes*1.05 {
+		t.Errorf("repayments add %.1f keys, %.0f bytes each after 50, %.1f keys, %.0f bytes before",
+			laterKeys, laterBytes, firstKeys, firstBytes)
+	}
+}
+
+// Submits the n-th repayment of 1 on a loan
+func (l *testLedger) repayment(loanID string) func(n int) error {
+	return func(n int) error {
+		return l.submit(hdfc, func(ctx *TransactionContext) error {
+			_, err := l.contract.RepayLoan(ctx, loanID, "1", fmt.Sprintf("UTR%d", n))
+			return err
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// NACH debit mandate authorizing ProcessDay to collect the loan's repayment
+// from the borrower's account once it falls due
+type RepaymentMandate struct {
+	UMRN         string       `json:"umrn"`      // unique mandate reference number from NPCI
+	MaxAmount    token.Amount `json:"maxAmount"` // largest single collection
+	RegisteredAt string       `json:"registeredAt"`
+}
+
+// ============== Repayment Mandates ==============
+
+// Register the borrower's debit mandate for an APPROVED or ACTIVE loan,
+// replacing any earlier one. Callable by the organization operating the
+// borrower's account.
+func (s *SmartContract) RegisterMandate(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	umrn string,
+	maxAmount string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "RegisterMandate")
+	if err != nil {
+		return nil, err
+	}
+	value, err := parseAmount(maxAmount)
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	borrower, err := s.accountOf(ctx, loan.BorrowerID)
+	if err != nil {
+		return nil, err
+	}
+	err = requireOperatorOf(ctx, borrower)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Status != "APPROVED" && loan.Status != "ACTIVE" {
+		return nil, fmt.Errorf("loan %s cannot take a mandate in current status: %s", loanID, loan.Status)
+	}
+	if umrn == "" {
+		return nil, fmt.Errorf("mandate reference is required")
+	}
+	if value.Sign() <= 0 {
+		return nil, fmt.Errorf("mandate amount must be positive")
+	}
+
+	registeredAt, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	loan.Mandate = &RepaymentMandate{
+		UMRN:         umrn,
+		MaxAmount:    token.NewAmount(value),
+		RegisteredAt: registeredAt.Format(time.RFC3339),
+	}
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Repayment mandate %s registered for up to %s (TxID: %s)",
+			umrn,
+			loan.Mandate.MaxAmount,
+			ctx.GetStub().GetTxID()))
+
+	return s.putLoanResult(ctx, loan)
+}
+
+// Cancel the loan's debit mandate, callable by the organization operating the
+// borrower's account
+func (s *SmartContract) CancelMandate(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "CancelMandate")
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	borrower, err := s.accountOf(ctx, loan.BorrowerID)
+	if err != nil {
+		return nil, err
+	}
+	err = requireOperatorOf(ctx, borrower)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Mandate == nil {
+		return nil, fmt.Errorf("loan %s has no mandate", loanID)
+	}
+
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Repayment mandate %s cancelled (TxID: %s)",
+			loan.Mandate.UMRN,
+			ctx.GetStub().GetTxID()))
+	loan.Mandate = nil
+
+	return s.putLoanResult(ctx, loan)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// ============== Cash Margin ==============
+
+// Reference a loan's cash margin is earmarked under in the borrower's account
+func marginReference(loanID string) string {
+	return "margin:" + loanID
+}
+
+// Pledge amount of the borrower's available balance as cash margin against
+// the loan, callable by the organization operating the borrower's account.
+// Overdue amounts are debited from the margin before any mandate, and what is
+// left is released when the loan closes.
+func (s *SmartContract) PostMargin(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	amount string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "PostMargin")
+	if err != nil {
+		return nil, err
+	}
+	value, err := parseAmount(amount)
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	borrower, err := s.accountOf(ctx, loan.BorrowerID)
+	if err != nil {
+		return nil, err
+	}
+	err = requireOperatorOf(ctx, borrower)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Status != "APPROVED" && loan.Status != "ACTIVE" {
+		return nil, fmt.Errorf("loan %s cannot take a margin in current status: %s", loanID, loan.Status)
+	}
+	if value.Sign() <= 0 {
+		return nil, fmt.Errorf("margin amount must be positive")
+	}
+
+	margin, err := s.increaseEarmark(ctx, loan.BorrowerID, marginReference(loanID), value)
+	if err != nil {
+		return nil, err
+	}
+
+	loan.Margin = token.NewAmount(margin)
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Cash margin of %s posted from account %s, %s pledged (TxID: %s)",
+			token.FormatAmount(value),
+			loan.BorrowerID,
+			loan.Margin,
+			ctx.GetStub().GetTxID()))
+
+	return s.putLoanResult(ctx, loan)
+}
+
+// Debits an overdue loan's cash margin towards its balance. The collection is
+// returned for ProcessDay to report, nil when the loan has no margin.
+func (s *SmartContract) drawMargin(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	asOfDate string,
+) (*MandateCollection, error) {
+	if loan.Margin.Rat().Sign() == 0 || loan.RemainingBalance.Rat().Sign() <= 0 {
+		return nil, nil
+	}
+
+	value := ratMin(loan.Margin.Rat(), loan.RemainingBalance.Rat())
+	collection := &MandateCollection{
+		LoanID:           loan.LoanID,
+		Amount:           token.NewAmount(value),
+		PaymentReference: fmt.Sprintf("MARGIN-%s-%s", loan.LoanID, asOfDate),
+		Status:           collectionCollected,
+	}
+
+	refusal, err := s.debitRefusal(ctx, loan.BorrowerID, value, marginReference(loan.LoanID))
+	if err != nil {
+		return nil, err
+	}
+	if refusal != "" {
+		collection.Status = collectionBounced
+		loan.AuditHistory = append(loan.AuditHistory,
+			fmt.Sprintf("Cash margin debit of %s bounced, %s (TxID: %s)",
+				collection.Amount,
+				refusal,
+				ctx.GetStub().GetTxID()))
+		return collection, nil
+	}
+
+	remaining, err := s.drawEarmark(ctx, loan.BorrowerID, marginReference(loan.LoanID), value)
+	if err != nil {
+		return nil, err
+	}
+
+	loan.Margin = token.NewAmount(remaining)
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Cash margin of %s debited for amounts overdue as of %s (TxID: %s)",
+			collection.Amount,
+			asOfDate,
+			ctx.GetStub().GetTxID()))
+
+	return collection, nil
+}
+
+// Returns what is left of a closed loan's cash margin to the borrower's
+// available balance
+func (s *SmartContract) releaseMargin(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+) error {
+	if loan.Margin.Rat().Sign() == 0 {
+		return nil
+	}
+
+	err := s.releaseEarmark(ctx, loan.BorrowerID, marginReference(loan.LoanID))
+	if err != nil {
+		return err
+	}
+
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Cash margin of %s released to account %s (TxID: %s)",
+			loan.Margin,
+			loan.BorrowerID,
+			ctx.GetStub().GetTxID()))
+	loan.Margin = ""
+	return nil
+}
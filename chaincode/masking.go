@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Upper bounds of the principal ranges shown on redacted loans
+var amountBands = []int64{50000, 100000, 500000, 1000000, 5000000, 10000000}
+
+// Decides which loans a query caller sees in full. The regulator and the
+// organizations operating a loan's borrower or lender account see everything,
+// other callers get a redacted view so anonymized demand can still be browsed.
+// Identities with a branch attribute only see their own branch's loans in full.
+type loanViewer struct {
+	mspID       string
+	branch      string
+	accountOrgs map[string]string // operating organization by account, looked up once per query
+}
+
+func newLoanViewer() *loanViewer {
+	return &loanViewer{accountOrgs: map[string]string{}}
+}
+
+// The loan as the caller may see it
+func (s *SmartContract) viewLoan(
+	ctx contractapi.TransactionContextInterface,
+	viewer *loanViewer,
+	loan *Loan,
+) (*Loan, error) {
+	party, err := s.isPartyTo(ctx, viewer, loan)
+	if err != nil {
+		return nil, err
+	}
+	if party {
+		return loan, nil
+	}
+
+	return redactLoan(loan), nil
+}
+
+// Replaces each loan with the view of it the caller may see
+func (s *SmartContract) viewLoans(
+	ctx contractapi.TransactionContextInterface,
+	loans []*Loan,
+) error {
+	viewer := newLoanViewer()
+	for i, loan := range loans {
+		view, err := s.viewLoan(ctx, viewer, loan)
+		if err != nil {
+			return err
+		}
+		loans[i] = view
+	}
+	return nil
+}
+
+func (s *SmartContract) isPartyTo(
+	ctx contractapi.TransactionContextInterface,
+	viewer *loanViewer,
+	loan *Loan,
+) (bool, error) {
+	if viewer.mspID == "" {
+		mspID, err := callerMSP(ctx)
+		if err != nil {
+			return false, err
+		}
+		viewer.mspID = mspID
+		viewer.branch, err = callerAttribute(ctx, branchAttribute)
+		if err != nil {
+			return false, err
+		}
+	}
+	if viewer.mspID == regulatorMSP {
+		return true, nil
+	}
+	if viewer.branch != "" && loan.Branch != "" && loan.Branch != viewer.branch {
+		return false, nil
+	}
+
+	payee, err := s.payeeOf(ctx, loan)
+	if err != nil {
+		return false, err
+	}
+
+	for _, accountID := range []string{loan.BorrowerID, loan.LenderID, payee} {
+		if accountID == "" {
+			continue
+		}
+		orgMSP, ok := viewer.accountOrgs[accountID]
+		if !ok {
+			account, err := s.accountOf(ctx, accountID)
+			if err != nil {
+				return false, err
+			}
+			orgMSP = account.OrgMSP
+			viewer.accountOrgs[accountID] = orgMSP
+		}
+		// As with requireOperatorOf, an account without an organization is open to any caller
+		if orgMSP == "" || orgMSP == viewer.mspID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Copy of the loan keeping its terms and lifecycle, with the borrower masked
+// and amounts replaced by the range of the principal
+func redactLoan(loan *Loan) *Loan {
+	return &Loan{
+		DocType:              loan.DocType,
+		LoanID:               loan.LoanID,
+		BorrowerID:           maskID(loan.BorrowerID),
+		LenderID:             loan.LenderID,
+		InterestRate:         loan.InterestRate,
+		Duration:             loan.Duration,
+		Status:               loan.Status,
+		Defaulted:            loan.Defaulted,
+		DisbursementDate:     loan.DisbursementDate,
+		AuditHistory:         []string{},
+		CreatedAt:            loan.CreatedAt,
+		DueDate:              loan.DueDate,
+		ApprovedAt:           loan.ApprovedAt,
+		Product:              loan.Product,
+		Branch:               loan.Branch,
+		PSLCategory:          loan.PSLCategory,
+		ClosedAt:             loan.ClosedAt,
+		Archived:             loan.Archived,
+		SchemeID:             loan.SchemeID,
+		InterestMethod:       loan.InterestMethod,
+		CompoundingFrequency: loan.CompoundingFrequency,
+		AmountBand:           amountBand(loan.Amount),
+		Redacted:             true,
+	}
+}
+
+// Keeps the first character of an ID so masked IDs stay recognizable as such
+func maskID(id string) string {
+	if id == "" {
+		return ""
+	}
+	return id[:1] + strings.Repeat("*", 4)
+}
+
+func amountBand(amount token.Amount) string {
+	lower := int64(0)
+	for _, upper := range amountBands {
+		if amount.Rat().Cmp(ratInt(upper)) < 0 {
+			return fmt.Sprintf("%d-%d", lower, upper)
+		}
+		lower = upper
+	}
+	return fmt.Sprintf("%d+", lower)
+}
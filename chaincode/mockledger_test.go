@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/peer"
+
+	"lending/internal/mockstub"
+	"lending/token"
+)
+
+// Identities of the organizations set up by InitLedger
+var (
+	regulator = mockstub.NewIdentity(regulatorMSP, "rbi-admin")
+	hdfc      = mockstub.NewIdentity("HDFCMSP", "hdfc-officer")
+	sbi       = mockstub.NewIdentity("SBIMSP", "sbi-officer")
+)
+
+// Lending chaincode running against an in-memory ledger. Each call is one
+// transaction, committed if it succeeds and rolled back otherwise.
+type testLedger struct {
+	tb       testing.TB
+	stub     *mockstub.Stub
+	contract *SmartContract
+	txs      int
+
+	// Token chaincode lending settles through, nil while it uses the embedded
+	// token ledger. Its writes commit and roll back with the lending transaction.
+	tokens        *mockstub.Stub
+	tokenContract *token.TokenContract
+	identity      mockstub.Identity // caller of the running transaction
+
+	// Keys the last committed transaction read and wrote on the lending stub
+	rwset *mockstub.ReadWriteSet
+}
+
+// A ledger initialized by InitLedger
+func newTestLedger(tb testing.TB) *testLedger {
+	l := &testLedger{tb: tb, stub: mockstub.New(), contract: new(SmartContract)}
+	l.must(regulator, func(ctx *TransactionContext) error {
+		return l.contract.InitLedger(ctx)
+	})
+	return l
+}
+
+// Runs a transaction as the identity
+func (l *testLedger) submit(identity mockstub.Identity, tx func(ctx *TransactionContext) error) error {
+	l.txs++
+	l.stub.TxID = fmt.Sprintf("tx%06d", l.txs)
+	l.identity = identity
+
+	ctx := new(TransactionContext)
+	ctx.SetStub(l.stub)
+	ctx.SetClientIdentity(identity)
+
+	err := tx(ctx)
+	if err != nil {
+		l.stub.Rollback()
+		if l.tokens != nil {
+			l.tokens.Rollback()
+		}
+		return err
+	}
+	l.rwset = l.stub.ReadWriteSet()
+	l.stub.Commit()
+	if l.tokens != nil {
+		l.tokens.Commit()
+	}
+	return nil
+}
+
+func (l *testLedger) must(identity mockstub.Identity, tx func(ctx *TransactionContext) error) {
+	l.tb.Helper()
+	err := l.submit(identity, tx)
+	if err != nil {
+		l.tb.Fatal(err)
+	}
+}
+
+// Registers a borrower operated by HDFC holding balance tokens, on the token
+// chaincode if one is deployed, and relaxes the checks on new loans so tests
+// only set up what they exercise
+func (l *testLedger) borrower(borrowerID string, balance string) {
+	l.tb.Helper()
+	l.must(regulator, func(ctx *TransactionContext) error {
+		return l.contract.UpdateConfig(ctx, `{"creditPolicy":{"noActiveDefaults":false},"requireAaConsent":false,"velocity":{"maxRequestsPerDay":0}}`)
+	})
+	l.must(regulator, func(ctx *TransactionContext) error {
+		if l.tokens != nil {
+			return l.tokenContract.CreateAccount(l.tokenContext(regulator), borrowerID, "BORROWER", "HDFCMSP", nil)
+		}
+		return l.contract.CreateAccount(ctx, borrowerID, "BORROWER", "HDFCMSP", nil)
+	})
+	l.must(regulator, func(ctx *TransactionContext) error {
+		if l.tokens != nil {
+			return l.tokenContract.Mint(l.tokenContext(regulator), borrowerID, balance)
+		}
+		return l.contract.Mint(ctx, borrowerID, balance)
+	})
+}
+
+// Balance of an account on the ledger lending settles on
+func (l *testLedger) balance(account string) string {
+	l.tb.Helper()
+	var balance string
+	l.must(regulator, func(ctx *TransactionContext) error {
+		var err error
+		if l.tokens != nil {
+			balance, err = l.tokenContract.GetBalance(l.tokenContext(regulator), account)
+		} else {
+			balance, err = l.contract.GetBalance(ctx, account)
+		}
+		return err
+	})
+	return balance
+}
+
+// Available balance of an account on the ledger lending settles on, its
+// balance less its earmarks
+func (l *testLedger) available(account string) string {
+	l.tb.Helper()
+	var available string
+	l.must(regulator, func(ctx *TransactionContext) error {
+		var err error
+		if l.tokens != nil {
+			available, err = l.tokenContract.GetAvailableBalance(l.tokenContext(regulator), account)
+		} else {
+			available, err = l.contract.GetAvailableBalance(ctx, account)
+		}
+		return err
+	})
+	return available
+}
+
+// Requests, approves and disburses a loan from HDFC to the borrower
+func (l *testLedger) disbursedLoan(loanID string, borrowerID string, amount string) {
+	l.tb.Helper()
+	l.must(hdfc, func(ctx *TransactionContext) error {
+		_, err := l.contract.RequestLoan(ctx, loanID, borrowerID, amount, "12", 12, "", "", "", "")
+		return err
+	})
+	l.must(hdfc, func(ctx *TransactionContext) error {
+		_, err := l.contract.ApproveLoan(ctx, loanID, "HDFC")
+		return err
+	})
+	l.must(hdfc, func(ctx *TransactionContext) error {
+		_, err := l.contract.DisburseLoan(ctx, loanID)
+		return err
+	})
+}
+
+// Name of the lending chaincode when the token ledger is deployed on its own
+const lendingChaincode = "lending"
+
+// Deploys the token ledger as a chaincode of its own under name, initialized
+// by its InitLedger and accepting movements from lendingChaincode, and
+// configures lending to settle through it
+func (l *testLedger) deployTokenChaincode(name string) {
+	l.tb.Helper()
+	l.tokens = mockstub.New()
+	l.tokenContract = new(token.TokenContract)
+	l.stub.Invoke = func(chaincodeName string, args [][]byte, channel string) peer.Response {
+		if chaincodeName != name {
+			return shim.Error(fmt.Sprintf("chaincode %s is not installed", chaincodeName))
+		}
+		// Called chaincodes see the proposal of the lending transaction
+		ctx := l.tokenContext(l.identity)
+		l.tokens.Proposal = mockstub.NewProposal(lendingChaincode, "SmartContract:Invoke")
+		defer func() { l.tokens.Proposal = nil }()
+		return invokeTokenContract(ctx, l.tokenContract, args)
+	}
+
+	l.must(regulator, func(ctx *TransactionContext) error {
+		return l.tokenContract.InitLedger(l.tokenContext(regulator))
+	})
+	l.must(regulator, func(ctx *TransactionContext) error {
+		return l.tokenContract.SetLendingChaincode(l.tokenContext(regulator), lendingChaincode)
+	})
+	l.must(regulator, func(ctx *TransactionContext) error {
+		return l.contract.UpdateConfig(ctx, fmt.Sprintf(`{"tokenChaincode":%q}`, name))
+	})
+}
+
+// Context of a call to the token chaincode in the running transaction
+func (l *testLedger) tokenContext(identity mockstub.Identity) contractapi.TransactionContextInterface {
+	l.tokens.TxID = l.stub.TxID
+	l.tokens.Now = l.stub.Now
+
+	ctx := new(token.TransactionContext)
+	ctx.SetStub(l.tokens)
+	ctx.SetClientIdentity(identity)
+	return ctx
+}
+
+// Runs the token functions lending calls, as the chaincode dispatcher would
+func invokeTokenContract(
+	ctx contractapi.TransactionContextInterface,
+	contract *token.TokenContract,
+	args [][]byte,
+) peer.Response {
+	params := make([]string, len(args))
+	for i, arg := range args {
+		params[i] = string(arg)
+	}
+
+	var result interface{}
+	var err error
+	switch {
+	case params[0] == "TransferTokensWithReason" && len(params) == 7:
+		err = contract.TransferTokensWithReason(ctx, params[1], params[2], params[3], params[4], params[5], params[6])
+	case params[0] == "GetBalance" && len(params) == 2:
+		result, err = contract.GetBalance(ctx, params[1])
+	case params[0] == "GetDebitRefusal" && len(params) == 4:
+		result, err = contract.GetDebitRefusal(ctx, params[1], params[2], params[3])
+	case params[0] == "PlaceEarmark" && len(params) == 4:
+		err = contract.PlaceEarmark(ctx, params[1], params[2], params[3])
+	case params[0] == "IncreaseEarmark" && len(params) == 4:
+		result, err = contract.IncreaseEarmark(ctx, params[1], params[2], params[3])
+	case params[0] == "DrawEarmark" && len(params) == 4:
+		result, err = contract.DrawEarmark(ctx, params[1], params[2], params[3])
+	case params[0] == "ReleaseEarmark" && len(params) == 3:
+		err = contract.ReleaseEarmark(ctx, params[1], params[2])
+	case params[0] == "GetAccountInfo" && len(params) == 2:
+		result, err = contract.GetAccountInfo(ctx, params[1])
+	case params[0] == "GetAccountBalances" && len(params) == 3:
+		pageSize, _ := strconv.Atoi(params[1])
+		result, err = contract.GetAccountBalances(ctx, int32(pageSize), params[2])
+	default:
+		return shim.Error(fmt.Sprintf("function %s with %d arguments is not supported", params[0], len(params)-1))
+	}
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	switch value := result.(type) {
+	case nil:
+		return shim.Success(nil)
+	case string:
+		return shim.Success([]byte(value))
+	default:
+		payload, err := json.Marshal(value)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		return shim.Success(payload)
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// A proposal to transfer an ACTIVE loan's obligation to another borrower,
+// kept on the loan until the next one is proposed. The old borrower proposes,
+// the new borrower consents and the lender approves after re-running its
+// checks on the new obligor.
+type LoanNovation struct {
+	FromBorrowerID string             `json:"fromBorrowerId"`
+	ToBorrowerID   string             `json:"toBorrowerId"`
+	ProposedAt     string             `json:"proposedAt"`
+	ProposedBy     string             `json:"proposedBy"` // MSP ID of the old borrower's organization
+	Status         string             `json:"status"`     // PROPOSED, CONSENTED, APPROVED, REJECTED
+	ConsentedAt    string             `json:"consentedAt,omitempty" metadata:",optional"`
+	ConsentedBy    string             `json:"consentedBy,omitempty" metadata:",optional"` // MSP ID of the new borrower's organization
+	DecidedAt      string             `json:"decidedAt,omitempty" metadata:",optional"`
+	Reason         string             `json:"reason,omitempty" metadata:",optional"`        // given by the lender when rejected
+	PolicyResults  []PolicyRuleResult `json:"policyResults,omitempty" metadata:",optional"` // credit policy run on the new borrower
+}
+
+// Novation statuses
+const (
+	novationProposed  = "PROPOSED"
+	novationConsented = "CONSENTED"
+	novationApproved  = "APPROVED"
+	novationRejected  = "REJECTED"
+)
+
+// ============== Loan Novation ==============
+
+// Propose to transfer an ACTIVE loan to another borrower account, called by
+// the organization operating the current borrower's account
+func (s *SmartContract) ProposeNovation(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	newBorrowerID string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "ProposeNovation")
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	borrower, err := s.accountOf(ctx, loan.BorrowerID)
+	if err != nil {
+		return nil, err
+	}
+	err = requireOperatorOf(ctx, borrower)
+	if err != nil {
+		return nil, err
+	}
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Status != "ACTIVE" {
+		return nil, fmt.Errorf("loan %s cannot be novated in current status: %s", loanID, loan.Status)
+	}
+	if pending := loan.Novation; pending != nil && (pending.Status == novationProposed || pending.Status == novationConsented) {
+		return nil, fmt.Errorf("loan %s already has a novation to %s proposed", loanID, pending.ToBorrowerID)
+	}
+	if newBorrowerID == loan.BorrowerID {
+		return nil, fmt.Errorf("loan %s is already owed by %s", loanID, newBorrowerID)
+	}
+	_, err = s.requireAccountType(ctx, newBorrowerID, token.AccountBorrower)
+	if err != nil {
+		return nil, err
+	}
+
+	proposedAt, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	loan.Novation = &LoanNovation{
+		FromBorrowerID: loan.BorrowerID,
+		ToBorrowerID:   newBorrowerID,
+		ProposedAt:     proposedAt.Format(time.RFC3339),
+		ProposedBy:     mspID,
+		Status:         novationProposed,
+	}
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Novation from %s to %s proposed (TxID: %s)",
+			loan.BorrowerID,
+			newBorrowerID,
+			ctx.GetStub().GetTxID()))
+
+	return s.putLoanResult(ctx, loan)
+}
+
+// Consent to take over the loan, called by the organization operating the
+// proposed borrower's account
+func (s *SmartContract) ConsentToNovation(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "ConsentToNovation")
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	novation := loan.Novation
+	if novation == nil || novation.Status != novationProposed {
+		return nil, fmt.Errorf("loan %s has no novation awaiting consent", loanID)
+	}
+
+	borrower, err := s.accountOf(ctx, novation.ToBorrowerID)
+	if err != nil {
+		return nil, err
+	}
+	err = requireOperatorOf(ctx, borrower)
+	if err != nil {
+		return nil, err
+	}
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	consentedAt, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	novation.Status = novationConsented
+	novation.ConsentedAt = consentedAt.Format(time.RFC3339)
+	novation.ConsentedBy = mspID
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Novation to %s consented (TxID: %s)",
+			novation.ToBorrowerID,
+			ctx.GetStub().GetTxID()))
+
+	return s.putLoanResult(ctx, loan)
+}
+
+// Approve the consented novation, called by the organization operating the
+// lender's account. The new borrower is screened and run through the credit
+// policy for the remaining balance, a failing borrower rejects the novation
+// with the results kept on it. The loan keeps its repayments, history and
+// collateral, and the old borrower's repayment mandate is dropped.
+func (s *SmartContract) ApproveNovation(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "ApproveNovation")
+	if err != nil {
+		return nil, err
+	}
+
+	loan, novation, err := s.consentedNovation(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Status != "ACTIVE" {
+		return nil, fmt.Errorf("loan %s cannot be novated in current status: %s", loanID, loan.Status)
+	}
+	_, err = s.requireAccountType(ctx, novation.ToBorrowerID, token.AccountBorrower)
+	if err != nil {
+		return nil, err
+	}
+	err = token.ScreenParties(ctx, novation.ToBorrowerID)
+	if err != nil {
+		return nil, err
+	}
+
+	decidedAt, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The new obligor takes on the remaining balance, not the sanctioned amount
+	obligation := *loan
+	obligation.BorrowerID = novation.ToBorrowerID
+	obligation.Amount = loan.RemainingBalance
+	novation.PolicyResults, err = s.evaluateCreditPolicy(ctx, &obligation)
+	if err != nil {
+		return nil, err
+	}
+	novation.DecidedAt = decidedAt.Format(time.RFC3339)
+	if failed := failedRules(novation.PolicyResults); len(failed) > 0 {
+		novation.Status = novationRejected
+		novation.Reason = fmt.Sprintf("credit policy failed: %v", failed)
+		loan.AuditHistory = append(loan.AuditHistory,
+			fmt.Sprintf("Novation to %s rejected by credit policy: %v (TxID: %s)",
+				novation.ToBorrowerID,
+				failed,
+				ctx.GetStub().GetTxID()))
+		return s.putLoanResult(ctx, loan)
+	}
+
+	err = s.deleteIndex(ctx, borrowerLoanIndex, loan.BorrowerID, loanID)
+	if err != nil {
+		return nil, err
+	}
+	err = s.putIndex(ctx, borrowerLoanIndex, novation.ToBorrowerID, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	novation.Status = novationApproved
+	loan.BorrowerID = novation.ToBorrowerID
+	loan.Mandate = nil
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Loan novated from %s to %s, remaining balance %s (TxID: %s)",
+			novation.FromBorrowerID,
+			novation.ToBorrowerID,
+			loan.RemainingBalance,
+			ctx.GetStub().GetTxID()))
+
+	err = s.putLoan(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := newLoanEventHeader(ctx, loanID, 2)
+	if err != nil {
+		return nil, err
+	}
+	return newLoanResult(ctx, loan).emit(ctx, eventLoanNovated, LoanNovatedEventV2{
+		LoanEventHeader:  header,
+		FromBorrowerID:   novation.FromBorrowerID,
+		ToBorrowerID:     novation.ToBorrowerID,
+		LenderID:         loan.LenderID,
+		RemainingBalance: loan.RemainingBalance,
+	})
+}
+
+// Reject the proposed novation, called by the organization operating the
+// lender's account
+func (s *SmartContract) RejectNovation(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	reason string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "RejectNovation")
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	err = s.requireLender(ctx, loan.LenderID)
+	if err != nil {
+		return nil, err
+	}
+	novation := loan.Novation
+	if novation == nil || (novation.Status != novationProposed && novation.Status != novationConsented) {
+		return nil, fmt.Errorf("loan %s has no novation proposed", loanID)
+	}
+	if reason == "" {
+		return nil, fmt.Errorf("rejection reason is required")
+	}
+
+	decidedAt, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	novation.Status = novationRejected
+	novation.Reason = reason
+	novation.DecidedAt = decidedAt.Format(time.RFC3339)
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Novation to %s rejected: %s (TxID: %s)",
+			novation.ToBorrowerID,
+			reason,
+			ctx.GetStub().GetTxID()))
+
+	return s.putLoanResult(ctx, loan)
+}
+
+// Reads the loan with its consented novation, failing unless the caller
+// operates the lender's account
+func (s *SmartContract) consentedNovation(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+) (*Loan, *LoanNovation, error) {
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = s.requireLender(ctx, loan.LenderID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if loan.Novation == nil || loan.Novation.Status != novationConsented {
+		return nil, nil, fmt.Errorf("loan %s has no novation consented by the new borrower", loanID)
+	}
+	return loan, loan.Novation, nil
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Cap table of the fungible participation units a loan's claim owner issued
+// against it. Once issued the loan's repayments are split between the unit
+// holders in proportion to their units. Under PERIODIC distribution only the
+// principal is split as it is repaid, the interest is collected by the issuer
+// and paid out by DistributeIncome.
+type ParticipationTable struct {
+	LoanID       string         `json:"loanId"`
+	Issuer       string         `json:"issuer"` // claim owner that issued the units
+	TotalUnits   int            `json:"totalUnits"`
+	Holdings     map[string]int `json:"holdings"` // units by holding account
+	IssuedAt     string         `json:"issuedAt"`
+	AuditHistory []string       `json:"auditHistory"`
+	Distribution string         `json:"distribution,omitempty" metadata:",optional"` // IMMEDIATE or PERIODIC, empty for IMMEDIATE
+}
+
+// A page of the cap tables of the loans an account holds units of
+type ParticipationPage struct {
+	Tables   []*ParticipationTable `json:"tables"`
+	Bookmark string                `json:"bookmark"` // empty on the last page
+}
+
+// A holder's part of an amount split by units
+type unitShare struct {
+	Holder string
+	Amount *big.Rat
+}
+
+// When unit holders receive a loan's interest
+const (
+	distributeImmediate = "IMMEDIATE"
+	distributePeriodic  = "PERIODIC"
+)
+
+const participationObjectType = "participation"
+
+// Index of participations by holding account
+const holderParticipationIndex = "holder~participation"
+
+// ============== Participation Functions ==============
+
+// Issue totalUnits participation units against a loan, all held by the owner
+// of its claim until transferred, with interest distributed IMMEDIATE or
+// PERIODIC. Called by the organization operating the claim owner's account.
+func (s *SmartContract) IssueParticipations(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	totalUnits int,
+	distribution string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "IssueParticipations")
+	if err != nil {
+		return nil, err
+	}
+
+	if totalUnits <= 0 {
+		return nil, fmt.Errorf("total units must be positive")
+	}
+	if distribution != distributeImmediate && distribution != distributePeriodic {
+		return nil, fmt.Errorf("invalid distribution %s, must be %s or %s", distribution, distributeImmediate, distributePeriodic)
+	}
+
+	_, exists, err := s.participationsOf(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, fmt.Errorf("participations have already been issued on loan %s", loanID)
+	}
+
+	loan, err := s.readLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	if loan.Status != "ACTIVE" {
+		return nil, fmt.Errorf("participations cannot be issued on loan %s in current status: %s", loanID, loan.Status)
+	}
+
+	claim, err := s.GetLoanClaim(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	owner, err := s.accountOf(ctx, claim.Owner)
+	if err != nil {
+		return nil, err
+	}
+	err = requireOperatorOf(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	issuedAt, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	table := ParticipationTable{
+		LoanID:       loanID,
+		Issuer:       claim.Owner,
+		TotalUnits:   totalUnits,
+		Distribution: distribution,
+		Holdings:     map[string]int{claim.Owner: totalUnits},
+		IssuedAt:     issuedAt.Format(time.RFC3339),
+		AuditHistory: []string{
+			fmt.Sprintf("%d units issued to %s (TxID: %s)",
+				totalUnits,
+				claim.Owner,
+				ctx.GetStub().GetTxID()),
+		},
+	}
+
+	err = s.putIndex(ctx, holderParticipationIndex, claim.Owner, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = stampAuditEntries(ctx, table.AuditHistory)
+	if err != nil {
+		return nil, err
+	}
+	err = putRecord(ctx, participationObjectType, []string{loanID}, table)
+	if err != nil {
+		return nil, err
+	}
+	// The loan was read without its pending repayments, so is its result
+	return newLoanResult(ctx, loan), nil
+}
+
+// Transfer participation units of a loan between accounts, called by the
+// organization operating the sending account
+func (s *SmartContract) TransferParticipations(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	from string,
+	to string,
+	units int,
+) error {
+	err := claimRequestID(ctx, "TransferParticipations")
+	if err != nil {
+		return err
+	}
+
+	if units <= 0 {
+		return fmt.Errorf("units must be positive")
+	}
+	if from == to {
+		return fmt.Errorf("cannot transfer units to the same account")
+	}
+
+	table, err := s.GetParticipations(ctx, loanID)
+	if err != nil {
+		return err
+	}
+	if table.Holdings[from] < units {
+		return fmt.Errorf("%s holds %d units of loan %s, %d requested", from, table.Holdings[from], loanID, units)
+	}
+
+	sender, err := s.accountOf(ctx, from)
+	if err != nil {
+		return err
+	}
+	err = requireOperatorOf(ctx, sender)
+	if err != nil {
+		return err
+	}
+	_, err = s.accountOf(ctx, to)
+	if err != nil {
+		return err
+	}
+	err = token.ScreenParties(ctx, to)
+	if err != nil {
+		return err
+	}
+
+	table.Holdings[from] -= units
+	if table.Holdings[from] == 0 {
+		delete(table.Holdings, from)
+		err = s.deleteIndex(ctx, holderParticipationIndex, from, loanID)
+		if err != nil {
+			return err
+		}
+	}
+	if table.Holdings[to] == 0 {
+		err = s.putIndex(ctx, holderParticipationIndex, to, loanID)
+		if err != nil {
+			return err
+		}
+	}
+	table.Holdings[to] += units
+	table.AuditHistory = append(table.AuditHistory,
+		fmt.Sprintf("%d units transferred from %s to %s (TxID: %s)",
+			units,
+			from,
+			to,
+			ctx.GetStub().GetTxID()))
+
+	err = stampAuditEntries(ctx, table.AuditHistory)
+	if err != nil {
+		return err
+	}
+	return putRecord(ctx, participationObjectType, []string{loanID}, table)
+}
+
+// ============== Participation Queries ==============
+
+// The cap table of a loan
+func (s *SmartContract) GetParticipations(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+) (*ParticipationTable, error) {
+	table, exists, err := s.participationsOf(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("no participations have been issued on loan %s", loanID)
+	}
+
+	return table, nil
+}
+
+// Cap tables of the loans an account holds units of, a page at a time in
+// loan ID order
+func (s *SmartContract) GetParticipationsByHolder(
+	ctx contractapi.TransactionContextInterface,
+	holder string,
+	pageSize int32,
+	bookmark string,
+) (*ParticipationPage, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive")
+	}
+	bookmark, err := token.DecodeBookmark(bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(holderParticipationIndex, []string{holder}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	page := ParticipationPage{Tables: []*ParticipationTable{}}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		table, err := s.GetParticipations(ctx, keyParts[1])
+		if err != nil {
+			return nil, err
+		}
+		page.Tables = append(page.Tables, table)
+	}
+
+	page.Bookmark = token.EncodeBookmark(nextBookmark(metadata.GetFetchedRecordsCount(), pageSize, metadata.GetBookmark()))
+	return &page, nil
+}
+
+func (s *SmartContract) participationsOf(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+) (*ParticipationTable, bool, error) {
+	var table ParticipationTable
+	exists, err := getRecord(ctx, participationObjectType, []string{loanID}, &table)
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+	return &table, true, nil
+}
+
+// Pays a loan's cash flow to the holder of its claim, or to its unit holders
+// pro rata once participations are issued. Under PERIODIC distribution the
+// interest part goes to the issuer instead. A single movement is returned for
+// the loan event to carry, none when the amount was split.
+func (s *SmartContract) payLoanHolders(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	payer string,
+	amount *big.Rat,
+	interest *big.Rat,
+	reason string,
+	reserved string,
+) (*token.TokenEventV1, error) {
+	table, exists, err := s.participationsOf(ctx, loan.LoanID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		payee, err := s.payeeOf(ctx, loan)
+		if err != nil {
+			return nil, err
+		}
+		return s.settleFrom(ctx, payer, payee, amount, reason, loan.LoanID, reserved)
+	}
+
+	// A transaction moves tokens between two accounts once, so the issuer's
+	// interest is paid together with its share of the rest
+	split := new(big.Rat).Set(amount)
+	issuerInterest := new(big.Rat)
+	if table.Distribution == distributePeriodic && interest.Sign() > 0 {
+		issuerInterest = interest
+		split.Sub(split, issuerInterest)
+	}
+
+	shares := table.split(split)
+	if _, holds := table.Holdings[table.Issuer]; !holds {
+		shares = append(shares, unitShare{Holder: table.Issuer, Amount: new(big.Rat)})
+	}
+	for _, share := range shares {
+		if share.Holder == table.Issuer {
+			share.Amount.Add(share.Amount, issuerInterest)
+		}
+		if share.Amount.Sign() == 0 {
+			continue
+		}
+		_, err = s.settleFrom(ctx, payer, share.Holder, share.Amount, reason, loan.LoanID, reserved)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+// Splits an amount by units, rounded down to the token scale. The paise left
+// over go to the largest holder, the first by account ID among equals.
+func (t *ParticipationTable) split(amount *big.Rat) []unitShare {
+	holders := make([]string, 0, len(t.Holdings))
+	for holder := range t.Holdings {
+		holders = append(holders, holder)
+	}
+	sort.Strings(holders)
+
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(token.AmountScale), nil)
+	minor := new(big.Int).Quo(new(big.Int).Mul(amount.Num(), scale), amount.Denom())
+	total := big.NewInt(int64(t.TotalUnits))
+
+	shares := make([]unitShare, len(holders))
+	remainder := new(big.Int).Set(minor)
+	largest := 0
+	for i, holder := range holders {
+		units := big.NewInt(int64(t.Holdings[holder]))
+		part := new(big.Int).Quo(new(big.Int).Mul(minor, units), total)
+		remainder.Sub(remainder, part)
+		shares[i] = unitShare{Holder: holder, Amount: new(big.Rat).SetFrac(part, scale)}
+		if t.Holdings[holder] > t.Holdings[holders[largest]] {
+			largest = i
+		}
+	}
+	if len(shares) > 0 {
+		shares[largest].Amount.Add(shares[largest].Amount, new(big.Rat).SetFrac(remainder, scale))
+	}
+
+	return shares
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// What it takes to close a loan early. Interest is only owed up to the
+// payment date, the unaccrued part of the loan's interest is rebated.
+type PrepaymentQuote struct {
+	LoanID           string       `json:"loanId"`
+	AsOf             string       `json:"asOf"`
+	RemainingBalance token.Amount `json:"remainingBalance"`
+	AccruedInterest  token.Amount `json:"accruedInterest"`
+	Payoff           token.Amount `json:"payoff"`
+	Rebate           token.Amount `json:"rebate"`
+}
+
+// ============== Prepayment ==============
+
+// Close an active loan ahead of schedule. The borrower pays the principal and
+// the interest accrued to date, the rest of the loan's interest is rebated.
+// Unlike RepayLoan the pending repayments are read to price the payoff, so a
+// prepayment conflicts with repayments of the loan in flight.
+func (s *SmartContract) PrepayLoan(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	paymentReference string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "PrepayLoan")
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Status != "ACTIVE" {
+		return nil, fmt.Errorf("loan %s cannot be prepaid in current status: %s", loanID, loan.Status)
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	paidAt, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	payoff := prepaymentPayoff(loan, paidAt, config.Rounding)
+	rebate := config.Rounding.round(ratSub(loan.RemainingBalance.Rat(), payoff))
+
+	repaymentID, err := nextRecordID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.repay(ctx, loan, loan.BorrowerID, payoff, rebate, paymentReference, repaymentID)
+}
+
+// Quote the amount that closes an active loan at the current time
+func (s *SmartContract) GetPrepaymentQuote(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+) (*PrepaymentQuote, error) {
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Status != "ACTIVE" {
+		return nil, fmt.Errorf("loan %s cannot be prepaid in current status: %s", loanID, loan.Status)
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	asOf, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return prepaymentQuote(loan, asOf, config.Rounding), nil
+}
+
+func prepaymentQuote(loan *Loan, asOf time.Time, rounding RoundingPolicy) *PrepaymentQuote {
+	payoff := prepaymentPayoff(loan, asOf, rounding)
+	return &PrepaymentQuote{
+		LoanID:           loan.LoanID,
+		AsOf:             asOf.Format(time.RFC3339),
+		RemainingBalance: loan.RemainingBalance,
+		AccruedInterest:  token.NewAmount(interestAccrued(loan, asOf, rounding)),
+		Payoff:           token.NewAmount(payoff),
+		Rebate:           rounding.amount(ratSub(loan.RemainingBalance.Rat(), payoff)),
+	}
+}
+
+// Principal plus the interest accrued by asOf, less what has been repaid
+func prepaymentPayoff(loan *Loan, asOf time.Time, rounding RoundingPolicy) *big.Rat {
+	repaid := ratSub(loan.RepaymentDue.Rat(), loan.RemainingBalance.Rat())
+	payoff := rounding.round(ratSub(ratAdd(disbursedPrincipal(loan), interestAccrued(loan, asOf, rounding)), repaid))
+
+	return ratMax(ratMin(payoff, loan.RemainingBalance.Rat()), new(big.Rat))
+}
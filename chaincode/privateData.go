@@ -0,0 +1,195 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Borrower personal data, kept only in a private data collection so that it
+// can be purged on an erasure request while its hash stays on-chain
+type BorrowerPII struct {
+	BorrowerID string `json:"borrowerId"`
+	Name       string `json:"name"`
+	Address    string `json:"address"`
+	Phone      string `json:"phone"`
+	Email      string `json:"email"`
+}
+
+// Collection defined in collections_config.json and the transient field carrying the data.
+// The collection's blockToLive of 78840000 blocks, five years at the orderer's
+// default two second batch timeout, keeps the data for the five years KYC
+// records must be retained after the borrower last supplied it; an erasure
+// request is served earlier by PurgeBorrowerPrivateData.
+const (
+	borrowerPIICollection = "borrowerPIICollection"
+	borrowerPIITransient  = "borrower_pii"
+)
+
+// ============== Borrower Private Data ==============
+
+// Store a borrower's personal data, passed in the transient map under
+// "borrower_pii" so it never appears in the transaction proposal. Only the
+// bank operating the borrower's account or the regulator may set it.
+func (s *SmartContract) SetBorrowerPrivateData(
+	ctx contractapi.TransactionContextInterface,
+	borrowerID string,
+) error {
+	err := claimRequestID(ctx, "SetBorrowerPrivateData")
+	if err != nil {
+		return err
+	}
+
+	err = s.requireBorrowerDataAccess(ctx, borrowerID)
+	if err != nil {
+		return err
+	}
+
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("failed to read transient data: %v", err)
+	}
+
+	piiJSON, ok := transient[borrowerPIITransient]
+	if !ok {
+		return fmt.Errorf("%s must be provided in the transient map", borrowerPIITransient)
+	}
+
+	_, err = putBorrowerPII(ctx, borrowerID, piiJSON)
+	return err
+}
+
+// Read a borrower's personal data, by the bank operating the borrower's
+// account or the regulator
+func (s *SmartContract) GetBorrowerPrivateData(
+	ctx contractapi.TransactionContextInterface,
+	borrowerID string,
+) (*BorrowerPII, error) {
+	err := s.requireBorrowerDataAccess(ctx, borrowerID)
+	if err != nil {
+		return nil, err
+	}
+
+	piiJSON, err := ctx.GetStub().GetPrivateData(borrowerPIICollection, borrowerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private data: %v", err)
+	}
+	if piiJSON == nil {
+		return nil, fmt.Errorf("private data for borrower %s does not exist", borrowerID)
+	}
+
+	var pii BorrowerPII
+	err = json.Unmarshal(piiJSON, &pii)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pii, nil
+}
+
+// Erase a borrower's personal data from the collection and its history,
+// only the hash already recorded on-chain remains
+func (s *SmartContract) PurgeBorrowerPrivateData(
+	ctx contractapi.TransactionContextInterface,
+	borrowerID string,
+) error {
+	err := claimRequestID(ctx, "PurgeBorrowerPrivateData")
+	if err != nil {
+		return err
+	}
+
+	err = requireRegulator(ctx)
+	if err != nil {
+		return err
+	}
+
+	piiHash, err := ctx.GetStub().GetPrivateDataHash(borrowerPIICollection, borrowerID)
+	if err != nil {
+		return fmt.Errorf("failed to read private data hash: %v", err)
+	}
+	if piiHash == nil {
+		return fmt.Errorf("private data for borrower %s does not exist", borrowerID)
+	}
+
+	return ctx.GetStub().PurgePrivateData(borrowerPIICollection, borrowerID)
+}
+
+// Stores the personal data a loan application carries in the transient map,
+// returning the hash the loan records in its place, empty when the
+// application carries none
+func (s *SmartContract) applicationPII(
+	ctx contractapi.TransactionContextInterface,
+	borrowerID string,
+) (string, error) {
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return "", fmt.Errorf("failed to read transient data: %v", err)
+	}
+	piiJSON, ok := transient[borrowerPIITransient]
+	if !ok {
+		return "", nil
+	}
+
+	err = s.requireBorrowerDataAccess(ctx, borrowerID)
+	if err != nil {
+		return "", err
+	}
+	return putBorrowerPII(ctx, borrowerID, piiJSON)
+}
+
+// Writes a borrower's personal data to the collection, returning the hex
+// SHA-256 hash of what was written, the hash Fabric keeps on-chain
+func putBorrowerPII(
+	ctx contractapi.TransactionContextInterface,
+	borrowerID string,
+	piiJSON []byte,
+) (string, error) {
+	var pii BorrowerPII
+	err := json.Unmarshal(piiJSON, &pii)
+	if err != nil {
+		return "", fmt.Errorf("invalid borrower data: %v", err)
+	}
+	pii.BorrowerID = borrowerID
+
+	piiJSON, err = json.Marshal(pii)
+	if err != nil {
+		return "", err
+	}
+
+	err = ctx.GetStub().PutPrivateData(borrowerPIICollection, borrowerID, piiJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to write private data: %v", err)
+	}
+	hash := sha256.Sum256(piiJSON)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// Fails unless the caller is the regulator or belongs to the bank operating
+// the borrower's account. Unlike requireOperatorOf, an account registered
+// without an organization gives no one else access.
+func (s *SmartContract) requireBorrowerDataAccess(
+	ctx contractapi.TransactionContextInterface,
+	borrowerID string,
+) error {
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return err
+	}
+	if mspID == regulatorMSP {
+		return nil
+	}
+
+	account, err := s.requireAccountType(ctx, borrowerID, token.AccountBorrower)
+	if err != nil {
+		return err
+	}
+	if account.OrgMSP != mspID {
+		return fmt.Errorf("caller from %s cannot access the personal data of borrower %s", mspID, borrowerID)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"lending/internal/mockstub"
+)
+
+// Personal data given with an application lands in the collection, the loan
+// keeping only its hash, and only the borrower's bank and the regulator can
+// read, replace or purge it
+func TestBorrowerPrivateData(t *testing.T) {
+	l := newTestLedger(t)
+	l.borrower("B1", "100")
+
+	piiJSON := []byte(`{"name":"Asha Rao","address":"12 MG Road, Pune","phone":"9800000000","email":"asha@example.com"}`)
+	l.stub.Transient = map[string][]byte{borrowerPIITransient: piiJSON}
+	l.must(hdfc, func(ctx *TransactionContext) error {
+		_, err := l.contract.RequestLoan(ctx, "L1", "B1", "1000", "12", 12, "", "", "", "")
+		return err
+	})
+	l.stub.Transient = nil
+	var loan *Loan
+	l.must(regulator, func(ctx *TransactionContext) error {
+		var err error
+		loan, err = l.contract.GetLoan(ctx, "L1")
+		return err
+	})
+
+	stored, err := l.stub.GetPrivateData(borrowerPIICollection, "B1")
+	if err != nil || stored == nil {
+		t.Fatalf("application data not stored: %v", err)
+	}
+	hash := sha256.Sum256(stored)
+	if loan.BorrowerDataHash != hex.EncodeToString(hash[:]) {
+		t.Errorf("loan records hash %q, want the hash of the stored data", loan.BorrowerDataHash)
+	}
+	loanJSON, err := json.Marshal(loan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(loanJSON), "Asha") || strings.Contains(string(loanJSON), "MG Road") {
+		t.Errorf("loan record carries personal data: %s", loanJSON)
+	}
+
+	for _, tt := range []struct {
+		caller  mockstub.Identity
+		wantErr string
+	}{
+		{hdfc, ""},
+		{regulator, ""},
+		{sbi, "caller from SBIMSP cannot access the personal data of borrower B1"},
+	} {
+		var pii *BorrowerPII
+		err := l.submit(tt.caller, func(ctx *TransactionContext) error {
+			var err error
+			pii, err = l.contract.GetBorrowerPrivateData(ctx, "B1")
+			return err
+		})
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("reading as %s: %v", tt.caller.MSPID, err)
+		case tt.wantErr == "" && pii.Name != "Asha Rao":
+			t.Errorf("reading as %s: got %+v", tt.caller.MSPID, pii)
+		case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+			t.Errorf("reading as %s: got %v, want %s", tt.caller.MSPID, err, tt.wantErr)
+		}
+	}
+
+	l.stub.Transient = map[string][]byte{borrowerPIITransient: []byte(`{"name":"Mallory"}`)}
+	err = l.submit(sbi, func(ctx *TransactionContext) error {
+		return l.contract.SetBorrowerPrivateData(ctx, "B1")
+	})
+	if err == nil {
+		t.Error("another bank replaced the borrower's data")
+	}
+	err = l.submit(sbi, func(ctx *TransactionContext) error {
+		_, err := l.contract.RequestLoan(ctx, "L2", "B1", "1000", "12", 12, "", "", "", "")
+		return err
+	})
+	if err == nil {
+		t.Error("another bank's application replaced the borrower's data")
+	}
+	l.stub.Transient = nil
+
+	err = l.submit(hdfc, func(ctx *TransactionContext) error {
+		return l.contract.PurgeBorrowerPrivateData(ctx, "B1")
+	})
+	if err == nil {
+		t.Error("the borrower's bank purged without the regulator")
+	}
+	l.must(regulator, func(ctx *TransactionContext) error {
+		return l.contract.PurgeBorrowerPrivateData(ctx, "B1")
+	})
+	stored, _ = l.stub.GetPrivateData(borrowerPIICollection, "B1")
+	if stored != nil {
+		t.Errorf("purged data still stored: %s", stored)
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Immovable property, identified by its registration number
+type Property struct {
+	PropertyID   string `json:"propertyId"`
+	SurveyNumber string `json:"surveyNumber"`
+	OwnerID      string `json:"ownerId"`
+	Description  string `json:"description"`
+}
+
+// Property mortgaged against a loan
+type PropertyCollateral struct {
+	PropertyID string `json:"propertyId"`
+	Status     string `json:"status"` // PLEDGED, LIEN, RELEASED
+}
+
+// Lien of a lender on a property, one per loan
+type Lien struct {
+	PropertyID string       `json:"propertyId"`
+	LoanID     string       `json:"loanId"`
+	LenderID   string       `json:"lenderId"`
+	Amount     token.Amount `json:"amount"`
+	Status     string       `json:"status"` // ACTIVE, RELEASED
+	CreatedAt  string       `json:"createdAt"`
+	ReleasedAt string       `json:"releasedAt"`
+}
+
+// A page of the liens recorded on a property
+type LienPage struct {
+	Liens    []*Lien `json:"liens"`
+	Bookmark string  `json:"bookmark"` // empty on the last page
+}
+
+const (
+	propertyObjectType = "property"
+	lienObjectType     = "lien"
+)
+
+// ============== Property Liens ==============
+
+// Register a property, called by the organization operating the owner's account
+func (s *SmartContract) RegisterProperty(
+	ctx contractapi.TransactionContextInterface,
+	propertyID string,
+	surveyNumber string,
+	ownerID string,
+	description string,
+) error {
+	err := claimRequestID(ctx, "RegisterProperty")
+	if err != nil {
+		return err
+	}
+
+	if propertyID == "" {
+		return fmt.Errorf("property ID is required")
+	}
+
+	owner, err := s.accountOf(ctx, ownerID)
+	if err != nil {
+		return err
+	}
+	err = requireOperatorOf(ctx, owner)
+	if err != nil {
+		return err
+	}
+
+	var existing Property
+	exists, err := getRecord(ctx, propertyObjectType, []string{propertyID}, &existing)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("property %s already exists", propertyID)
+	}
+
+	return putRecord(ctx, propertyObjectType, []string{propertyID}, Property{
+		PropertyID:   propertyID,
+		SurveyNumber: surveyNumber,
+		OwnerID:      ownerID,
+		Description:  description,
+	})
+}
+
+func (s *SmartContract) GetProperty(
+	ctx contractapi.TransactionContextInterface,
+	propertyID string,
+) (*Property, error) {
+	var property Property
+	exists, err := getRecord(ctx, propertyObjectType, []string{propertyID}, &property)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("property %s does not exist", propertyID)
+	}
+	return &property, nil
+}
+
+// Mortgage a borrower's property against a pending loan, the lien is created
+// when the loan is approved
+func (s *SmartContract) PledgeProperty(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	propertyID string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "PledgeProperty")
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Status != "PENDING" {
+		return nil, fmt.Errorf("collateral of loan %s cannot change in current status: %s", loanID, loan.Status)
+	}
+
+	property, err := s.GetProperty(ctx, propertyID)
+	if err != nil {
+		return nil, err
+	}
+	if property.OwnerID != loan.BorrowerID {
+		return nil, fmt.Errorf("property %s is not owned by borrower %s", propertyID, loan.BorrowerID)
+	}
+
+	previousID := ""
+	if loan.Property != nil {
+		previousID = loan.Property.PropertyID
+	}
+	err = s.indexCollateral(ctx, loanID, collateralProperty, previousID, propertyID)
+	if err != nil {
+		return nil, err
+	}
+
+	loan.Property = &PropertyCollateral{PropertyID: propertyID, Status: "PLEDGED"}
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Property %s pledged (TxID: %s)",
+			propertyID,
+			ctx.GetStub().GetTxID()))
+
+	return s.putLoanResult(ctx, loan)
+}
+
+// The liens ever recorded on a property, active and released, a page at a
+// time
+func (s *SmartContract) GetPropertyLiens(
+	ctx contractapi.TransactionContextInterface,
+	propertyID string,
+	pageSize int32,
+	bookmark string,
+) (*LienPage, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive")
+	}
+	bookmark, err := token.DecodeBookmark(bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(lienObjectType, []string{propertyID}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	page := LienPage{Liens: []*Lien{}}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var lien Lien
+		err = json.Unmarshal(entry.Value, &lien)
+		if err != nil {
+			return nil, err
+		}
+		page.Liens = append(page.Liens, &lien)
+	}
+
+	page.Bookmark = token.EncodeBookmark(nextBookmark(metadata.GetFetchedRecordsCount(), pageSize, metadata.GetBookmark()))
+	return &page, nil
+}
+
+// Creates the lender's lien on an approved loan's property, failing if
+// another lien on it is active
+func (s *SmartContract) createLien(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+) error {
+	if loan.Property == nil || loan.Property.Status != "PLEDGED" {
+		return nil
+	}
+
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(lienObjectType, []string{loan.Property.PropertyID})
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return err
+		}
+
+		var lien Lien
+		err = json.Unmarshal(entry.Value, &lien)
+		if err != nil {
+			return err
+		}
+		if lien.Status == "ACTIVE" {
+			return fmt.Errorf("property %s already has an active lien of %s for loan %s", lien.PropertyID, lien.LenderID, lien.LoanID)
+		}
+	}
+
+	createdAt, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = putRecord(ctx, lienObjectType, []string{loan.Property.PropertyID, loan.LoanID}, Lien{
+		PropertyID: loan.Property.PropertyID,
+		LoanID:     loan.LoanID,
+		LenderID:   loan.LenderID,
+		Amount:     loan.Amount,
+		Status:     "ACTIVE",
+		CreatedAt:  createdAt.Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+
+	loan.Property.Status = "LIEN"
+	return nil
+}
+
+// Releases the lien of a closed loan
+func (s *SmartContract) releaseLien(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+) error {
+	if loan.Property == nil || loan.Property.Status != "LIEN" {
+		return nil
+	}
+
+	var lien Lien
+	exists, err := getRecord(ctx, lienObjectType, []string{loan.Property.PropertyID, loan.LoanID}, &lien)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("lien of loan %s on property %s does not exist", loan.LoanID, loan.Property.PropertyID)
+	}
+
+	releasedAt, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	lien.Status = "RELEASED"
+	lien.ReleasedAt = releasedAt.Format(time.RFC3339)
+	err = putRecord(ctx, lienObjectType, []string{lien.PropertyID, lien.LoanID}, lien)
+	if err != nil {
+		return err
+	}
+
+	loan.Property.Status = "RELEASED"
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Lien on property %s released (TxID: %s)",
+			lien.PropertyID,
+			ctx.GetStub().GetTxID()))
+	return nil
+}
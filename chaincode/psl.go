@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Priority sector lending categories
+const (
+	pslAgriculture = "AGRICULTURE"
+	pslMSME        = "MSME"
+	pslEducation   = "EDUCATION"
+	pslHousing     = "HOUSING"
+	pslTotal       = "TOTAL"
+)
+
+// A loan product and the PSL categories its loans may be tagged with
+type LoanProduct struct {
+	PSLCategories []string     `json:"pslCategories"`
+	PSLMaxAmount  token.Amount `json:"pslMaxAmount"` // per-loan ceiling for PSL eligibility, 0 for none
+}
+
+type PSLCategoryAchievement struct {
+	Category        string       `json:"category"`
+	LoanCount       int          `json:"loanCount"`
+	DisbursedAmount token.Amount `json:"disbursedAmount"`
+	AchievedPercent Decimal      `json:"achievedPercent"`
+	TargetPercent   Decimal      `json:"targetPercent"`
+	Shortfall       token.Amount `json:"shortfall"` // amount still needed to meet the target
+}
+
+type PSLReport struct {
+	LenderID       string                   `json:"lenderId"`
+	Quarter        string                   `json:"quarter"`
+	TotalDisbursed token.Amount             `json:"totalDisbursed"`
+	Categories     []PSLCategoryAchievement `json:"categories"`
+}
+
+// Checks a requested PSL tag is allowed for the product and within its ceiling
+func (s *SmartContract) validatePSLCategory(
+	ctx contractapi.TransactionContextInterface,
+	product string,
+	pslCategory string,
+	amount *big.Rat,
+) error {
+	if product == "" {
+		if pslCategory != "" {
+			return fmt.Errorf("PSL category %s requires a loan product", pslCategory)
+		}
+		return nil
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	loanProduct, ok := config.Products[product]
+	if !ok {
+		return fmt.Errorf("loan product %s does not exist", product)
+	}
+	if pslCategory == "" {
+		return nil
+	}
+
+	for _, category := range loanProduct.PSLCategories {
+		if category == pslCategory {
+			ceiling := loanProduct.PSLMaxAmount.Rat()
+			if ceiling.Sign() > 0 && amount.Cmp(ceiling) > 0 {
+				return fmt.Errorf("amount %s exceeds the PSL ceiling of %s for product %s", token.FormatAmount(amount), loanProduct.PSLMaxAmount, product)
+			}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("PSL category %s is not allowed for product %s", pslCategory, product)
+}
+
+// ============== Priority Sector Lending Reports ==============
+
+// Aggregate a lender's PSL disbursements for a quarter (YYYY-Qn) against the configured targets
+func (s *SmartContract) GetPSLReport(
+	ctx contractapi.TransactionContextInterface,
+	lenderID string,
+	quarter string,
+) (*PSLReport, error) {
+	start, end, err := parsePeriod(quarter)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	categories := []string{pslAgriculture, pslMSME, pslEducation, pslHousing, pslTotal}
+	achievements := map[string]*PSLCategoryAchievement{}
+	amounts := map[string]*big.Rat{}
+	for _, category := range categories {
+		amounts[category] = new(big.Rat)
+		achievements[category] = &PSLCategoryAchievement{
+			Category:      category,
+			TargetPercent: config.PSLTargets[category],
+		}
+	}
+
+	report := PSLReport{
+		LenderID:   lenderID,
+		Quarter:    quarter,
+		Categories: []PSLCategoryAchievement{},
+	}
+	total := new(big.Rat)
+
+	err = s.forEachIndexedLoan(ctx, lenderLoanIndex, []string{lenderID}, func(loan *Loan) error {
+		disbursedAt, ok := disbursementTime(loan)
+		if !ok || disbursedAt.Before(start) || disbursedAt.After(end) {
+			return nil
+		}
+
+		disbursed := disbursedPrincipal(loan)
+		total.Add(total, disbursed)
+		if achievement, ok := achievements[loan.PSLCategory]; ok {
+			achievement.LoanCount++
+			amounts[loan.PSLCategory].Add(amounts[loan.PSLCategory], disbursed)
+			achievements[pslTotal].LoanCount++
+			amounts[pslTotal].Add(amounts[pslTotal], disbursed)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report.TotalDisbursed = token.NewAmount(total)
+	for _, category := range categories {
+		achievement := achievements[category]
+		disbursed := amounts[category]
+		achievement.DisbursedAmount = token.NewAmount(disbursed)
+		achievement.AchievedPercent = newRate(ratMul(ratQuo(disbursed, total), ratInt(100)))
+		shortfall := ratSub(percentOf(total, achievement.TargetPercent.Rat()), disbursed)
+		achievement.Shortfall = config.Rounding.amount(ratMax(shortfall, new(big.Rat)))
+		report.Categories = append(report.Categories, *achievement)
+	}
+
+	err = emitReportGenerated(ctx, "GetPSLReport", map[string]string{"lenderId": lenderID, "quarter": quarter}, &report)
+	if err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
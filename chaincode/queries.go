@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// A page of loans with the bookmark to pass back for the next page, empty when done
+type LoanPage struct {
+	Loans    []*Loan `json:"loans"`
+	Bookmark string  `json:"bookmark"`
+}
+
+// Layouts of the month bucket and sortable instant attributes of date indexes
+const (
+	indexMonthLayout   = "2006-01"
+	indexInstantLayout = "20060102150405"
+)
+
+func (s *SmartContract) putDateIndex(
+	ctx contractapi.TransactionContextInterface,
+	index string,
+	at time.Time,
+	loanID string,
+) error {
+	at = at.UTC()
+	return s.putIndex(ctx, index, at.Format(indexMonthLayout), at.Format(indexInstantLayout), loanID)
+}
+
+// ============== List Queries ==============
+
+// List loans approved by a lender, a page at a time
+func (s *SmartContract) GetLoansByLender(
+	ctx contractapi.TransactionContextInterface,
+	lenderID string,
+	pageSize int32,
+	bookmark string,
+) (*LoanPage, error) {
+	return s.getIndexedLoanPage(ctx, lenderLoanIndex, []string{lenderID}, pageSize, bookmark)
+}
+
+// List loans requested by a borrower, a page at a time
+func (s *SmartContract) GetLoansByBorrower(
+	ctx contractapi.TransactionContextInterface,
+	borrowerID string,
+	pageSize int32,
+	bookmark string,
+) (*LoanPage, error) {
+	return s.getIndexedLoanPage(ctx, borrowerLoanIndex, []string{borrowerID}, pageSize, bookmark)
+}
+
+// List loans in a status, a page at a time. Requires CouchDB as the state database.
+func (s *SmartContract) GetLoansByStatus(
+	ctx contractapi.TransactionContextInterface,
+	status string,
+	pageSize int32,
+	bookmark string,
+) (*LoanPage, error) {
+	selector := map[string]interface{}{
+		"selector": map[string]interface{}{
+			"docType": loanDocType,
+			"status":  status,
+		},
+		"use_index": []string{"_design/indexLoanStatusDoc", "indexLoanStatus"},
+	}
+	query, err := json.Marshal(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.getQueryLoanPage(ctx, string(query), pageSize, bookmark)
+}
+
+func (s *SmartContract) getIndexedLoanPage(
+	ctx contractapi.TransactionContextInterface,
+	index string,
+	attributes []string,
+	pageSize int32,
+	bookmark string,
+) (*LoanPage, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive")
+	}
+	bookmark, err := token.DecodeBookmark(bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(index, attributes, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	page := LoanPage{Loans: []*Loan{}}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		loan, err := s.getLoan(ctx, keyParts[len(keyParts)-1])
+		if err != nil {
+			return nil, err
+		}
+		page.Loans = append(page.Loans, loan)
+	}
+
+	err = s.viewLoans(ctx, page.Loans)
+	if err != nil {
+		return nil, err
+	}
+
+	page.Bookmark = token.EncodeBookmark(nextBookmark(metadata.GetFetchedRecordsCount(), pageSize, metadata.GetBookmark()))
+	return &page, nil
+}
+
+func (s *SmartContract) getQueryLoanPage(
+	ctx contractapi.TransactionContextInterface,
+	query string,
+	pageSize int32,
+	bookmark string,
+) (*LoanPage, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive")
+	}
+	bookmark, err := token.DecodeBookmark(bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, metadata, err := ctx.GetStub().GetQueryResultWithPagination(query, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query world state: %v", err)
+	}
+	defer iterator.Close()
+
+	page := LoanPage{Loans: []*Loan{}}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var loan Loan
+		err = json.Unmarshal(entry.Value, &loan)
+		if err != nil {
+			return nil, err
+		}
+		err = s.applyPendingRepayments(ctx, &loan)
+		if err != nil {
+			return nil, err
+		}
+		page.Loans = append(page.Loans, &loan)
+	}
+
+	err = s.viewLoans(ctx, page.Loans)
+	if err != nil {
+		return nil, err
+	}
+
+	page.Bookmark = token.EncodeBookmark(nextBookmark(metadata.GetFetchedRecordsCount(), pageSize, metadata.GetBookmark()))
+	return &page, nil
+}
+
+// A short page is the last one, so callers get no bookmark to follow
+func nextBookmark(fetched int32, pageSize int32, bookmark string) string {
+	if fetched < pageSize {
+		return ""
+	}
+	return bookmark
+}
+
+// ============== Date Range Queries ==============
+
+// List loans requested between two dates (YYYY-MM-DD or RFC3339), inclusive
+func (s *SmartContract) GetLoansCreatedBetween(
+	ctx contractapi.TransactionContextInterface,
+	from string,
+	to string,
+	pageSize int32,
+	bookmark string,
+) (*LoanPage, error) {
+	return s.getLoansInDateRange(ctx, createdLoanIndex, from, to, pageSize, bookmark)
+}
+
+// List loans disbursed between two dates (YYYY-MM-DD or RFC3339), inclusive
+func (s *SmartContract) GetLoansDisbursedBetween(
+	ctx contractapi.TransactionContextInterface,
+	from string,
+	to string,
+	pageSize int32,
+	bookmark string,
+) (*LoanPage, error) {
+	return s.getLoansInDateRange(ctx, disbursedLoanIndex, from, to, pageSize, bookmark)
+}
+
+// Walks the month buckets of a date index between from and to. The returned
+// bookmark encodes the month being read and the index bookmark within it.
+func (s *SmartContract) getLoansInDateRange(
+	ctx contractapi.TransactionContextInterface,
+	index string,
+	from string,
+	to string,
+	pageSize int32,
+	bookmark string,
+) (*LoanPage, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive")
+	}
+	bookmark, err := token.DecodeBookmark(bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	start, err := parseDate(from)
+	if err != nil {
+		return nil, err
+	}
+	// A bare start date covers its whole day
+	if len(from) == len("2006-01-02") {
+		start = start.AddDate(0, 0, -1).Add(time.Second)
+	}
+	end, err := parseDate(to)
+	if err != nil {
+		return nil, err
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("range end %s is before its start %s", to, from)
+	}
+
+	month := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC)
+	monthBookmark := ""
+	if bookmark != "" {
+		parts := strings.SplitN(bookmark, "|", 2)
+		month, err = time.Parse(indexMonthLayout, parts[0])
+		if err != nil || len(parts) != 2 {
+			return nil, fmt.Errorf("invalid bookmark %s", bookmark)
+		}
+		monthBookmark = parts[1]
+	}
+
+	startInstant := start.Format(indexInstantLayout)
+	endInstant := end.Format(indexInstantLayout)
+	page := LoanPage{Loans: []*Loan{}}
+
+	for !month.After(end) {
+		remaining := pageSize - int32(len(page.Loans))
+		iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(
+			index, []string{month.Format(indexMonthLayout)}, remaining, monthBookmark)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read from world state: %v", err)
+		}
+
+		for iterator.HasNext() {
+			entry, err := iterator.Next()
+			if err != nil {
+				iterator.Close()
+				return nil, err
+			}
+
+			_, keyParts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+			if err != nil {
+				iterator.Close()
+				return nil, err
+			}
+
+			instant := keyParts[1]
+			if instant < startInstant || instant > endInstant {
+				continue
+			}
+
+			loan, err := s.getLoan(ctx, keyParts[2])
+			if err != nil {
+				iterator.Close()
+				return nil, err
+			}
+			page.Loans = append(page.Loans, loan)
+		}
+		iterator.Close()
+
+		// A full page leaves the rest of this month for the next call
+		if metadata.GetFetchedRecordsCount() == remaining && metadata.GetBookmark() != "" {
+			page.Bookmark = token.EncodeBookmark(month.Format(indexMonthLayout) + "|" + metadata.GetBookmark())
+			break
+		}
+
+		month = month.AddDate(0, 1, 0)
+		monthBookmark = ""
+	}
+
+	err = s.viewLoans(ctx, page.Loans)
+	if err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
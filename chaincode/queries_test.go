@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// Every rich query names an index shipped with the chaincode, so CouchDB
+// never falls back to scanning every document
+func TestCouchDBIndexes(t *testing.T) {
+	indexFiles, err := filepath.Glob("META-INF/statedb/couchdb/indexes/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexes := map[[2]string]bool{}
+	for _, file := range indexFiles {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var index struct {
+			Ddoc string `json:"ddoc"`
+			Name string `json:"name"`
+		}
+		err = json.Unmarshal(content, &index)
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		indexes[[2]string{"_design/" + index.Ddoc, index.Name}] = true
+	}
+
+	sources, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	useIndex := regexp.MustCompile(`"use_index":\s*\[\]string\{"([^"]+)",\s*"([^"]+)"\}`)
+	queries := 0
+	for _, source := range sources {
+		content, err := os.ReadFile(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, match := range useIndex.FindAllStringSubmatch(string(content), -1) {
+			queries++
+			if !indexes[[2]string{match[1], match[2]}] {
+				t.Errorf("%s: index %s of design document %s is not in META-INF", source, match[2], match[1])
+			}
+		}
+	}
+	if queries == 0 {
+		t.Error("found no rich queries")
+	}
+}
+
+// Reminders page through the due date index and carry on into the months
+// that follow
+func TestNotifyUpcomingDues(t *testing.T) {
+	tests := []struct {
+		name      string
+		daysAhead int
+		pageSize  int
+		wantPages int
+		wantDues  int
+	}{
+		{name: "one page", daysAhead: 10, pageSize: 10, wantPages: 1, wantDues: 3},
+		{name: "exact page", daysAhead: 10, pageSize: 3, wantPages: 1, wantDues: 3},
+		{name: "pages of two", daysAhead: 10, pageSize: 2, wantPages: 2, wantDues: 3},
+		{name: "not yet due", daysAhead: 2, pageSize: 2, wantPages: 1, wantDues: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLedger(t)
+			l.borrower("B1", "100")
+			for _, loanID := range []string{"L1", "L2", "L3"} {
+				l.disbursedLoan(loanID, "B1", "1000")
+			}
+			l.stub.Now = time.Date(2026, 12, 25, 9, 0, 0, 0, time.UTC)
+
+			pages, dues := 0, 0
+			bookmark := ""
+			for {
+				var page *UpcomingDuePage
+				l.must(regulator, func(ctx *TransactionContext) error {
+					var err error
+					page, err = l.contract.NotifyUpcomingDues(ctx, tt.daysAhead, tt.pageSize, bookmark)
+					return err
+				})
+				pages++
+				dues += len(page.Dues)
+				if page.Bookmark == "" {
+					break
+				}
+				if pages > 10 {
+					t.Fatal("paging does not end")
+				}
+				bookmark = page.Bookmark
+			}
+			if pages != tt.wantPages || dues != tt.wantDues {
+				t.Errorf("got %d dues in %d pages, want %d in %d", dues, pages, tt.wantDues, tt.wantPages)
+			}
+		})
+	}
+}
+
+// Snapshots read the account registry a batch at a time, from the token
+// chaincode too
+func TestSnapshotBalances(t *testing.T) {
+	for _, tokenChaincode := range []bool{false, true} {
+		l := newTestLedger(t)
+		if tokenChaincode {
+			l.deployTokenChaincode("token")
+		}
+		for i := 0; i < indexPageSize+1; i++ {
+			l.borrower(fmt.Sprintf("B%03d", i), "10")
+		}
+
+		var snapshot *Snapshot
+		l.must(regulator, func(ctx *TransactionContext) error {
+			var err error
+			snapshot, err = l.contract.TakeSnapshot(ctx, "EOD")
+			return err
+		})
+		borrowers := 0
+		for _, balance := range snapshot.Balances {
+			if balance.Type == "BORROWER" {
+				borrowers++
+			}
+		}
+		if borrowers != indexPageSize+1 {
+			t.Errorf("token chaincode %v: snapshot has %d borrowers, want %d", tokenChaincode, borrowers, indexPageSize+1)
+		}
+	}
+}
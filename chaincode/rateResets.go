@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// A floating rate reset of a disbursed loan, the rate applying from the part
+// of the term run at the reset
+type RateReset struct {
+	PriorRate Decimal `json:"priorRate"`
+	Rate      Decimal `json:"rate"`
+	Elapsed   Decimal `json:"elapsed"` // fraction of the term run
+	ResetAt   string  `json:"resetAt"`
+	TxID      string  `json:"txId"`
+}
+
+// What a reset changed for the borrower, who must be informed of it. The
+// maturity is kept, the installments absorb the new rate.
+type RateResetImpact struct {
+	LoanID          string       `json:"loanId"`
+	LenderID        string       `json:"lenderId"`
+	BorrowerID      string       `json:"borrowerId"`
+	Benchmark       string       `json:"benchmark"`
+	Fixing          Decimal      `json:"fixing"`
+	OldRate         Decimal      `json:"oldRate"`
+	NewRate         Decimal      `json:"newRate"`
+	OldInstallment  token.Amount `json:"oldInstallment"` // next installment due
+	NewInstallment  token.Amount `json:"newInstallment"`
+	OldRepaymentDue token.Amount `json:"oldRepaymentDue"`
+	NewRepaymentDue token.Amount `json:"newRepaymentDue"`
+	Maturity        string       `json:"maturity"`
+	ResetAt         string       `json:"resetAt"`
+	TxID            string       `json:"txId"`
+}
+
+// The rate resets of a lender's loans in a period, oldest first
+type RateResetReport struct {
+	LenderID string             `json:"lenderId"`
+	Period   string             `json:"period"`
+	Resets   []*RateResetImpact `json:"resets"`
+}
+
+// Impacts are stored by lender and the time of the reset
+const rateResetObjectType = "ratereset"
+
+// ============== Rate Resets ==============
+
+// Reprice a disbursed floating rate loan at its benchmark's current fixing
+// plus its spread, called by a keeper or the organization operating the
+// lender's account. The new rate applies to the rest of the term, and the
+// impact is recorded for the lender's reset report and emitted in a
+// LoanRateReset event, one transaction per loan.
+func (s *SmartContract) ResetLoanRate(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+) (*RateResetImpact, error) {
+	err := claimRequestID(ctx, "ResetLoanRate")
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := requireKeeper(ctx, config); err != nil {
+		err = s.requireLender(ctx, loan.LenderID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if loan.Status != "ACTIVE" {
+		return nil, fmt.Errorf("rate of loan %s cannot be reset in current status: %s", loanID, loan.Status)
+	}
+	if loan.Benchmark == "" {
+		return nil, fmt.Errorf("loan %s does not have a floating rate", loanID)
+	}
+	if len(loan.Tranches) > 0 {
+		return nil, fmt.Errorf("tranches of loan %s keep the rate they were disbursed at", loanID)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	elapsed := termElapsed(loan, now)
+	if elapsed.Cmp(ratInt(1)) >= 0 {
+		return nil, fmt.Errorf("loan %s is past its due date", loanID)
+	}
+	fixing, err := benchmarkFixing(ctx, loan.Benchmark, config, now, nil)
+	if err != nil {
+		return nil, err
+	}
+	if fixing == nil {
+		return nil, fmt.Errorf("benchmark %s has fewer than %d recent submissions", loan.Benchmark, config.BenchmarkQuorum)
+	}
+
+	rounding := config.Rounding
+	rate := newRate(rounding.round(ratAdd(fixing.Rate.Rat(), loan.Spread.Rat())))
+	if rate.Rat().Cmp(loan.InterestRate.Rat()) == 0 {
+		return nil, fmt.Errorf("rate of loan %s is already %s%%", loanID, rate)
+	}
+
+	start, _ := disbursementTime(loan)
+	impact := &RateResetImpact{
+		LoanID:          loanID,
+		LenderID:        loan.LenderID,
+		BorrowerID:      loan.BorrowerID,
+		Benchmark:       loan.Benchmark,
+		Fixing:          fixing.Rate,
+		OldRate:         loan.InterestRate,
+		NewRate:         rate,
+		OldInstallment:  nextInstallment(repaymentSchedule(loan, start, rounding), now),
+		OldRepaymentDue: loan.RepaymentDue,
+		Maturity:        loan.DueDate,
+		ResetAt:         now.Format(time.RFC3339),
+		TxID:            ctx.GetStub().GetTxID(),
+	}
+
+	loan.RateResets = append(loan.RateResets, &RateReset{
+		PriorRate: loan.InterestRate,
+		Rate:      rate,
+		Elapsed:   newDecimal(elapsed, fractionScale),
+		ResetAt:   impact.ResetAt,
+		TxID:      impact.TxID,
+	})
+	loan.InterestRate = rate
+	loan.RepaymentDue = repaymentDue(loan, rounding)
+	loan.RemainingBalance = rounding.amount(ratSub(amountSum(loan.RemainingBalance, loan.RepaymentDue), impact.OldRepaymentDue.Rat()))
+	impact.NewInstallment = nextInstallment(repaymentSchedule(loan, start, rounding), now)
+	impact.NewRepaymentDue = loan.RepaymentDue
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Rate reset from %s%% to %s%%, %s fixing of %s%% plus spread of %s%%, repayment due %s (TxID: %s)",
+			impact.OldRate,
+			rate,
+			loan.Benchmark,
+			fixing.Rate,
+			loan.Spread,
+			loan.RepaymentDue,
+			ctx.GetStub().GetTxID()))
+
+	err = s.putLoan(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+	err = putRecord(ctx, rateResetObjectType, []string{loan.LenderID, now.Format(indexInstantLayout), loanID}, impact)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := newLoanEventHeader(ctx, loanID, 2)
+	if err != nil {
+		return nil, err
+	}
+	return impact, emitEvent(ctx, eventLoanRateReset, LoanRateResetEventV2{
+		LoanEventHeader:  header,
+		BorrowerID:       loan.BorrowerID,
+		LenderID:         loan.LenderID,
+		Benchmark:        loan.Benchmark,
+		OldRate:          impact.OldRate,
+		NewRate:          rate,
+		OldInstallment:   impact.OldInstallment,
+		NewInstallment:   impact.NewInstallment,
+		RemainingBalance: loan.RemainingBalance,
+		Maturity:         loan.DueDate,
+	})
+}
+
+// The rate resets of a lender's loans in a period (YYYY-MM or YYYY-Qn), with
+// each loan's installment and repayment due before and after
+func (s *SmartContract) GetRateResetReport(
+	ctx contractapi.TransactionContextInterface,
+	lenderID string,
+	period string,
+) (*RateResetReport, error) {
+	start, end, err := parsePeriod(period)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(rateResetObjectType, []string{lenderID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	report := RateResetReport{
+		LenderID: lenderID,
+		Period:   period,
+		Resets:   []*RateResetImpact{},
+	}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var impact RateResetImpact
+		err = json.Unmarshal(entry.Value, &impact)
+		if err != nil {
+			return nil, err
+		}
+		resetAt, err := time.Parse(time.RFC3339, impact.ResetAt)
+		if err != nil || resetAt.Before(start) || resetAt.After(end) {
+			continue
+		}
+		report.Resets = append(report.Resets, &impact)
+	}
+
+	err = emitReportGenerated(ctx, "GetRateResetReport", map[string]string{"lenderId": lenderID, "period": period}, &report)
+	if err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
+
+// Total of the first installment falling due after asOf, 0 when none does
+func nextInstallment(schedule []ScheduleInstallment, asOf time.Time) token.Amount {
+	for _, row := range schedule {
+		dueDate, err := time.Parse(time.RFC3339, row.DueDate)
+		if err == nil && dueDate.After(asOf) {
+			return row.Total
+		}
+	}
+	return zeroAmount
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// How a repayment was applied between principal and interest
+type ReceiptComponents struct {
+	Principal token.Amount `json:"principal"`
+	Interest  token.Amount `json:"interest"`
+	Rebate    token.Amount `json:"rebate,omitempty" metadata:",optional"` // interest waived on early closure
+	TDS       token.Amount `json:"tds,omitempty" metadata:",optional"`    // tax withheld from the interest, included in Interest
+}
+
+// Proof of a repayment. The receipt ID is the ID of the repayment and Hash is
+// the SHA-256 of the receipt's JSON with Hash left empty.
+type Receipt struct {
+	ReceiptID        string            `json:"receiptId"`
+	LoanID           string            `json:"loanId"`
+	PayerID          string            `json:"payerId"`
+	Installment      int               `json:"installment"` // month of the loan term the payment falls in
+	Amount           token.Amount      `json:"amount"`
+	Components       ReceiptComponents `json:"components"`
+	PaymentReference string            `json:"paymentReference"`
+	PaidAt           string            `json:"paidAt"`
+	TxID             string            `json:"txId"`
+	Hash             string            `json:"hash"`
+}
+
+type ReceiptVerification struct {
+	ReceiptID string `json:"receiptId"`
+	Valid     bool   `json:"valid"`
+	Detail    string `json:"detail"`
+}
+
+const receiptObjectType = "receipt"
+
+// Issues the receipt of a repayment made in the current transaction. Nothing
+// is read from the loan's repayment history, so concurrent repayments of a
+// loan still do not conflict.
+func (s *SmartContract) issueReceipt(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	receiptID string,
+	payer string,
+	amount *big.Rat,
+	rebate *big.Rat,
+	paymentReference string,
+) error {
+	paidAt, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	interest := repaymentInterest(loan, amount, rebate, config.Rounding)
+
+	receipt := Receipt{
+		ReceiptID:   receiptID,
+		LoanID:      loan.LoanID,
+		PayerID:     payer,
+		Installment: installmentAt(loan, paidAt),
+		Amount:      token.NewAmount(amount),
+		Components: ReceiptComponents{
+			Principal: config.Rounding.amount(ratSub(amount, interest)),
+			Interest:  token.NewAmount(interest),
+			Rebate:    optionalAmount(rebate),
+			TDS:       optionalAmount(taxWithheld(interest, config)),
+		},
+		PaymentReference: paymentReference,
+		PaidAt:           paidAt.Format(time.RFC3339),
+		TxID:             ctx.GetStub().GetTxID(),
+	}
+
+	receipt.Hash, err = receiptHash(&receipt)
+	if err != nil {
+		return err
+	}
+
+	return putRecord(ctx, receiptObjectType, []string{receipt.ReceiptID}, receipt)
+}
+
+// ============== Receipts ==============
+
+func (s *SmartContract) GetReceipt(
+	ctx contractapi.TransactionContextInterface,
+	receiptID string,
+) (*Receipt, error) {
+	var receipt Receipt
+	exists, err := getRecord(ctx, receiptObjectType, []string{receiptID}, &receipt)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("receipt %s does not exist", receiptID)
+	}
+
+	return &receipt, nil
+}
+
+// Check a receipt hash presented by a borrower against the stored receipt and
+// the ledger history of its key
+func (s *SmartContract) VerifyReceipt(
+	ctx contractapi.TransactionContextInterface,
+	receiptID string,
+	hash string,
+) (*ReceiptVerification, error) {
+	verification := ReceiptVerification{ReceiptID: receiptID}
+
+	receipt, err := s.GetReceipt(ctx, receiptID)
+	if err != nil {
+		verification.Detail = err.Error()
+		return &verification, nil
+	}
+
+	computed, err := receiptHash(receipt)
+	if err != nil {
+		return nil, err
+	}
+	if computed != receipt.Hash || hash != receipt.Hash {
+		verification.Detail = "receipt hash does not match"
+		return &verification, nil
+	}
+
+	// The receipt must have been written once, by the repayment transaction
+	receiptKey, err := ctx.GetStub().CreateCompositeKey(receiptObjectType, []string{receiptID})
+	if err != nil {
+		return nil, err
+	}
+	iterator, err := ctx.GetStub().GetHistoryForKey(receiptKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history for receipt %s: %v", receiptID, err)
+	}
+	defer iterator.Close()
+
+	writes := 0
+	for iterator.HasNext() {
+		modification, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		writes++
+		if modification.TxId != receipt.TxID {
+			verification.Detail = fmt.Sprintf("receipt was modified by transaction %s", modification.TxId)
+			return &verification, nil
+		}
+	}
+	if writes != 1 {
+		verification.Detail = fmt.Sprintf("receipt has %d writes in ledger history", writes)
+		return &verification, nil
+	}
+
+	verification.Valid = true
+	verification.Detail = fmt.Sprintf("written by transaction %s", receipt.TxID)
+	return &verification, nil
+}
+
+// Interest part of a repayment. Interest is rounded and principal takes the
+// rest, so the parts add up to the amount. A rebate settles part of the
+// balance and comes off interest.
+func repaymentInterest(loan *Loan, amount *big.Rat, rebate *big.Rat, rounding RoundingPolicy) *big.Rat {
+	due := loan.RepaymentDue.Rat()
+	share := ratQuo(ratSub(due, disbursedPrincipal(loan)), due)
+	interest := rounding.round(ratSub(ratMul(ratAdd(amount, rebate), share), rebate))
+	return ratMax(interest, new(big.Rat))
+}
+
+func receiptHash(receipt *Receipt) (string, error) {
+	unhashed := *receipt
+	unhashed.Hash = ""
+
+	receiptJSON, err := json.Marshal(unhashed)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(receiptJSON)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Month of the loan term, counting from 1 at disbursement, that at falls in
+func installmentAt(loan *Loan, at time.Time) int {
+	disbursedAt, ok := disbursementTime(loan)
+	if !ok {
+		return 0
+	}
+
+	installment := 1
+	for installment < loan.Duration && !at.Before(disbursedAt.AddDate(0, installment, 0)) {
+		installment++
+	}
+	return installment
+}
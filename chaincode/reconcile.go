@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Token movement settling a loan, journaled by the transaction that made it
+type LoanMovement struct {
+	LoanID string       `json:"loanId"`
+	From   string       `json:"from"`
+	To     string       `json:"to"`
+	Amount token.Amount `json:"amount"`
+	Reason string       `json:"reason"`
+	TxID   string       `json:"txId"`
+}
+
+// Loan ledger against token ledger. Only discrepancies are listed.
+type ReconciliationReport struct {
+	AsOf         string                  `json:"asOf"`
+	LoansChecked int                     `json:"loansChecked"`
+	LoansSkipped int                     `json:"loansSkipped"` // disbursed before movements were journaled, or on another channel
+	Accounts     []AccountReconciliation `json:"accounts"`
+	Loans        []LoanReconciliation    `json:"loans"`
+}
+
+// Net of an account's disbursements received or made and repayments paid, by
+// the loan records and by the token movements
+type AccountReconciliation struct {
+	AccountID  string       `json:"accountId"`
+	LoanNet    token.Amount `json:"loanNet"`
+	TokenNet   token.Amount `json:"tokenNet"`
+	Difference token.Amount `json:"difference"`
+}
+
+// Repayments of a loan by its records against the tokens its holders received
+type LoanReconciliation struct {
+	LoanID         string       `json:"loanId"`
+	Repaid         token.Amount `json:"repaid"`
+	HoldersCredit  token.Amount `json:"holdersCredit"`
+	Difference     token.Amount `json:"difference"`
+	RepaymentCount int          `json:"repaymentCount"`
+}
+
+const loanMovementObjectType = "loanMovement"
+
+func journalMovement(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	from string,
+	to string,
+	value *big.Rat,
+	reason string,
+) error {
+	return putRecord(ctx, loanMovementObjectType, []string{loanID, ctx.GetStub().GetTxID(), from, to}, LoanMovement{
+		LoanID: loanID,
+		From:   from,
+		To:     to,
+		Amount: token.NewAmount(value),
+		Reason: reason,
+		TxID:   ctx.GetStub().GetTxID(),
+	})
+}
+
+// ============== Reconciliation ==============
+
+// Cross-check the loan ledger against the token movements journaled for each
+// loan, regulator only. Per account, disbursed minus repaid by the loan and
+// repayment records must equal the net DISBURSEMENT and REPAYMENT movements;
+// per loan, its repayments must equal what its holders were credited.
+// Cooling-off returns and income distributions are not reconciled.
+func (s *SmartContract) Reconcile(
+	ctx contractapi.TransactionContextInterface,
+) (*ReconciliationReport, error) {
+	err := requireRegulator(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	asOf, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report := ReconciliationReport{
+		AsOf:     asOf.Format(time.RFC3339),
+		Accounts: []AccountReconciliation{},
+		Loans:    []LoanReconciliation{},
+	}
+
+	loanNet := map[string]*big.Rat{}
+	tokenNet := map[string]*big.Rat{}
+	add := func(net map[string]*big.Rat, account string, value *big.Rat) {
+		if net[account] == nil {
+			net[account] = new(big.Rat)
+		}
+		net[account].Add(net[account], value)
+	}
+
+	loans, err := s.getIndexedLoans(ctx, borrowerLoanIndex)
+	if err != nil {
+		return nil, err
+	}
+	for _, loan := range loans {
+		if _, disbursed := disbursementTime(loan); !disbursed {
+			continue
+		}
+
+		movements, err := loanMovements(ctx, loan.LoanID)
+		if err != nil {
+			return nil, err
+		}
+		journaled := false
+		for _, movement := range movements {
+			journaled = journaled || movement.Reason == token.ReasonDisbursement
+		}
+		if !journaled {
+			report.LoansSkipped++
+			continue
+		}
+		report.LoansChecked++
+
+		principal := disbursedPrincipal(loan)
+		add(loanNet, loan.BorrowerID, principal)
+		add(loanNet, loan.LenderID, new(big.Rat).Neg(principal))
+
+		repaid := new(big.Rat)
+		repayments, err := s.getRepayments(ctx, loan.LoanID)
+		if err != nil {
+			return nil, err
+		}
+		for _, repayment := range repayments {
+			receipt, err := s.GetReceipt(ctx, repayment.RepaymentID)
+			if err != nil {
+				return nil, err
+			}
+			value := receipt.Amount.Rat()
+			repaid.Add(repaid, value)
+			add(loanNet, receipt.PayerID, new(big.Rat).Neg(value))
+		}
+
+		credited := new(big.Rat)
+		for _, movement := range movements {
+			value := movement.Amount.Rat()
+			switch movement.Reason {
+			case token.ReasonDisbursement:
+				add(tokenNet, movement.To, value)
+				add(tokenNet, movement.From, new(big.Rat).Neg(value))
+			case token.ReasonRepayment:
+				add(tokenNet, movement.From, new(big.Rat).Neg(value))
+				credited.Add(credited, value)
+			}
+		}
+
+		if repaid.Cmp(credited) != 0 {
+			report.Loans = append(report.Loans, LoanReconciliation{
+				LoanID:         loan.LoanID,
+				Repaid:         token.NewAmount(repaid),
+				HoldersCredit:  token.NewAmount(credited),
+				Difference:     token.NewAmount(new(big.Rat).Sub(repaid, credited)),
+				RepaymentCount: len(repayments),
+			})
+		}
+	}
+
+	accounts := []string{}
+	for account := range loanNet {
+		accounts = append(accounts, account)
+	}
+	for account := range tokenNet {
+		if loanNet[account] == nil {
+			accounts = append(accounts, account)
+		}
+	}
+	sort.Strings(accounts)
+	for _, account := range accounts {
+		expected, actual := new(big.Rat), new(big.Rat)
+		if loanNet[account] != nil {
+			expected = loanNet[account]
+		}
+		if tokenNet[account] != nil {
+			actual = tokenNet[account]
+		}
+		if expected.Cmp(actual) == 0 {
+			continue
+		}
+		report.Accounts = append(report.Accounts, AccountReconciliation{
+			AccountID:  account,
+			LoanNet:    token.NewAmount(expected),
+			TokenNet:   token.NewAmount(actual),
+			Difference: token.NewAmount(new(big.Rat).Sub(expected, actual)),
+		})
+	}
+
+	return &report, nil
+}
+
+// Movements journaled for a loan
+func loanMovements(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+) ([]*LoanMovement, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(loanMovementObjectType, []string{loanID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	movements := []*LoanMovement{}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var movement LoanMovement
+		err = json.Unmarshal(entry.Value, &movement)
+		if err != nil {
+			return nil, err
+		}
+		movements = append(movements, &movement)
+	}
+
+	return movements, nil
+}
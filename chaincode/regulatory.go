@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Supervisory return types, CONSOLIDATED carries the sections of all others
+const (
+	returnSanctions     = "SANCTIONS"
+	returnDisbursements = "DISBURSEMENTS"
+	returnOutstandings  = "OUTSTANDINGS"
+	returnNPA           = "NPA"
+	returnProvisioning  = "PROVISIONING"
+	returnRestructured  = "RESTRUCTURED"
+	returnMoratorium    = "MORATORIUM"
+	returnConsolidated  = "CONSOLIDATED"
+)
+
+type ReturnLine struct {
+	Section string       `json:"section"`
+	Item    string       `json:"item"`
+	Count   int          `json:"count"`
+	Amount  token.Amount `json:"amount"`
+}
+
+type RegulatoryReturn struct {
+	LenderID   string       `json:"lenderId"`
+	Period     string       `json:"period"`
+	ReturnType string       `json:"returnType"`
+	AsOf       string       `json:"asOf"`
+	Lines      []ReturnLine `json:"lines"`
+}
+
+// Accumulates lines keyed by section and item, keeping a stable output order
+type returnBuilder struct {
+	lines map[string]*ReturnLine
+}
+
+func (b *returnBuilder) add(section string, item string, amount *big.Rat) {
+	key := section + "/" + item
+	line, ok := b.lines[key]
+	if !ok {
+		line = &ReturnLine{Section: section, Item: item}
+		b.lines[key] = line
+	}
+	line.Count++
+	line.Amount = token.NewAmount(ratAdd(line.Amount.Rat(), amount))
+}
+
+func (b *returnBuilder) sorted() []ReturnLine {
+	keys := make([]string, 0, len(b.lines))
+	for key := range b.lines {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	lines := []ReturnLine{}
+	for _, key := range keys {
+		lines = append(lines, *b.lines[key])
+	}
+	return lines
+}
+
+// ============== Regulatory Returns ==============
+
+// Generate the aggregates of a supervisory return for a lender, regulator only
+func (s *SmartContract) GenerateRegulatoryReturn(
+	ctx contractapi.TransactionContextInterface,
+	lenderID string,
+	period string,
+	returnType string,
+) (*RegulatoryReturn, error) {
+	err := requireRegulator(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sections := map[string]bool{}
+	switch returnType {
+	case returnSanctions, returnDisbursements, returnOutstandings, returnNPA, returnProvisioning, returnRestructured, returnMoratorium:
+		sections[returnType] = true
+	case returnConsolidated:
+		for _, section := range []string{returnSanctions, returnDisbursements, returnOutstandings, returnNPA, returnProvisioning, returnRestructured, returnMoratorium} {
+			sections[section] = true
+		}
+	default:
+		return nil, fmt.Errorf("unknown return type %s", returnType)
+	}
+
+	start, end, err := parsePeriod(period)
+	if err != nil {
+		return nil, err
+	}
+	asOf, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if end.Before(asOf) {
+		asOf = end
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	builder := returnBuilder{lines: map[string]*ReturnLine{}}
+	inPeriod := func(at time.Time, ok bool) bool {
+		return ok && !at.Before(start) && !at.After(end)
+	}
+
+	err = s.forEachIndexedLoan(ctx, lenderLoanIndex, []string{lenderID}, func(loan *Loan) error {
+		product := loan.Product
+		if product == "" {
+			product = "UNSPECIFIED"
+		}
+
+		if sections[returnSanctions] && inPeriod(approvalTime(loan)) {
+			builder.add(returnSanctions, product, loan.Amount.Rat())
+		}
+		if sections[returnDisbursements] && inPeriod(disbursementTime(loan)) {
+			builder.add(returnDisbursements, product, disbursedPrincipal(loan))
+		}
+
+		// Stock figures only cover loans disbursed and unpaid at the reporting date
+		disbursedAt, disbursed := disbursementTime(loan)
+		balance := loan.RemainingBalance.Rat()
+		if !disbursed || disbursedAt.After(asOf) || balance.Sign() <= 0 {
+			return nil
+		}
+
+		classification := assetClassification(loan, asOf)
+		if sections[returnOutstandings] {
+			builder.add(returnOutstandings, classification, balance)
+		}
+		if sections[returnNPA] && isNPA(classification) {
+			builder.add(returnNPA, classification, balance)
+		}
+		if sections[returnProvisioning] {
+			builder.add(returnProvisioning, classification, config.Rounding.round(percentOf(balance, config.Provisioning[classification].Rat())))
+		}
+		// Restructured stock is reported apart, its classification is held
+		if sections[returnRestructured] && isRestructured(loan, asOf) {
+			builder.add(returnRestructured, classification, balance)
+		}
+		if sections[returnMoratorium] && underMoratorium(loan, asOf) {
+			builder.add(returnMoratorium, classification, balance)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RegulatoryReturn{
+		LenderID:   lenderID,
+		Period:     period,
+		ReturnType: returnType,
+		AsOf:       asOf.Format(time.RFC3339),
+		Lines:      builder.sorted(),
+	}
+	err = emitReportGenerated(ctx, "GenerateRegulatoryReturn", map[string]string{"lenderId": lenderID, "period": period, "returnType": returnType}, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Structured reasons a loan application is declined
+const (
+	rejectCreditPolicy         = "CREDIT_POLICY"
+	rejectLendingCap           = "LENDING_CAP"
+	rejectIncompleteDocuments  = "INCOMPLETE_DOCUMENTS"
+	rejectInsufficientIncome   = "INSUFFICIENT_INCOME"
+	rejectInadequateCollateral = "INADEQUATE_COLLATERAL"
+	rejectOther                = "OTHER"
+)
+
+// Index of rejected applications by the lender that declined them and the reason
+const rejectionLoanIndex = "rejection~loan"
+
+type RejectionCount struct {
+	ReasonCode string `json:"reasonCode"`
+	Count      int    `json:"count"`
+}
+
+// Rejection counts of a page of a lender's declined applications
+type RejectionCountPage struct {
+	Counts   []RejectionCount `json:"counts"`
+	Bookmark string           `json:"bookmark"` // empty on the last page
+}
+
+// ============== Rejections ==============
+
+// Decline a pending loan application on behalf of a lender with one of the
+// structured reason codes
+func (s *SmartContract) RejectLoan(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	lenderID string,
+	reasonCode string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "RejectLoan")
+	if err != nil {
+		return nil, err
+	}
+
+	switch reasonCode {
+	case rejectIncompleteDocuments, rejectInsufficientIncome, rejectInadequateCollateral, rejectOther:
+	default:
+		return nil, fmt.Errorf("unknown rejection reason %s", reasonCode)
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Status != "PENDING" {
+		return nil, fmt.Errorf("loan %s cannot be rejected in current status: %s", loanID, loan.Status)
+	}
+
+	err = s.requireLender(ctx, lenderID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.rejectLoan(ctx, loan, lenderID, reasonCode, []string{})
+}
+
+// Counts by reason code of a page of a lender's declined applications, the
+// lender's counts are the sums over its pages
+func (s *SmartContract) GetRejectionCounts(
+	ctx contractapi.TransactionContextInterface,
+	lenderID string,
+	pageSize int32,
+	bookmark string,
+) (*RejectionCountPage, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive")
+	}
+	bookmark, err := token.DecodeBookmark(bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(rejectionLoanIndex, []string{lenderID}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	byReason := map[string]int{}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+		if err != nil {
+			return nil, err
+		}
+		byReason[keyParts[1]]++
+	}
+
+	page := RejectionCountPage{Counts: []RejectionCount{}}
+	for _, reasonCode := range []string{rejectCreditPolicy, rejectLendingCap, rejectIncompleteDocuments, rejectInsufficientIncome, rejectInadequateCollateral, rejectOther} {
+		page.Counts = append(page.Counts, RejectionCount{ReasonCode: reasonCode, Count: byReason[reasonCode]})
+	}
+	page.Bookmark = token.EncodeBookmark(nextBookmark(metadata.GetFetchedRecordsCount(), pageSize, metadata.GetBookmark()))
+	return &page, nil
+}
+
+// The application history of a loan, the loan itself first followed by the
+// earlier applications it re-applied for, pageSize applications at a time.
+// The bookmark is the ID of the next earlier application.
+func (s *SmartContract) GetApplicationHistory(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	pageSize int32,
+	bookmark string,
+) (*LoanPage, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive")
+	}
+	if bookmark != "" {
+		loanID = bookmark
+	}
+
+	page := LoanPage{Loans: []*Loan{}}
+	for loanID != "" {
+		if len(page.Loans) == int(pageSize) {
+			page.Bookmark = loanID
+			break
+		}
+		loan, err := s.getLoan(ctx, loanID)
+		if err != nil {
+			return nil, err
+		}
+		page.Loans = append(page.Loans, loan)
+		loanID = loan.PriorApplicationID
+	}
+
+	err := s.viewLoans(ctx, page.Loans)
+	if err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+// Marks a pending loan REJECTED by lenderID, failed lists the credit policy
+// rules that did not pass
+func (s *SmartContract) rejectLoan(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	lenderID string,
+	reasonCode string,
+	failed []string,
+) (*LoanResult, error) {
+	loan.Status = "REJECTED"
+	loan.RejectionReason = reasonCode
+	if len(failed) > 0 {
+		check := "credit policy"
+		if reasonCode == rejectLendingCap {
+			check = "lending caps"
+		}
+		loan.AuditHistory = append(loan.AuditHistory,
+			fmt.Sprintf("Approval by %s rejected by %s: %s (TxID: %s)",
+				lenderID,
+				check,
+				strings.Join(failed, ", "),
+				ctx.GetStub().GetTxID()))
+	} else {
+		loan.AuditHistory = append(loan.AuditHistory,
+			fmt.Sprintf("Loan rejected by %s: %s (TxID: %s)",
+				lenderID,
+				reasonCode,
+				ctx.GetStub().GetTxID()))
+	}
+
+	err := s.putIndex(ctx, rejectionLoanIndex, lenderID, reasonCode, loan.LoanID)
+	if err != nil {
+		return nil, err
+	}
+	err = s.closeEscalation(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+	err = s.dequeueApplication(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.releaseInvoice(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.putLoan(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := newLoanEventHeader(ctx, loan.LoanID, 1)
+	if err != nil {
+		return nil, err
+	}
+	return newLoanResult(ctx, loan).emit(ctx, eventLoanRejected, LoanRejectedEventV1{
+		LoanEventHeader: header,
+		BorrowerID:      loan.BorrowerID,
+		LenderID:        lenderID,
+		FailedRules:     failed,
+		ReasonCode:      reasonCode,
+	})
+}
+
+// Links a new application to an earlier rejected application of the same borrower
+func (s *SmartContract) linkPriorApplication(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	priorLoanID string,
+) error {
+	prior, err := s.getLoan(ctx, priorLoanID)
+	if err != nil {
+		return err
+	}
+
+	if prior.BorrowerID != loan.BorrowerID {
+		return fmt.Errorf("prior application %s belongs to another borrower", priorLoanID)
+	}
+	if prior.Status != "REJECTED" {
+		return fmt.Errorf("prior application %s was not rejected, current status: %s", priorLoanID, prior.Status)
+	}
+
+	loan.PriorApplicationID = priorLoanID
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Re-application of %s rejected for %s (TxID: %s)",
+			priorLoanID,
+			prior.RejectionReason,
+			ctx.GetStub().GetTxID()))
+
+	return nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// A single repayment, stored under the loan and keyed by its repayment ID
+type Repayment struct {
+	RepaymentID      string       `json:"repaymentId"`
+	LoanID           string       `json:"loanId"`
+	Amount           token.Amount `json:"amount"`
+	PaymentReference string       `json:"paymentReference"` // UPI transaction ID or UTR
+	PaidAt           string       `json:"paidAt"`
+	TxID             string       `json:"txId"`
+	Rebate           token.Amount `json:"rebate,omitempty" metadata:",optional"` // interest waived when the repayment closed the loan early
+}
+
+const repaymentObjectType = "repayment"
+
+// Repayments not yet folded into their loan record
+const pendingRepaymentIndex = "pending~repayment"
+
+func (s *SmartContract) recordRepayment(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	repaymentID string,
+	amount *big.Rat,
+	rebate *big.Rat,
+	paymentReference string,
+) error {
+	if paymentReference == "" {
+		return fmt.Errorf("payment reference is required")
+	}
+
+	// A reference identifies one payment, reusing it would break reconciliation
+	existing, err := ctx.GetStub().GetStateByPartialCompositeKey(paymentReferenceIndex, []string{paymentReference})
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer existing.Close()
+	if existing.HasNext() {
+		return fmt.Errorf("payment reference %s has already been used", paymentReference)
+	}
+
+	paidAt, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	repayment := Repayment{
+		RepaymentID:      repaymentID,
+		LoanID:           loan.LoanID,
+		Amount:           token.NewAmount(amount),
+		PaymentReference: paymentReference,
+		PaidAt:           paidAt.Format(time.RFC3339),
+		TxID:             ctx.GetStub().GetTxID(),
+		Rebate:           optionalAmount(rebate),
+	}
+
+	err = putRecord(ctx, repaymentObjectType, []string{loan.LoanID, repayment.RepaymentID}, repayment)
+	if err != nil {
+		return err
+	}
+
+	err = s.putIndex(ctx, pendingRepaymentIndex, loan.LoanID, repayment.RepaymentID)
+	if err != nil {
+		return err
+	}
+
+	return s.putIndex(ctx, paymentReferenceIndex, paymentReference, loan.LoanID, repayment.RepaymentID)
+}
+
+// Applies the loan's pending repayments in payment order, closing it once
+// repaid. They stay pending until putLoan saves the loan.
+func (s *SmartContract) applyPendingRepayments(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+) error {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(pendingRepaymentIndex, []string{loan.LoanID})
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	repayments := []Repayment{}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return err
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+		if err != nil {
+			return err
+		}
+
+		var repayment Repayment
+		exists, err := getRecord(ctx, repaymentObjectType, keyParts, &repayment)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("repayment %s does not exist", keyParts[1])
+		}
+		repayments = append(repayments, repayment)
+		loan.pendingRepayments = append(loan.pendingRepayments, entry.Key)
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return err
+	}
+	rounding := config.Rounding
+
+	sort.SliceStable(repayments, func(i, j int) bool {
+		return repayments[i].PaidAt < repayments[j].PaidAt
+	})
+
+	balance := loan.RemainingBalance.Rat()
+	for _, repayment := range repayments {
+		balance = rounding.round(ratSub(balance, amountSum(repayment.Amount, repayment.Rebate)))
+		loan.AuditHistory = append(loan.AuditHistory,
+			fmt.Sprintf("Repayment of %s, reference %s (TxID: %s)",
+				repayment.Amount,
+				repayment.PaymentReference,
+				repayment.TxID))
+		if repayment.Rebate.Rat().Sign() > 0 {
+			loan.AuditHistory = append(loan.AuditHistory,
+				fmt.Sprintf("Prepayment rebate of %s for unaccrued interest (TxID: %s)",
+					repayment.Rebate,
+					repayment.TxID))
+		}
+
+		if balance.Sign() <= 0 && loan.Status == "ACTIVE" {
+			paidAt, err := time.Parse(time.RFC3339, repayment.PaidAt)
+			if err != nil {
+				return err
+			}
+			loan.Status = "REPAID"
+			loan.ClosedAt = fmt.Sprintf("%d", paidAt.Unix())
+		}
+	}
+
+	// Repayments are bounded by the balance as last saved, those pending
+	// together can exceed it. The excess is not returned by the chaincode.
+	if balance.Sign() < 0 {
+		loan.AuditHistory = append(loan.AuditHistory,
+			fmt.Sprintf("Loan overpaid by %s, excess due to the borrower", token.FormatAmount(new(big.Rat).Neg(balance))))
+		balance = new(big.Rat)
+	}
+	if len(repayments) > 0 {
+		loan.RemainingBalance = rounding.amount(balance)
+	}
+
+	return nil
+}
+
+// Save a loan's pending repayments into its record
+func (s *SmartContract) ConsolidateRepayments(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "ConsolidateRepayments")
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.putLoanResult(ctx, loan)
+}
+
+// ============== Repayment Queries ==============
+
+// Look up a repayment by its UPI transaction ID or UTR for reconciliation
+func (s *SmartContract) GetRepaymentByReference(
+	ctx contractapi.TransactionContextInterface,
+	paymentReference string,
+) (*Repayment, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(paymentReferenceIndex, []string{paymentReference})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	if !iterator.HasNext() {
+		return nil, fmt.Errorf("no repayment with reference %s", paymentReference)
+	}
+	entry, err := iterator.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	_, keyParts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	var repayment Repayment
+	exists, err := getRecord(ctx, repaymentObjectType, keyParts[1:], &repayment)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("repayment %s does not exist", keyParts[2])
+	}
+
+	return &repayment, nil
+}
+
+// All repayments recorded against a loan, folded or pending
+func (s *SmartContract) getRepayments(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+) ([]*Repayment, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(repaymentObjectType, []string{loanID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	repayments := []*Repayment{}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var repayment Repayment
+		err = json.Unmarshal(entry.Value, &repayment)
+		if err != nil {
+			return nil, err
+		}
+		repayments = append(repayments, &repayment)
+	}
+
+	return repayments, nil
+}
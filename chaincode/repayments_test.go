@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"lending/internal/mockstub"
+	"lending/token"
+)
+
+// Repayments stay pending beside the stored loan under keys of their own
+// until they are folded into the loan record
+func TestPendingRepayments(t *testing.T) {
+	tests := []struct {
+		name        string
+		repayments  []string
+		consolidate bool
+		wantErr     string // of the last repayment
+		wantStored  token.Amount
+		wantBalance token.Amount
+		wantPending int
+		wantStatus  string
+		wantAudit   string
+	}{
+		{
+			name:        "single repayment",
+			repayments:  []string{"100"},
+			wantStored:  "1120.00",
+			wantBalance: "1020.00",
+			wantPending: 1,
+			wantStatus:  "ACTIVE",
+		},
+		{
+			name:        "repayments accumulate",
+			repayments:  []string{"100", "200"},
+			wantStored:  "1120.00",
+			wantBalance: "820.00",
+			wantPending: 2,
+			wantStatus:  "ACTIVE",
+		},
+		{
+			name:        "consolidated",
+			repayments:  []string{"100", "200"},
+			consolidate: true,
+			wantStored:  "820.00",
+			wantBalance: "820.00",
+			wantStatus:  "ACTIVE",
+		},
+		{
+			name:        "overpayment of the saved balance",
+			repayments:  []string{"1200"},
+			wantErr:     "exceeds remaining balance of 1120.00",
+			wantStored:  "1120.00",
+			wantBalance: "1120.00",
+			wantStatus:  "ACTIVE",
+		},
+		{
+			name:        "pending repayments paying more than is owed",
+			repayments:  []string{"1000", "200"},
+			wantStored:  "1120.00",
+			wantBalance: "0.00",
+			wantPending: 2,
+			wantStatus:  "REPAID",
+			wantAudit:   "Loan overpaid by 80.00, excess due to the borrower",
+		},
+		{
+			name:        "repaid while pending",
+			repayments:  []string{"620", "500"},
+			wantStored:  "1120.00",
+			wantBalance: "0.00",
+			wantPending: 2,
+			wantStatus:  "REPAID",
+		},
+		{
+			name:        "repaid and consolidated",
+			repayments:  []string{"620", "500"},
+			consolidate: true,
+			wantStored:  "0.00",
+			wantBalance: "0.00",
+			wantStatus:  "REPAID",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLedger(t)
+			l.borrower("B1", "2000")
+			l.disbursedLoan("L1", "B1", "1000")
+
+			for i, amount := range tt.repayments {
+				err := l.submit(hdfc, func(ctx *TransactionContext) error {
+					_, err := l.contract.RepayLoan(ctx, "L1", amount, fmt.Sprintf("UTR%d", i))
+					return err
+				})
+				if i < len(tt.repayments)-1 || tt.wantErr == "" {
+					if err != nil {
+						t.Fatalf("repayment %d: %v", i, err)
+					}
+				} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("repayment %d error = %v, want %q", i, err, tt.wantErr)
+				}
+			}
+			if tt.consolidate {
+				l.must(hdfc, func(ctx *TransactionContext) error {
+					_, err := l.contract.ConsolidateRepayments(ctx, "L1")
+					return err
+				})
+			}
+
+			l.must(hdfc, func(ctx *TransactionContext) error {
+				stored, err := l.contract.readLoan(ctx, "L1")
+				if err != nil {
+					return err
+				}
+				if stored.RemainingBalance != tt.wantStored {
+					t.Errorf("stored balance = %s, want %s", stored.RemainingBalance, tt.wantStored)
+				}
+
+				loan, err := l.contract.getLoan(ctx, "L1")
+				if err != nil {
+					return err
+				}
+				if loan.RemainingBalance != tt.wantBalance {
+					t.Errorf("balance = %s, want %s", loan.RemainingBalance, tt.wantBalance)
+				}
+				if loan.Status != tt.wantStatus {
+					t.Errorf("status = %s, want %s", loan.Status, tt.wantStatus)
+				}
+				if len(loan.pendingRepayments) != tt.wantPending {
+					t.Errorf("pending repayments = %d, want %d", len(loan.pendingRepayments), tt.wantPending)
+				}
+				if tt.wantAudit != "" && !strings.Contains(strings.Join(loan.AuditHistory, "\n"), tt.wantAudit) {
+					t.Errorf("audit history = %q, want an entry %q", loan.AuditHistory, tt.wantAudit)
+				}
+				return nil
+			})
+		})
+	}
+}
+
+// Repayments of one loan endorsed at once must not invalidate each other, so
+// neither may read a lending key the other writes. The token chaincode keeps
+// the balances, which conflict only for the same payer.
+func TestConcurrentRepayments(t *testing.T) {
+	l := newTestLedger(t)
+	l.deployTokenChaincode("token")
+	l.borrower("B1", "2000")
+	l.disbursedLoan("L1", "B1", "1000")
+
+	var sets []*mockstub.ReadWriteSet
+	for i, amount := range []string{"100", "200"} {
+		l.must(hdfc, func(ctx *TransactionContext) error {
+			_, err := l.contract.RepayLoan(ctx, "L1", amount, fmt.Sprintf("UTR%d", i))
+			return err
+		})
+		sets = append(sets, l.rwset)
+	}
+
+	if conflicts := sets[1].ConflictsWith(sets[0]); len(conflicts) > 0 {
+		t.Errorf("second repayment read keys the first wrote: %q", conflicts)
+	}
+	if conflicts := sets[0].ConflictsWith(sets[1]); len(conflicts) > 0 {
+		t.Errorf("first repayment read keys the second wrote: %q", conflicts)
+	}
+}
+
+// Amounts keep every paisa at sizes a float64 cannot hold, from the
+// application through the repayment and its event, and an amount finer than
+// a paisa is refused rather than rounded
+func TestExactAmounts(t *testing.T) {
+	const amount = "1000000000000000.01"
+	l := newTestLedger(t)
+	l.borrower("B1", "100")
+	l.must(regulator, func(ctx *TransactionContext) error {
+		return l.contract.Mint(ctx, "HDFC", amount)
+	})
+	l.disbursedLoan("L1", "B1", amount)
+
+	var loan *Loan
+	var event LoanRepaidEventV2
+	l.must(hdfc, func(ctx *TransactionContext) error {
+		var err error
+		loan, err = l.contract.getLoan(ctx, "L1")
+		if err != nil {
+			return err
+		}
+		_, err = l.contract.RepayLoan(ctx, "L1", amount, "UTR1")
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(l.stub.EventPayload, &event)
+	})
+
+	if loan.Amount != amount {
+		t.Errorf("loan amount = %s, want %s", loan.Amount, amount)
+	}
+	if event.Amount != amount {
+		t.Errorf("repaid amount = %s, want %s", event.Amount, amount)
+	}
+	remaining := token.NewAmount(ratSub(loan.RepaymentDue.Rat(), token.Amount(amount).Rat()))
+	if event.RemainingBalance != remaining {
+		t.Errorf("remaining balance = %s, want %s", event.RemainingBalance, remaining)
+	}
+
+	for _, tx := range []func(ctx *TransactionContext) error{
+		func(ctx *TransactionContext) error {
+			_, err := l.contract.RequestLoan(ctx, "L2", "B1", "1000.001", "12", 12, "", "", "", "")
+			return err
+		},
+		func(ctx *TransactionContext) error {
+			_, err := l.contract.RepayLoan(ctx, "L1", "0.001", "UTR2")
+			return err
+		},
+	} {
+		err := l.submit(hdfc, tx)
+		if err == nil || !strings.Contains(err.Error(), "has more than 2 decimal places") {
+			t.Errorf("error = %v, want the amount refused", err)
+		}
+	}
+}
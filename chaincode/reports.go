@@ -0,0 +1,904 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// One account line in a credit bureau submission
+type BureauRecord struct {
+	AccountNumber    string       `json:"accountNumber"`
+	BorrowerID       string       `json:"borrowerId"`
+	SanctionedAmount token.Amount `json:"sanctionedAmount"`
+	DisbursementDate string       `json:"disbursementDate"`
+	CurrentBalance   token.Amount `json:"currentBalance"`
+	AmountOverdue    token.Amount `json:"amountOverdue"`
+	DaysPastDue      int          `json:"daysPastDue"`
+	AccountStatus    string       `json:"accountStatus"`
+	DueDate          string       `json:"dueDate"`
+	AssetClass       string       `json:"assetClass"`
+	Restructured     bool         `json:"restructured,omitempty" metadata:",optional"`
+	Moratorium       bool         `json:"moratorium,omitempty" metadata:",optional"` // moratorium running at the report date
+}
+
+type BureauReport struct {
+	LenderID     string         `json:"lenderId"`
+	Period       string         `json:"period"`
+	ReportedAsOf string         `json:"reportedAsOf"`
+	Records      []BureauRecord `json:"records"`
+}
+
+// ============== Credit Bureau Reporting ==============
+
+// Generate a CIBIL-like account record set for a lender's disbursed loans.
+// A past period is reported as the loans stood at its end. Available to the
+// regulator and the organization operating the lender's account.
+func (s *SmartContract) GenerateBureauReport(
+	ctx contractapi.TransactionContextInterface,
+	lenderID string,
+	period string,
+) (*BureauReport, error) {
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if mspID != regulatorMSP {
+		err = s.requireLender(ctx, lenderID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, periodEnd, err := parsePeriod(period)
+	if err != nil {
+		return nil, err
+	}
+
+	// A report for the running period is as of now, not as of its end
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	asOf := now
+	if periodEnd.Before(asOf) {
+		asOf = periodEnd
+	}
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := BureauReport{
+		LenderID:     lenderID,
+		Period:       period,
+		ReportedAsOf: asOf.Format(time.RFC3339),
+		Records:      []BureauRecord{},
+	}
+
+	err = s.forEachIndexedLoan(ctx, lenderLoanIndex, []string{lenderID}, func(loan *Loan) error {
+		disbursedAt, ok := disbursementTime(loan)
+		if !ok || disbursedAt.After(asOf) {
+			return nil
+		}
+		if asOf.Before(now) {
+			loan, err = s.loanAsOf(ctx, loan, asOf, config.Rounding)
+			if err != nil || loan == nil {
+				return err
+			}
+		}
+
+		dpd := daysPastDue(loan, asOf)
+		record := BureauRecord{
+			AccountNumber:    loan.LoanID,
+			BorrowerID:       loan.BorrowerID,
+			SanctionedAmount: loan.Amount,
+			DisbursementDate: disbursedAt.Format(time.RFC3339),
+			CurrentBalance:   loan.RemainingBalance,
+			AmountOverdue:    zeroAmount,
+			DaysPastDue:      dpd,
+			AccountStatus:    loan.Status,
+			DueDate:          loan.DueDate,
+			AssetClass:       assetClassification(loan, asOf),
+			Restructured:     isRestructured(loan, asOf),
+			Moratorium:       underMoratorium(loan, asOf),
+		}
+		if dpd > 0 {
+			record.AmountOverdue = loan.RemainingBalance
+		}
+
+		report.Records = append(report.Records, record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = emitReportGenerated(ctx, "GenerateBureauReport", map[string]string{"lenderId": lenderID, "period": period}, &report)
+	if err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
+
+// ============== Portfolio Analytics ==============
+
+type StatusSummary struct {
+	Status      string       `json:"status"`
+	Count       int          `json:"count"`
+	Amount      token.Amount `json:"amount"`
+	Outstanding token.Amount `json:"outstanding"`
+}
+
+type PortfolioSummary struct {
+	LenderID            string          `json:"lenderId"`
+	AsOf                string          `json:"asOf"`
+	LoanCount           int             `json:"loanCount"`
+	ByStatus            []StatusSummary `json:"byStatus"`
+	TotalDisbursed      token.Amount    `json:"totalDisbursed"`
+	TotalOutstanding    token.Amount    `json:"totalOutstanding"`
+	WeightedAverageRate Decimal         `json:"weightedAverageRate"` // weighted by outstanding balance
+	NPAOutstanding      token.Amount    `json:"npaOutstanding"`
+	NPARatio            Decimal         `json:"npaRatio"`
+}
+
+// Summarize a lender's book by status along with outstanding, yield and NPA
+// figures. Available to the regulator and the organization operating the
+// lender's account.
+func (s *SmartContract) GetPortfolioSummary(
+	ctx contractapi.TransactionContextInterface,
+	lenderID string,
+) (*PortfolioSummary, error) {
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if mspID != regulatorMSP {
+		err = s.requireLender(ctx, lenderID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	asOf, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := PortfolioSummary{
+		LenderID: lenderID,
+		AsOf:     asOf.Format(time.RFC3339),
+		ByStatus: []StatusSummary{},
+	}
+	// Amount and outstanding of each status
+	byStatus := map[string]*StatusSummary{}
+	totals := map[string][2]*big.Rat{}
+	disbursed, outstanding, npa, rateWeight := new(big.Rat), new(big.Rat), new(big.Rat), new(big.Rat)
+
+	err = s.forEachIndexedLoan(ctx, lenderLoanIndex, []string{lenderID}, func(loan *Loan) error {
+		status, ok := byStatus[loan.Status]
+		if !ok {
+			status = &StatusSummary{Status: loan.Status}
+			byStatus[loan.Status] = status
+			totals[loan.Status] = [2]*big.Rat{new(big.Rat), new(big.Rat)}
+		}
+		total := totals[loan.Status]
+		status.Count++
+		total[0].Add(total[0], loan.Amount.Rat())
+		summary.LoanCount++
+
+		if _, ok := disbursementTime(loan); !ok {
+			return nil
+		}
+		disbursed.Add(disbursed, disbursedPrincipal(loan))
+
+		balance := loan.RemainingBalance.Rat()
+		if balance.Sign() <= 0 || loan.Status == "REPAID" {
+			return nil
+		}
+		total[1].Add(total[1], balance)
+		outstanding.Add(outstanding, balance)
+		rateWeight.Add(rateWeight, ratMul(loan.InterestRate.Rat(), balance))
+		if isNPA(assetClassification(loan, asOf)) {
+			npa.Add(npa, balance)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	summary.TotalDisbursed = token.NewAmount(disbursed)
+	summary.TotalOutstanding = token.NewAmount(outstanding)
+	summary.NPAOutstanding = token.NewAmount(npa)
+	summary.WeightedAverageRate = newRate(ratQuo(rateWeight, outstanding))
+	summary.NPARatio = newRate(ratQuo(npa, outstanding))
+
+	statuses := make([]string, 0, len(byStatus))
+	for status := range byStatus {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	for _, status := range statuses {
+		summary.ByStatus = append(summary.ByStatus, *byStatus[status])
+		line := &summary.ByStatus[len(summary.ByStatus)-1]
+		line.Amount = token.NewAmount(totals[status][0])
+		line.Outstanding = token.NewAmount(totals[status][1])
+	}
+
+	err = emitReportGenerated(ctx, "GetPortfolioSummary", map[string]string{"lenderId": lenderID}, &summary)
+	if err != nil {
+		return nil, err
+	}
+
+	return &summary, nil
+}
+
+// ============== Lender Statements ==============
+
+// A loan's cash flows and write-off within a lender statement period
+type LenderStatementLine struct {
+	LoanID            string       `json:"loanId"`
+	Disbursed         token.Amount `json:"disbursed"`
+	PrincipalReceived token.Amount `json:"principalReceived"`
+	InterestReceived  token.Amount `json:"interestReceived"`
+	RebatesGiven      token.Amount `json:"rebatesGiven"`
+	FeesEarned        token.Amount `json:"feesEarned"`
+	FeesPaid          token.Amount `json:"feesPaid"`
+	WrittenOff        token.Amount `json:"writtenOff"`
+}
+
+// A lender's cash flows over a period, for booking entries from the ledger.
+// Interest is counted as received, fees earned as charged to the borrower,
+// fees paid as invoiced by the platform, both before GST, and a write-off is
+// the remaining balance of a loan when it was defaulted.
+type LenderStatement struct {
+	LenderID          string                 `json:"lenderId"`
+	Period            string                 `json:"period"`
+	From              string                 `json:"from"`
+	To                string                 `json:"to"`
+	LoansDisbursed    int                    `json:"loansDisbursed"`
+	Disbursed         token.Amount           `json:"disbursed"`
+	PrincipalReceived token.Amount           `json:"principalReceived"`
+	InterestReceived  token.Amount           `json:"interestReceived"`
+	RebatesGiven      token.Amount           `json:"rebatesGiven"`
+	FeesEarned        token.Amount           `json:"feesEarned"`
+	FeesPaid          token.Amount           `json:"feesPaid"`
+	LoansWrittenOff   int                    `json:"loansWrittenOff"`
+	WrittenOff        token.Amount           `json:"writtenOff"`
+	NetCashFlow       token.Amount           `json:"netCashFlow"` // received less disbursed
+	Lines             []*LenderStatementLine `json:"lines"`       // loans with activity in the period
+	GeneratedAt       string                 `json:"generatedAt"`
+}
+
+// Summarize what a lender disbursed, received, charged and wrote off in a
+// period (YYYY-MM or YYYY-Qn). Available to the regulator and the
+// organization operating the lender's account. Loans defaulted before their
+// default date was recorded are not counted as written off.
+func (s *SmartContract) GetLenderStatement(
+	ctx contractapi.TransactionContextInterface,
+	lenderID string,
+	period string,
+) (*LenderStatement, error) {
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if mspID != regulatorMSP {
+		err = s.requireLender(ctx, lenderID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	start, end, err := parsePeriod(period)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rounding := config.Rounding
+
+	statement := LenderStatement{
+		LenderID:    lenderID,
+		Period:      period,
+		From:        start.Format(time.RFC3339),
+		To:          end.Format(time.RFC3339),
+		Lines:       []*LenderStatementLine{},
+		GeneratedAt: now.Format(time.RFC3339),
+	}
+	inPeriod := func(at time.Time, ok bool) bool {
+		return ok && !at.Before(start) && !at.After(end)
+	}
+
+	err = s.forEachIndexedLoan(ctx, lenderLoanIndex, []string{lenderID}, func(loan *Loan) error {
+		if _, disbursed := disbursementTime(loan); !disbursed {
+			return nil
+		}
+		line := LenderStatementLine{LoanID: loan.LoanID}
+		active := false
+
+		if inPeriod(disbursementTime(loan)) {
+			line.Disbursed = token.NewAmount(disbursedPrincipal(loan))
+			statement.LoansDisbursed++
+			active = true
+		}
+		if inPeriod(unixTime(loan.DefaultedAt)) {
+			line.WrittenOff = loan.DefaultedBalance
+			statement.LoansWrittenOff++
+			active = true
+		}
+
+		repayments, err := s.getRepayments(ctx, loan.LoanID)
+		if err != nil {
+			return err
+		}
+		for _, repayment := range repayments {
+			paidAt, err := time.Parse(time.RFC3339, repayment.PaidAt)
+			if !inPeriod(paidAt, err == nil) {
+				continue
+			}
+
+			receipt, err := s.GetReceipt(ctx, repayment.RepaymentID)
+			if err != nil {
+				return err
+			}
+			addAmounts(&line.PrincipalReceived, receipt.Components.Principal)
+			addAmounts(&line.InterestReceived, receipt.Components.Interest)
+			addAmounts(&line.RebatesGiven, receipt.Components.Rebate)
+			active = true
+		}
+
+		charges, err := s.getCharges(ctx, loan.LoanID)
+		if err != nil {
+			return err
+		}
+		for _, charge := range charges {
+			chargedAt, err := time.Parse(time.RFC3339, charge.ChargedAt)
+			if !inPeriod(chargedAt, err == nil) {
+				continue
+			}
+			addAmounts(&line.FeesEarned, charge.Amount)
+			active = true
+		}
+
+		invoices, err := s.getFeeInvoices(ctx, loan.LoanID)
+		if err != nil {
+			return err
+		}
+		for _, invoice := range invoices {
+			issuedAt, err := time.Parse(time.RFC3339, invoice.IssuedAt)
+			if !inPeriod(issuedAt, err == nil) {
+				continue
+			}
+			if invoice.Supplier == lenderID {
+				addAmounts(&line.FeesEarned, invoice.TaxableValue)
+			}
+			if invoice.Recipient == lenderID {
+				addAmounts(&line.FeesPaid, invoice.TaxableValue)
+			}
+			active = true
+		}
+
+		if !active {
+			return nil
+		}
+		line.Disbursed = rounding.amount(line.Disbursed.Rat())
+		line.WrittenOff = rounding.amount(line.WrittenOff.Rat())
+		line.PrincipalReceived = rounding.amount(line.PrincipalReceived.Rat())
+		line.InterestReceived = rounding.amount(line.InterestReceived.Rat())
+		line.RebatesGiven = rounding.amount(line.RebatesGiven.Rat())
+		line.FeesEarned = rounding.amount(line.FeesEarned.Rat())
+		line.FeesPaid = rounding.amount(line.FeesPaid.Rat())
+
+		addAmounts(&statement.Disbursed, line.Disbursed)
+		addAmounts(&statement.PrincipalReceived, line.PrincipalReceived)
+		addAmounts(&statement.InterestReceived, line.InterestReceived)
+		addAmounts(&statement.RebatesGiven, line.RebatesGiven)
+		addAmounts(&statement.FeesEarned, line.FeesEarned)
+		addAmounts(&statement.FeesPaid, line.FeesPaid)
+		addAmounts(&statement.WrittenOff, line.WrittenOff)
+		statement.Lines = append(statement.Lines, &line)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	statement.Disbursed = rounding.amount(statement.Disbursed.Rat())
+	statement.PrincipalReceived = rounding.amount(statement.PrincipalReceived.Rat())
+	statement.InterestReceived = rounding.amount(statement.InterestReceived.Rat())
+	statement.RebatesGiven = rounding.amount(statement.RebatesGiven.Rat())
+	statement.FeesEarned = rounding.amount(statement.FeesEarned.Rat())
+	statement.FeesPaid = rounding.amount(statement.FeesPaid.Rat())
+	statement.WrittenOff = rounding.amount(statement.WrittenOff.Rat())
+	statement.NetCashFlow = rounding.amount(ratSub(amountSum(statement.PrincipalReceived, statement.InterestReceived), statement.Disbursed.Rat()))
+
+	err = emitReportGenerated(ctx, "GetLenderStatement", map[string]string{"lenderId": lenderID, "period": period}, &statement)
+	if err != nil {
+		return nil, err
+	}
+
+	return &statement, nil
+}
+
+// ============== Interest Accrual ==============
+
+// Interest of a loan accrued and received up to the report date
+type AccruedInterestLine struct {
+	LoanID            string       `json:"loanId"`
+	AssetClass        string       `json:"assetClass"`
+	Accrued           token.Amount `json:"accrued"`
+	Received          token.Amount `json:"received"`
+	AccruedUnreceived token.Amount `json:"accruedUnreceived"`
+	ReceivedInAdvance token.Amount `json:"receivedInAdvance"` // received ahead of its accrual
+}
+
+// A lender's interest income on an accrual basis. Interest accrued but
+// unreceived on non-performing loans is not recognized as income and is
+// reported apart as SuspendedInterest.
+type AccruedInterestReport struct {
+	LenderID          string                 `json:"lenderId"`
+	AsOfDate          string                 `json:"asOfDate"`
+	Accrued           token.Amount           `json:"accrued"`
+	Received          token.Amount           `json:"received"`
+	AccruedUnreceived token.Amount           `json:"accruedUnreceived"` // performing loans only
+	ReceivedInAdvance token.Amount           `json:"receivedInAdvance"`
+	SuspendedInterest token.Amount           `json:"suspendedInterest"`
+	Lines             []*AccruedInterestLine `json:"lines"`
+	GeneratedAt       string                 `json:"generatedAt"`
+}
+
+// Report the interest accrued and received on a lender's loans open at the
+// close of asOfDate (YYYY-MM-DD), a date after the transaction date is taken
+// as the transaction date. Available to the regulator and the organization
+// operating the lender's account.
+func (s *SmartContract) GetAccruedInterestReport(
+	ctx contractapi.TransactionContextInterface,
+	lenderID string,
+	asOfDate string,
+) (*AccruedInterestReport, error) {
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if mspID != regulatorMSP {
+		err = s.requireLender(ctx, lenderID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	asOf, err := parseDate(asOfDate)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if asOf.After(now) {
+		asOf = now
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rounding := config.Rounding
+
+	report := AccruedInterestReport{
+		LenderID:    lenderID,
+		AsOfDate:    asOfDate,
+		Lines:       []*AccruedInterestLine{},
+		GeneratedAt: now.Format(time.RFC3339),
+	}
+
+	err = s.forEachIndexedLoan(ctx, lenderLoanIndex, []string{lenderID}, func(loan *Loan) error {
+		disbursedAt, disbursed := disbursementTime(loan)
+		if !disbursed || disbursedAt.After(asOf) {
+			return nil
+		}
+		if closedAt, closed := unixTime(loan.ClosedAt); closed && !closedAt.After(asOf) {
+			return nil
+		}
+
+		received, _, err := s.interestReceived(ctx, loan.LoanID, disbursedAt, asOf.Add(time.Second))
+		if err != nil {
+			return err
+		}
+		accrued := interestAccrued(loan, asOf, rounding)
+		line := AccruedInterestLine{
+			LoanID:            loan.LoanID,
+			AssetClass:        assetClassification(loan, asOf),
+			Accrued:           token.NewAmount(accrued),
+			Received:          token.NewAmount(received),
+			AccruedUnreceived: rounding.amount(ratMax(ratSub(accrued, received), new(big.Rat))),
+			ReceivedInAdvance: rounding.amount(ratMax(ratSub(received, accrued), new(big.Rat))),
+		}
+
+		addAmounts(&report.Accrued, line.Accrued)
+		addAmounts(&report.Received, line.Received)
+		addAmounts(&report.ReceivedInAdvance, line.ReceivedInAdvance)
+		if isNPA(line.AssetClass) {
+			addAmounts(&report.SuspendedInterest, line.AccruedUnreceived)
+		} else {
+			addAmounts(&report.AccruedUnreceived, line.AccruedUnreceived)
+		}
+		report.Lines = append(report.Lines, &line)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report.Accrued = rounding.amount(report.Accrued.Rat())
+	report.Received = rounding.amount(report.Received.Rat())
+	report.AccruedUnreceived = rounding.amount(report.AccruedUnreceived.Rat())
+	report.ReceivedInAdvance = rounding.amount(report.ReceivedInAdvance.Rat())
+	report.SuspendedInterest = rounding.amount(report.SuspendedInterest.Rat())
+
+	err = emitReportGenerated(ctx, "GetAccruedInterestReport", map[string]string{"lenderId": lenderID, "asOfDate": asOfDate}, &report)
+	if err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
+
+// ============== Delinquency Aging ==============
+
+type DelinquencyBucket struct {
+	Bucket  string       `json:"bucket"`
+	MinDPD  int          `json:"minDpd"`
+	MaxDPD  int          `json:"maxDpd"` // 0 for the open-ended bucket
+	Count   int          `json:"count"`
+	Amount  token.Amount `json:"amount"`
+	LoanIDs []string     `json:"loanIds"`
+}
+
+type DelinquencyReport struct {
+	LenderID string              `json:"lenderId"`
+	AsOf     string              `json:"asOf"`
+	Buckets  []DelinquencyBucket `json:"buckets"`
+}
+
+// Group a lender's overdue loans into days-past-due buckets as of a date
+// (YYYY-MM-DD), a past date as the loans stood at its close. Available to the
+// regulator and the organization operating the lender's account.
+func (s *SmartContract) GetDelinquencyBuckets(
+	ctx contractapi.TransactionContextInterface,
+	lenderID string,
+	asOfDate string,
+) (*DelinquencyReport, error) {
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if mspID != regulatorMSP {
+		err = s.requireLender(ctx, lenderID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	asOf, err := parseDate(asOfDate)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := DelinquencyReport{
+		LenderID: lenderID,
+		AsOf:     asOf.Format(time.RFC3339),
+		Buckets: []DelinquencyBucket{
+			{Bucket: "1-30", MinDPD: 1, MaxDPD: 30, Amount: zeroAmount, LoanIDs: []string{}},
+			{Bucket: "31-60", MinDPD: 31, MaxDPD: 60, Amount: zeroAmount, LoanIDs: []string{}},
+			{Bucket: "61-90", MinDPD: 61, MaxDPD: 90, Amount: zeroAmount, LoanIDs: []string{}},
+			{Bucket: "90+", MinDPD: 91, Amount: zeroAmount, LoanIDs: []string{}},
+		},
+	}
+
+	err = s.forEachIndexedLoan(ctx, lenderLoanIndex, []string{lenderID}, func(loan *Loan) error {
+		disbursedAt, ok := disbursementTime(loan)
+		if !ok || disbursedAt.After(asOf) {
+			return nil
+		}
+		if asOf.Before(now) {
+			loan, err = s.loanAsOf(ctx, loan, asOf, config.Rounding)
+			if err != nil || loan == nil {
+				return err
+			}
+		}
+
+		dpd := daysPastDue(loan, asOf)
+		if dpd == 0 {
+			return nil
+		}
+
+		for i := range report.Buckets {
+			bucket := &report.Buckets[i]
+			if dpd >= bucket.MinDPD && (bucket.MaxDPD == 0 || dpd <= bucket.MaxDPD) {
+				bucket.Count++
+				addAmounts(&bucket.Amount, loan.RemainingBalance)
+				bucket.LoanIDs = append(bucket.LoanIDs, loan.LoanID)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = emitReportGenerated(ctx, "GetDelinquencyBuckets", map[string]string{"lenderId": lenderID, "asOfDate": asOfDate}, &report)
+	if err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
+
+// ============== Report Helpers ==============
+
+// Announces a report in a ReportGenerated event with the hash of its JSON, so
+// copies rendered off-chain can be checked against the figures the chain
+// computed. The event is only committed when the report is submitted rather
+// than evaluated.
+func emitReportGenerated(
+	ctx contractapi.TransactionContextInterface,
+	report string,
+	parameters map[string]string,
+	result interface{},
+) error {
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	timestamp, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return err
+	}
+	id, err := callerID(ctx)
+	if err != nil {
+		return err
+	}
+
+	return emitEvent(ctx, eventReportGenerated, ReportGeneratedEventV1{
+		SchemaVersion: 1,
+		TxID:          ctx.GetStub().GetTxID(),
+		Timestamp:     timestamp.Format(time.RFC3339),
+		SubmitterMSP:  mspID,
+		SubmitterID:   id,
+		Report:        report,
+		Parameters:    parameters,
+		ReportHash:    hashHex(resultJSON),
+	})
+}
+
+// A loan as it stood at asOf, for reports of a past date: the version of its
+// record last saved by then, less the repayments paid by then that the version
+// had not folded in yet. Nil when the record was deleted by then.
+func (s *SmartContract) loanAsOf(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	asOf time.Time,
+	rounding RoundingPolicy,
+) (*Loan, error) {
+	iterator, err := ctx.GetStub().GetHistoryForKey(loan.LoanID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history for %s: %v", loan.LoanID, err)
+	}
+	defer iterator.Close()
+
+	// The history iterator returns the newest write first
+	var version *Loan
+	for iterator.HasNext() {
+		modification, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if time.Unix(modification.GetTimestamp().GetSeconds(), 0).After(asOf) {
+			continue
+		}
+		if modification.IsDelete {
+			return nil, nil
+		}
+
+		version = &Loan{}
+		err = json.Unmarshal(modification.Value, version)
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+	// Without a version by then, as with the history database disabled, the
+	// loan is reported as it stands
+	if version == nil {
+		version = loan
+	}
+
+	repayments, err := s.getRepayments(ctx, loan.LoanID)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(repayments, func(i, j int) bool {
+		return repayments[i].PaidAt < repayments[j].PaidAt
+	})
+	for _, repayment := range repayments {
+		paidAt, err := time.Parse(time.RFC3339, repayment.PaidAt)
+		if err != nil || paidAt.After(asOf) || foldedInto(version, repayment) {
+			continue
+		}
+
+		balance := rounding.round(ratSub(version.RemainingBalance.Rat(), amountSum(repayment.Amount, repayment.Rebate)))
+		version.RemainingBalance = token.NewAmount(ratMax(balance, new(big.Rat)))
+		if balance.Sign() <= 0 && version.Status == "ACTIVE" {
+			version.Status = "REPAID"
+			version.ClosedAt = fmt.Sprintf("%d", paidAt.Unix())
+		}
+	}
+
+	return version, nil
+}
+
+// Whether a saved loan version includes a repayment, which its audit trail
+// records when it is folded in
+func foldedInto(loan *Loan, repayment *Repayment) bool {
+	folded := fmt.Sprintf("reference %s (TxID: %s", repayment.PaymentReference, repayment.TxID)
+	for _, entry := range loan.AuditHistory {
+		if strings.Contains(entry, folded) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parses a reporting period given as a month (YYYY-MM) or a quarter (YYYY-Qn)
+// into its first and last instants
+func parsePeriod(period string) (time.Time, time.Time, error) {
+	var year, quarter int
+	if _, err := fmt.Sscanf(period, "%4d-Q%1d", &year, &quarter); err == nil && len(period) == 7 {
+		if quarter < 1 || quarter > 4 {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid quarter %s", period)
+		}
+		start := time.Date(year, time.Month(3*quarter-2), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 3, 0).Add(-time.Second), nil
+	}
+
+	start, err := time.Parse("2006-01", period)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid period %s, expected YYYY-MM or YYYY-Qn", period)
+	}
+
+	return start, start.AddDate(0, 1, 0).Add(-time.Second), nil
+}
+
+// Parses a calendar date (YYYY-MM-DD) or a full RFC3339 timestamp, a bare
+// date is taken as the end of that day
+func parseDate(date string) (time.Time, error) {
+	if parsed, err := time.Parse(time.RFC3339, date); err == nil {
+		return parsed.UTC(), nil
+	}
+
+	parsed, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %s, expected YYYY-MM-DD", date)
+	}
+
+	return parsed.AddDate(0, 0, 1).Add(-time.Second), nil
+}
+
+func disbursementTime(loan *Loan) (time.Time, bool) {
+	return unixTime(loan.DisbursementDate)
+}
+
+func approvalTime(loan *Loan) (time.Time, bool) {
+	return unixTime(loan.ApprovedAt)
+}
+
+// Parses the seconds-since-epoch strings loan timestamps are stored as
+func unixTime(seconds string) (time.Time, bool) {
+	if seconds == "" {
+		return time.Time{}, false
+	}
+
+	parsed, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(parsed, 0).UTC(), true
+}
+
+// Asset classifications, SMA buckets for overdue standard assets and NPA grades by age
+const (
+	assetStandard    = "STANDARD"
+	assetSMA0        = "SMA-0"
+	assetSMA1        = "SMA-1"
+	assetSMA2        = "SMA-2"
+	assetSubstandard = "SUBSTANDARD"
+	assetDoubtful    = "DOUBTFUL"
+	assetLoss        = "LOSS"
+)
+
+// Classifies a loan per RBI IRAC norms, a loan turns NPA after 90 days past due.
+// Restructured loans and loans under moratorium are held at their class when
+// granted, a restructured loan at SUBSTANDARD or worse, while the hold runs.
+func assetClassification(loan *Loan, asOf time.Time) string {
+	return restructuredClassification(loan, asOf, overdueClassification(loan, asOf))
+}
+
+// Classifies a loan by its days past due alone
+func overdueClassification(loan *Loan, asOf time.Time) string {
+	dpd := daysPastDue(loan, asOf)
+	if dpd <= 90 && loan.Status != "DEFAULTED" {
+		switch {
+		case dpd == 0:
+			return assetStandard
+		case dpd <= 30:
+			return assetSMA0
+		case dpd <= 60:
+			return assetSMA1
+		default:
+			return assetSMA2
+		}
+	}
+
+	daysAsNPA := dpd - 90
+	switch {
+	case daysAsNPA <= 365:
+		return assetSubstandard
+	case daysAsNPA <= 4*365:
+		return assetDoubtful
+	default:
+		return assetLoss
+	}
+}
+
+// Classifications from best to worst
+var assetClasses = []string{assetStandard, assetSMA0, assetSMA1, assetSMA2, assetSubstandard, assetDoubtful, assetLoss}
+
+// The worse of two classifications
+func worseClass(a string, b string) string {
+	for _, classification := range assetClasses {
+		if classification == a {
+			return b
+		}
+		if classification == b {
+			return a
+		}
+	}
+	return a
+}
+
+func isNPA(classification string) bool {
+	return classification == assetSubstandard || classification == assetDoubtful || classification == assetLoss
+}
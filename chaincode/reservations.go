@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// ============== Funds Reservation ==============
+
+// Reference a loan's funds are earmarked under in the lender's account
+func reservationReference(loanID string) string {
+	return "loan:" + loanID
+}
+
+// Earmarks the loan amount in the lender's account at approval, so the lender
+// cannot spend it before disbursement
+func (s *SmartContract) reserveFunds(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	lenderID string,
+) error {
+	err := s.placeEarmark(ctx, lenderID, reservationReference(loan.LoanID), loan.Amount.Rat())
+	if err != nil {
+		return err
+	}
+
+	loan.Reserved = loan.Amount
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Funds of %s reserved in account %s (TxID: %s)",
+			loan.Amount,
+			lenderID,
+			ctx.GetStub().GetTxID()))
+	return nil
+}
+
+// Returns a loan's reservation to the lender's available balance. The
+// reference is returned, empty when the loan had none, for movements of the
+// same transaction to draw on the released funds.
+func (s *SmartContract) releaseReservation(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+) (string, error) {
+	if loan.Reserved.Rat().Sign() == 0 {
+		return "", nil
+	}
+
+	reference := reservationReference(loan.LoanID)
+	err := s.releaseEarmark(ctx, loan.LenderID, reference)
+	if err != nil {
+		return "", err
+	}
+
+	loan.Reserved = ""
+	return reference, nil
+}
+
+// Draws part of a loan's reservation for a tranche of its funds, the rest
+// stays earmarked for later tranches. The reference is returned as with
+// releaseReservation.
+func (s *SmartContract) drawReservation(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	value *big.Rat,
+) (string, error) {
+	if loan.Reserved.Rat().Sign() == 0 {
+		return "", nil
+	}
+
+	reference := reservationReference(loan.LoanID)
+	remaining, err := s.drawEarmark(ctx, loan.LenderID, reference, value)
+	if err != nil {
+		return "", err
+	}
+
+	loan.Reserved = token.NewAmount(remaining)
+	return reference, nil
+}
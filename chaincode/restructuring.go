@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// A restructuring or moratorium granted on a loan, deferring its due date.
+// The loan's classification is held no better than AssetClass, or SUBSTANDARD
+// for a restructuring, until HeldUntil.
+type LoanRestructuring struct {
+	Kind         string `json:"kind"` // RESTRUCTURED, MORATORIUM
+	PriorDueDate string `json:"priorDueDate"`
+	NewDueDate   string `json:"newDueDate"`
+	AssetClass   string `json:"assetClass"` // classification when granted
+	HeldUntil    string `json:"heldUntil"`  // end of the specified period, or the deferred due date
+	Reason       string `json:"reason"`
+	GrantedAt    string `json:"grantedAt"`
+}
+
+// Restructuring kinds
+const (
+	restructuringRestructured = "RESTRUCTURED"
+	restructuringMoratorium   = "MORATORIUM"
+)
+
+// Months a restructured loan must perform before it can be upgraded
+const restructuringSpecifiedMonths = 12
+
+// ============== Restructuring ==============
+
+// Restructure an ACTIVE loan by rescheduling its due date to newDueDate,
+// called by the organization operating the lender's account. The loan is
+// classified SUBSTANDARD or worse for the specified period that follows.
+func (s *SmartContract) RestructureLoan(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	newDueDate string,
+	reason string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "RestructureLoan")
+	if err != nil {
+		return nil, err
+	}
+
+	dueDate, err := parseDate(newDueDate)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.restructure(ctx, loanID, restructuringRestructured, reason, func(priorDueDate time.Time) (time.Time, time.Time, error) {
+		if !dueDate.After(priorDueDate) {
+			return time.Time{}, time.Time{}, fmt.Errorf("new due date %s must be after the current due date", newDueDate)
+		}
+		return dueDate, now.AddDate(0, restructuringSpecifiedMonths, 0), nil
+	})
+}
+
+// Defer an ACTIVE loan's due date by a moratorium of the given months, called
+// by the organization operating the lender's account. The loan's
+// classification stands still until the deferred due date.
+func (s *SmartContract) GrantMoratorium(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	months int,
+	reason string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "GrantMoratorium")
+	if err != nil {
+		return nil, err
+	}
+
+	return s.restructure(ctx, loanID, restructuringMoratorium, reason, func(priorDueDate time.Time) (time.Time, time.Time, error) {
+		dueDate := priorDueDate.AddDate(0, months, 0)
+		return dueDate, dueDate, nil
+	})
+}
+
+// Records a restructuring of the loan, reschedule returning its new due date
+// and the end of its classification hold given the current one
+func (s *SmartContract) restructure(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	kind string,
+	reason string,
+	reschedule func(priorDueDate time.Time) (time.Time, time.Time, error),
+) (*LoanResult, error) {
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	err = s.requireLender(ctx, loan.LenderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Status != "ACTIVE" {
+		return nil, fmt.Errorf("loan %s cannot be restructured in current status: %s", loanID, loan.Status)
+	}
+	if reason == "" {
+		return nil, fmt.Errorf("restructuring reason is required")
+	}
+
+	priorDueDate, err := time.Parse(time.RFC3339, loan.DueDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid due date %s of loan %s: %v", loan.DueDate, loanID, err)
+	}
+	dueDate, heldUntil, err := reschedule(priorDueDate)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	restructuring := &LoanRestructuring{
+		Kind:         kind,
+		PriorDueDate: loan.DueDate,
+		NewDueDate:   dueDate.Format(time.RFC3339),
+		AssetClass:   assetClassification(loan, now),
+		HeldUntil:    heldUntil.Format(time.RFC3339),
+		Reason:       reason,
+		GrantedAt:    now.Format(time.RFC3339),
+	}
+	loan.Restructurings = append(loan.Restructurings, restructuring)
+	loan.DueDate = restructuring.NewDueDate
+	description := "Loan restructured"
+	if kind == restructuringMoratorium {
+		description = "Moratorium granted"
+	}
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("%s, due date moved from %s to %s: %s (TxID: %s)",
+			description,
+			restructuring.PriorDueDate,
+			restructuring.NewDueDate,
+			reason,
+			ctx.GetStub().GetTxID()))
+
+	err = s.putLoan(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+
+	return newLoanResult(ctx, loan), nil
+}
+
+// Whether the loan had been restructured by asOf, bureaus keep the flag for
+// the life of the account
+func isRestructured(loan *Loan, asOf time.Time) bool {
+	for _, restructuring := range loan.Restructurings {
+		grantedAt, err := time.Parse(time.RFC3339, restructuring.GrantedAt)
+		if err == nil && restructuring.Kind == restructuringRestructured && !grantedAt.After(asOf) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether a moratorium of the loan was running at asOf
+func underMoratorium(loan *Loan, asOf time.Time) bool {
+	for _, restructuring := range loan.Restructurings {
+		if restructuring.Kind == restructuringMoratorium && holding(restructuring, asOf) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether the restructuring held the loan's classification at asOf
+func holding(restructuring *LoanRestructuring, asOf time.Time) bool {
+	grantedAt, err := time.Parse(time.RFC3339, restructuring.GrantedAt)
+	if err != nil {
+		return false
+	}
+	heldUntil, err := time.Parse(time.RFC3339, restructuring.HeldUntil)
+	if err != nil {
+		return false
+	}
+	return !grantedAt.After(asOf) && asOf.Before(heldUntil)
+}
+
+// Holds the classification of a restructured loan no better than its class
+// when restructured, and no better than SUBSTANDARD over the specified period
+func restructuredClassification(loan *Loan, asOf time.Time, classification string) string {
+	for _, restructuring := range loan.Restructurings {
+		if !holding(restructuring, asOf) {
+			continue
+		}
+		classification = worseClass(classification, restructuring.AssetClass)
+		if restructuring.Kind == restructuringRestructured {
+			classification = worseClass(classification, assetSubstandard)
+		}
+	}
+	return classification
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// What a loan transaction left the loan as, returned so one submit gives the
+// caller the new status and balances, the IDs the transaction generated and
+// the payload of the event it emitted without querying the loan again
+type LoanResult struct {
+	LoanID           string                `json:"loanId"`
+	TxID             string                `json:"txId"`
+	Status           string                `json:"status"`
+	RepaymentDue     token.Amount          `json:"repaymentDue"`
+	RemainingBalance token.Amount          `json:"remainingBalance"` // including repayments of the transaction
+	DueDate          string                `json:"dueDate,omitempty" metadata:",optional"`
+	ReceiptID        string                `json:"receiptId,omitempty" metadata:",optional"` // repayments
+	TrancheID        string                `json:"trancheId,omitempty" metadata:",optional"` // tranche disbursements
+	Schedule         []ScheduleInstallment `json:"schedule,omitempty" metadata:",optional"`  // disbursements
+	EventName        string                `json:"eventName,omitempty" metadata:",optional"`
+	Event            interface{}           `json:"event,omitempty" metadata:",optional"`
+}
+
+// Result of a transaction that saved loan
+func newLoanResult(ctx contractapi.TransactionContextInterface, loan *Loan) *LoanResult {
+	return &LoanResult{
+		LoanID:           loan.LoanID,
+		TxID:             ctx.GetStub().GetTxID(),
+		Status:           loan.Status,
+		RepaymentDue:     loan.RepaymentDue,
+		RemainingBalance: loan.RemainingBalance,
+		DueDate:          loan.DueDate,
+	}
+}
+
+// Saves a loan the transaction changed and returns its result
+func (s *SmartContract) putLoanResult(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+) (*LoanResult, error) {
+	err := s.putLoan(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+	return newLoanResult(ctx, loan), nil
+}
+
+// Emits the transaction's event and returns the result carrying it
+func (result *LoanResult) emit(
+	ctx contractapi.TransactionContextInterface,
+	name string,
+	payload interface{},
+) (*LoanResult, error) {
+	err := emitEvent(ctx, name, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	result.EventName = name
+	result.Event = payload
+	return result, nil
+}
+
+// Adds the repayment schedule of a loan disbursed in the transaction
+func (s *SmartContract) withSchedule(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	result *LoanResult,
+) (*LoanResult, error) {
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	start, _ := disbursementTime(loan)
+
+	result.Schedule = repaymentSchedule(loan, start, config.Rounding)
+	return result, nil
+}
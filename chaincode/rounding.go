@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+
+	"lending/token"
+)
+
+// Rounding modes of monetary amounts
+const (
+	roundHalfEven = "HALF_EVEN"
+	roundHalfUp   = "HALF_UP"
+	roundDown     = "DOWN" // towards zero
+	roundUp       = "UP"   // away from zero
+)
+
+// How computed amounts are rounded, Places is the number of decimals kept,
+// 2 for paise and at most token.AmountScale
+type RoundingPolicy struct {
+	Mode   string `json:"mode"`
+	Places int    `json:"places"`
+}
+
+func (p RoundingPolicy) validate() error {
+	switch p.Mode {
+	case roundHalfEven, roundHalfUp, roundDown, roundUp:
+	default:
+		return fmt.Errorf("unknown rounding mode %s", p.Mode)
+	}
+	if p.Places < 0 || p.Places > token.AmountScale {
+		return fmt.Errorf("rounding places must be between 0 and %d", token.AmountScale)
+	}
+	return nil
+}
+
+// Rounds amount to the policy's decimal places. Every computed amount goes
+// through here so components and their totals reconcile.
+func (p RoundingPolicy) round(amount *big.Rat) *big.Rat {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(p.Places)), nil)
+	scaled := new(big.Rat).Mul(amount, new(big.Rat).SetInt(scale))
+
+	// Whole units towards zero, and the magnitude of what is left over
+	quotient, remainder := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+	if remainder.Sign() != 0 {
+		away := false
+		switch p.Mode {
+		case roundDown:
+		case roundUp:
+			away = true
+		default:
+			// Compare twice the remainder with the denominator for the tie
+			half := new(big.Int).Abs(remainder)
+			half.Lsh(half, 1)
+			switch half.Cmp(scaled.Denom()) {
+			case 1:
+				away = true
+			case 0:
+				away = p.Mode == roundHalfUp || quotient.Bit(0) == 1
+			}
+		}
+		if away {
+			quotient.Add(quotient, big.NewInt(int64(scaled.Sign())))
+		}
+	}
+
+	return new(big.Rat).SetFrac(quotient, scale)
+}
+
+// Rounds amount to the policy's decimal places as a token amount
+func (p RoundingPolicy) amount(amount *big.Rat) token.Amount {
+	return token.NewAmount(p.round(amount))
+}
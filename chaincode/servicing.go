@@ -0,0 +1,369 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// A mandate collection attempted by ProcessDay, or a debit of the loan's cash
+// margin
+type MandateCollection struct {
+	LoanID           string       `json:"loanId"`
+	Amount           token.Amount `json:"amount"`
+	PaymentReference string       `json:"paymentReference"`
+	RepaymentID      string       `json:"repaymentId,omitempty" metadata:",optional"` // also the receipt ID, empty when bounced
+	Status           string       `json:"status"`                                     // COLLECTED, BOUNCED
+}
+
+// Loans serviced by a ProcessDay call, call again with Bookmark until it is empty
+type DayProcessingPage struct {
+	AsOfDate     string               `json:"asOfDate"`
+	Scanned      int                  `json:"scanned"`
+	Processed    int                  `json:"processed"` // ACTIVE loans not yet processed for the day
+	Overdue      int                  `json:"overdue"`
+	PenalCharged token.Amount         `json:"penalCharged"`
+	Collections  []*MandateCollection `json:"collections"`
+	Bookmark     string               `json:"bookmark"`
+}
+
+// Loans added to the index of ACTIVE loans by an IndexActiveLoans call
+type ActiveIndexPage struct {
+	Scanned  int    `json:"scanned"`  // disbursed loans looked at in this batch
+	Indexed  int    `json:"indexed"`  // ACTIVE loans added to the index
+	Bookmark string `json:"bookmark"` // empty when done
+}
+
+const (
+	collectionCollected = "COLLECTED"
+	collectionBounced   = "BOUNCED"
+)
+
+// ============== Daily Servicing ==============
+
+// Run the end of day servicing of asOfDate (YYYY-MM-DD) over pageSize ACTIVE
+// loans at a time in loan ID order, keeper only. For every ACTIVE loan it records the interest
+// accrued and the days past due and asset classification at the close of the
+// day, charges penal interest at the configured rate on an overdue balance for
+// the days since it was last charged, and once the loan has fallen due
+// collects its repayment under a registered mandate. A loan is processed once
+// per day, so a page can be rerun and days run in order. Fabric keeps a single
+// event per transaction, the page is emitted as a DayProcessed event in place
+// of the LoanRepaid events of its collections.
+func (s *SmartContract) ProcessDay(
+	ctx contractapi.TransactionContextInterface,
+	asOfDate string,
+	pageSize int,
+	bookmark string,
+) (*DayProcessingPage, error) {
+	err := claimRequestID(ctx, "ProcessDay")
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keeperMSP, err := requireKeeper(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	keeperID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive")
+	}
+
+	day, err := time.Parse("2006-01-02", asOfDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %s, expected YYYY-MM-DD", asOfDate)
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if day.After(now) {
+		return nil, fmt.Errorf("cannot process %s before the day has started", asOfDate)
+	}
+
+	// The peer refuses writes after a paginated query, so the index of ACTIVE
+	// loans is walked from the start, skipping the loans up to the bookmark
+	// by key
+	after := ""
+	if bookmark != "" {
+		after, err = ctx.GetStub().CreateCompositeKey(activeLoanIndex, []string{bookmark})
+		if err != nil {
+			return nil, fmt.Errorf("invalid bookmark %s", bookmark)
+		}
+	}
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(activeLoanIndex, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	page := DayProcessingPage{
+		AsOfDate:    asOfDate,
+		Collections: []*MandateCollection{},
+	}
+	// Debits are checked against the balance at the start of the transaction,
+	// which a collection's own debit does not reduce, so a second collection
+	// from a borrower ends the page and the next page makes it
+	collectedFrom := map[string]bool{}
+	done := true
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if entry.Key <= after {
+			continue
+		}
+		if page.Scanned == pageSize {
+			done = false
+			break
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+		if err != nil {
+			return nil, err
+		}
+		loan, err := s.getLoan(ctx, keyParts[0])
+		if err != nil {
+			return nil, err
+		}
+		if collectedFrom[loan.BorrowerID] && (loan.Mandate != nil || loan.Margin.Rat().Sign() > 0) {
+			done = false
+			break
+		}
+
+		// Repayments folded in on read may have closed the loan
+		if loan.Status != "ACTIVE" {
+			err = s.deleteIndex(ctx, activeLoanIndex, loan.LoanID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		collection, err := s.serviceLoan(ctx, loan, asOfDate, config, &page)
+		if err != nil {
+			return nil, err
+		}
+		if collection != nil {
+			page.Collections = append(page.Collections, collection)
+			if collection.Status == collectionCollected {
+				collectedFrom[loan.BorrowerID] = true
+			}
+		}
+		page.Scanned++
+		page.Bookmark = loan.LoanID
+	}
+	if done {
+		page.Bookmark = ""
+	}
+	page.PenalCharged = config.Rounding.amount(page.PenalCharged.Rat())
+
+	return &page, emitEvent(ctx, eventDayProcessed, DayProcessedEventV2{
+		SchemaVersion: 2,
+		TxID:          ctx.GetStub().GetTxID(),
+		Timestamp:     now.Format(time.RFC3339),
+		SubmitterMSP:  keeperMSP,
+		SubmitterID:   keeperID,
+		AsOfDate:      asOfDate,
+		Processed:     page.Processed,
+		Overdue:       page.Overdue,
+		PenalCharged:  page.PenalCharged,
+		Collections:   page.Collections,
+	})
+}
+
+// Add the ACTIVE loans disbursed before the index of ACTIVE loans existed to
+// it, batchSize disbursed loans at a time, keeper only. Loans already indexed
+// are left untouched, so a batch can be rerun.
+func (s *SmartContract) IndexActiveLoans(
+	ctx contractapi.TransactionContextInterface,
+	batchSize int,
+	bookmark string,
+) (*ActiveIndexPage, error) {
+	err := claimRequestID(ctx, "IndexActiveLoans")
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, err = requireKeeper(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	loans, next, err := s.getIndexedLoanBatch(ctx, disbursedLoanIndex, []string{}, batchSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	page := ActiveIndexPage{Scanned: len(loans), Bookmark: next}
+	for _, loan := range loans {
+		if loan.Status != "ACTIVE" {
+			continue
+		}
+		indexKey, err := ctx.GetStub().CreateCompositeKey(activeLoanIndex, []string{loan.LoanID})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create index key: %v", err)
+		}
+		indexed, err := ctx.GetStub().GetState(indexKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read from world state: %v", err)
+		}
+		if indexed != nil {
+			continue
+		}
+
+		err = s.putIndex(ctx, activeLoanIndex, loan.LoanID)
+		if err != nil {
+			return nil, err
+		}
+		page.Indexed++
+	}
+
+	return &page, nil
+}
+
+// Services an ACTIVE loan for the day, returning the margin debit or mandate
+// collection it attempted if any
+func (s *SmartContract) serviceLoan(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	asOfDate string,
+	config *LendingConfig,
+	page *DayProcessingPage,
+) (*MandateCollection, error) {
+	if loan.Status != "ACTIVE" || loan.ProcessedThrough >= asOfDate {
+		return nil, nil
+	}
+	page.Processed++
+
+	// Positions are taken at the close of the day
+	asOf, err := parseDate(asOfDate)
+	if err != nil {
+		return nil, err
+	}
+	dueDate, err := time.Parse(time.RFC3339, loan.DueDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid due date %s of loan %s: %v", loan.DueDate, loan.LoanID, err)
+	}
+	rounding := config.Rounding
+
+	daysPast := daysPastDue(loan, asOf)
+	if daysPast > 0 {
+		page.Overdue++
+
+		// Penal interest runs from the later of the due date and the last day processed
+		chargedFrom := dueDate.UTC().Format("2006-01-02")
+		if loan.ProcessedThrough > chargedFrom {
+			chargedFrom = loan.ProcessedThrough
+		}
+		from, _ := time.Parse("2006-01-02", chargedFrom)
+		to, _ := time.Parse("2006-01-02", asOfDate)
+		days := int(to.Sub(from).Hours() / 24)
+
+		penalty := rounding.round(ratMul(percentOf(loan.RemainingBalance.Rat(), config.PenalRate.Rat()), big.NewRat(int64(days), 365)))
+		if penalty.Sign() > 0 {
+			description := fmt.Sprintf("Penal interest of %s for %d days overdue to %s", token.FormatAmount(penalty), days, asOfDate)
+			err = s.recordCharge(ctx, loan, chargePenal, token.NewAmount(penalty), description)
+			if err != nil {
+				return nil, err
+			}
+
+			loan.PenalCharges = rounding.amount(ratAdd(loan.PenalCharges.Rat(), penalty))
+			loan.RepaymentDue = rounding.amount(ratAdd(loan.RepaymentDue.Rat(), penalty))
+			loan.RemainingBalance = rounding.amount(ratAdd(loan.RemainingBalance.Rat(), penalty))
+			loan.AuditHistory = append(loan.AuditHistory,
+				fmt.Sprintf("%s (TxID: %s)",
+					description,
+					ctx.GetStub().GetTxID()))
+			page.PenalCharged = token.NewAmount(ratAdd(page.PenalCharged.Rat(), penalty))
+		}
+	}
+
+	previousClass := loan.AssetClass
+	if previousClass == "" {
+		previousClass = assetStandard
+	}
+	loan.AssetClass = assetClassification(loan, asOf)
+	if loan.AssetClass != previousClass {
+		loan.AuditHistory = append(loan.AuditHistory,
+			fmt.Sprintf("Classified %s as of %s (TxID: %s)",
+				loan.AssetClass,
+				asOfDate,
+				ctx.GetStub().GetTxID()))
+	}
+	loan.DaysPastDue = daysPast
+	loan.AccruedInterest = token.NewAmount(interestAccrued(loan, asOf, rounding))
+	loan.ProcessedThrough = asOfDate
+
+	// An overdue loan is paid from its cash margin before any mandate. Either
+	// is checked with the token ledger first and bounces if it would be
+	// refused, a refused movement would fail the whole page as the writes
+	// before it cannot be undone.
+	var collection *MandateCollection
+	var reserved string
+	if daysPast > 0 {
+		collection, err = s.drawMargin(ctx, loan, asOfDate)
+		if err != nil {
+			return nil, err
+		}
+		if collection != nil && collection.Status == collectionCollected {
+			reserved = marginReference(loan.LoanID)
+		}
+	}
+	if collection == nil && loan.Mandate != nil && !asOf.Before(dueDate) && loan.RemainingBalance.Rat().Sign() > 0 {
+		collection = &MandateCollection{
+			LoanID:           loan.LoanID,
+			Amount:           token.NewAmount(ratMin(loan.RemainingBalance.Rat(), loan.Mandate.MaxAmount.Rat())),
+			PaymentReference: fmt.Sprintf("NACH-%s-%s", loan.Mandate.UMRN, asOfDate),
+			Status:           collectionCollected,
+		}
+
+		// Earmarks, holds, debit limits and screening apply as to any debit
+		refusal, err := s.debitRefusal(ctx, loan.BorrowerID, collection.Amount.Rat(), "")
+		if err != nil {
+			return nil, err
+		}
+		if refusal != "" {
+			collection.Status = collectionBounced
+			loan.AuditHistory = append(loan.AuditHistory,
+				fmt.Sprintf("Mandate collection of %s bounced, %s (TxID: %s)",
+					collection.Amount,
+					refusal,
+					ctx.GetStub().GetTxID()))
+		}
+	}
+
+	err = s.putLoan(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+	if collection == nil || collection.Status != collectionCollected {
+		return collection, nil
+	}
+
+	collection.RepaymentID, err = nextRecordID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.repayFrom(ctx, loan, loan.BorrowerID, collection.Amount.Rat(), new(big.Rat), collection.PaymentReference, collection.RepaymentID, reserved)
+	if err != nil {
+		return nil, err
+	}
+
+	return collection, nil
+}
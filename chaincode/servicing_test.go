@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"lending/internal/mockstub"
+)
+
+// ProcessDay pages through the disbursed loans, servicing each ACTIVE loan
+// once a day and collecting under mandates once they fall due
+func TestProcessDay(t *testing.T) {
+	tests := []struct {
+		name            string
+		caller          mockstub.Identity
+		loans           int
+		balance         string // of the borrower before disbursement
+		mandate         string // registered on every loan if set
+		asOfDate        string
+		pageSize        int
+		wantErr         string
+		wantPages       int
+		wantProcessed   int
+		wantOverdue     int
+		wantCollections []string
+	}{
+		{
+			name:     "keeper only",
+			caller:   hdfc,
+			loans:    1,
+			asOfDate: "2026-06-01",
+			pageSize: 10,
+			wantErr:  "not authorized to run scheduled jobs",
+		},
+		{
+			name:     "day not started",
+			caller:   regulator,
+			loans:    1,
+			asOfDate: "2027-03-01",
+			pageSize: 10,
+			wantErr:  "before the day has started",
+		},
+		{
+			name:     "page size",
+			caller:   regulator,
+			loans:    1,
+			asOfDate: "2026-06-01",
+			pageSize: 0,
+			wantErr:  "page size must be positive",
+		},
+		{
+			name:          "before due",
+			caller:        regulator,
+			loans:         1,
+			asOfDate:      "2026-06-01",
+			pageSize:      10,
+			wantPages:     1,
+			wantProcessed: 1,
+		},
+		{
+			name:          "overdue",
+			caller:        regulator,
+			loans:         1,
+			asOfDate:      "2027-01-15",
+			pageSize:      10,
+			wantPages:     1,
+			wantProcessed: 1,
+			wantOverdue:   1,
+		},
+		{
+			name:          "pages of two",
+			caller:        regulator,
+			loans:         3,
+			asOfDate:      "2026-06-01",
+			pageSize:      2,
+			wantPages:     2,
+			wantProcessed: 3,
+		},
+		{
+			name:          "page per loan",
+			caller:        regulator,
+			loans:         3,
+			asOfDate:      "2027-01-15",
+			pageSize:      1,
+			wantPages:     3,
+			wantProcessed: 3,
+			wantOverdue:   3,
+		},
+		{
+			name:            "mandate collected",
+			caller:          regulator,
+			loans:           1,
+			balance:         "500",
+			mandate:         "5000",
+			asOfDate:        "2027-01-01",
+			pageSize:        10,
+			wantPages:       1,
+			wantProcessed:   1,
+			wantCollections: []string{collectionCollected},
+		},
+		{
+			name:            "mandate bounced",
+			caller:          regulator,
+			loans:           1,
+			balance:         "1",
+			mandate:         "5000",
+			asOfDate:        "2027-01-01",
+			pageSize:        10,
+			wantPages:       1,
+			wantProcessed:   1,
+			wantCollections: []string{collectionBounced},
+		},
+		{
+			name:            "mandate not yet due",
+			caller:          regulator,
+			loans:           1,
+			balance:         "500",
+			mandate:         "5000",
+			asOfDate:        "2026-12-31",
+			pageSize:        10,
+			wantPages:       1,
+			wantProcessed:   1,
+			wantCollections: []string{},
+		},
+		{
+			name:            "one collection per borrower a page",
+			caller:          regulator,
+			loans:           2,
+			balance:         "2000",
+			mandate:         "5000",
+			asOfDate:        "2027-01-01",
+			pageSize:        10,
+			wantPages:       2,
+			wantProcessed:   2,
+			wantCollections: []string{collectionCollected, collectionCollected},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLedger(t)
+			balance := tt.balance
+			if balance == "" {
+				balance = "1"
+			}
+			l.borrower("B1", balance)
+			for i := 1; i <= tt.loans; i++ {
+				loanID := fmt.Sprintf("L%d", i)
+				l.disbursedLoan(loanID, "B1", "1000")
+				if tt.mandate != "" {
+					l.must(hdfc, func(ctx *TransactionContext) error {
+						_, err := l.contract.RegisterMandate(ctx, loanID, "UMRN"+loanID, tt.mandate)
+						return err
+					})
+				}
+			}
+			l.stub.Now = time.Date(2027, 2, 1, 0, 0, 0, 0, time.UTC)
+
+			processDay := func(bookmark string) (*DayProcessingPage, error) {
+				var page *DayProcessingPage
+				err := l.submit(tt.caller, func(ctx *TransactionContext) error {
+					var err error
+					page, err = l.contract.ProcessDay(ctx, tt.asOfDate, tt.pageSize, bookmark)
+					return err
+				})
+				return page, err
+			}
+
+			pages, processed, overdue := 0, 0, 0
+			collections := []string{}
+			bookmark := ""
+			for {
+				page, err := processDay(bookmark)
+				if tt.wantErr != "" {
+					if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+						t.Fatalf("error = %v, want %q", err, tt.wantErr)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				pages++
+				processed += page.Processed
+				overdue += page.Overdue
+				for _, collection := range page.Collections {
+					collections = append(collections, collection.Status)
+				}
+				bookmark = page.Bookmark
+				if bookmark == "" || pages > tt.loans {
+					break
+				}
+			}
+
+			if pages != tt.wantPages {
+				t.Errorf("pages = %d, want %d", pages, tt.wantPages)
+			}
+			if processed != tt.wantProcessed {
+				t.Errorf("processed = %d, want %d", processed, tt.wantProcessed)
+			}
+			if overdue != tt.wantOverdue {
+				t.Errorf("overdue = %d, want %d", overdue, tt.wantOverdue)
+			}
+			if tt.wantCollections == nil {
+				tt.wantCollections = []string{}
+			}
+			if strings.Join(collections, ",") != strings.Join(tt.wantCollections, ",") {
+				t.Errorf("collections = %v, want %v", collections, tt.wantCollections)
+			}
+
+			// A loan is processed once a day, rerunning the day services nothing
+			page, err := processDay("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page.Processed != 0 {
+				t.Errorf("rerun processed = %d, want 0", page.Processed)
+			}
+		})
+	}
+}
+
+// ProcessDay walks only the loans still ACTIVE, a closed loan leaves the
+// index on the next run, and IndexActiveLoans adds loans disbursed before the
+// index existed
+func TestProcessDayActiveLoans(t *testing.T) {
+	l := newTestLedger(t)
+	l.borrower("B1", "2000")
+	for _, loanID := range []string{"L1", "L2", "L3"} {
+		l.disbursedLoan(loanID, "B1", "1000")
+	}
+	l.must(hdfc, func(ctx *TransactionContext) error {
+		_, err := l.contract.RepayLoan(ctx, "L2", "1120", "UTR1")
+		return err
+	})
+	l.stub.Now = time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	processDay := func(asOfDate string) *DayProcessingPage {
+		t.Helper()
+		var page *DayProcessingPage
+		l.must(regulator, func(ctx *TransactionContext) error {
+			var err error
+			page, err = l.contract.ProcessDay(ctx, asOfDate, 10, "")
+			return err
+		})
+		return page
+	}
+
+	// The repayment is folded in on read, closing L2
+	page := processDay("2026-06-01")
+	if page.Scanned != 3 || page.Processed != 2 {
+		t.Errorf("first day scanned %d and processed %d, want 3 and 2", page.Scanned, page.Processed)
+	}
+	page = processDay("2026-06-02")
+	if page.Scanned != 2 || page.Processed != 2 {
+		t.Errorf("second day scanned %d and processed %d, want 2 and 2", page.Scanned, page.Processed)
+	}
+
+	// L1 disbursed before the index existed
+	l.must(regulator, func(ctx *TransactionContext) error {
+		return l.contract.deleteIndex(ctx, activeLoanIndex, "L1")
+	})
+	page = processDay("2026-06-03")
+	if page.Scanned != 1 {
+		t.Errorf("scanned %d without L1, want 1", page.Scanned)
+	}
+
+	indexed := 0
+	batches := 0
+	bookmark := ""
+	for {
+		var batch *ActiveIndexPage
+		l.must(regulator, func(ctx *TransactionContext) error {
+			var err error
+			batch, err = l.contract.IndexActiveLoans(ctx, 2, bookmark)
+			return err
+		})
+		batches++
+		indexed += batch.Indexed
+		if batch.Bookmark == "" || batches > 3 {
+			break
+		}
+		bookmark = batch.Bookmark
+	}
+	if batches != 2 || indexed != 1 {
+		t.Errorf("indexed %d loans in %d batches, want 1 in 2", indexed, batches)
+	}
+	page = processDay("2026-06-04")
+	if page.Scanned != 2 || page.Processed != 2 {
+		t.Errorf("after indexing scanned %d and processed %d, want 2 and 2", page.Scanned, page.Processed)
+	}
+}
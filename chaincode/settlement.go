@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// ============== Token Settlement ==============
+
+// Moves tokens for a loan, through the token chaincode when one is configured
+// or the embedded token ledger otherwise. A transaction carries a single event
+// and events of called chaincodes are dropped, so the movement is returned for
+// the loan event to carry. Movements for a loan are journaled for
+// reconciliation.
+func (s *SmartContract) settle(
+	ctx contractapi.TransactionContextInterface,
+	from string,
+	to string,
+	value *big.Rat,
+	reason string,
+	loanID string,
+) (*token.TokenEventV1, error) {
+	return s.settleFrom(ctx, from, to, value, reason, loanID, "")
+}
+
+// Settles a movement drawing on the sender's reservation for the loan, if
+// reserved is set
+func (s *SmartContract) settleFrom(
+	ctx contractapi.TransactionContextInterface,
+	from string,
+	to string,
+	value *big.Rat,
+	reason string,
+	loanID string,
+	reserved string,
+) (*token.TokenEventV1, error) {
+	tokenChaincode, err := s.tokenChaincode(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if loanID != "" {
+		err = journalMovement(ctx, loanID, from, to, value, reason)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if tokenChaincode == "" {
+		if reserved != "" {
+			return token.Transfer(ctx, from, to, value, reason, loanID, reserved)
+		}
+		return token.Transfer(ctx, from, to, value, reason, loanID)
+	}
+
+	_, err = s.invokeToken(ctx, tokenChaincode, "TransferTokensWithReason",
+		from, to, token.FormatAmount(value), reason, loanID, reserved)
+	if err != nil {
+		return nil, err
+	}
+
+	return token.NewTokenEvent(ctx, "TRANSFER", from, to, value, reason, loanID)
+}
+
+func (s *SmartContract) balanceOf(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+) (*big.Rat, error) {
+	tokenChaincode, err := s.tokenChaincode(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if tokenChaincode == "" {
+		return token.BalanceOf(ctx, account)
+	}
+
+	payload, err := s.invokeToken(ctx, tokenChaincode, "GetBalance", account)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseTokenAmount(tokenChaincode, payload)
+}
+
+// Why the token ledger would refuse a debit of value from an account, empty
+// when it would not. A debit drawing on the account's reservation for a loan
+// names it in reserved.
+func (s *SmartContract) debitRefusal(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+	value *big.Rat,
+	reserved string,
+) (string, error) {
+	tokenChaincode, err := s.tokenChaincode(ctx)
+	if err != nil {
+		return "", err
+	}
+	if tokenChaincode != "" {
+		payload, err := s.invokeToken(ctx, tokenChaincode, "GetDebitRefusal", account, token.FormatAmount(value), reserved)
+		if err != nil {
+			return "", err
+		}
+		return string(payload), nil
+	}
+
+	var consumed []string
+	if reserved != "" {
+		consumed = append(consumed, reserved)
+	}
+	err = token.CheckDebit(ctx, account, value, consumed...)
+	if err != nil {
+		return err.Error(), nil
+	}
+	return "", nil
+}
+
+// Earmarks value of an account's available balance for a reference, in the
+// token chaincode when one is configured
+func (s *SmartContract) placeEarmark(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+	reference string,
+	value *big.Rat,
+) error {
+	tokenChaincode, err := s.tokenChaincode(ctx)
+	if err != nil {
+		return err
+	}
+	if tokenChaincode == "" {
+		return token.PlaceEarmark(ctx, account, reference, value)
+	}
+
+	_, err = s.invokeToken(ctx, tokenChaincode, "PlaceEarmark", account, reference, token.FormatAmount(value))
+	return err
+}
+
+// Adds to an account's earmark for a reference, returning the earmarked total
+func (s *SmartContract) increaseEarmark(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+	reference string,
+	value *big.Rat,
+) (*big.Rat, error) {
+	tokenChaincode, err := s.tokenChaincode(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if tokenChaincode == "" {
+		return token.IncreaseEarmark(ctx, account, reference, value)
+	}
+
+	payload, err := s.invokeToken(ctx, tokenChaincode, "IncreaseEarmark", account, reference, token.FormatAmount(value))
+	if err != nil {
+		return nil, err
+	}
+	return parseTokenAmount(tokenChaincode, payload)
+}
+
+// Spends part of an account's earmark for a reference, returning what is left
+func (s *SmartContract) drawEarmark(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+	reference string,
+	value *big.Rat,
+) (*big.Rat, error) {
+	tokenChaincode, err := s.tokenChaincode(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if tokenChaincode == "" {
+		return token.DrawEarmark(ctx, account, reference, value)
+	}
+
+	payload, err := s.invokeToken(ctx, tokenChaincode, "DrawEarmark", account, reference, token.FormatAmount(value))
+	if err != nil {
+		return nil, err
+	}
+	return parseTokenAmount(tokenChaincode, payload)
+}
+
+// Returns an account's earmark for a reference to its available balance
+func (s *SmartContract) releaseEarmark(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+	reference string,
+) error {
+	tokenChaincode, err := s.tokenChaincode(ctx)
+	if err != nil {
+		return err
+	}
+	if tokenChaincode == "" {
+		return token.ReleaseEarmark(ctx, account, reference)
+	}
+
+	_, err = s.invokeToken(ctx, tokenChaincode, "ReleaseEarmark", account, reference)
+	return err
+}
+
+func parseTokenAmount(tokenChaincode string, payload []byte) (*big.Rat, error) {
+	value, err := token.ParseAmount(string(payload))
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount returned by %s: %v", tokenChaincode, err)
+	}
+	return value, nil
+}
+
+// Registry entry of a token account, from the token chaincode when one is configured
+func (s *SmartContract) accountOf(
+	ctx contractapi.TransactionContextInterface,
+	accountID string,
+) (*token.Account, error) {
+	tokenChaincode, err := s.tokenChaincode(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if tokenChaincode == "" {
+		return s.GetAccountInfo(ctx, accountID)
+	}
+
+	payload, err := s.invokeToken(ctx, tokenChaincode, "GetAccountInfo", accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	var account token.Account
+	err = json.Unmarshal(payload, &account)
+	if err != nil {
+		return nil, fmt.Errorf("invalid account returned by %s: %v", tokenChaincode, err)
+	}
+
+	return &account, nil
+}
+
+func (s *SmartContract) tokenChaincode(ctx contractapi.TransactionContextInterface) (string, error) {
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+	return config.TokenChaincode, nil
+}
+
+// Calls a token chaincode function on the current channel
+func (s *SmartContract) invokeToken(
+	ctx contractapi.TransactionContextInterface,
+	tokenChaincode string,
+	function string,
+	args ...string,
+) ([]byte, error) {
+	invokeArgs := [][]byte{[]byte(function)}
+	for _, arg := range args {
+		invokeArgs = append(invokeArgs, []byte(arg))
+	}
+
+	response := ctx.GetStub().InvokeChaincode(tokenChaincode, invokeArgs, "")
+	if response.GetStatus() != 200 {
+		return nil, fmt.Errorf("%s %s failed: %s", tokenChaincode, function, response.GetMessage())
+	}
+
+	return response.GetPayload(), nil
+}
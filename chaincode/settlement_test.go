@@ -0,0 +1,129 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Disbursements and repayments move tokens on the embedded token ledger, or
+// on the token chaincode once one is configured
+func TestSettlement(t *testing.T) {
+	tests := []struct {
+		name           string
+		tokenChaincode string
+	}{
+		{"embedded token ledger", ""},
+		{"token chaincode", "token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLedger(t)
+			if tt.tokenChaincode != "" {
+				l.deployTokenChaincode(tt.tokenChaincode)
+			}
+			l.borrower("B1", "100.00")
+
+			l.disbursedLoan("L1", "B1", "1000")
+			if balance := l.balance("B1"); balance != "1100.00" {
+				t.Errorf("borrower balance after disbursement = %s, want 1100.00", balance)
+			}
+			if balance := l.balance("HDFC"); balance != "499000.00" {
+				t.Errorf("lender balance after disbursement = %s, want 499000.00", balance)
+			}
+
+			l.must(hdfc, func(ctx *TransactionContext) error {
+				_, err := l.contract.RepayLoan(ctx, "L1", "500", "UTR1")
+				return err
+			})
+			if balance := l.balance("B1"); balance != "600.00" {
+				t.Errorf("borrower balance after repayment = %s, want 600.00", balance)
+			}
+			if balance := l.balance("HDFC"); balance != "499500.00" {
+				t.Errorf("lender balance after repayment = %s, want 499500.00", balance)
+			}
+
+			// A repayment the token ledger refuses leaves the loan as it was
+			err := l.submit(hdfc, func(ctx *TransactionContext) error {
+				_, err := l.contract.RepayLoan(ctx, "L1", "620", "UTR2")
+				return err
+			})
+			if err == nil {
+				t.Fatal("repayment beyond the borrower's balance succeeded")
+			}
+			if balance := l.balance("B1"); balance != "600.00" {
+				t.Errorf("borrower balance after refused repayment = %s, want 600.00", balance)
+			}
+			if tt.tokenChaincode != "" && l.stub.Committed("B1") != nil {
+				t.Error("borrower balance written to the lending ledger with a token chaincode configured")
+			}
+		})
+	}
+}
+
+// Funds reserved at approval and cash margins are earmarked on the ledger
+// lending settles on, so they cannot be spent elsewhere
+func TestSettlementEarmarks(t *testing.T) {
+	tests := []struct {
+		name           string
+		tokenChaincode string
+	}{
+		{"embedded token ledger", ""},
+		{"token chaincode", "token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLedger(t)
+			if tt.tokenChaincode != "" {
+				l.deployTokenChaincode(tt.tokenChaincode)
+			}
+			l.borrower("B1", "100.00")
+			l.borrower("B2", "100.00")
+
+			for _, loanID := range []string{"L1", "L2"} {
+				l.must(hdfc, func(ctx *TransactionContext) error {
+					_, err := l.contract.RequestLoan(ctx, loanID, "B1", "300000", "12", 12, "", "", "", "")
+					return err
+				})
+			}
+			l.must(hdfc, func(ctx *TransactionContext) error {
+				_, err := l.contract.ApproveLoan(ctx, "L1", "HDFC")
+				return err
+			})
+			if available := l.available("HDFC"); available != "200000.00" {
+				t.Errorf("lender available balance after approval = %s, want 200000.00", available)
+			}
+			err := l.submit(hdfc, func(ctx *TransactionContext) error {
+				_, err := l.contract.ApproveLoan(ctx, "L2", "HDFC")
+				return err
+			})
+			if err == nil || !strings.Contains(err.Error(), "insufficient available funds") {
+				t.Errorf("approval beyond the funds not reserved: error = %v", err)
+			}
+
+			l.must(hdfc, func(ctx *TransactionContext) error {
+				_, err := l.contract.DisburseLoan(ctx, "L1")
+				return err
+			})
+			if balance := l.balance("HDFC"); balance != "200000.00" {
+				t.Errorf("lender balance after disbursement = %s, want 200000.00", balance)
+			}
+			if available := l.available("HDFC"); available != "200000.00" {
+				t.Errorf("lender available balance after disbursement = %s, want 200000.00", available)
+			}
+
+			l.must(hdfc, func(ctx *TransactionContext) error {
+				_, err := l.contract.PostMargin(ctx, "L1", "50")
+				return err
+			})
+			if available := l.available("B1"); available != "300050.00" {
+				t.Errorf("borrower available balance after margin = %s, want 300050.00", available)
+			}
+			marginKey, _ := l.stub.CreateCompositeKey("earmark", []string{"B1", marginReference("L1")})
+			if tt.tokenChaincode != "" && l.stub.Committed(marginKey) != nil {
+				t.Error("margin earmarked on the lending ledger with a token chaincode configured")
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Schedule of a loan that has not been requested, as it would be if disbursed
+// now
+type ScheduleSimulation struct {
+	Amount               token.Amount          `json:"amount"`
+	InterestRate         Decimal               `json:"interestRate"`
+	Duration             int                   `json:"duration"`
+	InterestMethod       string                `json:"interestMethod"`
+	CompoundingFrequency int                   `json:"compoundingFrequency,omitempty" metadata:",optional"`
+	RepaymentDue         token.Amount          `json:"repaymentDue"`
+	TotalInterest        token.Amount          `json:"totalInterest"`
+	Installments         []ScheduleInstallment `json:"installments"`
+}
+
+// ============== Simulation ==============
+
+// Quote the schedule of a loan of amount at interestRate over duration months
+// without writing state, computed as GetRepaymentSchedule computes it for a
+// loan disbursed now
+func (s *SmartContract) SimulateSchedule(
+	ctx contractapi.TransactionContextInterface,
+	amount string,
+	interestRate string,
+	duration int,
+	method string,
+	compoundingFrequency int,
+) (*ScheduleSimulation, error) {
+	value, err := parseAmount(amount)
+	if err != nil {
+		return nil, err
+	}
+	rate, err := parseRate(interestRate)
+	if err != nil {
+		return nil, err
+	}
+	err = checkInterestMethod(method, compoundingFrequency)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	start, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	loan := &Loan{
+		Amount:               token.NewAmount(value),
+		InterestRate:         newRate(rate),
+		Duration:             duration,
+		InterestMethod:       method,
+		CompoundingFrequency: compoundingFrequency,
+	}
+	rounding := config.Rounding
+	repaymentDue := repaymentDue(loan, rounding)
+
+	return &ScheduleSimulation{
+		Amount:               loan.Amount,
+		InterestRate:         loan.InterestRate,
+		Duration:             duration,
+		InterestMethod:       method,
+		CompoundingFrequency: compoundingFrequency,
+		RepaymentDue:         repaymentDue,
+		TotalInterest:        rounding.amount(ratSub(repaymentDue.Rat(), value)),
+		Installments:         repaymentSchedule(loan, start, rounding),
+	}, nil
+}
+
+// Quote the amount that would close an active loan at the end of asOfDate,
+// as GetPrepaymentQuote does for the current time, without writing state
+func (s *SmartContract) SimulateForeclosure(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	asOfDate string,
+) (*PrepaymentQuote, error) {
+	asOf, err := parseDate(asOfDate)
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Status != "ACTIVE" {
+		return nil, fmt.Errorf("loan %s cannot be prepaid in current status: %s", loanID, loan.Status)
+	}
+	disbursedAt, _ := disbursementTime(loan)
+	if asOf.Before(disbursedAt) {
+		return nil, fmt.Errorf("loan %s was disbursed after %s", loanID, asOfDate)
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return prepaymentQuote(loan, asOf, config.Rounding), nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Point-in-time copy of every account balance and each lender's outstanding
+// book, kept for month-end closing
+type Snapshot struct {
+	Label            string                 `json:"label"`
+	TakenAt          string                 `json:"takenAt"`
+	TxID             string                 `json:"txId"`
+	Balances         []token.AccountSummary `json:"balances"`
+	TotalBalance     token.Amount           `json:"totalBalance"`
+	Lenders          []LenderOutstanding    `json:"lenders"`
+	TotalOutstanding token.Amount           `json:"totalOutstanding"`
+}
+
+type LenderOutstanding struct {
+	LenderID    string       `json:"lenderId"`
+	LoanCount   int          `json:"loanCount"` // disbursed loans not yet repaid
+	Outstanding token.Amount `json:"outstanding"`
+}
+
+const snapshotObjectType = "snapshot"
+
+// ============== Snapshots ==============
+
+// Record all account balances and per-lender outstandings under a label, such
+// as 2026-03, regulator only. Labels cannot be reused.
+func (s *SmartContract) TakeSnapshot(
+	ctx contractapi.TransactionContextInterface,
+	label string,
+) (*Snapshot, error) {
+	err := claimRequestID(ctx, "TakeSnapshot")
+	if err != nil {
+		return nil, err
+	}
+
+	err = requireRegulator(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if label == "" {
+		return nil, fmt.Errorf("snapshot label is required")
+	}
+
+	var existing Snapshot
+	exists, err := getRecord(ctx, snapshotObjectType, []string{label}, &existing)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, fmt.Errorf("snapshot %s was taken by transaction %s", label, existing.TxID)
+	}
+
+	takenAt, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	balances, err := s.accountBalances(ctx)
+	if err != nil {
+		return nil, err
+	}
+	total := new(big.Rat)
+	for _, balance := range balances {
+		total.Add(total, balance.Balance.Rat())
+	}
+
+	snapshot := Snapshot{
+		Label:        label,
+		TakenAt:      takenAt.Format(time.RFC3339),
+		TxID:         ctx.GetStub().GetTxID(),
+		Balances:     balances,
+		TotalBalance: token.NewAmount(total),
+		Lenders:      []LenderOutstanding{},
+	}
+
+	// Transactions that write state cannot use paginated queries
+	loans, err := s.getIndexedLoans(ctx, lenderLoanIndex)
+	if err != nil {
+		return nil, err
+	}
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byLender := map[string]*LenderOutstanding{}
+	outstanding := map[string]*big.Rat{}
+	for _, loan := range loans {
+		if _, disbursed := disbursementTime(loan); !disbursed {
+			continue
+		}
+		if loan.RemainingBalance.Rat().Sign() <= 0 || loan.Status == "REPAID" {
+			continue
+		}
+		lender, ok := byLender[loan.LenderID]
+		if !ok {
+			lender = &LenderOutstanding{LenderID: loan.LenderID}
+			byLender[loan.LenderID] = lender
+			outstanding[loan.LenderID] = new(big.Rat)
+		}
+		lender.LoanCount++
+		outstanding[loan.LenderID].Add(outstanding[loan.LenderID], loan.RemainingBalance.Rat())
+	}
+
+	lenders := make([]string, 0, len(byLender))
+	for lenderID := range byLender {
+		lenders = append(lenders, lenderID)
+	}
+	sort.Strings(lenders)
+	totalOutstanding := new(big.Rat)
+	for _, lenderID := range lenders {
+		lender := byLender[lenderID]
+		lenderOutstanding := config.Rounding.round(outstanding[lenderID])
+		lender.Outstanding = token.NewAmount(lenderOutstanding)
+		totalOutstanding.Add(totalOutstanding, lenderOutstanding)
+		snapshot.Lenders = append(snapshot.Lenders, *lender)
+	}
+	snapshot.TotalOutstanding = config.Rounding.amount(totalOutstanding)
+
+	err = putRecord(ctx, snapshotObjectType, []string{label}, snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
+
+// A snapshot by label, regulator only
+func (s *SmartContract) GetSnapshot(
+	ctx contractapi.TransactionContextInterface,
+	label string,
+) (*Snapshot, error) {
+	err := requireRegulator(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot Snapshot
+	exists, err := getRecord(ctx, snapshotObjectType, []string{label}, &snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("snapshot %s does not exist", label)
+	}
+
+	return &snapshot, nil
+}
+
+// Balances of all registered accounts, from the token chaincode when one is
+// configured, read indexPageSize accounts at a time
+func (s *SmartContract) accountBalances(
+	ctx contractapi.TransactionContextInterface,
+) ([]token.AccountSummary, error) {
+	tokenChaincode, err := s.tokenChaincode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	balances := []token.AccountSummary{}
+	bookmark := ""
+	for {
+		var page *token.AccountPage
+		if tokenChaincode == "" {
+			page, err = s.GetAccountBalances(ctx, indexPageSize, bookmark)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			payload, err := s.invokeToken(ctx, tokenChaincode, "GetAccountBalances", strconv.Itoa(indexPageSize), bookmark)
+			if err != nil {
+				return nil, err
+			}
+			err = json.Unmarshal(payload, &page)
+			if err != nil || page == nil {
+				return nil, fmt.Errorf("invalid balances returned by %s: %v", tokenChaincode, err)
+			}
+		}
+
+		balances = append(balances, page.Accounts...)
+		if page.Bookmark == "" {
+			return balances, nil
+		}
+		bookmark = page.Bookmark
+	}
+}
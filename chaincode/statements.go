@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// A dated line of a statement of account. Debits raise the balance owed,
+// credits lower it.
+type StatementEntry struct {
+	Date        string       `json:"date"` // RFC3339
+	Type        string       `json:"type"` // DISBURSEMENT, INTEREST, CHARGE, REPAYMENT
+	Description string       `json:"description"`
+	Reference   string       `json:"reference,omitempty" metadata:",optional"` // payment reference or charge ID
+	Debit       token.Amount `json:"debit"`
+	Credit      token.Amount `json:"credit"`
+	Balance     token.Amount `json:"balance"` // running balance after the entry
+}
+
+// A borrower's statement of account for a loan over a period. Interest is
+// shown as it accrues, at each month end and at the end of the period, so the
+// balance is what the borrower owed on each date rather than the contractual
+// repayment.
+type LoanStatement struct {
+	LoanID         string            `json:"loanId"`
+	BorrowerID     string            `json:"borrowerId"`
+	LenderID       string            `json:"lenderId"`
+	FromDate       string            `json:"fromDate"`
+	ToDate         string            `json:"toDate"`
+	OpeningBalance token.Amount      `json:"openingBalance"`
+	TotalDebits    token.Amount      `json:"totalDebits"`
+	TotalCredits   token.Amount      `json:"totalCredits"`
+	ClosingBalance token.Amount      `json:"closingBalance"`
+	Entries        []*StatementEntry `json:"entries"`
+	GeneratedAt    string            `json:"generatedAt"`
+}
+
+// Statement entry types, in the order entries of the same instant are listed
+const (
+	entryDisbursement = "DISBURSEMENT"
+	entryInterest     = "INTEREST"
+	entryCharge       = "CHARGE"
+	entryRepayment    = "REPAYMENT"
+)
+
+var entryOrder = map[string]int{
+	entryDisbursement: 0,
+	entryInterest:     1,
+	entryCharge:       2,
+	entryRepayment:    3,
+}
+
+// ============== Statements ==============
+
+// Statement of account of a disbursed loan from fromDate to toDate
+// (YYYY-MM-DD, both included) listing its disbursement, interest accruals,
+// charges and repayments with the running balance. A period running past the
+// transaction date ends at it. Available to the regulator and the loan's
+// parties.
+func (s *SmartContract) GetStatement(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	fromDate string,
+	toDate string,
+) (*LoanStatement, error) {
+	from, err := time.Parse("2006-01-02", fromDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %s, expected YYYY-MM-DD", fromDate)
+	}
+	to, err := parseDate(toDate)
+	if err != nil {
+		return nil, err
+	}
+	if to.Before(from) {
+		return nil, fmt.Errorf("statement period ends before it starts")
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	viewer := newLoanViewer()
+	party, err := s.isPartyTo(ctx, viewer, loan)
+	if err != nil {
+		return nil, err
+	}
+	if !party {
+		return nil, fmt.Errorf("caller from %s is not a party to loan %s", viewer.mspID, loanID)
+	}
+
+	disbursedAt, ok := disbursementTime(loan)
+	if !ok {
+		return nil, fmt.Errorf("loan %s has not been disbursed", loanID)
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if to.After(now) {
+		to = now
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rounding := config.Rounding
+
+	entries := []*StatementEntry{}
+	if len(loan.Tranches) == 0 {
+		entries = append(entries, &StatementEntry{
+			Date:        disbursedAt.Format(time.RFC3339),
+			Type:        entryDisbursement,
+			Description: fmt.Sprintf("Loan disbursed by %s", loan.LenderID),
+			Debit:       loan.Amount,
+		})
+	}
+	for i, tranche := range loan.Tranches {
+		entries = append(entries, &StatementEntry{
+			Date:        tranche.DisbursedAt,
+			Type:        entryDisbursement,
+			Description: fmt.Sprintf("Tranche %d disbursed by %s", i+1, loan.LenderID),
+			Reference:   tranche.TxID,
+			Debit:       tranche.Amount,
+		})
+	}
+
+	charges, err := s.getCharges(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	for _, charge := range charges {
+		entries = append(entries, &StatementEntry{
+			Date:        charge.ChargedAt,
+			Type:        entryCharge,
+			Description: charge.Description,
+			Reference:   charge.ChargeID,
+			Debit:       charge.Amount,
+		})
+	}
+
+	repayments, err := s.getRepayments(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	for _, repayment := range repayments {
+		entries = append(entries, &StatementEntry{
+			Date:        repayment.PaidAt,
+			Type:        entryRepayment,
+			Description: "Repayment received",
+			Reference:   repayment.PaymentReference,
+			Credit:      repayment.Amount,
+		})
+	}
+
+	entries = append(entries, interestEntries(loan, disbursedAt, from, to, rounding)...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Date != entries[j].Date {
+			return entries[i].Date < entries[j].Date
+		}
+		return entryOrder[entries[i].Type] < entryOrder[entries[j].Type]
+	})
+
+	statement := LoanStatement{
+		LoanID:      loan.LoanID,
+		BorrowerID:  loan.BorrowerID,
+		LenderID:    loan.LenderID,
+		FromDate:    fromDate,
+		ToDate:      toDate,
+		Entries:     []*StatementEntry{},
+		GeneratedAt: now.Format(time.RFC3339),
+	}
+	startInstant := from.Format(time.RFC3339)
+	endInstant := to.Format(time.RFC3339)
+	balance, debits, credits := new(big.Rat), new(big.Rat), new(big.Rat)
+	statement.OpeningBalance = zeroAmount
+	for _, entry := range entries {
+		if entry.Date > endInstant {
+			break
+		}
+		debit, credit := entry.Debit.Rat(), entry.Credit.Rat()
+		entry.Debit, entry.Credit = token.NewAmount(debit), token.NewAmount(credit)
+		balance = rounding.round(ratSub(ratAdd(balance, debit), credit))
+		entry.Balance = token.NewAmount(balance)
+		if entry.Date < startInstant {
+			statement.OpeningBalance = entry.Balance
+			continue
+		}
+
+		debits.Add(debits, debit)
+		credits.Add(credits, credit)
+		statement.Entries = append(statement.Entries, entry)
+	}
+	statement.TotalDebits = rounding.amount(debits)
+	statement.TotalCredits = rounding.amount(credits)
+	statement.ClosingBalance = token.NewAmount(balance)
+
+	return &statement, nil
+}
+
+// Interest accrued at the close of each month from disbursement, up to the
+// end of the statement or the loan's closure, and at the end itself. An
+// accrual is also made just before from, so the opening balance includes the
+// interest accrued before the period.
+func interestEntries(
+	loan *Loan,
+	disbursedAt time.Time,
+	from time.Time,
+	to time.Time,
+	rounding RoundingPolicy,
+) []*StatementEntry {
+	end := to
+	if closedAt, ok := unixTime(loan.ClosedAt); ok && closedAt.Before(end) {
+		end = closedAt
+	}
+
+	points := []time.Time{}
+	if beforeFrom := from.Add(-time.Second); beforeFrom.After(disbursedAt) && beforeFrom.Before(end) {
+		points = append(points, beforeFrom)
+	}
+	nextMonth := time.Date(disbursedAt.Year(), disbursedAt.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	for monthEnd := nextMonth.Add(-time.Second); monthEnd.Before(end); monthEnd = nextMonth.Add(-time.Second) {
+		points = append(points, monthEnd)
+		nextMonth = nextMonth.AddDate(0, 1, 0)
+	}
+	points = append(points, end)
+	sort.Slice(points, func(i, j int) bool { return points[i].Before(points[j]) })
+
+	entries := []*StatementEntry{}
+	accrued := new(big.Rat)
+	net := newRate(ratSub(loan.InterestRate.Rat(), loan.SubventionRate.Rat()))
+	for _, point := range points {
+		total := interestAccrued(loan, point, rounding)
+		if total.Cmp(accrued) <= 0 {
+			continue
+		}
+
+		entries = append(entries, &StatementEntry{
+			Date:        point.Format(time.RFC3339),
+			Type:        entryInterest,
+			Description: fmt.Sprintf("Interest accrued at %s%%", net),
+			Debit:       rounding.amount(ratSub(total, accrued)),
+		})
+		accrued = total
+	}
+	return entries
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// A borrower's proposal to swap a registry asset securing an ACTIVE loan for
+// another, kept on the loan until the next one is proposed
+type CollateralSubstitution struct {
+	ReleaseID     string       `json:"releaseId"`     // encumbered asset to return to the borrower
+	ReplacementID string       `json:"replacementId"` // registered asset to encumber in its place
+	Value         token.Amount `json:"value"`         // replacement valuation when proposed, then approved
+	ProposedAt    string       `json:"proposedAt"`
+	ProposedBy    string       `json:"proposedBy"` // MSP ID of the borrower's organization
+	Status        string       `json:"status"`     // PROPOSED, APPROVED, REJECTED
+	DecidedAt     string       `json:"decidedAt,omitempty" metadata:",optional"`
+	Reason        string       `json:"reason,omitempty" metadata:",optional"` // given by the lender when rejected
+}
+
+// Substitution statuses
+const (
+	substitutionProposed = "PROPOSED"
+	substitutionApproved = "APPROVED"
+	substitutionRejected = "REJECTED"
+)
+
+// ============== Collateral Substitution ==============
+
+// Propose to replace an encumbered asset of an ACTIVE loan with another
+// valued asset of the borrower, called by the organization operating the
+// borrower's account. The swap is made when the lender approves it.
+func (s *SmartContract) ProposeCollateralSubstitution(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	releaseID string,
+	replacementID string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "ProposeCollateralSubstitution")
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	borrower, err := s.accountOf(ctx, loan.BorrowerID)
+	if err != nil {
+		return nil, err
+	}
+	err = requireOperatorOf(ctx, borrower)
+	if err != nil {
+		return nil, err
+	}
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Status != "ACTIVE" {
+		return nil, fmt.Errorf("collateral of loan %s cannot be substituted in current status: %s", loanID, loan.Status)
+	}
+	if loan.Substitution != nil && loan.Substitution.Status == substitutionProposed {
+		return nil, fmt.Errorf("loan %s already has a substitution of collateral %s proposed",
+			loanID, loan.Substitution.ReleaseID)
+	}
+	_, err = encumberedPledge(loan, releaseID)
+	if err != nil {
+		return nil, err
+	}
+
+	replacement, err := s.checkReplacement(ctx, loan, replacementID)
+	if err != nil {
+		return nil, err
+	}
+
+	proposedAt, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	loan.Substitution = &CollateralSubstitution{
+		ReleaseID:     releaseID,
+		ReplacementID: replacementID,
+		Value:         replacement.Value,
+		ProposedAt:    proposedAt.Format(time.RFC3339),
+		ProposedBy:    mspID,
+		Status:        substitutionProposed,
+	}
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Substitution of collateral %s by %s proposed (TxID: %s)",
+			releaseID,
+			replacementID,
+			ctx.GetStub().GetTxID()))
+
+	return s.putLoanResult(ctx, loan)
+}
+
+// Approve the proposed substitution, called by the organization operating the
+// lender's account. The assets are revalued and the loan must stay within the
+// configured loan to value after the swap. The released asset's encumbrance
+// is closed and the replacement encumbered to the lender.
+func (s *SmartContract) ApproveCollateralSubstitution(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "ApproveCollateralSubstitution")
+	if err != nil {
+		return nil, err
+	}
+
+	loan, substitution, err := s.proposedSubstitution(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Status != "ACTIVE" {
+		return nil, fmt.Errorf("collateral of loan %s cannot be substituted in current status: %s", loanID, loan.Status)
+	}
+	released, err := encumberedPledge(loan, substitution.ReleaseID)
+	if err != nil {
+		return nil, err
+	}
+	replacement, err := s.checkReplacement(ctx, loan, substitution.ReplacementID)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	remaining, err := s.pledgedValue(ctx, loan, substitution.ReleaseID)
+	if err != nil {
+		return nil, err
+	}
+	value := ratAdd(remaining, replacement.Value.Rat())
+	if loan.RemainingBalance.Rat().Cmp(percentOf(value, config.CollateralLTV.Rat())) > 0 {
+		return nil, fmt.Errorf("remaining balance %s would exceed %s%% of the %s of collateral after substitution",
+			loan.RemainingBalance, config.CollateralLTV, token.FormatAmount(value))
+	}
+
+	decidedAt, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.closeEncumbrance(ctx, loan, released, "RELEASED")
+	if err != nil {
+		return nil, err
+	}
+	err = s.indexCollateral(ctx, loanID, replacement.Type, "", replacement.CollateralID)
+	if err != nil {
+		return nil, err
+	}
+	loan.Pledges = append(loan.Pledges, &CollateralPledge{
+		CollateralID: replacement.CollateralID,
+		Type:         replacement.Type,
+		Status:       "PLEDGED",
+		Value:        replacement.Value,
+	})
+	err = s.encumberCollateral(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+
+	substitution.Status = substitutionApproved
+	substitution.Value = replacement.Value
+	substitution.DecidedAt = decidedAt.Format(time.RFC3339)
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Collateral %s substituted by %s, encumbered to %s (TxID: %s)",
+			substitution.ReleaseID,
+			substitution.ReplacementID,
+			loan.LenderID,
+			ctx.GetStub().GetTxID()))
+
+	return s.putLoanResult(ctx, loan)
+}
+
+// Reject the proposed substitution, called by the organization operating the
+// lender's account
+func (s *SmartContract) RejectCollateralSubstitution(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	reason string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "RejectCollateralSubstitution")
+	if err != nil {
+		return nil, err
+	}
+
+	loan, substitution, err := s.proposedSubstitution(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	if reason == "" {
+		return nil, fmt.Errorf("rejection reason is required")
+	}
+
+	decidedAt, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	substitution.Status = substitutionRejected
+	substitution.Reason = reason
+	substitution.DecidedAt = decidedAt.Format(time.RFC3339)
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Substitution of collateral %s by %s rejected: %s (TxID: %s)",
+			substitution.ReleaseID,
+			substitution.ReplacementID,
+			reason,
+			ctx.GetStub().GetTxID()))
+
+	return s.putLoanResult(ctx, loan)
+}
+
+// Reads the loan with its proposed substitution, failing unless the caller
+// operates the lender's account
+func (s *SmartContract) proposedSubstitution(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+) (*Loan, *CollateralSubstitution, error) {
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = s.requireLender(ctx, loan.LenderID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if loan.Substitution == nil || loan.Substitution.Status != substitutionProposed {
+		return nil, nil, fmt.Errorf("loan %s has no collateral substitution proposed", loanID)
+	}
+	return loan, loan.Substitution, nil
+}
+
+// Fails unless the asset is a valued asset of the borrower, free of
+// encumbrances and never pledged to the loan before
+func (s *SmartContract) checkReplacement(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	collateralID string,
+) (*CollateralAsset, error) {
+	asset, err := s.GetCollateral(ctx, collateralID)
+	if err != nil {
+		return nil, err
+	}
+	if asset.OwnerID != loan.BorrowerID {
+		return nil, fmt.Errorf("collateral %s is not owned by borrower %s", collateralID, loan.BorrowerID)
+	}
+	if asset.Value.Rat().Sign() <= 0 {
+		return nil, fmt.Errorf("collateral %s has not been valued", collateralID)
+	}
+	for _, pledge := range loan.Pledges {
+		if pledge.CollateralID == collateralID {
+			return nil, fmt.Errorf("collateral %s has already been pledged to loan %s", collateralID, loan.LoanID)
+		}
+	}
+
+	err = s.checkCollateralFree(ctx, collateralID)
+	if err != nil {
+		return nil, err
+	}
+	return asset, nil
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Government interest subvention scheme. The scheme account pays
+// SubventionRate points of the interest of enrolled loans, the borrower the rest.
+type SubventionScheme struct {
+	SchemeID       string   `json:"schemeId"`
+	Name           string   `json:"name"`
+	SchemeAccount  string   `json:"schemeAccount"`
+	SubventionRate Decimal  `json:"subventionRate"` // percent of principal
+	Products       []string `json:"products"`       // eligible loan products
+	Active         bool     `json:"active"`
+}
+
+// A lender's settlement of the subvention accrued on its loans under a scheme
+type SubventionClaim struct {
+	ClaimID   string                  `json:"claimId"`
+	LenderID  string                  `json:"lenderId"`
+	SchemeID  string                  `json:"schemeId"`
+	Amount    token.Amount            `json:"amount"`
+	Loans     map[string]token.Amount `json:"loans"` // amount claimed per loan
+	ClaimedAt string                  `json:"claimedAt"`
+	Bookmark  string                  `json:"bookmark,omitempty" metadata:",optional"` // claim the next loans with it
+}
+
+const (
+	subventionSchemeObjectType = "scheme"
+	subventionClaimObjectType  = "subventionClaim"
+)
+
+// ============== Interest Subvention ==============
+
+// Define or replace a subvention scheme, regulator only
+func (s *SmartContract) SetSubventionScheme(
+	ctx contractapi.TransactionContextInterface,
+	schemeID string,
+	name string,
+	schemeAccount string,
+	subventionRate string,
+	products []string,
+	active bool,
+) error {
+	err := claimRequestID(ctx, "SetSubventionScheme")
+	if err != nil {
+		return err
+	}
+	rate, err := parseRate(subventionRate)
+	if err != nil {
+		return err
+	}
+
+	err = requireRegulator(ctx)
+	if err != nil {
+		return err
+	}
+
+	if rate.Sign() <= 0 {
+		return fmt.Errorf("subvention rate must be positive")
+	}
+	_, err = s.accountOf(ctx, schemeAccount)
+	if err != nil {
+		return err
+	}
+
+	return putRecord(ctx, subventionSchemeObjectType, []string{schemeID}, SubventionScheme{
+		SchemeID:       schemeID,
+		Name:           name,
+		SchemeAccount:  schemeAccount,
+		SubventionRate: newRate(rate),
+		Products:       products,
+		Active:         active,
+	})
+}
+
+func (s *SmartContract) GetSubventionScheme(
+	ctx contractapi.TransactionContextInterface,
+	schemeID string,
+) (*SubventionScheme, error) {
+	var scheme SubventionScheme
+	exists, err := getRecord(ctx, subventionSchemeObjectType, []string{schemeID}, &scheme)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("subvention scheme %s does not exist", schemeID)
+	}
+	return &scheme, nil
+}
+
+// Enroll a pending loan in a scheme, lowering the interest the borrower repays
+func (s *SmartContract) EnrollInSubventionScheme(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	schemeID string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "EnrollInSubventionScheme")
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Status != "PENDING" {
+		return nil, fmt.Errorf("loan %s cannot be enrolled in current status: %s", loanID, loan.Status)
+	}
+	if loan.SchemeID != "" {
+		return nil, fmt.Errorf("loan %s is already enrolled in scheme %s", loanID, loan.SchemeID)
+	}
+
+	scheme, err := s.GetSubventionScheme(ctx, schemeID)
+	if err != nil {
+		return nil, err
+	}
+	if !scheme.Active {
+		return nil, fmt.Errorf("subvention scheme %s is not active", schemeID)
+	}
+
+	eligible := false
+	for _, product := range scheme.Products {
+		if product == loan.Product {
+			eligible = true
+		}
+	}
+	if !eligible {
+		return nil, fmt.Errorf("product %s is not eligible for scheme %s", loan.Product, schemeID)
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The scheme never pays more than the loan's interest
+	subventionRate := scheme.SubventionRate
+	if subventionRate.Rat().Cmp(loan.InterestRate.Rat()) > 0 {
+		subventionRate = loan.InterestRate
+	}
+
+	loan.SchemeID = schemeID
+	loan.SubventionRate = subventionRate
+	loan.RepaymentDue = repaymentDue(loan, config.Rounding)
+	loan.RemainingBalance = loan.RepaymentDue
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Enrolled in subvention scheme %s at %s%% (TxID: %s)",
+			schemeID,
+			subventionRate,
+			ctx.GetStub().GetTxID()))
+
+	return s.putLoanResult(ctx, loan)
+}
+
+// Settle the subvention accrued since its last claim on the next pageSize of a
+// lender's loans, paid from the scheme account to the lender. A claim with a
+// bookmark is followed by claims with it until the lender's loans are done.
+func (s *SmartContract) ClaimSubvention(
+	ctx contractapi.TransactionContextInterface,
+	lenderID string,
+	schemeID string,
+	pageSize int,
+	bookmark string,
+) (*SubventionClaim, error) {
+	err := claimRequestID(ctx, "ClaimSubvention")
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.requireLender(ctx, lenderID)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme, err := s.GetSubventionScheme(ctx, schemeID)
+	if err != nil {
+		return nil, err
+	}
+
+	asOf, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	loans, next, err := s.getIndexedLoanBatch(ctx, lenderLoanIndex, []string{lenderID}, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	claim := SubventionClaim{
+		ClaimID:   ctx.GetStub().GetTxID(),
+		LenderID:  lenderID,
+		SchemeID:  schemeID,
+		Loans:     map[string]token.Amount{},
+		ClaimedAt: asOf.Format(time.RFC3339),
+		Bookmark:  next,
+	}
+	total := new(big.Rat)
+
+	for _, loan := range loans {
+		if loan.SchemeID != schemeID {
+			continue
+		}
+
+		due := ratSub(subventionAccrued(loan, asOf, config.Rounding), loan.SubventionClaimed.Rat())
+		if due.Sign() <= 0 {
+			continue
+		}
+
+		loan.SubventionClaimed = token.NewAmount(ratAdd(loan.SubventionClaimed.Rat(), due))
+		loan.AuditHistory = append(loan.AuditHistory,
+			fmt.Sprintf("Subvention of %s claimed from scheme %s (TxID: %s)",
+				token.FormatAmount(due),
+				schemeID,
+				ctx.GetStub().GetTxID()))
+
+		err = s.putLoan(ctx, loan)
+		if err != nil {
+			return nil, err
+		}
+
+		claim.Loans[loan.LoanID] = token.NewAmount(due)
+		total = config.Rounding.round(ratAdd(total, due))
+	}
+	claim.Amount = token.NewAmount(total)
+
+	if total.Sign() == 0 {
+		if next != "" || bookmark != "" {
+			return &claim, nil
+		}
+		return nil, fmt.Errorf("no subvention due to %s under scheme %s", lenderID, schemeID)
+	}
+
+	_, err = s.settle(ctx, scheme.SchemeAccount, lenderID, total, token.ReasonSubvention, "")
+	if err != nil {
+		return nil, err
+	}
+
+	err = putRecord(ctx, subventionClaimObjectType, []string{lenderID, schemeID, claim.ClaimID}, claim)
+	if err != nil {
+		return nil, err
+	}
+
+	return &claim, nil
+}
+
+// Scheme-payable interest accrued by asOf, the difference between interest at
+// the loan rate and at the borrower's rate. Accrual stops once the loan is
+// closed or defaulted.
+func subventionAccrued(loan *Loan, asOf time.Time, rounding RoundingPolicy) *big.Rat {
+	if loan.SchemeID == "" || loan.Status == "DEFAULTED" {
+		return loan.SubventionClaimed.Rat()
+	}
+
+	end := asOf
+	if closedAt, ok := unixTime(loan.ClosedAt); ok && closedAt.Before(end) {
+		end = closedAt
+	}
+
+	elapsed := termElapsed(loan, end)
+	rate := loan.InterestRate.Rat()
+	return rounding.round(ratSub(interestAt(loan, rate, elapsed), interestAt(loan, ratSub(rate, loan.SubventionRate.Rat()), elapsed)))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// ============== Loan Tags ==============
+
+// Attach a metadata tag (scheme code, branch code, campaign ID...) to a loan,
+// an empty value removes the tag
+func (s *SmartContract) SetLoanTag(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	key string,
+	value string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "SetLoanTag")
+	if err != nil {
+		return nil, err
+	}
+
+	if key == "" {
+		return nil, fmt.Errorf("tag key must not be empty")
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	if previous, ok := loan.Metadata[key]; ok {
+		err = s.deleteIndex(ctx, tagLoanIndex, key, previous, loanID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if value == "" {
+		delete(loan.Metadata, key)
+		loan.AuditHistory = append(loan.AuditHistory,
+			fmt.Sprintf("Tag %s removed (TxID: %s)",
+				key,
+				ctx.GetStub().GetTxID()))
+		return s.putLoanResult(ctx, loan)
+	}
+
+	if loan.Metadata == nil {
+		loan.Metadata = map[string]string{}
+	}
+	loan.Metadata[key] = value
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Tag %s set to %s (TxID: %s)",
+			key,
+			value,
+			ctx.GetStub().GetTxID()))
+
+	err = s.putIndex(ctx, tagLoanIndex, key, value, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.putLoanResult(ctx, loan)
+}
+
+// List loans carrying a tag with the given value, a page at a time
+func (s *SmartContract) GetLoansByTag(
+	ctx contractapi.TransactionContextInterface,
+	key string,
+	value string,
+	pageSize int32,
+	bookmark string,
+) (*LoanPage, error) {
+	return s.getIndexedLoanPage(ctx, tagLoanIndex, []string{key, value}, pageSize, bookmark)
+}
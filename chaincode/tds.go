@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Certificate of the tax withheld from the interest of a repayment. The
+// payer deducts it and pays it to the configured tax account, the loan is
+// credited with the full repayment.
+type TDSCertificate struct {
+	CertificateID    string       `json:"certificateId"` // repayment ID
+	LoanID           string       `json:"loanId"`
+	Deductor         string       `json:"deductor"` // account paying the interest
+	Deductee         string       `json:"deductee"` // lender earning the interest
+	TaxAccount       string       `json:"taxAccount"`
+	Interest         token.Amount `json:"interest"`
+	Rate             Decimal      `json:"rate"` // percent of the interest
+	Withheld         token.Amount `json:"withheld"`
+	PaymentReference string       `json:"paymentReference"`
+	DeductedAt       string       `json:"deductedAt"`
+	TxID             string       `json:"txId"`
+}
+
+// Certificates an account deducted or had deducted in a period, a page at a
+// time
+type TDSLedger struct {
+	Account        string            `json:"account"`
+	Period         string            `json:"period"`
+	Deducted       token.Amount      `json:"deducted"`       // withheld as deductor
+	DeductedFrom   token.Amount      `json:"deductedFrom"`   // withheld as deductee
+	InterestPaid   token.Amount      `json:"interestPaid"`   // as deductor
+	InterestEarned token.Amount      `json:"interestEarned"` // as deductee
+	Certificates   []*TDSCertificate `json:"certificates"`
+	Bookmark       string            `json:"bookmark"` // empty on the last page
+}
+
+const tdsCertificateObjectType = "tds"
+
+// Indexes of certificates by either party
+const (
+	deductorTDSIndex = "deductor~tds"
+	deducteeTDSIndex = "deductee~tds"
+)
+
+// Tax to withhold from the interest of a repayment, 0 unless withholding is
+// configured
+func taxWithheld(interest *big.Rat, config *LendingConfig) *big.Rat {
+	if config.TDSRate.Rat().Sign() <= 0 || interest.Sign() <= 0 {
+		return new(big.Rat)
+	}
+	return config.Rounding.round(percentOf(interest, config.TDSRate.Rat()))
+}
+
+// Pays the tax withheld from a repayment to the tax account and records its
+// certificate
+func (s *SmartContract) withholdTax(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+	repaymentID string,
+	payer string,
+	interest *big.Rat,
+	withheld *big.Rat,
+	paymentReference string,
+	config *LendingConfig,
+	reserved string,
+) error {
+	_, err := s.settleFrom(ctx, payer, config.TaxAccount, withheld, token.ReasonTDS, loan.LoanID, reserved)
+	if err != nil {
+		return err
+	}
+
+	deductedAt, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	certificate := TDSCertificate{
+		CertificateID:    repaymentID,
+		LoanID:           loan.LoanID,
+		Deductor:         payer,
+		Deductee:         loan.LenderID,
+		TaxAccount:       config.TaxAccount,
+		Interest:         token.NewAmount(interest),
+		Rate:             config.TDSRate,
+		Withheld:         token.NewAmount(withheld),
+		PaymentReference: paymentReference,
+		DeductedAt:       deductedAt.Format(time.RFC3339),
+		TxID:             ctx.GetStub().GetTxID(),
+	}
+	err = putRecord(ctx, tdsCertificateObjectType, []string{certificate.CertificateID}, certificate)
+	if err != nil {
+		return err
+	}
+
+	err = s.putIndex(ctx, deductorTDSIndex, payer, certificate.CertificateID)
+	if err != nil {
+		return err
+	}
+	return s.putIndex(ctx, deducteeTDSIndex, loan.LenderID, certificate.CertificateID)
+}
+
+// ============== TDS Queries ==============
+
+func (s *SmartContract) GetTDSCertificate(
+	ctx contractapi.TransactionContextInterface,
+	certificateID string,
+) (*TDSCertificate, error) {
+	var certificate TDSCertificate
+	exists, err := getRecord(ctx, tdsCertificateObjectType, []string{certificateID}, &certificate)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("TDS certificate %s does not exist", certificateID)
+	}
+
+	return &certificate, nil
+}
+
+// The tax an account withheld as payer of interest or had withheld as
+// lender in a period (YYYY-MM or YYYY-Qn), read pageSize index entries at a
+// time, the certificates the account deducted first. Totals are those of the
+// page's certificates. Available to the regulator and the organization
+// operating the account.
+func (s *SmartContract) GetTDSLedger(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+	period string,
+	pageSize int32,
+	bookmark string,
+) (*TDSLedger, error) {
+	mspID, err := callerMSP(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if mspID != regulatorMSP {
+		holder, err := s.accountOf(ctx, account)
+		if err != nil {
+			return nil, err
+		}
+		err = requireOperatorOf(ctx, holder)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive")
+	}
+
+	start, end, err := parsePeriod(period)
+	if err != nil {
+		return nil, err
+	}
+	// The bookmark is the index being read and the bookmark within it
+	indexes := []string{deductorTDSIndex, deducteeTDSIndex}
+	bookmark, err = token.DecodeBookmark(bookmark)
+	if err != nil {
+		return nil, err
+	}
+	current := 0
+	indexBookmark := ""
+	if bookmark != "" {
+		parts := strings.SplitN(bookmark, "|", 2)
+		current, err = strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 || current < 0 || current >= len(indexes) {
+			return nil, fmt.Errorf("invalid bookmark %s", bookmark)
+		}
+		indexBookmark = parts[1]
+	}
+
+	ledger := TDSLedger{
+		Account:        account,
+		Period:         period,
+		Deducted:       zeroAmount,
+		DeductedFrom:   zeroAmount,
+		InterestPaid:   zeroAmount,
+		InterestEarned: zeroAmount,
+		Certificates:   []*TDSCertificate{},
+	}
+	startInstant := start.Format(time.RFC3339)
+	endInstant := end.Format(time.RFC3339)
+	read := int32(0)
+	for current < len(indexes) {
+		index := indexes[current]
+		remaining := pageSize - read
+		if remaining == 0 {
+			ledger.Bookmark = token.EncodeBookmark(strconv.Itoa(current) + "|" + indexBookmark)
+			break
+		}
+
+		iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(index, []string{account}, remaining, indexBookmark)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read from world state: %v", err)
+		}
+
+		for iterator.HasNext() {
+			entry, err := iterator.Next()
+			if err != nil {
+				iterator.Close()
+				return nil, err
+			}
+			_, keyParts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+			if err != nil {
+				iterator.Close()
+				return nil, err
+			}
+
+			certificate, err := s.GetTDSCertificate(ctx, keyParts[1])
+			if err != nil {
+				iterator.Close()
+				return nil, err
+			}
+			if certificate.DeductedAt < startInstant || certificate.DeductedAt > endInstant {
+				continue
+			}
+
+			// A lender repaying its own loan appears under both indexes
+			if index == deductorTDSIndex {
+				ledger.Deducted = token.NewAmount(amountSum(ledger.Deducted, certificate.Withheld))
+				ledger.InterestPaid = token.NewAmount(amountSum(ledger.InterestPaid, certificate.Interest))
+			} else {
+				ledger.DeductedFrom = token.NewAmount(amountSum(ledger.DeductedFrom, certificate.Withheld))
+				ledger.InterestEarned = token.NewAmount(amountSum(ledger.InterestEarned, certificate.Interest))
+				if certificate.Deductor == account {
+					continue
+				}
+			}
+			ledger.Certificates = append(ledger.Certificates, certificate)
+		}
+		iterator.Close()
+		read += metadata.GetFetchedRecordsCount()
+
+		// A full page leaves the rest of this index for the next call
+		if metadata.GetFetchedRecordsCount() == remaining && metadata.GetBookmark() != "" {
+			indexBookmark = metadata.GetBookmark()
+			continue
+		}
+		current++
+		indexBookmark = ""
+	}
+
+	sort.SliceStable(ledger.Certificates, func(i, j int) bool {
+		return ledger.Certificates[i].DeductedAt < ledger.Certificates[j].DeductedAt
+	})
+
+	return &ledger, nil
+}
+
+// Fails unless the withholding settings are usable
+func (c *LendingConfig) validateTDS() error {
+	if checkRate(c.TDSRate, 100) != nil {
+		return fmt.Errorf("TDS rate must be a decimal between 0 and 100")
+	}
+	if c.TDSRate.Rat().Sign() > 0 && c.TaxAccount == "" {
+		return fmt.Errorf("a tax account is required to withhold TDS")
+	}
+	return nil
+}
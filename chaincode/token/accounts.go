@@ -0,0 +1,381 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Registry entry of a token account. Balances stay under the account key,
+// the registry lets accounts be listed without knowing their IDs.
+type Account struct {
+	AccountID string            `json:"accountId"`
+	Type      string            `json:"type"`
+	OrgMSP    string            `json:"orgMsp"` // organization operating the account
+	Metadata  map[string]string `json:"metadata,omitempty" metadata:",optional"`
+	CreatedAt string            `json:"createdAt"`
+}
+
+// Account types. Only the issuer, operating the REGULATOR account, mints and
+// burns; the lending chaincode lets only BANK accounts lend and BORROWER
+// accounts borrow.
+const (
+	AccountBank      = "BANK"
+	AccountBorrower  = "BORROWER"
+	AccountRegulator = "REGULATOR"
+	AccountPlatform  = "PLATFORM"
+)
+
+type AccountSummary struct {
+	AccountID string `json:"accountId"`
+	Type      string `json:"type"`
+	Balance   Amount `json:"balance"`
+}
+
+type AccountPage struct {
+	Accounts []AccountSummary `json:"accounts"`
+	Bookmark string           `json:"bookmark"` // empty on the last page
+}
+
+// A registry entry with its balance, as exported
+type ExportedAccount struct {
+	AccountID string            `json:"accountId"`
+	Type      string            `json:"type"`
+	OrgMSP    string            `json:"orgMsp"`
+	Metadata  map[string]string `json:"metadata,omitempty" metadata:",optional"`
+	CreatedAt string            `json:"createdAt"`
+	Balance   Amount            `json:"balance"`
+}
+
+// A batch of exported accounts in account ID order, Cursor is the account ID
+// the next batch starts from, empty after the last
+type AccountExport struct {
+	Accounts []ExportedAccount `json:"accounts"`
+	Cursor   string            `json:"cursor"`
+}
+
+const accountObjectType = "account"
+
+// ============== Account Registry ==============
+
+// Onboard a token account with a zero balance, issuer only. An account holding
+// a balance from before the registry is registered with its balance kept.
+func (t *TokenContract) CreateAccount(
+	ctx contractapi.TransactionContextInterface,
+	accountID string,
+	accountType string,
+	orgMSP string,
+	metadata map[string]string,
+) error {
+	err := ClaimRequestID(ctx, "CreateAccount")
+	if err != nil {
+		return err
+	}
+
+	err = requireIssuer(ctx, "create accounts")
+	if err != nil {
+		return err
+	}
+
+	if accountID == "" {
+		return fmt.Errorf("account ID is required")
+	}
+	switch accountType {
+	case AccountBank, AccountBorrower, AccountRegulator, AccountPlatform:
+	default:
+		return fmt.Errorf("unknown account type %s", accountType)
+	}
+
+	existing, err := GetAccount(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("account %s already exists", accountID)
+	}
+
+	createdAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = putAccount(ctx, &Account{
+		AccountID: accountID,
+		Type:      accountType,
+		OrgMSP:    orgMSP,
+		Metadata:  metadata,
+		CreatedAt: createdAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	balanceJSON, err := ctx.GetStub().GetState(accountID)
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if balanceJSON != nil {
+		return nil
+	}
+
+	return setBalance(ctx, accountID, new(big.Rat))
+}
+
+// List token accounts with their balances, a page at a time
+func (t *TokenContract) GetAllAccounts(
+	ctx contractapi.TransactionContextInterface,
+	pageSize int32,
+	bookmark string,
+) (*AccountPage, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive")
+	}
+	bookmark, err := DecodeBookmark(bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(accountObjectType, []string{}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	page := AccountPage{Accounts: []AccountSummary{}}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var account Account
+		err = json.Unmarshal(entry.Value, &account)
+		if err != nil {
+			return nil, err
+		}
+
+		balance, err := BalanceOf(ctx, account.AccountID)
+		if err != nil {
+			return nil, err
+		}
+
+		page.Accounts = append(page.Accounts, AccountSummary{
+			AccountID: account.AccountID,
+			Type:      account.Type,
+			Balance:   NewAmount(balance),
+		})
+	}
+
+	if metadata.GetFetchedRecordsCount() >= pageSize {
+		page.Bookmark = EncodeBookmark(metadata.GetBookmark())
+	}
+	return &page, nil
+}
+
+// Balances of up to pageSize registered accounts in account ID order,
+// following the account ID bookmark, issuer only. Unlike GetAllAccounts it
+// can be called by transactions that write state: the peer refuses writes
+// after a paginated query, so accounts up to the bookmark are skipped by key.
+func (t *TokenContract) GetAccountBalances(
+	ctx contractapi.TransactionContextInterface,
+	pageSize int32,
+	bookmark string,
+) (*AccountPage, error) {
+	err := requireIssuer(ctx, "list all balances")
+	if err != nil {
+		return nil, err
+	}
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive")
+	}
+
+	after := ""
+	if bookmark != "" {
+		after, err = ctx.GetStub().CreateCompositeKey(accountObjectType, []string{bookmark})
+		if err != nil {
+			return nil, fmt.Errorf("invalid bookmark %s: %v", bookmark, err)
+		}
+	}
+
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(accountObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	page := AccountPage{Accounts: []AccountSummary{}}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if entry.Key <= after {
+			continue
+		}
+		if len(page.Accounts) == int(pageSize) {
+			page.Bookmark = page.Accounts[len(page.Accounts)-1].AccountID
+			break
+		}
+
+		var account Account
+		err = json.Unmarshal(entry.Value, &account)
+		if err != nil {
+			return nil, err
+		}
+
+		balance, err := BalanceOf(ctx, account.AccountID)
+		if err != nil {
+			return nil, err
+		}
+
+		page.Accounts = append(page.Accounts, AccountSummary{
+			AccountID: account.AccountID,
+			Type:      account.Type,
+			Balance:   NewAmount(balance),
+		})
+	}
+
+	return &page, nil
+}
+
+// Export up to limit registered accounts with their balances in account ID
+// order, starting from cursor, empty for the first batch. Reads the registry
+// by key range, so exports do not need rich queries.
+func (t *TokenContract) ExportAccounts(
+	ctx contractapi.TransactionContextInterface,
+	cursor string,
+	limit int32,
+) (*AccountExport, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be positive")
+	}
+
+	bookmark := ""
+	if cursor != "" {
+		key, err := ctx.GetStub().CreateCompositeKey(accountObjectType, []string{cursor})
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor %s: %v", cursor, err)
+		}
+		bookmark = key
+	}
+
+	iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(accountObjectType, []string{}, limit, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	export := AccountExport{Accounts: []ExportedAccount{}}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var account Account
+		err = json.Unmarshal(entry.Value, &account)
+		if err != nil {
+			return nil, err
+		}
+
+		balance, err := BalanceOf(ctx, account.AccountID)
+		if err != nil {
+			return nil, err
+		}
+
+		export.Accounts = append(export.Accounts, ExportedAccount{
+			AccountID: account.AccountID,
+			Type:      account.Type,
+			OrgMSP:    account.OrgMSP,
+			Metadata:  account.Metadata,
+			CreatedAt: account.CreatedAt,
+			Balance:   NewAmount(balance),
+		})
+	}
+
+	// The bookmark is the key of the next account
+	if metadata.GetFetchedRecordsCount() >= limit && metadata.GetBookmark() != "" {
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(metadata.GetBookmark())
+		if err != nil || len(keyParts) != 1 {
+			return nil, fmt.Errorf("invalid bookmark returned by the state database")
+		}
+		export.Cursor = keyParts[0]
+	}
+	return &export, nil
+}
+
+func (t *TokenContract) GetAccountInfo(
+	ctx contractapi.TransactionContextInterface,
+	accountID string,
+) (*Account, error) {
+	account, err := GetAccount(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return nil, fmt.Errorf("account %s does not exist", accountID)
+	}
+	return account, nil
+}
+
+// Registry entry of an account, nil if it was never created
+func GetAccount(
+	ctx contractapi.TransactionContextInterface,
+	accountID string,
+) (*Account, error) {
+	accountKey, err := ctx.GetStub().CreateCompositeKey(accountObjectType, []string{accountID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create account key: %v", err)
+	}
+
+	accountJSON, err := ctx.GetStub().GetState(accountKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if accountJSON == nil {
+		return nil, nil
+	}
+
+	var account Account
+	err = json.Unmarshal(accountJSON, &account)
+	if err != nil {
+		return nil, err
+	}
+
+	return &account, nil
+}
+
+func putAccount(
+	ctx contractapi.TransactionContextInterface,
+	account *Account,
+) error {
+	accountJSON, err := json.Marshal(account)
+	if err != nil {
+		return err
+	}
+
+	accountKey, err := ctx.GetStub().CreateCompositeKey(accountObjectType, []string{account.AccountID})
+	if err != nil {
+		return fmt.Errorf("failed to create account key: %v", err)
+	}
+
+	return ctx.GetStub().PutState(accountKey, accountJSON)
+}
+
+// Fails unless the account was onboarded, tokens are never credited to an
+// unknown account ID
+func requireAccount(
+	ctx contractapi.TransactionContextInterface,
+	accountID string,
+) error {
+	account, err := GetAccount(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	if account == nil {
+		return fmt.Errorf("account %s does not exist", accountID)
+	}
+	return nil
+}
@@ -0,0 +1,453 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Thresholds transfers are screened against. A transfer of at least the
+// threshold opens a case, as does a run of debits of an account each just
+// under it, from StructuringFloor up, within the structuring window.
+type AMLPolicy struct {
+	TransferThreshold      Amount `json:"transferThreshold"`  // zero disables threshold flags
+	RepaymentThreshold     Amount `json:"repaymentThreshold"` // for REPAYMENT transfers, zero uses TransferThreshold
+	StructuringFloor       Amount `json:"structuringFloor"`   // zero disables structuring flags
+	StructuringCount       int    `json:"structuringCount"`
+	StructuringWindowHours int    `json:"structuringWindowHours"`
+}
+
+// Suspicious activity flagged by the screening, queued for compliance review
+type AMLCase struct {
+	CaseID         string `json:"caseId"`
+	Rule           string `json:"rule"` // THRESHOLD, STRUCTURING
+	Account        string `json:"account"`
+	Counterparty   string `json:"counterparty"`
+	Amount         Amount `json:"amount"`
+	TransferReason string `json:"transferReason"`
+	LoanID         string `json:"loanId"`
+	Detail         string `json:"detail"`
+	TxID           string `json:"txId"`
+	OpenedAt       string `json:"openedAt"`
+	Status         string `json:"status"`                                     // OPEN, CLOSED
+	Disposition    string `json:"disposition,omitempty" metadata:",optional"` // REPORTED to the FIU or NO_ACTION
+	Notes          string `json:"notes,omitempty" metadata:",optional"`
+	ClosedBy       string `json:"closedBy,omitempty" metadata:",optional"`
+	ClosedAt       string `json:"closedAt,omitempty" metadata:",optional"`
+}
+
+type AMLCasePage struct {
+	Cases    []*AMLCase `json:"cases"`
+	Bookmark string     `json:"bookmark"` // empty on the last page
+}
+
+// Payload of AMLCase.v1, emitted when a case is closed for the bank's FIU
+// reporting pipeline. Opened cases ride along in the transfer's event.
+type AMLCaseEventV1 struct {
+	SchemaVersion int      `json:"schemaVersion"`
+	Case          *AMLCase `json:"case"`
+}
+
+// A debit counted towards structuring, kept until it leaves the window
+type amlDebit struct {
+	Amount  Amount `json:"amount"`
+	DebitAt string `json:"debitAt"`
+	TxID    string `json:"txId"`
+}
+
+const (
+	amlRuleThreshold   = "THRESHOLD"
+	amlRuleStructuring = "STRUCTURING"
+
+	amlDispositionReported = "REPORTED"
+	amlDispositionNoAction = "NO_ACTION"
+
+	// Certificate attribute value of compliance officers, role=compliance
+	complianceRole = "compliance"
+)
+
+const (
+	amlPolicyObjectType = "amlPolicy"
+	amlCaseObjectType   = "amlCase"
+	amlDebitObjectType  = "amlDebit"
+
+	// Index of cases by status, the open ones form the review queue
+	amlStatusCaseIndex = "status~amlcase"
+)
+
+func defaultAMLPolicy() AMLPolicy {
+	return AMLPolicy{
+		TransferThreshold:      "1000000.00",
+		StructuringFloor:       "800000.00",
+		StructuringCount:       3,
+		StructuringWindowHours: 24,
+	}
+}
+
+// ============== AML Screening ==============
+
+// Replace the screening thresholds, issuer only
+func (t *TokenContract) SetAMLPolicy(
+	ctx contractapi.TransactionContextInterface,
+	policyJSON string,
+) error {
+	err := ClaimRequestID(ctx, "SetAMLPolicy")
+	if err != nil {
+		return err
+	}
+
+	err = requireIssuer(ctx, "set the AML policy")
+	if err != nil {
+		return err
+	}
+
+	var policy AMLPolicy
+	err = json.Unmarshal([]byte(policyJSON), &policy)
+	if err != nil {
+		return fmt.Errorf("invalid AML policy: %v", err)
+	}
+	for _, amount := range []Amount{policy.TransferThreshold, policy.RepaymentThreshold, policy.StructuringFloor} {
+		if amount == "" {
+			continue
+		}
+		_, err = ParseAmount(string(amount))
+		if err != nil {
+			return fmt.Errorf("invalid AML policy: %v", err)
+		}
+	}
+
+	return putRecord(ctx, amlPolicyObjectType, []string{}, policy)
+}
+
+func (t *TokenContract) GetAMLPolicy(
+	ctx contractapi.TransactionContextInterface,
+) (*AMLPolicy, error) {
+	policy := defaultAMLPolicy()
+	_, err := getRecord(ctx, amlPolicyObjectType, []string{}, &policy)
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// Close a case after review as REPORTED to the FIU or NO_ACTION, compliance
+// officers only
+func (t *TokenContract) CloseAMLCase(
+	ctx contractapi.TransactionContextInterface,
+	caseID string,
+	disposition string,
+	notes string,
+) error {
+	err := ClaimRequestID(ctx, "CloseAMLCase")
+	if err != nil {
+		return err
+	}
+
+	closedBy, err := requireCompliance(ctx)
+	if err != nil {
+		return err
+	}
+	if disposition != amlDispositionReported && disposition != amlDispositionNoAction {
+		return fmt.Errorf("invalid disposition %s, must be %s or %s", disposition, amlDispositionReported, amlDispositionNoAction)
+	}
+
+	var amlCase AMLCase
+	exists, err := getRecord(ctx, amlCaseObjectType, []string{caseID}, &amlCase)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("AML case %s does not exist", caseID)
+	}
+	if amlCase.Status != "OPEN" {
+		return fmt.Errorf("AML case %s is already %s", caseID, amlCase.Status)
+	}
+
+	closedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = deleteAMLIndex(ctx, amlCase.Status, caseID)
+	if err != nil {
+		return err
+	}
+
+	amlCase.Status = "CLOSED"
+	amlCase.Disposition = disposition
+	amlCase.Notes = notes
+	amlCase.ClosedBy = closedBy
+	amlCase.ClosedAt = closedAt
+
+	err = putAMLCase(ctx, &amlCase)
+	if err != nil {
+		return err
+	}
+
+	eventJSON, err := json.Marshal(AMLCaseEventV1{SchemaVersion: 1, Case: &amlCase})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().SetEvent(EventAMLCase, eventJSON)
+}
+
+func (t *TokenContract) GetAMLCase(
+	ctx contractapi.TransactionContextInterface,
+	caseID string,
+) (*AMLCase, error) {
+	_, err := requireCompliance(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var amlCase AMLCase
+	exists, err := getRecord(ctx, amlCaseObjectType, []string{caseID}, &amlCase)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("AML case %s does not exist", caseID)
+	}
+	return &amlCase, nil
+}
+
+// List AML cases in a status, OPEN for the review queue, a page at a time.
+// Compliance officers only.
+func (t *TokenContract) GetAMLCases(
+	ctx contractapi.TransactionContextInterface,
+	status string,
+	pageSize int32,
+	bookmark string,
+) (*AMLCasePage, error) {
+	_, err := requireCompliance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive")
+	}
+	bookmark, err = DecodeBookmark(bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(amlStatusCaseIndex, []string{status}, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	page := AMLCasePage{Cases: []*AMLCase{}}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		var amlCase AMLCase
+		_, err = getRecord(ctx, amlCaseObjectType, []string{keyParts[1]}, &amlCase)
+		if err != nil {
+			return nil, err
+		}
+		page.Cases = append(page.Cases, &amlCase)
+	}
+
+	if metadata.GetFetchedRecordsCount() >= pageSize {
+		page.Bookmark = EncodeBookmark(metadata.GetBookmark())
+	}
+	return &page, nil
+}
+
+// Screens a transfer against the AML policy, returning the ID of the case it
+// opened or an empty string
+func screenTransfer(
+	ctx contractapi.TransactionContextInterface,
+	from string,
+	to string,
+	value *big.Rat,
+	reason string,
+	loanID string,
+) (string, error) {
+	policy := defaultAMLPolicy()
+	_, err := getRecord(ctx, amlPolicyObjectType, []string{}, &policy)
+	if err != nil {
+		return "", err
+	}
+
+	threshold := policy.TransferThreshold.Rat()
+	if reason == ReasonRepayment && policy.RepaymentThreshold.Rat().Sign() > 0 {
+		threshold = policy.RepaymentThreshold.Rat()
+	}
+
+	if threshold.Sign() > 0 && value.Cmp(threshold) >= 0 {
+		detail := fmt.Sprintf("%s of %s at or above the threshold of %s", reason, FormatAmount(value), FormatAmount(threshold))
+		return openAMLCase(ctx, amlRuleThreshold, from, to, value, reason, loanID, detail)
+	}
+
+	floor := policy.StructuringFloor.Rat()
+	if floor.Sign() == 0 || policy.StructuringCount <= 0 || value.Cmp(floor) < 0 {
+		return "", nil
+	}
+	return screenStructuring(ctx, &policy, from, to, value, reason, loanID)
+}
+
+// Counts the account's recent debits between the structuring floor and the
+// threshold, opening a case once the run reaches the configured count. The
+// debits counted by a case are cleared so the run starts over.
+func screenStructuring(
+	ctx contractapi.TransactionContextInterface,
+	policy *AMLPolicy,
+	from string,
+	to string,
+	value *big.Rat,
+	reason string,
+	loanID string,
+) (string, error) {
+	now, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return "", fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+	debitAt := time.Unix(now.GetSeconds(), 0).UTC()
+	windowStart := debitAt.Add(-time.Duration(policy.StructuringWindowHours) * time.Hour)
+
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(amlDebitObjectType, []string{from})
+	if err != nil {
+		return "", fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	inWindow := []string{}
+	total := new(big.Rat).Set(value)
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return "", err
+		}
+
+		var debit amlDebit
+		err = json.Unmarshal(entry.Value, &debit)
+		if err != nil {
+			return "", err
+		}
+		at, err := time.Parse(time.RFC3339, debit.DebitAt)
+		if err != nil {
+			return "", err
+		}
+
+		if at.Before(windowStart) {
+			err = ctx.GetStub().DelState(entry.Key)
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+		inWindow = append(inWindow, entry.Key)
+		total.Add(total, debit.Amount.Rat())
+	}
+
+	if len(inWindow)+1 < policy.StructuringCount {
+		return "", putRecord(ctx, amlDebitObjectType, []string{from, ctx.GetStub().GetTxID(), to}, amlDebit{
+			Amount:  NewAmount(value),
+			DebitAt: debitAt.Format(time.RFC3339),
+			TxID:    ctx.GetStub().GetTxID(),
+		})
+	}
+
+	for _, debitKey := range inWindow {
+		err = ctx.GetStub().DelState(debitKey)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	detail := fmt.Sprintf("%d debits totalling %s within %d hours, each under the threshold",
+		len(inWindow)+1, FormatAmount(total), policy.StructuringWindowHours)
+	return openAMLCase(ctx, amlRuleStructuring, from, to, value, reason, loanID, detail)
+}
+
+func openAMLCase(
+	ctx contractapi.TransactionContextInterface,
+	rule string,
+	from string,
+	to string,
+	value *big.Rat,
+	reason string,
+	loanID string,
+	detail string,
+) (string, error) {
+	openedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return "", err
+	}
+	sequence, err := nextRecord(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	amlCase := AMLCase{
+		CaseID:         fmt.Sprintf("%s:%s:%s:%d", ctx.GetStub().GetTxID(), from, to, sequence),
+		Rule:           rule,
+		Account:        from,
+		Counterparty:   to,
+		Amount:         NewAmount(value),
+		TransferReason: reason,
+		LoanID:         loanID,
+		Detail:         detail,
+		TxID:           ctx.GetStub().GetTxID(),
+		OpenedAt:       openedAt,
+		Status:         "OPEN",
+	}
+
+	return amlCase.CaseID, putAMLCase(ctx, &amlCase)
+}
+
+func putAMLCase(
+	ctx contractapi.TransactionContextInterface,
+	amlCase *AMLCase,
+) error {
+	err := putRecord(ctx, amlCaseObjectType, []string{amlCase.CaseID}, amlCase)
+	if err != nil {
+		return err
+	}
+
+	indexKey, err := ctx.GetStub().CreateCompositeKey(amlStatusCaseIndex, []string{amlCase.Status, amlCase.CaseID})
+	if err != nil {
+		return fmt.Errorf("failed to create index key: %v", err)
+	}
+	return ctx.GetStub().PutState(indexKey, []byte{0x00})
+}
+
+func deleteAMLIndex(
+	ctx contractapi.TransactionContextInterface,
+	status string,
+	caseID string,
+) error {
+	indexKey, err := ctx.GetStub().CreateCompositeKey(amlStatusCaseIndex, []string{status, caseID})
+	if err != nil {
+		return fmt.Errorf("failed to create index key: %v", err)
+	}
+	return ctx.GetStub().DelState(indexKey)
+}
+
+// Fails unless the caller's certificate carries role=compliance, returning
+// the caller's identity
+func requireCompliance(ctx contractapi.TransactionContextInterface) (string, error) {
+	err := ctx.GetClientIdentity().AssertAttributeValue("role", complianceRole)
+	if err != nil {
+		return "", fmt.Errorf("caller is not authorized, compliance role required: %v", err)
+	}
+
+	id, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to read client identity: %v", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,82 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// Token amounts are exact decimals with at most AmountScale places, one paisa.
+// Arithmetic is done on big.Rat so balances of any size add up exactly, and
+// amounts cross transaction boundaries as decimal strings.
+const AmountScale = 2
+
+// A decimal amount as stored and returned, "1500.25". Records written while
+// amounts were float64 hold JSON numbers, which still decode.
+type Amount string
+
+var amountPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// Parses a decimal amount parameter, rejecting more than AmountScale places
+func ParseAmount(amount string) (*big.Rat, error) {
+	if !amountPattern.MatchString(amount) {
+		return nil, fmt.Errorf("invalid amount %q, expected a decimal such as 1500.25", amount)
+	}
+	if dot := strings.IndexByte(amount, '.'); dot >= 0 && len(amount)-dot-1 > AmountScale {
+		return nil, fmt.Errorf("amount %s has more than %d decimal places", amount, AmountScale)
+	}
+
+	value, ok := new(big.Rat).SetString(amount)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount %q", amount)
+	}
+	return value, nil
+}
+
+// Formats an amount with exactly AmountScale decimal places
+func FormatAmount(amount *big.Rat) string {
+	return amount.FloatString(AmountScale)
+}
+
+// The amount as a big.Rat, zero when empty
+func (a Amount) Rat() *big.Rat {
+	value, ok := new(big.Rat).SetString(string(a))
+	if !ok {
+		return new(big.Rat)
+	}
+	return value
+}
+
+// Approximate float64 value, for the Amount of version 1 token events
+func (a Amount) Float64() float64 {
+	value, _ := a.Rat().Float64()
+	return value
+}
+
+func NewAmount(amount *big.Rat) Amount {
+	return Amount(FormatAmount(amount))
+}
+
+// Accepts the JSON string form as well as numbers of records written before
+// amounts were decimal strings
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var value string
+		err := json.Unmarshal(data, &value)
+		if err != nil {
+			return err
+		}
+		*a = Amount(value)
+		return nil
+	}
+
+	var number json.Number
+	err := json.Unmarshal(data, &number)
+	if err != nil {
+		return err
+	}
+	*a = Amount(number.String())
+	return nil
+}
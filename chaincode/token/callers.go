@@ -0,0 +1,245 @@
+package token
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// The chaincode allowed to move tokens as part of its own transactions, when
+// the token ledger runs as a chaincode of its own
+type LendingChaincode struct {
+	Name      string `json:"name"` // empty while no chaincode is allowed
+	UpdatedAt string `json:"updatedAt"`
+}
+
+// Standing authority of a chaincode to debit an account in transactions the
+// organization operating the account did not submit, such as the mandate
+// collections of a servicing batch or a subvention scheme paying a lender
+type DebitAuthority struct {
+	AccountID string `json:"accountId"`
+	Chaincode string `json:"chaincode"`
+	GrantedBy string `json:"grantedBy"` // MSP ID
+	GrantedAt string `json:"grantedAt"`
+}
+
+const (
+	lendingChaincodeObjectType = "lendingChaincode"
+	debitAuthorityObjectType   = "debitAuthority"
+)
+
+// ============== Chaincode Callers ==============
+
+// Set the chaincode whose transactions may move tokens through
+// TransferTokensWithReason, issuer only. Empty allows none.
+func (t *TokenContract) SetLendingChaincode(
+	ctx contractapi.TransactionContextInterface,
+	chaincodeName string,
+) error {
+	err := ClaimRequestID(ctx, "SetLendingChaincode")
+	if err != nil {
+		return err
+	}
+
+	err = requireIssuer(ctx, "set the lending chaincode")
+	if err != nil {
+		return err
+	}
+
+	updatedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	return putRecord(ctx, lendingChaincodeObjectType, []string{}, LendingChaincode{
+		Name:      chaincodeName,
+		UpdatedAt: updatedAt,
+	})
+}
+
+func (t *TokenContract) GetLendingChaincode(
+	ctx contractapi.TransactionContextInterface,
+) (*LendingChaincode, error) {
+	var lending LendingChaincode
+	_, err := getRecord(ctx, lendingChaincodeObjectType, []string{}, &lending)
+	if err != nil {
+		return nil, err
+	}
+	return &lending, nil
+}
+
+// Let a chaincode debit an account in transactions submitted by other
+// organizations, called by the organization operating the account
+func (t *TokenContract) GrantDebitAuthority(
+	ctx contractapi.TransactionContextInterface,
+	accountID string,
+	chaincodeName string,
+) error {
+	err := ClaimRequestID(ctx, "GrantDebitAuthority")
+	if err != nil {
+		return err
+	}
+
+	err = requireOperator(ctx, accountID)
+	if err != nil {
+		return err
+	}
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to read client MSP ID: %v", err)
+	}
+	grantedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+	return putRecord(ctx, debitAuthorityObjectType, []string{accountID, chaincodeName}, DebitAuthority{
+		AccountID: accountID,
+		Chaincode: chaincodeName,
+		GrantedBy: mspID,
+		GrantedAt: grantedAt,
+	})
+}
+
+// Withdraw a chaincode's authority to debit an account, called by the
+// organization operating the account
+func (t *TokenContract) RevokeDebitAuthority(
+	ctx contractapi.TransactionContextInterface,
+	accountID string,
+	chaincodeName string,
+) error {
+	err := ClaimRequestID(ctx, "RevokeDebitAuthority")
+	if err != nil {
+		return err
+	}
+
+	err = requireOperator(ctx, accountID)
+	if err != nil {
+		return err
+	}
+
+	exists, err := getRecord(ctx, debitAuthorityObjectType, []string{accountID, chaincodeName}, &DebitAuthority{})
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("chaincode %s has no authority to debit account %s", chaincodeName, accountID)
+	}
+
+	authorityKey, err := ctx.GetStub().CreateCompositeKey(debitAuthorityObjectType, []string{accountID, chaincodeName})
+	if err != nil {
+		return fmt.Errorf("failed to create record key: %v", err)
+	}
+	return ctx.GetStub().DelState(authorityKey)
+}
+
+// Fails unless a movement out of an account, requested by chaincode in a
+// transaction it runs, is authorized: chaincode must be the lending chaincode
+// and the caller must operate the account or the account must have granted
+// chaincode the authority to debit it
+func requireChaincodeDebit(
+	ctx contractapi.TransactionContextInterface,
+	chaincode string,
+	accountID string,
+) error {
+	err := requireLendingChaincode(ctx, chaincode)
+	if err != nil {
+		return err
+	}
+
+	if requireOperator(ctx, accountID) == nil {
+		return nil
+	}
+	exists, err := getRecord(ctx, debitAuthorityObjectType, []string{accountID, chaincode}, &DebitAuthority{})
+	if err != nil {
+		return err
+	}
+	if !exists {
+		mspID, err := ctx.GetClientIdentity().GetMSPID()
+		if err != nil {
+			return fmt.Errorf("failed to read client MSP ID: %v", err)
+		}
+		return fmt.Errorf("caller from %s does not operate account %s and chaincode %s has no authority to debit it", mspID, accountID, chaincode)
+	}
+	return nil
+}
+
+// Fails unless chaincode is the lending chaincode
+func requireLendingChaincode(
+	ctx contractapi.TransactionContextInterface,
+	chaincode string,
+) error {
+	var lending LendingChaincode
+	_, err := getRecord(ctx, lendingChaincodeObjectType, []string{}, &lending)
+	if err != nil {
+		return err
+	}
+	if lending.Name == "" || chaincode != lending.Name {
+		return fmt.Errorf("chaincode %s is not authorized to move tokens", chaincode)
+	}
+	return nil
+}
+
+// Chaincode calling function as part of its own transaction, which must be
+// the case for functions only the lending chaincode calls
+func lendingCaller(
+	ctx contractapi.TransactionContextInterface,
+	function string,
+) (string, error) {
+	chaincode, err := callingChaincode(ctx, function)
+	if err != nil {
+		return "", err
+	}
+	if chaincode == "" {
+		return "", fmt.Errorf("%s is called by the lending chaincode in its own transactions", function)
+	}
+	return chaincode, nil
+}
+
+// Chaincode that called function as part of its own transaction, from the
+// client's proposal: the chaincode the client invoked if it invoked another
+// function. Empty when function was invoked itself.
+func callingChaincode(
+	ctx contractapi.TransactionContextInterface,
+	function string,
+) (string, error) {
+	signedProposal, err := ctx.GetStub().GetSignedProposal()
+	if err != nil {
+		return "", fmt.Errorf("failed to read the signed proposal: %v", err)
+	}
+	if signedProposal == nil {
+		return "", nil
+	}
+
+	var proposal peer.Proposal
+	err = proto.Unmarshal(signedProposal.GetProposalBytes(), &proposal)
+	if err != nil {
+		return "", fmt.Errorf("invalid proposal: %v", err)
+	}
+	var payload peer.ChaincodeProposalPayload
+	err = proto.Unmarshal(proposal.GetPayload(), &payload)
+	if err != nil {
+		return "", fmt.Errorf("invalid proposal payload: %v", err)
+	}
+	var invocation peer.ChaincodeInvocationSpec
+	err = proto.Unmarshal(payload.GetInput(), &invocation)
+	if err != nil {
+		return "", fmt.Errorf("invalid chaincode invocation: %v", err)
+	}
+
+	args := invocation.GetChaincodeSpec().GetInput().GetArgs()
+	if len(args) == 0 {
+		return "", fmt.Errorf("proposal invokes no function")
+	}
+	// Functions may be named with their contract, "TokenContract:Transfer"
+	invoked := string(args[0])
+	if colon := strings.LastIndexByte(invoked, ':'); colon >= 0 {
+		invoked = invoked[colon+1:]
+	}
+	if invoked == function {
+		return "", nil
+	}
+	return invocation.GetChaincodeSpec().GetChaincodeId().GetName(), nil
+}
@@ -0,0 +1,180 @@
+package token
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/internal/mockstub"
+)
+
+// TransferTokensWithReason invoked by a client needs the operator of the from
+// account. Called by a chaincode, that chaincode must be the lending
+// chaincode and the caller must operate the account or the account must have
+// granted it the authority to debit it.
+func TestTransferTokensWithReason(t *testing.T) {
+	tests := []struct {
+		name      string
+		lending   string // chaincode set by SetLendingChaincode
+		granted   string // chaincode HDFC granted debit authority to
+		chaincode string // chaincode the client invoked, empty to invoke the token chaincode
+		caller    mockstub.Identity
+		wantErr   string
+	}{
+		{"invoked by the operator", "lending", "", "", hdfc, ""},
+		{"invoked by another bank", "lending", "", "", sbi, "does not operate account HDFC"},
+		{"lending transaction of the operator", "lending", "", "lending", hdfc, ""},
+		{"lending transaction of another organization", "lending", "", "lending", issuer, "has no authority to debit it"},
+		{"lending transaction with debit authority", "lending", "lending", "lending", issuer, ""},
+		{"other chaincode", "lending", "", "rogue", hdfc, "chaincode rogue is not authorized"},
+		{"other chaincode with debit authority", "lending", "rogue", "rogue", hdfc, "chaincode rogue is not authorized"},
+		{"no lending chaincode", "", "", "lending", hdfc, "chaincode lending is not authorized"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLedger(t)
+			if tt.lending != "" {
+				l.must(issuer, func(ctx contractapi.TransactionContextInterface) error {
+					return l.contract.SetLendingChaincode(ctx, tt.lending)
+				})
+			}
+			if tt.granted != "" {
+				l.must(hdfc, func(ctx contractapi.TransactionContextInterface) error {
+					return l.contract.GrantDebitAuthority(ctx, "HDFC", tt.granted)
+				})
+			}
+
+			function := "TransferTokensWithReason"
+			if tt.chaincode != "" {
+				function = "SmartContract:DisburseLoan"
+			} else {
+				tt.chaincode = "token"
+			}
+			l.stub.Proposal = mockstub.NewProposal(tt.chaincode, function)
+			err := l.submit(tt.caller, func(ctx contractapi.TransactionContextInterface) error {
+				return l.contract.TransferTokensWithReason(ctx, "HDFC", "SBI", "100", ReasonDisbursement, "L1", "")
+			})
+			l.stub.Proposal = nil
+
+			want := "499900.00"
+			if tt.wantErr != "" {
+				want = "500000.00"
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			l.must(issuer, func(ctx contractapi.TransactionContextInterface) error {
+				balance, err := l.contract.GetBalance(ctx, "HDFC")
+				if err == nil && balance != want {
+					t.Errorf("balance of HDFC = %s, want %s", balance, want)
+				}
+				return err
+			})
+		})
+	}
+}
+
+// Only the organization operating an account grants or revokes the authority
+// to debit it
+func TestDebitAuthority(t *testing.T) {
+	l := newTestLedger(t)
+
+	err := l.submit(sbi, func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.GrantDebitAuthority(ctx, "HDFC", "lending")
+	})
+	if err == nil || !strings.Contains(err.Error(), "does not operate account HDFC") {
+		t.Fatalf("grant by another bank: error = %v", err)
+	}
+
+	l.must(hdfc, func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.GrantDebitAuthority(ctx, "HDFC", "lending")
+	})
+	err = l.submit(sbi, func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.RevokeDebitAuthority(ctx, "HDFC", "lending")
+	})
+	if err == nil || !strings.Contains(err.Error(), "does not operate account HDFC") {
+		t.Fatalf("revocation by another bank: error = %v", err)
+	}
+	l.must(hdfc, func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.RevokeDebitAuthority(ctx, "HDFC", "lending")
+	})
+
+	err = l.submit(hdfc, func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.RevokeDebitAuthority(ctx, "HDFC", "lending")
+	})
+	if err == nil || !strings.Contains(err.Error(), "has no authority to debit account HDFC") {
+		t.Fatalf("second revocation: error = %v", err)
+	}
+}
+
+// Earmarks are placed, drawn and released only by the lending chaincode in
+// its own transactions, and placing one needs the authority to debit the
+// account
+func TestEarmarkCallers(t *testing.T) {
+	tests := []struct {
+		name      string
+		chaincode string // chaincode the client invoked, empty to invoke the token chaincode
+		caller    mockstub.Identity
+		wantErr   string
+	}{
+		{"invoked by the operator", "", hdfc, "PlaceEarmark is called by the lending chaincode"},
+		{"lending transaction of the operator", "lending", hdfc, ""},
+		{"lending transaction of another organization", "lending", sbi, "has no authority to debit it"},
+		{"other chaincode", "rogue", hdfc, "chaincode rogue is not authorized"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLedger(t)
+			l.must(issuer, func(ctx contractapi.TransactionContextInterface) error {
+				return l.contract.SetLendingChaincode(ctx, "lending")
+			})
+
+			function := "PlaceEarmark"
+			if tt.chaincode != "" {
+				function = "SmartContract:ApproveLoan"
+			} else {
+				tt.chaincode = "token"
+			}
+			l.stub.Proposal = mockstub.NewProposal(tt.chaincode, function)
+			defer func() { l.stub.Proposal = nil }()
+			err := l.submit(tt.caller, func(ctx contractapi.TransactionContextInterface) error {
+				return l.contract.PlaceEarmark(ctx, "HDFC", "loan:L1", "100")
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Spending the earmark is for lending transactions naming it
+			l.stub.Proposal = mockstub.NewProposal("token", "TransferTokensWithReason")
+			err = l.submit(hdfc, func(ctx contractapi.TransactionContextInterface) error {
+				return l.contract.TransferTokensWithReason(ctx, "HDFC", "SBI", "100", ReasonDisbursement, "L1", "loan:L1")
+			})
+			if err == nil || !strings.Contains(err.Error(), "earmarks are spent only by lending transactions") {
+				t.Fatalf("direct transfer spending the earmark: error = %v", err)
+			}
+
+			l.stub.Proposal = mockstub.NewProposal("lending", "SmartContract:ExpireApprovals")
+			l.must(sbi, func(ctx contractapi.TransactionContextInterface) error {
+				return l.contract.ReleaseEarmark(ctx, "HDFC", "loan:L1")
+			})
+			l.must(issuer, func(ctx contractapi.TransactionContextInterface) error {
+				available, err := l.contract.GetAvailableBalance(ctx, "HDFC")
+				if err == nil && available != "500000.00" {
+					t.Errorf("available balance of HDFC = %s, want 500000.00", available)
+				}
+				return err
+			})
+		})
+	}
+}
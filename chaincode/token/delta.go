@@ -0,0 +1,129 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// A balance change written by one transaction. Changes are stored under their
+// own keys instead of rewriting the account's balance, so concurrent
+// transactions crediting the same bank account do not conflict at validation.
+// The balance of an account is its base record plus all of its deltas.
+//
+// Debits still conflict: a debit checks the sender's balance, a range read of
+// its deltas, so it fails validation if another transaction committed a delta
+// of the sender in the meantime. Debits of one account are serialized, and
+// PruneBalance keeps the read short.
+type BalanceDelta struct {
+	Account string `json:"account"`
+	Amount  Amount `json:"amount"` // negative for debits
+	TxID    string `json:"txId"`
+}
+
+// Deltas are keyed by account, transaction and their sequence number in the
+// transaction
+const balanceDeltaObjectType = "balance~delta"
+
+// ============== Balance Deltas ==============
+
+// Fold an account's deltas into its base balance, keeping range reads of
+// GetBalance short on busy accounts
+func (t *TokenContract) PruneBalance(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+) (string, error) {
+	err := ClaimRequestID(ctx, "PruneBalance")
+	if err != nil {
+		return "", err
+	}
+
+	balance, err := BalanceOf(ctx, account)
+	if err != nil {
+		return "", err
+	}
+
+	err = setBalance(ctx, account, balance)
+	if err != nil {
+		return "", err
+	}
+
+	return FormatAmount(balance), nil
+}
+
+// Records a balance change and its statement entry
+func addDelta(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+	counterparty string,
+	amount *big.Rat,
+	reason string,
+	reference string,
+) error {
+	sequence, err := nextRecord(ctx)
+	if err != nil {
+		return err
+	}
+	if amount.Sign() > 0 {
+		err := requireAccount(ctx, account)
+		if err != nil {
+			return err
+		}
+	}
+
+	deltaJSON, err := json.Marshal(BalanceDelta{
+		Account: account,
+		Amount:  NewAmount(amount),
+		TxID:    ctx.GetStub().GetTxID(),
+	})
+	if err != nil {
+		return err
+	}
+
+	deltaKey, err := ctx.GetStub().CreateCompositeKey(balanceDeltaObjectType,
+		[]string{account, ctx.GetStub().GetTxID(), strconv.Itoa(sequence)})
+	if err != nil {
+		return fmt.Errorf("failed to create delta key: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(deltaKey, deltaJSON)
+	if err != nil {
+		return err
+	}
+
+	return putAccountMovement(ctx, account, counterparty, amount, reason, reference)
+}
+
+// Sums an account's deltas, returning their keys so they can be pruned
+func sumDeltas(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+) (*big.Rat, []string, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(balanceDeltaObjectType, []string{account})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	total := new(big.Rat)
+	keys := []string{}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var delta BalanceDelta
+		err = json.Unmarshal(entry.Value, &delta)
+		if err != nil {
+			return nil, nil, err
+		}
+		total.Add(total, delta.Amount.Rat())
+		keys = append(keys, entry.Key)
+	}
+
+	return total, keys, nil
+}
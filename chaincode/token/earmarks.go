@@ -0,0 +1,304 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Part of an account's balance set aside for a reference, such as a loan the
+// lender approved. Earmarked tokens stay in the account but cannot be spent
+// until the earmark is released, except by movements consuming it.
+type Earmark struct {
+	Account   string `json:"account"`
+	Reference string `json:"reference"`
+	Amount    Amount `json:"amount"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// Earmarks are stored under their account and reference
+const earmarkObjectType = "earmark"
+
+// ============== Earmarks ==============
+
+// Balance of an account less its earmarks
+func (t *TokenContract) GetAvailableBalance(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+) (string, error) {
+	available, err := AvailableBalance(ctx, account)
+	if err != nil {
+		return "", err
+	}
+	return FormatAmount(available), nil
+}
+
+// Spendable part of an account's balance, its balance less its earmarks other
+// than the consumed ones
+func AvailableBalance(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+	consumed ...string,
+) (*big.Rat, error) {
+	balance, err := BalanceOf(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(earmarkObjectType, []string{account})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var earmark Earmark
+		err = json.Unmarshal(entry.Value, &earmark)
+		if err != nil {
+			return nil, err
+		}
+		if contains(consumed, earmark.Reference) {
+			continue
+		}
+		balance.Sub(balance, earmark.Amount.Rat())
+	}
+
+	return balance, nil
+}
+
+// Sets aside part of an account's available balance for a reference
+func PlaceEarmark(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+	reference string,
+	value *big.Rat,
+) error {
+	if value.Sign() <= 0 {
+		return fmt.Errorf("earmark amount must be positive")
+	}
+	exists, err := getRecord(ctx, earmarkObjectType, []string{account, reference}, &Earmark{})
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("account %s already has an earmark for %s", account, reference)
+	}
+
+	available, err := AvailableBalance(ctx, account)
+	if err != nil {
+		return err
+	}
+	if available.Cmp(value) < 0 {
+		return fmt.Errorf("insufficient available funds in account %s", account)
+	}
+
+	createdAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	return putRecord(ctx, earmarkObjectType, []string{account, reference}, Earmark{
+		Account:   account,
+		Reference: reference,
+		Amount:    NewAmount(value),
+		CreatedAt: createdAt,
+	})
+}
+
+// Adds to the earmark of an account for a reference, placing it if there is
+// none. The earmarked total is returned.
+func IncreaseEarmark(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+	reference string,
+	value *big.Rat,
+) (*big.Rat, error) {
+	if value.Sign() <= 0 {
+		return nil, fmt.Errorf("earmark amount must be positive")
+	}
+	var earmark Earmark
+	exists, err := getRecord(ctx, earmarkObjectType, []string{account, reference}, &earmark)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return value, PlaceEarmark(ctx, account, reference, value)
+	}
+
+	available, err := AvailableBalance(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	if available.Cmp(value) < 0 {
+		return nil, fmt.Errorf("insufficient available funds in account %s", account)
+	}
+
+	total := new(big.Rat).Add(earmark.Amount.Rat(), value)
+	earmark.Amount = NewAmount(total)
+	return total, putRecord(ctx, earmarkObjectType, []string{account, reference}, earmark)
+}
+
+// Returns an earmarked amount to the account's available balance. Movements
+// consuming the earmark in the same transaction must still name it, as
+// Fabric reads do not see the transaction's own writes.
+func ReleaseEarmark(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+	reference string,
+) error {
+	exists, err := getRecord(ctx, earmarkObjectType, []string{account, reference}, &Earmark{})
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("account %s has no earmark for %s", account, reference)
+	}
+
+	earmarkKey, err := ctx.GetStub().CreateCompositeKey(earmarkObjectType, []string{account, reference})
+	if err != nil {
+		return fmt.Errorf("failed to create record key: %v", err)
+	}
+	return ctx.GetStub().DelState(earmarkKey)
+}
+
+// Spends part of an earmark, removing it once drawn in full. The remaining
+// earmarked amount is returned. As with a release, movements spending the
+// drawn funds in the same transaction must name the earmark as consumed.
+func DrawEarmark(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+	reference string,
+	value *big.Rat,
+) (*big.Rat, error) {
+	var earmark Earmark
+	exists, err := getRecord(ctx, earmarkObjectType, []string{account, reference}, &earmark)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("account %s has no earmark for %s", account, reference)
+	}
+
+	remaining := new(big.Rat).Sub(earmark.Amount.Rat(), value)
+	if remaining.Sign() > 0 {
+		earmark.Amount = NewAmount(remaining)
+		return remaining, putRecord(ctx, earmarkObjectType, []string{account, reference}, earmark)
+	}
+
+	earmarkKey, err := ctx.GetStub().CreateCompositeKey(earmarkObjectType, []string{account, reference})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create record key: %v", err)
+	}
+	return new(big.Rat), ctx.GetStub().DelState(earmarkKey)
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ============== Earmarks of Lending Transactions ==============
+
+// Earmark part of an account's available balance for a reference, called by
+// the lending chaincode in its own transactions when the token ledger runs as
+// a chaincode of its own. The caller must be allowed to debit the account,
+// see requireChaincodeDebit.
+func (t *TokenContract) PlaceEarmark(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+	reference string,
+	amount string,
+) error {
+	value, err := authorizeEarmark(ctx, "PlaceEarmark", account, amount)
+	if err != nil {
+		return err
+	}
+	return PlaceEarmark(ctx, account, reference, value)
+}
+
+// Add to the earmark of an account for a reference, as PlaceEarmark. The
+// earmarked total is returned.
+func (t *TokenContract) IncreaseEarmark(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+	reference string,
+	amount string,
+) (string, error) {
+	value, err := authorizeEarmark(ctx, "IncreaseEarmark", account, amount)
+	if err != nil {
+		return "", err
+	}
+	total, err := IncreaseEarmark(ctx, account, reference, value)
+	if err != nil {
+		return "", err
+	}
+	return FormatAmount(total), nil
+}
+
+// Spend part of the earmark of an account for a reference, as PlaceEarmark.
+// The remaining earmarked amount is returned.
+func (t *TokenContract) DrawEarmark(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+	reference string,
+	amount string,
+) (string, error) {
+	value, err := authorizeEarmark(ctx, "DrawEarmark", account, amount)
+	if err != nil {
+		return "", err
+	}
+	remaining, err := DrawEarmark(ctx, account, reference, value)
+	if err != nil {
+		return "", err
+	}
+	return FormatAmount(remaining), nil
+}
+
+// Return the earmark of an account for a reference to its available balance,
+// called by the lending chaincode in its own transactions. Releasing debits
+// nothing, any transaction of the lending chaincode may release its earmarks.
+func (t *TokenContract) ReleaseEarmark(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+	reference string,
+) error {
+	chaincode, err := lendingCaller(ctx, "ReleaseEarmark")
+	if err != nil {
+		return err
+	}
+	err = requireLendingChaincode(ctx, chaincode)
+	if err != nil {
+		return err
+	}
+	return ReleaseEarmark(ctx, account, reference)
+}
+
+// Authorizes an earmark on account requested by the lending chaincode and
+// parses its amount
+func authorizeEarmark(
+	ctx contractapi.TransactionContextInterface,
+	function string,
+	account string,
+	amount string,
+) (*big.Rat, error) {
+	chaincode, err := lendingCaller(ctx, function)
+	if err != nil {
+		return nil, err
+	}
+	err = requireChaincodeDebit(ctx, chaincode, account)
+	if err != nil {
+		return nil, err
+	}
+	return ParseAmount(amount)
+}
@@ -0,0 +1,327 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Tokens locked by a payer for a payee. Locked tokens leave the payer's
+// balance and belong to no account until the escrow is released or refunded.
+type Escrow struct {
+	EscrowID   string `json:"escrowId"`
+	Payer      string `json:"payer"`
+	Payee      string `json:"payee"`
+	Amount     Amount `json:"amount"`
+	ArbiterMSP string `json:"arbiterMsp"` // organization that may settle disputes, empty for none
+	Reference  string `json:"reference"`  // loan, settlement or auction the funds are held for
+	Status     string `json:"status"`     // LOCKED, RELEASED, REFUNDED
+	ReleasedTo string `json:"releasedTo"`
+	CreatedAt  string `json:"createdAt"`
+	ClosedAt   string `json:"closedAt"`
+}
+
+const escrowObjectType = "escrow"
+
+// ============== Escrow ==============
+
+// Lock tokens of the payer for the payee, called by the payer's organization
+func (t *TokenContract) LockFunds(
+	ctx contractapi.TransactionContextInterface,
+	escrowID string,
+	payer string,
+	payee string,
+	amount string,
+	arbiterMSP string,
+	reference string,
+) error {
+	err := ClaimRequestID(ctx, "LockFunds")
+	if err != nil {
+		return err
+	}
+
+	value, err := ParseAmount(amount)
+	if err != nil {
+		return err
+	}
+	if value.Sign() <= 0 {
+		return fmt.Errorf("escrow amount must be positive")
+	}
+
+	existing, err := getEscrow(ctx, escrowID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("escrow %s already exists", escrowID)
+	}
+
+	err = requireOperator(ctx, payer)
+	if err != nil {
+		return err
+	}
+	err = requireAccount(ctx, payee)
+	if err != nil {
+		return err
+	}
+	err = ScreenParties(ctx, payer, payee)
+	if err != nil {
+		return err
+	}
+
+	balance, err := AvailableBalance(ctx, payer)
+	if err != nil {
+		return err
+	}
+	if balance.Cmp(value) < 0 {
+		return fmt.Errorf("insufficient funds in account %s", payer)
+	}
+
+	err = addDelta(ctx, payer, escrowObjectType+":"+escrowID, new(big.Rat).Neg(value), "LOCK", reference)
+	if err != nil {
+		return err
+	}
+
+	createdAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	escrow := Escrow{
+		EscrowID:   escrowID,
+		Payer:      payer,
+		Payee:      payee,
+		Amount:     NewAmount(value),
+		ArbiterMSP: arbiterMSP,
+		Reference:  reference,
+		Status:     "LOCKED",
+		CreatedAt:  createdAt,
+	}
+	err = putEscrow(ctx, &escrow)
+	if err != nil {
+		return err
+	}
+
+	return emitEscrowEvent(ctx, "LOCK", &escrow, payer, "")
+}
+
+// Pay out a locked escrow. The payer's organization may release to the payee,
+// the arbiter to either counterparty.
+func (t *TokenContract) ReleaseFunds(
+	ctx contractapi.TransactionContextInterface,
+	escrowID string,
+	to string,
+) error {
+	err := ClaimRequestID(ctx, "ReleaseFunds")
+	if err != nil {
+		return err
+	}
+
+	escrow, err := lockedEscrow(ctx, escrowID)
+	if err != nil {
+		return err
+	}
+
+	isArbiter, err := callerIsArbiter(ctx, escrow)
+	if err != nil {
+		return err
+	}
+	switch {
+	case isArbiter && (to == escrow.Payee || to == escrow.Payer):
+	case to == escrow.Payee:
+		err = requireOperator(ctx, escrow.Payer)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("escrow %s cannot be released to %s", escrowID, to)
+	}
+
+	err = ScreenParties(ctx, to)
+	if err != nil {
+		return err
+	}
+
+	return closeEscrow(ctx, escrow, to, "RELEASED", "RELEASE")
+}
+
+// Return a locked escrow to the payer, called by the payee's organization or the arbiter
+func (t *TokenContract) RefundFunds(
+	ctx contractapi.TransactionContextInterface,
+	escrowID string,
+) error {
+	err := ClaimRequestID(ctx, "RefundFunds")
+	if err != nil {
+		return err
+	}
+
+	escrow, err := lockedEscrow(ctx, escrowID)
+	if err != nil {
+		return err
+	}
+
+	isArbiter, err := callerIsArbiter(ctx, escrow)
+	if err != nil {
+		return err
+	}
+	if !isArbiter {
+		err = requireOperator(ctx, escrow.Payee)
+		if err != nil {
+			return err
+		}
+	}
+
+	return closeEscrow(ctx, escrow, escrow.Payer, "REFUNDED", "REFUND")
+}
+
+func (t *TokenContract) GetEscrow(
+	ctx contractapi.TransactionContextInterface,
+	escrowID string,
+) (*Escrow, error) {
+	escrow, err := getEscrow(ctx, escrowID)
+	if err != nil {
+		return nil, err
+	}
+	if escrow == nil {
+		return nil, fmt.Errorf("escrow %s does not exist", escrowID)
+	}
+	return escrow, nil
+}
+
+func closeEscrow(
+	ctx contractapi.TransactionContextInterface,
+	escrow *Escrow,
+	to string,
+	status string,
+	movement string,
+) error {
+	err := addDelta(ctx, to, escrowObjectType+":"+escrow.EscrowID, escrow.Amount.Rat(), movement, escrow.Reference)
+	if err != nil {
+		return err
+	}
+
+	closedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	escrow.Status = status
+	escrow.ReleasedTo = to
+	escrow.ClosedAt = closedAt
+	err = putEscrow(ctx, escrow)
+	if err != nil {
+		return err
+	}
+
+	return emitEscrowEvent(ctx, movement, escrow, "", to)
+}
+
+func lockedEscrow(
+	ctx contractapi.TransactionContextInterface,
+	escrowID string,
+) (*Escrow, error) {
+	escrow, err := getEscrow(ctx, escrowID)
+	if err != nil {
+		return nil, err
+	}
+	if escrow == nil {
+		return nil, fmt.Errorf("escrow %s does not exist", escrowID)
+	}
+	if escrow.Status != "LOCKED" {
+		return nil, fmt.Errorf("escrow %s is already %s", escrowID, escrow.Status)
+	}
+	return escrow, nil
+}
+
+func callerIsArbiter(ctx contractapi.TransactionContextInterface, escrow *Escrow) (bool, error) {
+	if escrow.ArbiterMSP == "" {
+		return false, nil
+	}
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return false, fmt.Errorf("failed to read client MSP ID: %v", err)
+	}
+	return mspID == escrow.ArbiterMSP, nil
+}
+
+// Fails unless the caller belongs to the organization operating the account
+func requireOperator(
+	ctx contractapi.TransactionContextInterface,
+	accountID string,
+) error {
+	account, err := GetAccount(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	if account == nil {
+		return fmt.Errorf("account %s does not exist", accountID)
+	}
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to read client MSP ID: %v", err)
+	}
+	if account.OrgMSP != mspID {
+		return fmt.Errorf("caller from %s does not operate account %s", mspID, accountID)
+	}
+	return nil
+}
+
+func getEscrow(
+	ctx contractapi.TransactionContextInterface,
+	escrowID string,
+) (*Escrow, error) {
+	escrowKey, err := ctx.GetStub().CreateCompositeKey(escrowObjectType, []string{escrowID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create escrow key: %v", err)
+	}
+
+	escrowJSON, err := ctx.GetStub().GetState(escrowKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if escrowJSON == nil {
+		return nil, nil
+	}
+
+	var escrow Escrow
+	err = json.Unmarshal(escrowJSON, &escrow)
+	if err != nil {
+		return nil, err
+	}
+
+	return &escrow, nil
+}
+
+func putEscrow(
+	ctx contractapi.TransactionContextInterface,
+	escrow *Escrow,
+) error {
+	escrowJSON, err := json.Marshal(escrow)
+	if err != nil {
+		return err
+	}
+
+	escrowKey, err := ctx.GetStub().CreateCompositeKey(escrowObjectType, []string{escrow.EscrowID})
+	if err != nil {
+		return fmt.Errorf("failed to create escrow key: %v", err)
+	}
+
+	return ctx.GetStub().PutState(escrowKey, escrowJSON)
+}
+
+func emitEscrowEvent(
+	ctx contractapi.TransactionContextInterface,
+	movement string,
+	escrow *Escrow,
+	from string,
+	to string,
+) error {
+	event, err := NewTokenEvent(ctx, movement, from, to, escrow.Amount.Rat(), escrowObjectType+":"+escrow.EscrowID, "")
+	if err != nil {
+		return err
+	}
+	return emitTokenEvent(ctx, EventEscrow, event)
+}
@@ -0,0 +1,236 @@
+package token
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Funds of an account held for a reference, such as an auction bid, a
+// settlement offer or a margin posting, until they are captured by a payee or
+// released. Held funds stay in the account as an earmark, so concurrent holds
+// and transfers conflict at validation instead of overspending it.
+type Hold struct {
+	Reference  string `json:"reference"`
+	Account    string `json:"account"`
+	Amount     Amount `json:"amount"`
+	Status     string `json:"status"` // HELD, CAPTURED, RELEASED
+	CreatedAt  string `json:"createdAt"`
+	CapturedTo string `json:"capturedTo,omitempty" metadata:",optional"`
+	ClosedAt   string `json:"closedAt,omitempty" metadata:",optional"`
+}
+
+// Holds are stored under their reference, the earmark under the account and
+// the reference prefixed so it cannot collide with a loan reservation
+const holdObjectType = "hold"
+
+// Hold statuses
+const (
+	holdHeld     = "HELD"
+	holdCaptured = "CAPTURED"
+	holdReleased = "RELEASED"
+)
+
+// ============== Holds ==============
+
+// Hold amount of an account's available balance for ref, called by the
+// organization operating the account
+func (t *TokenContract) HoldFunds(
+	ctx contractapi.TransactionContextInterface,
+	from string,
+	amount string,
+	ref string,
+) error {
+	err := ClaimRequestID(ctx, "HoldFunds")
+	if err != nil {
+		return err
+	}
+
+	value, err := ParseAmount(amount)
+	if err != nil {
+		return err
+	}
+	if value.Sign() <= 0 {
+		return fmt.Errorf("hold amount must be positive")
+	}
+
+	exists, err := getRecord(ctx, holdObjectType, []string{ref}, &Hold{})
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("hold %s already exists", ref)
+	}
+
+	err = requireOperator(ctx, from)
+	if err != nil {
+		return err
+	}
+	err = ScreenParties(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	err = PlaceEarmark(ctx, from, holdReference(ref), value)
+	if err != nil {
+		return err
+	}
+
+	createdAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	hold := Hold{
+		Reference: ref,
+		Account:   from,
+		Amount:    NewAmount(value),
+		Status:    holdHeld,
+		CreatedAt: createdAt,
+	}
+	err = putRecord(ctx, holdObjectType, []string{ref}, hold)
+	if err != nil {
+		return err
+	}
+
+	return emitHoldEvent(ctx, "HOLD", &hold)
+}
+
+// Settle a hold in full to the payee, called by the organization operating
+// the held account. The movement is a SETTLEMENT transfer referencing the hold.
+func (t *TokenContract) CaptureHold(
+	ctx contractapi.TransactionContextInterface,
+	ref string,
+	to string,
+) error {
+	err := ClaimRequestID(ctx, "CaptureHold")
+	if err != nil {
+		return err
+	}
+
+	hold, err := heldFunds(ctx, ref)
+	if err != nil {
+		return err
+	}
+	err = requireOperator(ctx, hold.Account)
+	if err != nil {
+		return err
+	}
+
+	event, err := Transfer(ctx, hold.Account, to, hold.Amount.Rat(), ReasonSettlement, ref, holdReference(ref))
+	if err != nil {
+		return err
+	}
+	err = ReleaseEarmark(ctx, hold.Account, holdReference(ref))
+	if err != nil {
+		return err
+	}
+
+	closedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	hold.Status = holdCaptured
+	hold.CapturedTo = to
+	hold.ClosedAt = closedAt
+	err = putRecord(ctx, holdObjectType, []string{ref}, hold)
+	if err != nil {
+		return err
+	}
+
+	return emitTokenEvent(ctx, EventTransfer, event)
+}
+
+// Return a hold to the account's available balance, called by the
+// organization operating the held account
+func (t *TokenContract) ReleaseHold(
+	ctx contractapi.TransactionContextInterface,
+	ref string,
+) error {
+	err := ClaimRequestID(ctx, "ReleaseHold")
+	if err != nil {
+		return err
+	}
+
+	hold, err := heldFunds(ctx, ref)
+	if err != nil {
+		return err
+	}
+	err = requireOperator(ctx, hold.Account)
+	if err != nil {
+		return err
+	}
+
+	err = ReleaseEarmark(ctx, hold.Account, holdReference(ref))
+	if err != nil {
+		return err
+	}
+
+	closedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	hold.Status = holdReleased
+	hold.ClosedAt = closedAt
+	err = putRecord(ctx, holdObjectType, []string{ref}, hold)
+	if err != nil {
+		return err
+	}
+
+	return emitHoldEvent(ctx, "RELEASE", hold)
+}
+
+func (t *TokenContract) GetHold(
+	ctx contractapi.TransactionContextInterface,
+	ref string,
+) (*Hold, error) {
+	return getHold(ctx, ref)
+}
+
+func getHold(
+	ctx contractapi.TransactionContextInterface,
+	ref string,
+) (*Hold, error) {
+	var hold Hold
+	exists, err := getRecord(ctx, holdObjectType, []string{ref}, &hold)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("hold %s does not exist", ref)
+	}
+	return &hold, nil
+}
+
+// Reads a hold that is neither captured nor released
+func heldFunds(
+	ctx contractapi.TransactionContextInterface,
+	ref string,
+) (*Hold, error) {
+	hold, err := getHold(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if hold.Status != holdHeld {
+		return nil, fmt.Errorf("hold %s is already %s", ref, hold.Status)
+	}
+	return hold, nil
+}
+
+func holdReference(ref string) string {
+	return holdObjectType + ":" + ref
+}
+
+func emitHoldEvent(
+	ctx contractapi.TransactionContextInterface,
+	movement string,
+	hold *Hold,
+) error {
+	event, err := NewTokenEvent(ctx, movement, hold.Account, "", hold.Amount.Rat(), holdReference(hold.Reference), "")
+	if err != nil {
+		return err
+	}
+	return emitTokenEvent(ctx, EventHold, event)
+}
@@ -0,0 +1,92 @@
+package token
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// A client request ID already applied by a transaction
+type ProcessedRequest struct {
+	RequestID   string `json:"requestId"`
+	Function    string `json:"function"`
+	CallerMSP   string `json:"callerMsp"`
+	TxID        string `json:"txId"`
+	ProcessedAt string `json:"processedAt"`
+}
+
+// Request IDs are passed in the transient map so every state-changing function
+// accepts one without changing its arguments. They are scoped to the caller's
+// organization, and shared with the loan functions when deployed together.
+const (
+	requestIDTransient         = "request_id"
+	processedRequestObjectType = "request"
+)
+
+// ============== Idempotency ==============
+
+// Records the request ID the client attached to this transaction, failing if
+// it was already processed. Transactions without a request ID are not tracked.
+func ClaimRequestID(
+	ctx contractapi.TransactionContextInterface,
+	function string,
+) error {
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("failed to read transient data: %v", err)
+	}
+	requestID := string(transient[requestIDTransient])
+	if requestID == "" {
+		return nil
+	}
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to read client MSP ID: %v", err)
+	}
+
+	var processed ProcessedRequest
+	exists, err := getRecord(ctx, processedRequestObjectType, []string{mspID, requestID}, &processed)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("request %s was already processed by %s in transaction %s", requestID, processed.Function, processed.TxID)
+	}
+
+	processedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	return putRecord(ctx, processedRequestObjectType, []string{mspID, requestID}, ProcessedRequest{
+		RequestID:   requestID,
+		Function:    function,
+		CallerMSP:   mspID,
+		TxID:        ctx.GetStub().GetTxID(),
+		ProcessedAt: processedAt,
+	})
+}
+
+// Look up the transaction that applied one of the caller organization's
+// request IDs, so a client can resolve a retry after a timeout
+func (t *TokenContract) GetProcessedRequest(
+	ctx contractapi.TransactionContextInterface,
+	requestID string,
+) (*ProcessedRequest, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client MSP ID: %v", err)
+	}
+
+	var processed ProcessedRequest
+	exists, err := getRecord(ctx, processedRequestObjectType, []string{mspID, requestID}, &processed)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("request %s has not been processed", requestID)
+	}
+
+	return &processed, nil
+}
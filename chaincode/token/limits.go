@@ -0,0 +1,173 @@
+package token
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Daily debit limits of an account, like a bank's per-channel limits. A zero
+// count or value leaves that dimension unlimited, accounts without limits
+// are not restricted.
+type DebitLimit struct {
+	AccountID string `json:"accountId"`
+	MaxCount  int    `json:"maxCount"`
+	MaxValue  Amount `json:"maxValue"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+// Debits of an account on a UTC day. A single record per account is kept and
+// started over on the first debit of a new day.
+type DebitUsage struct {
+	AccountID string `json:"accountId"`
+	Day       string `json:"day"` // YYYY-MM-DD
+	Count     int    `json:"count"`
+	Value     Amount `json:"value"`
+}
+
+const (
+	debitLimitObjectType = "debitLimit"
+	debitUsageObjectType = "debitUsage"
+)
+
+const usageDayLayout = "2006-01-02"
+
+// ============== Debit Limits ==============
+
+// Set the daily debit limits of a registered account, issuer only. Zero
+// disables a limit.
+func (t *TokenContract) SetDebitLimit(
+	ctx contractapi.TransactionContextInterface,
+	accountID string,
+	maxCount int,
+	maxValue string,
+) error {
+	err := ClaimRequestID(ctx, "SetDebitLimit")
+	if err != nil {
+		return err
+	}
+
+	err = requireIssuer(ctx, "set debit limits")
+	if err != nil {
+		return err
+	}
+
+	if maxCount < 0 {
+		return fmt.Errorf("maximum debit count cannot be negative")
+	}
+	value, err := ParseAmount(maxValue)
+	if err != nil {
+		return err
+	}
+
+	account, err := GetAccount(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	if account == nil {
+		return fmt.Errorf("account %s does not exist", accountID)
+	}
+
+	updatedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	return putRecord(ctx, debitLimitObjectType, []string{accountID}, DebitLimit{
+		AccountID: accountID,
+		MaxCount:  maxCount,
+		MaxValue:  NewAmount(value),
+		UpdatedAt: updatedAt,
+	})
+}
+
+// Daily debit limits of an account, zero when none are set
+func (t *TokenContract) GetDebitLimit(
+	ctx contractapi.TransactionContextInterface,
+	accountID string,
+) (*DebitLimit, error) {
+	limit := DebitLimit{AccountID: accountID, MaxValue: NewAmount(new(big.Rat))}
+	_, err := getRecord(ctx, debitLimitObjectType, []string{accountID}, &limit)
+	if err != nil {
+		return nil, err
+	}
+	return &limit, nil
+}
+
+// Debits of an account so far on the transaction's day
+func (t *TokenContract) GetDebitUsage(
+	ctx contractapi.TransactionContextInterface,
+	accountID string,
+) (*DebitUsage, error) {
+	return debitUsageOf(ctx, accountID)
+}
+
+// Counts a debit against the account's daily limits, failing when it would
+// exceed either of them
+func chargeDebitLimit(
+	ctx contractapi.TransactionContextInterface,
+	accountID string,
+	value *big.Rat,
+) error {
+	usage, err := debitWithinLimit(ctx, accountID, value)
+	if err != nil || usage == nil {
+		return err
+	}
+	return putRecord(ctx, debitUsageObjectType, []string{accountID}, usage)
+}
+
+// The account's usage for the day including a debit of value, failing when it
+// would exceed either limit. Nil for accounts without limits.
+func debitWithinLimit(
+	ctx contractapi.TransactionContextInterface,
+	accountID string,
+	value *big.Rat,
+) (*DebitUsage, error) {
+	var limit DebitLimit
+	exists, err := getRecord(ctx, debitLimitObjectType, []string{accountID}, &limit)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	usage, err := debitUsageOf(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if limit.MaxCount > 0 && usage.Count+1 > limit.MaxCount {
+		return nil, fmt.Errorf("account %s has reached its limit of %d debits on %s", accountID, limit.MaxCount, usage.Day)
+	}
+	total := new(big.Rat).Add(usage.Value.Rat(), value)
+	if limit.MaxValue.Rat().Sign() > 0 && total.Cmp(limit.MaxValue.Rat()) > 0 {
+		remaining := new(big.Rat).Sub(limit.MaxValue.Rat(), usage.Value.Rat())
+		return nil, fmt.Errorf("debit of %s exceeds the daily limit of account %s, %s remaining on %s",
+			FormatAmount(value), accountID, FormatAmount(remaining), usage.Day)
+	}
+
+	usage.Count++
+	usage.Value = NewAmount(total)
+	return usage, nil
+}
+
+func debitUsageOf(
+	ctx contractapi.TransactionContextInterface,
+	accountID string,
+) (*DebitUsage, error) {
+	now, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+	day := time.Unix(now.GetSeconds(), 0).UTC().Format(usageDayLayout)
+
+	var usage DebitUsage
+	_, err = getRecord(ctx, debitUsageObjectType, []string{accountID}, &usage)
+	if err != nil {
+		return nil, err
+	}
+	if usage.Day != day {
+		usage = DebitUsage{AccountID: accountID, Day: day, Value: NewAmount(new(big.Rat))}
+	}
+	return &usage, nil
+}
@@ -0,0 +1,215 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Progress of a balance migration, call again with Bookmark until it is empty
+type MigrationPage struct {
+	Scanned  int    `json:"scanned"`  // accounts looked at in this batch
+	Migrated int    `json:"migrated"` // records rewritten, base balances, deltas and movements
+	Bookmark string `json:"bookmark"` // last account scanned, empty when done
+}
+
+// ============== Migration ==============
+
+// Rewrite the balances of registered accounts still holding float64 JSON
+// numbers as decimal strings and rekey their movements by month, batchSize
+// accounts at a time in account ID order, issuer only. Records already migrated are left untouched, so a batch
+// can be rerun. Loan records need no batch, their JSON numbers decode as amounts
+// and are written back as decimal strings the next time the loan is saved.
+func (t *TokenContract) MigrateBalances(
+	ctx contractapi.TransactionContextInterface,
+	batchSize int,
+	bookmark string,
+) (*MigrationPage, error) {
+	err := ClaimRequestID(ctx, "MigrateBalances")
+	if err != nil {
+		return nil, err
+	}
+
+	err = requireIssuer(ctx, "migrate balances")
+	if err != nil {
+		return nil, err
+	}
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("batch size must be positive")
+	}
+
+	// Paginated queries are not available to transactions that write state,
+	// so the registry is walked from the start and accounts up to the bookmark
+	// skipped
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(accountObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	page := MigrationPage{}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+		if err != nil {
+			return nil, err
+		}
+		accountID := keyParts[0]
+		if accountID <= bookmark {
+			continue
+		}
+		if page.Scanned == batchSize {
+			return &page, nil
+		}
+
+		migrated, err := migrateAccount(ctx, accountID)
+		if err != nil {
+			return nil, err
+		}
+		page.Scanned++
+		page.Migrated += migrated
+		page.Bookmark = accountID
+	}
+
+	page.Bookmark = ""
+	return &page, nil
+}
+
+// Rewrites the account's base balance and deltas still holding JSON numbers,
+// returning how many were rewritten
+func migrateAccount(
+	ctx contractapi.TransactionContextInterface,
+	accountID string,
+) (int, error) {
+	migrated := 0
+
+	balanceJSON, err := ctx.GetStub().GetState(accountID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if numericAmount(balanceJSON, "balance") {
+		var balance TokenBalance
+		err = json.Unmarshal(balanceJSON, &balance)
+		if err != nil {
+			return 0, err
+		}
+		balance.Balance = NewAmount(balance.Balance.Rat())
+
+		err = putJSON(ctx, accountID, balance)
+		if err != nil {
+			return 0, err
+		}
+		migrated++
+	}
+
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(balanceDeltaObjectType, []string{accountID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return 0, err
+		}
+		if !numericAmount(entry.Value, "amount") {
+			continue
+		}
+
+		var delta BalanceDelta
+		err = json.Unmarshal(entry.Value, &delta)
+		if err != nil {
+			return 0, err
+		}
+		delta.Amount = NewAmount(delta.Amount.Rat())
+
+		err = putJSON(ctx, entry.Key, delta)
+		if err != nil {
+			return 0, err
+		}
+		migrated++
+	}
+
+	movements, err := migrateMovements(ctx, accountID)
+	if err != nil {
+		return 0, err
+	}
+	return migrated + movements, nil
+}
+
+// Moves the account's movements still keyed by their instant alone under
+// their month, returning how many were moved. Their direction and
+// counterparty stand in for the sequence number.
+func migrateMovements(
+	ctx contractapi.TransactionContextInterface,
+	accountID string,
+) (int, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(accountMovementObjectType, []string{accountID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	migrated := 0
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return 0, err
+		}
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+		if err != nil {
+			return 0, err
+		}
+		if len(keyParts) != 4 || len(keyParts[1]) != len("20060102150405") {
+			continue
+		}
+
+		movementKey, err := ctx.GetStub().CreateCompositeKey(accountMovementObjectType,
+			[]string{accountID, keyParts[1][:6], keyParts[1][6:], keyParts[2], keyParts[3]})
+		if err != nil {
+			return 0, fmt.Errorf("failed to create record key: %v", err)
+		}
+		err = ctx.GetStub().PutState(movementKey, entry.Value)
+		if err != nil {
+			return 0, fmt.Errorf("failed to put to world state: %v", err)
+		}
+		err = ctx.GetStub().DelState(entry.Key)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete from world state: %v", err)
+		}
+		migrated++
+	}
+
+	return migrated, nil
+}
+
+// Whether a record's amount field was written as a JSON number
+func numericAmount(recordJSON []byte, field string) bool {
+	var fields map[string]json.RawMessage
+	if recordJSON == nil || json.Unmarshal(recordJSON, &fields) != nil {
+		return false
+	}
+	raw := fields[field]
+	return len(raw) > 0 && raw[0] != '"'
+}
+
+func putJSON(
+	ctx contractapi.TransactionContextInterface,
+	key string,
+	record interface{},
+) error {
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutState(key, recordJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put to world state: %v", err)
+	}
+	return nil
+}
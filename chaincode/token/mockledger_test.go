@@ -0,0 +1,67 @@
+package token
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/internal/mockstub"
+)
+
+// Identities of the organizations set up by InitLedger
+var (
+	issuer = mockstub.NewIdentity(issuerMSP, "rbi-admin")
+	hdfc   = mockstub.NewIdentity("HDFCMSP", "hdfc-officer")
+	sbi    = mockstub.NewIdentity("SBIMSP", "sbi-officer")
+)
+
+// Token chaincode running against an in-memory ledger. Each call is one
+// transaction, committed if it succeeds and rolled back otherwise.
+type testLedger struct {
+	tb       testing.TB
+	stub     *mockstub.Stub
+	contract *TokenContract
+	txs      int
+}
+
+// A ledger initialized by InitLedger
+func newTestLedger(tb testing.TB) *testLedger {
+	l := &testLedger{tb: tb, stub: mockstub.New(), contract: new(TokenContract)}
+	l.must(issuer, func(ctx contractapi.TransactionContextInterface) error {
+		return l.contract.InitLedger(ctx)
+	})
+	return l
+}
+
+// Runs a transaction as the identity
+func (l *testLedger) submit(
+	identity mockstub.Identity,
+	tx func(ctx contractapi.TransactionContextInterface) error,
+) error {
+	l.txs++
+	l.stub.TxID = fmt.Sprintf("tx%06d", l.txs)
+
+	ctx := new(TransactionContext)
+	ctx.SetStub(l.stub)
+	ctx.SetClientIdentity(identity)
+
+	err := tx(ctx)
+	if err != nil {
+		l.stub.Rollback()
+		return err
+	}
+	l.stub.Commit()
+	return nil
+}
+
+func (l *testLedger) must(
+	identity mockstub.Identity,
+	tx func(ctx contractapi.TransactionContextInterface) error,
+) {
+	l.tb.Helper()
+	err := l.submit(identity, tx)
+	if err != nil {
+		l.tb.Fatal(err)
+	}
+}
@@ -0,0 +1,269 @@
+package token
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Entry of the negative list. Only the hash of the listed identifier is kept
+// on the ledger, so the list can be shared without disclosing who is on it.
+type NegativeListEntry struct {
+	Hash    string `json:"hash"`   // hex SHA-256 of the identifier, see HashIdentifier
+	List    string `json:"list"`   // source of the entry, e.g. UNSC, MHA, INTERNAL
+	Reason  string `json:"reason"` // why the identifier was listed
+	AddedBy string `json:"addedBy"`
+	AddedAt string `json:"addedAt"`
+}
+
+// Clearance of an account wrongly matching a negative list entry, granted by
+// compliance after review. An override only clears the entry it names.
+type NegativeListOverride struct {
+	AccountID  string `json:"accountId"`
+	Hash       string `json:"hash"`
+	Reason     string `json:"reason"`
+	ApprovedBy string `json:"approvedBy"`
+	ApprovedAt string `json:"approvedAt"`
+	TxID       string `json:"txId"`
+}
+
+const (
+	negativeListObjectType = "negativeList"
+	overrideObjectType     = "negativeListOverride"
+)
+
+// Hash an identifier is listed under: hex SHA-256 of the identifier trimmed
+// and upper-cased
+func HashIdentifier(identifier string) string {
+	sum := sha256.Sum256([]byte(strings.ToUpper(strings.TrimSpace(identifier))))
+	return hex.EncodeToString(sum[:])
+}
+
+// ============== Negative List ==============
+
+// List the hash of an identifier, issuer only. Account IDs and the values of
+// account metadata, such as a PAN, are screened against the list.
+func (t *TokenContract) AddNegativeListEntry(
+	ctx contractapi.TransactionContextInterface,
+	hash string,
+	list string,
+	reason string,
+) error {
+	err := ClaimRequestID(ctx, "AddNegativeListEntry")
+	if err != nil {
+		return err
+	}
+
+	err = requireIssuer(ctx, "manage the negative list")
+	if err != nil {
+		return err
+	}
+
+	hash = strings.ToLower(hash)
+	decoded, err := hex.DecodeString(hash)
+	if err != nil || len(decoded) != sha256.Size {
+		return fmt.Errorf("invalid hash %s, expected hex SHA-256", hash)
+	}
+	if list == "" {
+		return fmt.Errorf("source list is required")
+	}
+
+	addedBy, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to read client identity: %v", err)
+	}
+	addedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	return putRecord(ctx, negativeListObjectType, []string{hash}, NegativeListEntry{
+		Hash:    hash,
+		List:    list,
+		Reason:  reason,
+		AddedBy: addedBy,
+		AddedAt: addedAt,
+	})
+}
+
+// Delist an identifier, issuer only. The entry stays in the key's history.
+func (t *TokenContract) RemoveNegativeListEntry(
+	ctx contractapi.TransactionContextInterface,
+	hash string,
+) error {
+	err := ClaimRequestID(ctx, "RemoveNegativeListEntry")
+	if err != nil {
+		return err
+	}
+
+	err = requireIssuer(ctx, "manage the negative list")
+	if err != nil {
+		return err
+	}
+
+	hash = strings.ToLower(hash)
+	var entry NegativeListEntry
+	exists, err := getRecord(ctx, negativeListObjectType, []string{hash}, &entry)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("hash %s is not on the negative list", hash)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(negativeListObjectType, []string{hash})
+	if err != nil {
+		return fmt.Errorf("failed to create key: %v", err)
+	}
+	return ctx.GetStub().DelState(key)
+}
+
+// Clear an account of a negative list entry it matches but does not belong
+// to, compliance officers only
+func (t *TokenContract) OverrideNegativeListMatch(
+	ctx contractapi.TransactionContextInterface,
+	accountID string,
+	hash string,
+	reason string,
+) error {
+	err := ClaimRequestID(ctx, "OverrideNegativeListMatch")
+	if err != nil {
+		return err
+	}
+
+	approvedBy, err := requireCompliance(ctx)
+	if err != nil {
+		return err
+	}
+	if reason == "" {
+		return fmt.Errorf("a reason is required to override a negative list match")
+	}
+
+	hash = strings.ToLower(hash)
+	matches, err := negativeListMatches(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	matched := false
+	for _, entry := range matches {
+		matched = matched || entry.Hash == hash
+	}
+	if !matched {
+		return fmt.Errorf("account %s does not match negative list entry %s", accountID, hash)
+	}
+
+	approvedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return err
+	}
+
+	return putRecord(ctx, overrideObjectType, []string{accountID, hash}, NegativeListOverride{
+		AccountID:  accountID,
+		Hash:       hash,
+		Reason:     reason,
+		ApprovedBy: approvedBy,
+		ApprovedAt: approvedAt,
+		TxID:       ctx.GetStub().GetTxID(),
+	})
+}
+
+// Negative list entries an account matches, with any overrides of them,
+// compliance officers only
+func (t *TokenContract) ScreenAccount(
+	ctx contractapi.TransactionContextInterface,
+	accountID string,
+) ([]*NegativeListOverride, error) {
+	_, err := requireCompliance(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := negativeListMatches(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Matches not overridden are returned without approval
+	screening := []*NegativeListOverride{}
+	for _, entry := range matches {
+		override := NegativeListOverride{AccountID: accountID, Hash: entry.Hash}
+		_, err = getRecord(ctx, overrideObjectType, []string{accountID, entry.Hash}, &override)
+		if err != nil {
+			return nil, err
+		}
+		screening = append(screening, &override)
+	}
+	return screening, nil
+}
+
+// Fails when an account matches a negative list entry it was not cleared of.
+// Screens the counterparties of token movements, and of loan operations when
+// called by the lending contract.
+func ScreenParties(
+	ctx contractapi.TransactionContextInterface,
+	accountIDs ...string,
+) error {
+	for _, accountID := range accountIDs {
+		if accountID == "" {
+			continue
+		}
+
+		matches, err := negativeListMatches(ctx, accountID)
+		if err != nil {
+			return err
+		}
+		for _, entry := range matches {
+			var override NegativeListOverride
+			cleared, err := getRecord(ctx, overrideObjectType, []string{accountID, entry.Hash}, &override)
+			if err != nil {
+				return err
+			}
+			if !cleared {
+				return fmt.Errorf("account %s matches a %s negative list entry, blocked pending compliance review", accountID, entry.List)
+			}
+		}
+	}
+	return nil
+}
+
+// Entries matching the account's ID or the values of its registry metadata
+func negativeListMatches(
+	ctx contractapi.TransactionContextInterface,
+	accountID string,
+) ([]*NegativeListEntry, error) {
+	identifiers := []string{accountID}
+	account, err := GetAccount(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if account != nil {
+		keys := make([]string, 0, len(account.Metadata))
+		for key := range account.Metadata {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			identifiers = append(identifiers, account.Metadata[key])
+		}
+	}
+
+	matches := []*NegativeListEntry{}
+	for _, identifier := range identifiers {
+		if strings.TrimSpace(identifier) == "" {
+			continue
+		}
+		var entry NegativeListEntry
+		exists, err := getRecord(ctx, negativeListObjectType, []string{HashIdentifier(identifier)}, &entry)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			matches = append(matches, &entry)
+		}
+	}
+	return matches, nil
+}
@@ -0,0 +1,47 @@
+package token
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Reason codes of token transfers, recorded on every movement for reporting
+// and reconciliation. A transaction moves tokens between two accounts once, so
+// a repayment carrying both principal and interest is a single REPAYMENT.
+const (
+	ReasonDisbursement       = "DISBURSEMENT"
+	ReasonRepayment          = "REPAYMENT"
+	ReasonRepaymentPrincipal = "REPAYMENT_PRINCIPAL"
+	ReasonRepaymentInterest  = "REPAYMENT_INTEREST"
+	ReasonFee                = "FEE"
+	ReasonPlatformFee        = "PLATFORM_FEE"
+	ReasonRefund             = "REFUND"
+	ReasonSettlement         = "SETTLEMENT"
+	ReasonTDS                = "TDS"
+	ReasonDistribution       = "INCOME_DISTRIBUTION"
+	ReasonSubvention         = "SUBVENTION"
+	ReasonCoolingOff         = "COOLING_OFF"
+)
+
+var transferReasons = []string{
+	ReasonDisbursement,
+	ReasonRepayment,
+	ReasonRepaymentPrincipal,
+	ReasonRepaymentInterest,
+	ReasonFee,
+	ReasonPlatformFee,
+	ReasonRefund,
+	ReasonSettlement,
+	ReasonTDS,
+	ReasonDistribution,
+	ReasonSubvention,
+	ReasonCoolingOff,
+}
+
+// Fails unless reason is one of the transfer reason codes
+func requireTransferReason(reason string) error {
+	if !contains(transferReasons, reason) {
+		return fmt.Errorf("invalid transfer reason %q, expected one of %s", reason, strings.Join(transferReasons, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// A credit or debit of an account, written with each balance delta. Unlike
+// deltas, movements are never pruned, so they can be listed after the deltas
+// are folded into the account's balance.
+type AccountMovement struct {
+	Account      string `json:"account"`
+	Counterparty string `json:"counterparty"` // empty for mints, burns and adjustments
+	Amount       Amount `json:"amount"`       // negative for debits
+	Reason       string `json:"reason"`
+	Reference    string `json:"reference"` // loan or other record the movement belongs to
+	TxID         string `json:"txId"`
+	Timestamp    string `json:"timestamp"` // RFC3339 transaction time
+}
+
+// A movement on an account statement with the running balance after it
+type AccountStatementEntry struct {
+	Date         string `json:"date"`
+	Counterparty string `json:"counterparty"`
+	Reference    string `json:"reference,omitempty" metadata:",optional"`
+	Reason       string `json:"reason"`
+	TxID         string `json:"txId"`
+	Debit        Amount `json:"debit"`
+	Credit       Amount `json:"credit"`
+	Balance      Amount `json:"balance"`
+}
+
+// A page of the movements of an account over a period with its running
+// balance, brought forward from the previous page. The opening balance of the
+// first page is worked back from the current balance, so movements made
+// before they were recorded are part of it. Totals are of the page's entries.
+type AccountStatement struct {
+	Account        string                  `json:"account"`
+	FromDate       string                  `json:"fromDate"`
+	ToDate         string                  `json:"toDate"`
+	OpeningBalance Amount                  `json:"openingBalance"`
+	TotalDebits    Amount                  `json:"totalDebits"`
+	TotalCredits   Amount                  `json:"totalCredits"`
+	ClosingBalance Amount                  `json:"closingBalance"`
+	Entries        []AccountStatementEntry `json:"entries"`
+	GeneratedAt    string                  `json:"generatedAt"`
+	Bookmark       string                  `json:"bookmark"` // empty on the last page
+}
+
+// Movements are keyed by account, month and the instant, transaction and
+// sequence number of the movement, so a period is read a month at a time in
+// time order
+const accountMovementObjectType = "account~movement"
+
+const (
+	movementMonthLayout   = "200601"
+	movementInstantLayout = "02150405"
+)
+
+// Reason of the movement recording a balance set directly
+const reasonAdjustment = "ADJUSTMENT"
+
+// ============== Account Statements ==============
+
+// Statement of an account's credits and debits from fromDate to toDate
+// (YYYY-MM-DD or RFC3339, both included) with the counterparty, reason and
+// reference of each and the running balance, pageSize movements at a time.
+// Available to the organization operating the account and the issuer.
+func (t *TokenContract) GetAccountStatement(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+	fromDate string,
+	toDate string,
+	pageSize int32,
+	bookmark string,
+) (*AccountStatement, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client MSP ID: %v", err)
+	}
+	if mspID != issuerMSP {
+		err = requireOperator(ctx, account)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be positive")
+	}
+
+	from, err := parseStatementDate(fromDate, false)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseStatementDate(toDate, true)
+	if err != nil {
+		return nil, err
+	}
+	if to.Before(from) {
+		return nil, fmt.Errorf("statement period ends before it starts")
+	}
+	firstMonth := monthOf(from)
+	lastMonth := monthOf(to)
+
+	// The bookmark is the month being read, the balance brought forward and
+	// the state database bookmark within the month
+	bookmark, err = DecodeBookmark(bookmark)
+	if err != nil {
+		return nil, err
+	}
+	month := firstMonth
+	monthBookmark := ""
+	var running *big.Rat
+	if bookmark == "" {
+		running, err = openingBalance(ctx, account, from)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		parts := strings.SplitN(bookmark, "|", 3)
+		if len(parts) == 3 {
+			month, err = time.Parse(movementMonthLayout, parts[0])
+			running, _ = new(big.Rat).SetString(parts[1])
+			monthBookmark = parts[2]
+		}
+		if len(parts) != 3 || err != nil || running == nil || month.Before(firstMonth) || month.After(lastMonth) {
+			return nil, fmt.Errorf("invalid bookmark for the statement period")
+		}
+	}
+
+	generatedAt, err := txTimestamp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statement := AccountStatement{
+		Account:        account,
+		FromDate:       from.Format(time.RFC3339),
+		ToDate:         to.Format(time.RFC3339),
+		OpeningBalance: NewAmount(running),
+		Entries:        []AccountStatementEntry{},
+		GeneratedAt:    generatedAt,
+	}
+
+	debits, credits := new(big.Rat), new(big.Rat)
+	for !month.After(lastMonth) {
+		remaining := pageSize - int32(len(statement.Entries))
+		if remaining == 0 {
+			statement.Bookmark = EncodeBookmark(month.Format(movementMonthLayout) + "|" + running.RatString() + "|" + monthBookmark)
+			break
+		}
+
+		iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(
+			accountMovementObjectType, []string{account, month.Format(movementMonthLayout)}, remaining, monthBookmark)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read from world state: %v", err)
+		}
+		movements, err := readMovements(iterator, from, to)
+		iterator.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, movement := range movements {
+			amount := movement.Amount.Rat()
+			running.Add(running, amount)
+
+			entry := AccountStatementEntry{
+				Date:         movement.Timestamp,
+				Counterparty: movement.Counterparty,
+				Reference:    movement.Reference,
+				Reason:       movement.Reason,
+				TxID:         movement.TxID,
+				Debit:        NewAmount(new(big.Rat)),
+				Credit:       NewAmount(new(big.Rat)),
+				Balance:      NewAmount(running),
+			}
+			if amount.Sign() < 0 {
+				debit := new(big.Rat).Neg(amount)
+				debits.Add(debits, debit)
+				entry.Debit = NewAmount(debit)
+			} else {
+				credits.Add(credits, amount)
+				entry.Credit = NewAmount(amount)
+			}
+			statement.Entries = append(statement.Entries, entry)
+		}
+
+		// A full fetch leaves the rest of this month for the next round
+		if metadata.GetFetchedRecordsCount() == remaining && metadata.GetBookmark() != "" {
+			monthBookmark = metadata.GetBookmark()
+			continue
+		}
+		month = month.AddDate(0, 1, 0)
+		monthBookmark = ""
+	}
+	statement.TotalDebits = NewAmount(debits)
+	statement.TotalCredits = NewAmount(credits)
+	statement.ClosingBalance = NewAmount(running)
+
+	return &statement, nil
+}
+
+// Balance of an account just before from, the current balance less the
+// movements since. Only the months from from's to the current one are read.
+func openingBalance(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+	from time.Time,
+) (*big.Rat, error) {
+	balance, err := BalanceOf(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	now, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+	lastMonth := monthOf(time.Unix(now.GetSeconds(), 0))
+
+	for month := monthOf(from); !month.After(lastMonth); month = month.AddDate(0, 1, 0) {
+		iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(
+			accountMovementObjectType, []string{account, month.Format(movementMonthLayout)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read from world state: %v", err)
+		}
+		movements, err := readMovements(iterator, from, time.Time{})
+		iterator.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, movement := range movements {
+			balance.Sub(balance, movement.Amount.Rat())
+		}
+	}
+
+	return balance, nil
+}
+
+// Reads the movements of an iterator made from from up to to, both included.
+// A zero to has no upper bound.
+func readMovements(
+	iterator shim.StateQueryIteratorInterface,
+	from time.Time,
+	to time.Time,
+) ([]*AccountMovement, error) {
+	movements := []*AccountMovement{}
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var movement AccountMovement
+		err = json.Unmarshal(entry.Value, &movement)
+		if err != nil {
+			return nil, err
+		}
+		at, err := time.Parse(time.RFC3339, movement.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time %s of movement %s", movement.Timestamp, movement.TxID)
+		}
+		if !at.Before(from) && (to.IsZero() || !at.After(to)) {
+			movements = append(movements, &movement)
+		}
+	}
+	return movements, nil
+}
+
+// First instant of the month of t, in UTC
+func monthOf(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Records a movement of an account for its statement
+func putAccountMovement(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+	counterparty string,
+	amount *big.Rat,
+	reason string,
+	reference string,
+) error {
+	sequence, err := nextRecord(ctx)
+	if err != nil {
+		return err
+	}
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+	at := time.Unix(timestamp.GetSeconds(), 0).UTC()
+
+	return putRecord(ctx, accountMovementObjectType,
+		[]string{account, at.Format(movementMonthLayout), at.Format(movementInstantLayout), ctx.GetStub().GetTxID(), strconv.Itoa(sequence)},
+		AccountMovement{
+			Account:      account,
+			Counterparty: counterparty,
+			Amount:       NewAmount(amount),
+			Reason:       reason,
+			Reference:    reference,
+			TxID:         ctx.GetStub().GetTxID(),
+			Timestamp:    at.Format(time.RFC3339),
+		})
+}
+
+// Parses a statement bound, a bare date covering the whole day
+func parseStatementDate(date string, endOfDay bool) (time.Time, error) {
+	if parsed, err := time.Parse(time.RFC3339, date); err == nil {
+		return parsed.UTC(), nil
+	}
+
+	parsed, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %s, expected YYYY-MM-DD", date)
+	}
+	if endOfDay {
+		return parsed.AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+	return parsed, nil
+}
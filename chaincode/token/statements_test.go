@@ -0,0 +1,114 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// A statement reads the months of its period a page at a time, bringing the
+// running balance forward from page to page
+func TestGetAccountStatement(t *testing.T) {
+	l := newTestLedger(t)
+	for i, day := range []string{"2026-01-10", "2026-02-05", "2026-02-20", "2026-03-15", "2026-04-02"} {
+		l.stub.Now, _ = time.Parse("2006-01-02", day)
+		l.must(hdfc, func(ctx contractapi.TransactionContextInterface) error {
+			return l.contract.TransferTokens(ctx, "HDFC", "SBI", "100", ReasonSettlement, fmt.Sprintf("SETTLE%d", i))
+		})
+	}
+	l.stub.Now = time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	type page struct {
+		opening, closing, debits string
+		balances                 []string
+	}
+	want := []page{
+		{"499900.00", "499700.00", "200.00", []string{"499800.00", "499700.00"}},
+		{"499700.00", "499600.00", "100.00", []string{"499600.00"}},
+	}
+
+	bookmark := ""
+	for i, wantPage := range want {
+		var statement *AccountStatement
+		l.must(hdfc, func(ctx contractapi.TransactionContextInterface) error {
+			var err error
+			statement, err = l.contract.GetAccountStatement(ctx, "HDFC", "2026-02-01", "2026-03-31", 2, bookmark)
+			return err
+		})
+
+		if got := FormatAmount(statement.OpeningBalance.Rat()); got != wantPage.opening {
+			t.Errorf("page %d opening balance = %s, want %s", i, got, wantPage.opening)
+		}
+		if got := FormatAmount(statement.ClosingBalance.Rat()); got != wantPage.closing {
+			t.Errorf("page %d closing balance = %s, want %s", i, got, wantPage.closing)
+		}
+		if got := FormatAmount(statement.TotalDebits.Rat()); got != wantPage.debits {
+			t.Errorf("page %d debits = %s, want %s", i, got, wantPage.debits)
+		}
+		balances := []string{}
+		for _, entry := range statement.Entries {
+			balances = append(balances, FormatAmount(entry.Balance.Rat()))
+		}
+		if fmt.Sprint(balances) != fmt.Sprint(wantPage.balances) {
+			t.Errorf("page %d running balances = %v, want %v", i, balances, wantPage.balances)
+		}
+
+		bookmark = statement.Bookmark
+		if (bookmark == "") != (i == len(want)-1) {
+			t.Fatalf("page %d bookmark = %q", i, bookmark)
+		}
+	}
+}
+
+// Movements recorded under their instant alone are moved under their month
+// by the balance migration
+func TestMigrateMovements(t *testing.T) {
+	l := newTestLedger(t)
+	l.must(issuer, func(ctx contractapi.TransactionContextInterface) error {
+		movement, err := json.Marshal(AccountMovement{
+			Account:      "HDFC",
+			Counterparty: "SBI",
+			Amount:       NewAmount(mustAmount(t, "-100")),
+			Reason:       ReasonSettlement,
+			TxID:         "old",
+			Timestamp:    "2025-12-31T10:00:00Z",
+		})
+		if err != nil {
+			return err
+		}
+		key, err := ctx.GetStub().CreateCompositeKey(accountMovementObjectType, []string{"HDFC", "20251231100000", "old", "debit:SBI"})
+		if err != nil {
+			return err
+		}
+		return ctx.GetStub().PutState(key, movement)
+	})
+
+	l.must(issuer, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := l.contract.MigrateBalances(ctx, 10, "")
+		return err
+	})
+
+	l.must(issuer, func(ctx contractapi.TransactionContextInterface) error {
+		statement, err := l.contract.GetAccountStatement(ctx, "HDFC", "2025-12-01", "2025-12-31", 10, "")
+		if err != nil {
+			return err
+		}
+		if len(statement.Entries) != 1 || statement.Entries[0].TxID != "old" {
+			t.Errorf("entries = %+v, want the migrated movement", statement.Entries)
+		}
+		return nil
+	})
+}
+
+func mustAmount(t *testing.T, amount string) *big.Rat {
+	t.Helper()
+	value, err := ParseAmount(amount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
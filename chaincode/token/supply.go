@@ -0,0 +1,98 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Tokens issued less those burned, and the part of them held in escrow rather
+// than by an account. Tracked from InitLedger on, Tracked is false on ledgers
+// initialized before.
+type TokenSupply struct {
+	Minted  Amount `json:"minted"` // including the balances created by InitLedger
+	Burned  Amount `json:"burned"`
+	Issued  Amount `json:"issued"`
+	Escrow  Amount `json:"escrow"` // locked in escrows not yet released or refunded
+	Tracked bool   `json:"tracked"`
+}
+
+// Running totals of minted and burned tokens
+type supplyTotals struct {
+	Minted Amount `json:"minted"`
+	Burned Amount `json:"burned"`
+}
+
+const supplyObjectType = "supply"
+
+// ============== Supply ==============
+
+func (t *TokenContract) GetTotalSupply(
+	ctx contractapi.TransactionContextInterface,
+) (*TokenSupply, error) {
+	var totals supplyTotals
+	tracked, err := getRecord(ctx, supplyObjectType, []string{}, &totals)
+	if err != nil {
+		return nil, err
+	}
+
+	issued := new(big.Rat).Sub(totals.Minted.Rat(), totals.Burned.Rat())
+	escrow, err := lockedInEscrow(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenSupply{
+		Minted:  NewAmount(totals.Minted.Rat()),
+		Burned:  NewAmount(totals.Burned.Rat()),
+		Issued:  NewAmount(issued),
+		Escrow:  NewAmount(escrow),
+		Tracked: tracked,
+	}, nil
+}
+
+// Adds to the minted and burned totals
+func addSupply(
+	ctx contractapi.TransactionContextInterface,
+	minted *big.Rat,
+	burned *big.Rat,
+) error {
+	var totals supplyTotals
+	_, err := getRecord(ctx, supplyObjectType, []string{}, &totals)
+	if err != nil {
+		return err
+	}
+
+	totals.Minted = NewAmount(new(big.Rat).Add(totals.Minted.Rat(), minted))
+	totals.Burned = NewAmount(new(big.Rat).Add(totals.Burned.Rat(), burned))
+	return putRecord(ctx, supplyObjectType, []string{}, totals)
+}
+
+func lockedInEscrow(ctx contractapi.TransactionContextInterface) (*big.Rat, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(escrowObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer iterator.Close()
+
+	locked := new(big.Rat)
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var escrow Escrow
+		err = json.Unmarshal(entry.Value, &escrow)
+		if err != nil {
+			return nil, err
+		}
+		if escrow.Status == "LOCKED" {
+			locked.Add(locked, escrow.Amount.Rat())
+		}
+	}
+
+	return locked, nil
+}
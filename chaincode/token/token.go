@@ -0,0 +1,699 @@
+// Package token implements the ERC20-like token ledger used to settle loans.
+// It is deployed inside the lending chaincode and can also run as a chaincode
+// of its own (see cmd/token), in which case lending settles through
+// cross-chaincode calls, accepted from the chaincode set by SetLendingChaincode.
+package token
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+type TokenBalance struct {
+	Account string `json:"account"`
+	Balance Amount `json:"balance"`
+}
+
+type TokenContract struct {
+	contractapi.Contract
+}
+
+// MSP of the central bank, the only issuer of new tokens
+const issuerMSP = "RBIMSP"
+
+// Token movement event names, versioned like the lending events: a version only
+// gains optional fields, other changes are published under a new name
+const (
+	EventTransfer = "TokenTransfer.v1"
+	EventMint     = "TokenMint.v1"
+	EventBurn     = "TokenBurn.v1"
+	EventEscrow   = "TokenEscrow.v1"
+	EventHold     = "TokenHold.v1"
+	EventAMLCase  = "AMLCase.v1"
+)
+
+// Payload of every token movement event. From is empty for a mint and To for a
+// burn, LoanID is the loan the movement settles or, for a direct transfer, the
+// reference it was made with. Amount is the nearest float64 of the exact
+// decimal Value.
+type TokenEventV1 struct {
+	SchemaVersion int     `json:"schemaVersion"`
+	Type          string  `json:"type"` // TRANSFER, MINT, BURN, LOCK, RELEASE, REFUND, HOLD
+	From          string  `json:"from"`
+	To            string  `json:"to"`
+	Amount        float64 `json:"amount"`
+	Reason        string  `json:"reason"` // transfer reason code, or MINT, BURN and the escrow movement
+	LoanID        string  `json:"loanId"`
+	TxID          string  `json:"txId"`
+	Timestamp     string  `json:"timestamp"` // RFC3339 transaction time
+	SubmitterMSP  string  `json:"submitterMsp"`
+	SubmitterID   string  `json:"submitterId"`
+	Value         Amount  `json:"value,omitempty"`
+	AMLCaseID     string  `json:"amlCaseId,omitempty"` // case opened by the AML screening of the movement
+}
+
+// Initialize ledger with token balances, issuer only and once. The supply
+// record it starts is kept by every later mint and burn, ledgers initialized
+// before it was kept already hold the initial balances.
+func (t *TokenContract) InitLedger(ctx contractapi.TransactionContextInterface) error {
+	err := requireIssuer(ctx, "initialize the ledger")
+	if err != nil {
+		return err
+	}
+
+	balances := []TokenBalance{
+		{Account: "RBI", Balance: "1000000.00"},
+		{Account: "HDFC", Balance: "500000.00"},
+		{Account: "SBI", Balance: "500000.00"},
+	}
+
+	initialized, err := getRecord(ctx, supplyObjectType, []string{}, &supplyTotals{})
+	if err != nil {
+		return err
+	}
+	for _, balance := range balances {
+		balanceJSON, err := ctx.GetStub().GetState(balance.Account)
+		if err != nil {
+			return fmt.Errorf("failed to read from world state: %v", err)
+		}
+		initialized = initialized || balanceJSON != nil
+	}
+	if initialized {
+		return fmt.Errorf("the token ledger is already initialized")
+	}
+
+	createdAt, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+
+	accounts := map[string]Account{
+		"RBI":  {AccountID: "RBI", Type: AccountRegulator, OrgMSP: "RBIMSP"},
+		"HDFC": {AccountID: "HDFC", Type: AccountBank, OrgMSP: "HDFCMSP"},
+		"SBI":  {AccountID: "SBI", Type: AccountBank, OrgMSP: "SBIMSP"},
+	}
+
+	minted := new(big.Rat)
+	for _, balance := range balances {
+		balanceJSON, err := json.Marshal(balance)
+		if err != nil {
+			return err
+		}
+		err = ctx.GetStub().PutState(balance.Account, balanceJSON)
+		if err != nil {
+			return fmt.Errorf("failed to put to world state: %v", err)
+		}
+
+		account := accounts[balance.Account]
+		account.CreatedAt = time.Unix(createdAt.GetSeconds(), 0).UTC().Format(time.RFC3339)
+		err = putAccount(ctx, &account)
+		if err != nil {
+			return err
+		}
+		minted.Add(minted, balance.Balance.Rat())
+	}
+
+	// The initial balances are the first tokens issued
+	return putRecord(ctx, supplyObjectType, []string{}, supplyTotals{
+		Minted: NewAmount(minted),
+		Burned: NewAmount(new(big.Rat)),
+	})
+}
+
+// ============== Token Functions (ERC20-like) ==============
+
+// Balance of an account, its base balance plus the deltas not yet pruned
+func (t *TokenContract) GetBalance(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+) (string, error) {
+	balance, err := BalanceOf(ctx, account)
+	if err != nil {
+		return "", err
+	}
+	return FormatAmount(balance), nil
+}
+
+// Exact balance of an account, for callers in the same chaincode
+func BalanceOf(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+) (*big.Rat, error) {
+	balanceJSON, err := ctx.GetStub().GetState(account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from world state: %v", err)
+	}
+
+	deltas, deltaKeys, err := sumDeltas(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	if balanceJSON == nil && len(deltaKeys) == 0 {
+		return nil, fmt.Errorf("account %s does not exist", account)
+	}
+
+	var balance TokenBalance
+	if balanceJSON != nil {
+		err = json.Unmarshal(balanceJSON, &balance)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return deltas.Add(deltas, balance.Balance.Rat()), nil
+}
+
+// Transfer tokens with the reason code of the movement and a reference to the
+// loan, invoice, auction or settlement it belongs to. The caller must belong
+// to the organization operating the from account.
+func (t *TokenContract) TransferTokens(
+	ctx contractapi.TransactionContextInterface,
+	from string,
+	to string,
+	amount string,
+	reason string,
+	reference string,
+) error {
+	err := ClaimRequestID(ctx, "TransferTokens")
+	if err != nil {
+		return err
+	}
+
+	err = requireOperator(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	return transferTokens(ctx, from, to, amount, reason, reference)
+}
+
+// Transfer tokens recording why they moved and the loan they settle, if any.
+// Called by lending when the token ledger runs as a chaincode of its own, the
+// lending transaction having authorized the movement, see
+// requireChaincodeDebit. It may then spend the sender's earmark under
+// consumed. Invoked directly, the caller must operate the from account as for
+// TransferTokens and consumed must be empty.
+func (t *TokenContract) TransferTokensWithReason(
+	ctx contractapi.TransactionContextInterface,
+	from string,
+	to string,
+	amount string,
+	reason string,
+	loanID string,
+	consumed string,
+) error {
+	chaincode, err := callingChaincode(ctx, "TransferTokensWithReason")
+	if err != nil {
+		return err
+	}
+	// A nested call is part of a lending transaction, which claimed its
+	// request ID, and may move tokens more than once
+	if chaincode != "" {
+		err = requireChaincodeDebit(ctx, chaincode, from)
+	} else {
+		err = ClaimRequestID(ctx, "TransferTokensWithReason")
+		if err == nil {
+			err = requireOperator(ctx, from)
+		}
+		if err == nil && consumed != "" {
+			err = fmt.Errorf("earmarks are spent only by lending transactions")
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	var earmarks []string
+	if consumed != "" {
+		earmarks = append(earmarks, consumed)
+	}
+	return transferTokens(ctx, from, to, amount, reason, loanID, earmarks...)
+}
+
+func transferTokens(
+	ctx contractapi.TransactionContextInterface,
+	from string,
+	to string,
+	amount string,
+	reason string,
+	loanID string,
+	consumed ...string,
+) error {
+	value, err := ParseAmount(amount)
+	if err != nil {
+		return err
+	}
+
+	event, err := Transfer(ctx, from, to, value, reason, loanID, consumed...)
+	if err != nil {
+		return err
+	}
+	return emitTokenEvent(ctx, EventTransfer, event)
+}
+
+// Moves tokens between accounts clear of the negative list, within the
+// sender's daily debit limits, and screens the movement for AML. The reason
+// must be a transfer reason code. The sender's earmarks are not spent unless
+// named as consumed. Returns the event payload of the movement without
+// emitting it so a lending transaction can carry it in its own event.
+func Transfer(
+	ctx contractapi.TransactionContextInterface,
+	from string,
+	to string,
+	value *big.Rat,
+	reason string,
+	loanID string,
+	consumed ...string,
+) (*TokenEventV1, error) {
+	if value.Sign() <= 0 {
+		return nil, fmt.Errorf("transfer amount must be positive")
+	}
+	err := requireTransferReason(reason)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ScreenParties(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get sender balance
+	fromBalance, err := AvailableBalance(ctx, from, consumed...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check sufficient funds
+	if fromBalance.Cmp(value) < 0 {
+		return nil, fmt.Errorf("insufficient funds in account %s", from)
+	}
+
+	err = chargeDebitLimit(ctx, from, value)
+	if err != nil {
+		return nil, err
+	}
+
+	// Record the movement as deltas, the recipient is credited without reading
+	// its balance
+	err = addDelta(ctx, from, to, new(big.Rat).Neg(value), reason, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = addDelta(ctx, to, from, value, reason, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := NewTokenEvent(ctx, "TRANSFER", from, to, value, reason, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	event.AMLCaseID, err = screenTransfer(ctx, from, to, value, reason, loanID)
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// Reports why Transfer would refuse a debit of value from an account, without
+// moving anything: a screening match, too little available balance or the
+// account's debit limits. Callers that cannot undo a failed movement, such as
+// a batch collecting from many accounts, check first and skip the refused ones.
+func CheckDebit(
+	ctx contractapi.TransactionContextInterface,
+	from string,
+	value *big.Rat,
+	consumed ...string,
+) error {
+	err := ScreenParties(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	available, err := AvailableBalance(ctx, from, consumed...)
+	if err != nil {
+		return err
+	}
+	if available.Cmp(value) < 0 {
+		return fmt.Errorf("insufficient funds in account %s", from)
+	}
+
+	_, err = debitWithinLimit(ctx, from, value)
+	return err
+}
+
+// Why a debit of amount from account would be refused, empty when it would
+// not. Lets the lending chaincode check a collection before making it when the
+// token ledger runs as a chaincode of its own. A debit spending the account's
+// earmark names it in consumed.
+func (t *TokenContract) GetDebitRefusal(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+	amount string,
+	consumed string,
+) (string, error) {
+	value, err := ParseAmount(amount)
+	if err != nil {
+		return "", err
+	}
+
+	var earmarks []string
+	if consumed != "" {
+		earmarks = append(earmarks, consumed)
+	}
+	err = CheckDebit(ctx, account, value, earmarks...)
+	if err != nil {
+		return err.Error(), nil
+	}
+	return "", nil
+}
+
+// Issue new tokens to an existing account
+func (t *TokenContract) Mint(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+	amount string,
+) error {
+	err := ClaimRequestID(ctx, "Mint")
+	if err != nil {
+		return err
+	}
+
+	err = requireIssuer(ctx, "mint tokens")
+	if err != nil {
+		return err
+	}
+	value, err := ParseAmount(amount)
+	if err != nil {
+		return err
+	}
+	if value.Sign() <= 0 {
+		return fmt.Errorf("mint amount must be positive")
+	}
+
+	err = ScreenParties(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	err = addDelta(ctx, account, "", value, "MINT", "")
+	if err != nil {
+		return err
+	}
+	err = addSupply(ctx, value, new(big.Rat))
+	if err != nil {
+		return err
+	}
+
+	event, err := NewTokenEvent(ctx, "MINT", "", account, value, "MINT", "")
+	if err != nil {
+		return err
+	}
+	return emitTokenEvent(ctx, EventMint, event)
+}
+
+// Withdraw tokens from circulation
+func (t *TokenContract) Burn(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+	amount string,
+) error {
+	err := ClaimRequestID(ctx, "Burn")
+	if err != nil {
+		return err
+	}
+
+	err = requireIssuer(ctx, "burn tokens")
+	if err != nil {
+		return err
+	}
+	value, err := ParseAmount(amount)
+	if err != nil {
+		return err
+	}
+	if value.Sign() <= 0 {
+		return fmt.Errorf("burn amount must be positive")
+	}
+
+	balance, err := BalanceOf(ctx, account)
+	if err != nil {
+		return err
+	}
+	if balance.Cmp(value) < 0 {
+		return fmt.Errorf("insufficient funds in account %s", account)
+	}
+
+	err = addDelta(ctx, account, "", new(big.Rat).Neg(value), "BURN", "")
+	if err != nil {
+		return err
+	}
+	err = addSupply(ctx, new(big.Rat), value)
+	if err != nil {
+		return err
+	}
+
+	event, err := NewTokenEvent(ctx, "BURN", account, "", value, "BURN", "")
+	if err != nil {
+		return err
+	}
+	return emitTokenEvent(ctx, EventBurn, event)
+}
+
+// Set an account's balance, issuer only. The difference from the current
+// balance is issued or withdrawn like a mint or burn, so the balances keep
+// adding up to the tokens in circulation.
+func (t *TokenContract) UpdateBalance(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+	newBalance string,
+) error {
+	err := ClaimRequestID(ctx, "UpdateBalance")
+	if err != nil {
+		return err
+	}
+
+	err = requireIssuer(ctx, "adjust balances")
+	if err != nil {
+		return err
+	}
+	value, err := ParseAmount(newBalance)
+	if err != nil {
+		return err
+	}
+	if value.Sign() < 0 {
+		return fmt.Errorf("balance must not be negative")
+	}
+
+	err = requireAccount(ctx, account)
+	if err != nil {
+		return err
+	}
+	previous, err := BalanceOf(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	err = setBalance(ctx, account, value)
+	if err != nil {
+		return err
+	}
+
+	change := new(big.Rat).Sub(value, previous)
+	switch change.Sign() {
+	case 1:
+		return addSupply(ctx, change, new(big.Rat))
+	case -1:
+		return addSupply(ctx, new(big.Rat), change.Neg(change))
+	}
+	return nil
+}
+
+// Sets an account's base balance, recording any change from its current
+// balance as an adjustment on its statement
+func setBalance(
+	ctx contractapi.TransactionContextInterface,
+	account string,
+	value *big.Rat,
+) error {
+	previous, deltaKeys, err := sumDeltas(ctx, account)
+	if err != nil {
+		return err
+	}
+	previousJSON, err := ctx.GetStub().GetState(account)
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if previousJSON != nil {
+		var base TokenBalance
+		err = json.Unmarshal(previousJSON, &base)
+		if err != nil {
+			return err
+		}
+		previous.Add(previous, base.Balance.Rat())
+	}
+	for _, deltaKey := range deltaKeys {
+		err = ctx.GetStub().DelState(deltaKey)
+		if err != nil {
+			return fmt.Errorf("failed to delete balance delta: %v", err)
+		}
+	}
+
+	change := new(big.Rat).Sub(value, previous)
+	if change.Sign() != 0 {
+		err = putAccountMovement(ctx, account, "", change, reasonAdjustment, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	balance := TokenBalance{
+		Account: account,
+		Balance: NewAmount(value),
+	}
+
+	balanceJSON, err := json.Marshal(balance)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(account, balanceJSON)
+}
+
+func requireIssuer(ctx contractapi.TransactionContextInterface, action string) error {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to read client MSP ID: %v", err)
+	}
+	if mspID != issuerMSP {
+		return fmt.Errorf("caller from %s is not authorized to %s", mspID, action)
+	}
+	return nil
+}
+
+// Builds the event payload of a token movement in the current transaction
+func NewTokenEvent(
+	ctx contractapi.TransactionContextInterface,
+	movement string,
+	from string,
+	to string,
+	amount *big.Rat,
+	reason string,
+	loanID string,
+) (*TokenEventV1, error) {
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client MSP ID: %v", err)
+	}
+	id, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client identity: %v", err)
+	}
+
+	return &TokenEventV1{
+		SchemaVersion: 1,
+		Type:          movement,
+		From:          from,
+		To:            to,
+		Amount:        NewAmount(amount).Float64(),
+		Reason:        reason,
+		LoanID:        loanID,
+		TxID:          ctx.GetStub().GetTxID(),
+		Timestamp:     time.Unix(timestamp.GetSeconds(), 0).UTC().Format(time.RFC3339),
+		SubmitterMSP:  mspID,
+		SubmitterID:   id,
+		Value:         NewAmount(amount),
+	}, nil
+}
+
+func emitTokenEvent(
+	ctx contractapi.TransactionContextInterface,
+	name string,
+	event *TokenEventV1,
+) error {
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().SetEvent(name, eventJSON)
+}
+
+// Transaction time as RFC3339
+func txTimestamp(ctx contractapi.TransactionContextInterface) (string, error) {
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return "", fmt.Errorf("failed to read transaction timestamp: %v", err)
+	}
+	return time.Unix(timestamp.GetSeconds(), 0).UTC().Format(time.RFC3339), nil
+}
+
+// Stores a record as JSON under a composite key
+func putRecord(
+	ctx contractapi.TransactionContextInterface,
+	objectType string,
+	attributes []string,
+	record interface{},
+) error {
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	recordKey, err := ctx.GetStub().CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return fmt.Errorf("failed to create record key: %v", err)
+	}
+
+	return ctx.GetStub().PutState(recordKey, recordJSON)
+}
+
+// Loads the record under a composite key, reporting whether it exists
+func getRecord(
+	ctx contractapi.TransactionContextInterface,
+	objectType string,
+	attributes []string,
+	record interface{},
+) (bool, error) {
+	recordKey, err := ctx.GetStub().CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return false, fmt.Errorf("failed to create record key: %v", err)
+	}
+
+	recordJSON, err := ctx.GetStub().GetState(recordKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to read from world state: %v", err)
+	}
+	if recordJSON == nil {
+		return false, nil
+	}
+
+	return true, json.Unmarshal(recordJSON, record)
+}
+
+// Bookmarks of composite key queries are state keys, whose NUL delimiters
+// the lending chaincode refuses in transaction arguments, so clients are
+// handed bookmarks encoded and pass them back as they got them
+func EncodeBookmark(bookmark string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(bookmark))
+}
+
+// The state database bookmark a client's bookmark stands for
+func DecodeBookmark(bookmark string) (string, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(bookmark)
+	if err != nil {
+		return "", fmt.Errorf("invalid bookmark %s", bookmark)
+	}
+	return string(decoded), nil
+}
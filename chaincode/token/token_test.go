@@ -0,0 +1,275 @@
+package token
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/bench"
+	"lending/internal/mockstub"
+)
+
+// InitLedger runs once, for the issuer, and never resets balances or the
+// supply record once tokens were minted
+func TestInitLedger(t *testing.T) {
+	tests := []struct {
+		name    string
+		caller  mockstub.Identity
+		minted  bool // initialized, then 5000 minted to SBI and its balance pruned
+		wantErr string
+	}{
+		{"issuer", issuer, false, ""},
+		{"bank", sbi, false, "not authorized to initialize the ledger"},
+		{"issuer again", issuer, true, "already initialized"},
+		{"bank again", sbi, true, "not authorized to initialize the ledger"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &testLedger{tb: t, stub: mockstub.New(), contract: new(TokenContract)}
+			wantSBI, wantMinted := "500000.00", "2000000.00"
+			if tt.minted {
+				l.must(issuer, func(ctx contractapi.TransactionContextInterface) error {
+					return l.contract.InitLedger(ctx)
+				})
+				l.must(issuer, func(ctx contractapi.TransactionContextInterface) error {
+					return l.contract.Mint(ctx, "SBI", "5000")
+				})
+				l.must(sbi, func(ctx contractapi.TransactionContextInterface) error {
+					_, err := l.contract.PruneBalance(ctx, "SBI")
+					return err
+				})
+				wantSBI, wantMinted = "505000.00", "2005000.00"
+			}
+
+			err := l.submit(tt.caller, func(ctx contractapi.TransactionContextInterface) error {
+				return l.contract.InitLedger(ctx)
+			})
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				if !tt.minted {
+					return
+				}
+			}
+
+			l.must(issuer, func(ctx contractapi.TransactionContextInterface) error {
+				balance, err := l.contract.GetBalance(ctx, "SBI")
+				if err != nil {
+					return err
+				}
+				if balance != wantSBI {
+					t.Errorf("balance of SBI = %s, want %s", balance, wantSBI)
+				}
+				supply, err := l.contract.GetTotalSupply(ctx)
+				if err != nil {
+					return err
+				}
+				if supply.Minted != Amount(wantMinted) {
+					t.Errorf("minted = %s, want %s", supply.Minted, wantMinted)
+				}
+				return nil
+			})
+		})
+	}
+}
+
+// Transfers move a positive amount for a known reason out of an account the
+// caller's organization operates, and only within its available balance
+func TestTransferTokens(t *testing.T) {
+	tests := []struct {
+		name     string
+		caller   mockstub.Identity
+		from     string
+		amount   string
+		reason   string
+		wantErr  string
+		wantFrom string
+		wantTo   string
+	}{
+		{"settlement", hdfc, "HDFC", "1250.50", ReasonSettlement, "", "498749.50", "501250.50"},
+		{"whole balance", hdfc, "HDFC", "500000", ReasonSettlement, "", "0.00", "1000000.00"},
+		{"zero", hdfc, "HDFC", "0", ReasonSettlement, "must be positive", "500000.00", "500000.00"},
+		{"negative", hdfc, "HDFC", "-5", ReasonSettlement, "must be positive", "500000.00", "500000.00"},
+		{"malformed", hdfc, "HDFC", "12.3.4", ReasonSettlement, "invalid amount", "500000.00", "500000.00"},
+		{"another bank's account", sbi, "HDFC", "100", ReasonSettlement, "does not operate account HDFC", "500000.00", "500000.00"},
+		{"regulator on a bank's account", issuer, "HDFC", "100", ReasonSettlement, "does not operate account HDFC", "500000.00", "500000.00"},
+		{"overdraft", hdfc, "HDFC", "500000.01", ReasonSettlement, "insufficient funds in account HDFC", "500000.00", "500000.00"},
+		{"unknown reason", hdfc, "HDFC", "100", "GIFT", "invalid transfer reason", "500000.00", "500000.00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLedger(t)
+
+			err := l.submit(tt.caller, func(ctx contractapi.TransactionContextInterface) error {
+				return l.contract.TransferTokens(ctx, tt.from, "SBI", tt.amount, tt.reason, "REF1")
+			})
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+
+			l.must(issuer, func(ctx contractapi.TransactionContextInterface) error {
+				for account, want := range map[string]string{tt.from: tt.wantFrom, "SBI": tt.wantTo} {
+					balance, err := l.contract.GetBalance(ctx, account)
+					if err != nil {
+						return err
+					}
+					if balance != want {
+						t.Errorf("balance of %s = %s, want %s", account, balance, want)
+					}
+				}
+				return nil
+			})
+		})
+	}
+}
+
+// Transfers between two banks, each committed before the next, so the cost
+// includes the balance deltas and statement entries every transfer adds
+func BenchmarkTransferTokens(b *testing.B) {
+	l := newTestLedger(b)
+
+	bench.Benchmark(b, l.stub, l.settlement("HDFC", "SBI"))
+}
+
+// What a transfer adds to the state stays the same as transfers between the
+// same accounts pile up
+func TestTransferTokensStateGrowth(t *testing.T) {
+	l := newTestLedger(t)
+
+	settle := l.settlement("HDFC", "SBI")
+	first := bench.Run(l.stub, "TransferTokens", 50, settle)
+	later := bench.Run(l.stub, "TransferTokens", 50, func(n int) error { return settle(50 + n) })
+	if testing.Verbose() {
+		first.Report(os.Stdout)
+		later.Report(os.Stdout)
+	}
+
+	if first.Failed+later.Failed > 0 {
+		t.Fatalf("%d transfers failed", first.Failed+later.Failed)
+	}
+	firstKeys, firstBytes := first.Growth()
+	laterKeys, laterBytes := later.Growth()
+	if laterKeys > firstKeys || laterBytes > firstBytes*1.05 {
+		t.Errorf("transfers add %.1f keys, %.0f bytes each after 50, %.1f keys, %.0f bytes before",
+			laterKeys, laterBytes, firstKeys, firstBytes)
+	}
+}
+
+// Submits the n-th settlement of 0.01 between two banks
+func (l *testLedger) settlement(from string, to string) func(n int) error {
+	return func(n int) error {
+		return l.submit(hdfc, func(ctx contractapi.TransactionContextInterface) error {
+			return l.contract.TransferTokens(ctx, from, to, "0.01", ReasonSettlement, fmt.Sprintf("SETTLE%d", n))
+		})
+	}
+}
+
+// Two movements between the same accounts in one transaction are both kept,
+// each delta under a key of its own
+func TestTransferTwiceInOneTransaction(t *testing.T) {
+	l := newTestLedger(t)
+
+	l.must(hdfc, func(ctx contractapi.TransactionContextInterface) error {
+		for _, amount := range []string{"100", "250"} {
+			value, err := ParseAmount(amount)
+			if err != nil {
+				return err
+			}
+			_, err = Transfer(ctx, "HDFC", "SBI", value, ReasonSettlement, "REF1")
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	l.must(issuer, func(ctx contractapi.TransactionContextInterface) error {
+		for account, want := range map[string]string{"HDFC": "499650.00", "SBI": "500350.00"} {
+			balance, err := l.contract.GetBalance(ctx, account)
+			if err != nil {
+				return err
+			}
+			if balance != want {
+				t.Errorf("balance of %s = %s, want %s", account, balance, want)
+			}
+		}
+		return nil
+	})
+
+	// Movements need the context numbering their deltas
+	ctx := new(contractapi.TransactionContext)
+	ctx.SetStub(l.stub)
+	ctx.SetClientIdentity(hdfc)
+	_, err := Transfer(ctx, "HDFC", "SBI", big.NewRat(1, 1), ReasonSettlement, "REF2")
+	if err == nil || !strings.Contains(err.Error(), "require the token transaction context") {
+		t.Errorf("transfer with a plain context: error = %v", err)
+	}
+	l.stub.Rollback()
+}
+
+// Balances page through the registry in account ID order, and a transaction
+// listing them can still write
+func TestGetAccountBalances(t *testing.T) {
+	l := newTestLedger(t)
+	for i := 0; i < 5; i++ {
+		l.must(issuer, func(ctx contractapi.TransactionContextInterface) error {
+			return l.contract.CreateAccount(ctx, fmt.Sprintf("B%d", i), "BORROWER", "HDFCMSP", nil)
+		})
+	}
+
+	var all *AccountPage
+	l.must(issuer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		all, err = l.contract.GetAccountBalances(ctx, 1000, "")
+		return err
+	})
+	if all.Bookmark != "" || len(all.Accounts) < 5 {
+		t.Fatalf("got %d accounts and bookmark %q in one page", len(all.Accounts), all.Bookmark)
+	}
+
+	accounts := []string{}
+	bookmark := ""
+	for {
+		var page *AccountPage
+		l.must(issuer, func(ctx contractapi.TransactionContextInterface) error {
+			var err error
+			page, err = l.contract.GetAccountBalances(ctx, 2, bookmark)
+			if err != nil {
+				return err
+			}
+			return l.contract.Mint(ctx, "B0", "1")
+		})
+		if len(page.Accounts) > 2 {
+			t.Fatalf("page of %d accounts, want at most 2", len(page.Accounts))
+		}
+		for _, account := range page.Accounts {
+			accounts = append(accounts, account.AccountID)
+		}
+		if page.Bookmark == "" {
+			break
+		}
+		bookmark = page.Bookmark
+	}
+
+	if len(accounts) != len(all.Accounts) {
+		t.Fatalf("paged %d accounts, want %d", len(accounts), len(all.Accounts))
+	}
+	for i, account := range all.Accounts {
+		if accounts[i] != account.AccountID {
+			t.Errorf("account %d is %s, want %s", i, accounts[i], account.AccountID)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package token
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Transaction context of the token ledger, which numbers the balance deltas
+// and AML cases the transaction writes so that two movements between the same
+// accounts keep keys of their own. A new context is created for every
+// transaction.
+type TransactionContext struct {
+	contractapi.TransactionContext
+	records int // deltas and cases numbered so far
+}
+
+// Sequence number of the next delta or case the transaction writes
+func (ctx *TransactionContext) nextRecord() int {
+	ctx.records++
+	return ctx.records
+}
+
+// Implemented by TransactionContext and the contexts embedding it
+type recordSequence interface {
+	nextRecord() int
+}
+
+// Numbers a record of the transaction, failing for contexts that cannot
+func nextRecord(ctx contractapi.TransactionContextInterface) (int, error) {
+	sequence, ok := ctx.(recordSequence)
+	if !ok {
+		return 0, fmt.Errorf("token movements require the token transaction context, got %T", ctx)
+	}
+	return sequence.nextRecord(), nil
+}
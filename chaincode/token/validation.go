@@ -0,0 +1,263 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Limits on transaction arguments
+const (
+	maxArgumentLength = 64 * 1024 // any argument, JSON documents included
+	maxIDLength       = 128       // IDs, references, hashes, codes and dates
+	maxTextLength     = 1024      // descriptions, reasons and other free text
+	maxBookmarkLength = 4096      // bookmarks, which encode state database keys
+)
+
+// Returned for a transaction argument failing validation, before the
+// transaction runs
+type ArgumentError struct {
+	Function string
+	Argument string
+	Reason   string
+}
+
+func (e *ArgumentError) Error() string {
+	return fmt.Sprintf("invalid argument %s of %s: %s", e.Argument, e.Function, e.Reason)
+}
+
+// A named positional argument of a transaction and the check it must pass
+type ArgumentRule struct {
+	Name  string
+	Check func(value string) string // reason the value is invalid, empty if valid
+}
+
+// Argument rules of the token ledger's transactions, a rule for every
+// parameter in parameter order
+var transactionArgs = map[string][]ArgumentRule{
+	"InitLedger":                {},
+	"GetTotalSupply":            {},
+	"CreateAccount":             {IDArg("accountID"), IDArg("accountType"), IDArg("orgMSP"), JSONArg("metadata")},
+	"GetAllAccounts":            {CountArg("pageSize"), BookmarkArg("bookmark")},
+	"GetAccountBalances":        {CountArg("pageSize"), BookmarkArg("bookmark")},
+	"ExportAccounts":            {OptionalIDArg("cursor"), CountArg("limit")},
+	"MigrateBalances":           {CountArg("batchSize"), OptionalIDArg("bookmark")},
+	"GetAccountInfo":            {IDArg("accountID")},
+	"GetBalance":                {IDArg("account")},
+	"GetAvailableBalance":       {IDArg("account")},
+	"Mint":                      {IDArg("account"), AmountArg("amount")},
+	"Burn":                      {IDArg("account"), AmountArg("amount")},
+	"UpdateBalance":             {IDArg("account"), BalanceArg("newBalance")},
+	"TransferTokens":            {IDArg("from"), IDArg("to"), AmountArg("amount"), IDArg("reason"), IDArg("reference")},
+	"TransferTokensWithReason":  {IDArg("from"), IDArg("to"), AmountArg("amount"), IDArg("reason"), OptionalIDArg("loanID"), OptionalIDArg("consumed")},
+	"SetLendingChaincode":       {OptionalIDArg("chaincodeName")},
+	"GetLendingChaincode":       {},
+	"GrantDebitAuthority":       {IDArg("accountID"), IDArg("chaincodeName")},
+	"RevokeDebitAuthority":      {IDArg("accountID"), IDArg("chaincodeName")},
+	"PruneBalance":              {IDArg("account")},
+	"GetAccountStatement":       {IDArg("account"), IDArg("fromDate"), IDArg("toDate"), CountArg("pageSize"), BookmarkArg("bookmark")},
+	"LockFunds":                 {IDArg("escrowID"), IDArg("payer"), IDArg("payee"), AmountArg("amount"), OptionalIDArg("arbiterMSP"), TextArg("reference")},
+	"ReleaseFunds":              {IDArg("escrowID"), IDArg("to")},
+	"RefundFunds":               {IDArg("escrowID")},
+	"GetEscrow":                 {IDArg("escrowID")},
+	"HoldFunds":                 {IDArg("from"), AmountArg("amount"), IDArg("ref")},
+	"CaptureHold":               {IDArg("ref"), IDArg("to")},
+	"ReleaseHold":               {IDArg("ref")},
+	"GetHold":                   {IDArg("ref")},
+	"SetDebitLimit":             {IDArg("accountID"), WholeNumberArg("maxCount"), BalanceArg("maxValue")},
+	"GetDebitLimit":             {IDArg("accountID")},
+	"GetDebitUsage":             {IDArg("accountID")},
+	"GetDebitRefusal":           {IDArg("account"), AmountArg("amount"), OptionalIDArg("consumed")},
+	"PlaceEarmark":              {IDArg("account"), IDArg("reference"), AmountArg("amount")},
+	"IncreaseEarmark":           {IDArg("account"), IDArg("reference"), AmountArg("amount")},
+	"DrawEarmark":               {IDArg("account"), IDArg("reference"), AmountArg("amount")},
+	"ReleaseEarmark":            {IDArg("account"), IDArg("reference")},
+	"CloseAMLCase":              {IDArg("caseID"), IDArg("disposition"), TextArg("notes")},
+	"GetAMLCase":                {IDArg("caseID")},
+	"GetAMLCases":               {IDArg("status"), CountArg("pageSize"), BookmarkArg("bookmark")},
+	"SetAMLPolicy":              {JSONArg("policyJSON")},
+	"GetAMLPolicy":              {},
+	"AddNegativeListEntry":      {IDArg("hash"), IDArg("list"), TextArg("reason")},
+	"RemoveNegativeListEntry":   {IDArg("hash")},
+	"OverrideNegativeListMatch": {IDArg("accountID"), IDArg("hash"), RequiredTextArg("reason")},
+	"ScreenAccount":             {IDArg("accountID")},
+	"GetProcessedRequest":       {IDArg("requestID")},
+}
+
+// ============== Input Validation ==============
+
+// Runs before every transaction of the token chaincode, see CheckArguments
+func ValidateArguments(ctx contractapi.TransactionContextInterface) error {
+	function, args := ctx.GetStub().GetFunctionAndParameters()
+	if separator := strings.LastIndex(function, ":"); separator >= 0 {
+		function = function[separator+1:]
+	}
+	return CheckArguments(function, args, ArgumentRules(function))
+}
+
+// Argument rules of a token ledger transaction, nil for other functions
+func ArgumentRules(function string) []ArgumentRule {
+	return transactionArgs[function]
+}
+
+// Each argument must be valid UTF-8 without NUL characters, which delimit
+// composite keys, and within maxArgumentLength, and must pass the rule the
+// transaction has for it
+func CheckArguments(function string, args []string, rules []ArgumentRule) error {
+	for i, value := range args {
+		name := fmt.Sprintf("#%d", i+1)
+		if i < len(rules) {
+			name = rules[i].Name
+		}
+
+		reason := ""
+		switch {
+		case !utf8.ValidString(value):
+			reason = "is not valid UTF-8"
+		case strings.ContainsRune(value, 0):
+			reason = "contains a NUL character"
+		case len(value) > maxArgumentLength:
+			reason = fmt.Sprintf("exceeds %d bytes", maxArgumentLength)
+		case i < len(rules):
+			reason = rules[i].Check(value)
+		}
+		if reason != "" {
+			return &ArgumentError{Function: function, Argument: name, Reason: reason}
+		}
+	}
+	return nil
+}
+
+// An identifier, reference, code or date: required, short and free of
+// whitespace and control characters
+func IDArg(name string) ArgumentRule {
+	return ArgumentRule{Name: name, Check: func(value string) string {
+		if value == "" {
+			return "is required"
+		}
+		return checkID(value)
+	}}
+}
+
+// An identifier that may be left empty
+func OptionalIDArg(name string) ArgumentRule {
+	return ArgumentRule{Name: name, Check: func(value string) string {
+		if value == "" {
+			return ""
+		}
+		return checkID(value)
+	}}
+}
+
+func checkID(value string) string {
+	if utf8.RuneCountInString(value) > maxIDLength {
+		return fmt.Sprintf("exceeds %d characters", maxIDLength)
+	}
+	if strings.IndexFunc(value, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0 {
+		return "contains whitespace or control characters"
+	}
+	return ""
+}
+
+// Free text, which may be empty
+func TextArg(name string) ArgumentRule {
+	return ArgumentRule{Name: name, Check: checkText}
+}
+
+// Free text that must be given
+func RequiredTextArg(name string) ArgumentRule {
+	return ArgumentRule{Name: name, Check: func(value string) string {
+		if strings.TrimSpace(value) == "" {
+			return "is required"
+		}
+		return checkText(value)
+	}}
+}
+
+func checkText(value string) string {
+	if utf8.RuneCountInString(value) > maxTextLength {
+		return fmt.Sprintf("exceeds %d characters", maxTextLength)
+	}
+	if strings.IndexFunc(value, func(r rune) bool { return unicode.IsControl(r) && r != '\n' && r != '\t' }) >= 0 {
+		return "contains control characters"
+	}
+	return ""
+}
+
+// A positive decimal token amount
+func AmountArg(name string) ArgumentRule {
+	return ArgumentRule{Name: name, Check: func(value string) string {
+		parsed, err := ParseAmount(value)
+		if err != nil {
+			return err.Error()
+		}
+		if parsed.Sign() <= 0 {
+			return "must be greater than 0"
+		}
+		return ""
+	}}
+}
+
+// A decimal token balance, which may be zero
+func BalanceArg(name string) ArgumentRule {
+	return ArgumentRule{Name: name, Check: func(value string) string {
+		parsed, err := ParseAmount(value)
+		if err != nil {
+			return err.Error()
+		}
+		if parsed.Sign() < 0 {
+			return "must not be negative"
+		}
+		return ""
+	}}
+}
+
+// A positive whole number, such as a page or batch size
+func CountArg(name string) ArgumentRule {
+	return ArgumentRule{Name: name, Check: func(value string) string {
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 1 {
+			return "must be a positive whole number"
+		}
+		return ""
+	}}
+}
+
+// A whole number that may be zero
+func WholeNumberArg(name string) ArgumentRule {
+	return ArgumentRule{Name: name, Check: func(value string) string {
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 0 {
+			return "must be a whole number of 0 or more"
+		}
+		return ""
+	}}
+}
+
+// A bookmark returned by a paged query, empty for the first page
+func BookmarkArg(name string) ArgumentRule {
+	return ArgumentRule{Name: name, Check: func(value string) string {
+		if len(value) > maxBookmarkLength {
+			return fmt.Sprintf("exceeds %d bytes", maxBookmarkLength)
+		}
+		if strings.IndexFunc(value, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0 {
+			return "contains whitespace or control characters"
+		}
+		return ""
+	}}
+}
+
+// A JSON document, such as a policy or a metadata object
+func JSONArg(name string) ArgumentRule {
+	return ArgumentRule{Name: name, Check: func(value string) string {
+		if !json.Valid([]byte(value)) {
+			return "is not valid JSON"
+		}
+		return ""
+	}}
+}
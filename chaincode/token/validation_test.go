@@ -0,0 +1,38 @@
+package token
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Every transaction of the token ledger has a rule for each of its
+// parameters, and every rule set belongs to a transaction with that many
+// parameters
+func TestTransactionArgs(t *testing.T) {
+	system := reflect.TypeOf(new(contractapi.Contract))
+	contract := reflect.TypeOf(new(TokenContract))
+	for i := 0; i < contract.NumMethod(); i++ {
+		method := contract.Method(i)
+		if _, found := system.MethodByName(method.Name); found {
+			continue
+		}
+
+		rules, found := transactionArgs[method.Name]
+		if !found {
+			t.Errorf("%s has no argument rules", method.Name)
+			continue
+		}
+		// The receiver and the transaction context take no argument
+		if parameters := method.Type.NumIn() - 2; len(rules) != parameters {
+			t.Errorf("%s has %d argument rules for %d parameters", method.Name, len(rules), parameters)
+		}
+	}
+
+	for function := range transactionArgs {
+		if _, found := contract.MethodByName(function); !found {
+			t.Errorf("argument rules of %s match no transaction", function)
+		}
+	}
+}
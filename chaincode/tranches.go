@@ -0,0 +1,339 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Part of a loan's principal paid out on its own date. Each tranche accrues
+// interest from its disbursement to the loan's due date, at the borrower's
+// rate when it was disbursed.
+type Tranche struct {
+	TrancheID   string       `json:"trancheId,omitempty" metadata:",optional"` // empty for tranches disbursed before IDs were assigned
+	Amount      token.Amount `json:"amount"`
+	Rate        Decimal      `json:"rate"`        // interest rate less subvention at disbursement
+	DisbursedAt string       `json:"disbursedAt"` // RFC3339
+	TxID        string       `json:"txId"`
+}
+
+// Interest a tranche has accrued by a date
+type TrancheAccrual struct {
+	Tranche     int          `json:"tranche"`
+	Amount      token.Amount `json:"amount"`
+	Rate        Decimal      `json:"rate"`
+	DisbursedAt string       `json:"disbursedAt"`
+	Interest    token.Amount `json:"interest"`
+}
+
+// Interest of a loan disbursed in tranches by a date. The blended rate is the
+// rate of the tranches weighted by their principal and the share of the term
+// they are out for. The effective rate charges the same interest over the term
+// on the sanctioned amount, as if it had all been out from the first tranche.
+type TrancheInterest struct {
+	LoanID        string           `json:"loanId"`
+	AsOf          string           `json:"asOf"`
+	Sanctioned    token.Amount     `json:"sanctioned"`
+	Disbursed     token.Amount     `json:"disbursed"`
+	Undisbursed   token.Amount     `json:"undisbursed"`
+	Interest      token.Amount     `json:"interest"`
+	BlendedRate   Decimal          `json:"blendedRate"`
+	EffectiveRate Decimal          `json:"effectiveRate"`
+	Tranches      []TrancheAccrual `json:"tranches"`
+}
+
+// ============== Tranche Disbursement ==============
+
+// Disburse part of a loan's principal. The first tranche disburses an
+// APPROVED loan, charging its fees and starting its term, later tranches add
+// to an ACTIVE one until the sanctioned amount is out. Each tranche is paid
+// out of the funds reserved at approval and its interest runs from its own
+// disbursement, so the repayment due grows with every tranche. Lender only.
+func (s *SmartContract) DisburseTranche(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	amount string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "DisburseTranche")
+	if err != nil {
+		return nil, err
+	}
+	value, err := parseAmount(amount)
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	err = s.requireLender(ctx, loan.LenderID)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rounding := config.Rounding
+
+	first := loan.Status == "APPROVED"
+	switch {
+	case first:
+		err = requireApprovalCurrent(ctx, loan, config)
+		if err != nil {
+			return nil, err
+		}
+	case loan.Status == "ACTIVE" && len(loan.Tranches) > 0:
+	default:
+		return nil, fmt.Errorf("loan %s cannot be disbursed in tranches in current status: %s", loanID, loan.Status)
+	}
+
+	// Each tranche of a floating rate loan is priced at the current fixing
+	err = repriceFloatingRate(ctx, loan, config)
+	if err != nil {
+		return nil, err
+	}
+
+	undisbursed := ratSub(loan.Amount.Rat(), trancheTotal(loan))
+	if value.Sign() <= 0 {
+		return nil, fmt.Errorf("tranche amount must be positive")
+	}
+	if value.Cmp(undisbursed) > 0 {
+		return nil, fmt.Errorf("tranche of %s exceeds the %s undisbursed on loan %s", token.FormatAmount(value), token.FormatAmount(undisbursed), loanID)
+	}
+
+	// The undrawn commitment is charged for up to this tranche
+	err = s.chargeCommitmentFee(ctx, loan, config)
+	if err != nil {
+		return nil, err
+	}
+
+	// The processing fee is priced on the sanctioned amount and deducted from
+	// the first tranche
+	paid := value
+	if first {
+		processingFee, err := s.issueFeeInvoice(ctx, loan, feeProcessing, config.Fees.ProcessingRate, loan.LenderID, loan.BorrowerID, config)
+		if err != nil {
+			return nil, err
+		}
+		if processingFee != nil {
+			paid = ratSub(value, processingFee.Total.Rat())
+			if paid.Sign() <= 0 {
+				return nil, fmt.Errorf("processing fee of %s leaves nothing to disburse", processingFee.Total)
+			}
+		}
+	}
+
+	reserved, err := s.drawReservation(ctx, loan, value)
+	if err != nil {
+		return nil, err
+	}
+	transfer, err := s.settleFrom(ctx, loan.LenderID, loan.BorrowerID, paid, token.ReasonDisbursement, loanID, reserved)
+	if err != nil {
+		return nil, err
+	}
+
+	if first {
+		platformFee, err := s.issueFeeInvoice(ctx, loan, feePlatform, config.Fees.PlatformRate, config.Fees.PlatformAccount, loan.LenderID, config)
+		if err != nil {
+			return nil, err
+		}
+		if platformFee != nil {
+			_, err = s.settleFrom(ctx, loan.LenderID, config.Fees.PlatformAccount, platformFee.Total.Rat(), token.ReasonPlatformFee, loanID, reserved)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Penal and other charges are part of the repayment due, only the change
+	// in principal and interest is applied
+	due := repaymentDue(loan, rounding)
+	if first {
+		err = s.startTerm(ctx, loan)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	disbursedAt, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	trancheID, err := nextRecordID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tranche := &Tranche{
+		TrancheID:   trancheID,
+		Amount:      token.NewAmount(value),
+		Rate:        newRate(ratSub(loan.InterestRate.Rat(), loan.SubventionRate.Rat())),
+		DisbursedAt: disbursedAt.Format(time.RFC3339),
+		TxID:        ctx.GetStub().GetTxID(),
+	}
+	loan.Tranches = append(loan.Tranches, tranche)
+
+	change := ratSub(repaymentDue(loan, rounding).Rat(), due.Rat())
+	loan.RepaymentDue = rounding.amount(ratAdd(loan.RepaymentDue.Rat(), change))
+	loan.RemainingBalance = rounding.amount(ratAdd(loan.RemainingBalance.Rat(), change))
+	loan.BlendedRate = newRate(rounding.round(blendedRate(loan)))
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Tranche %d of %s disbursed at %s%%, blended rate %s%% (TxID: %s)",
+			len(loan.Tranches),
+			tranche.Amount,
+			tranche.Rate,
+			loan.BlendedRate,
+			ctx.GetStub().GetTxID()))
+
+	err = s.putLoan(ctx, loan)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.withSchedule(ctx, loan, newLoanResult(ctx, loan))
+	if err != nil {
+		return nil, err
+	}
+	result.TrancheID = tranche.TrancheID
+
+	header, err := newLoanEventHeader(ctx, loanID, 2)
+	if err != nil {
+		return nil, err
+	}
+	return result.emit(ctx, eventLoanTrancheDisbursed, LoanTrancheDisbursedEventV2{
+		LoanEventHeader: header,
+		BorrowerID:      loan.BorrowerID,
+		LenderID:        loan.LenderID,
+		Tranche:         len(loan.Tranches),
+		TrancheID:       tranche.TrancheID,
+		Amount:          tranche.Amount,
+		Disbursed:       token.NewAmount(trancheTotal(loan)),
+		Sanctioned:      loan.Amount,
+		BlendedRate:     loan.BlendedRate,
+		RepaymentDue:    loan.RepaymentDue,
+		DueDate:         loan.DueDate,
+		Transfer:        transfer,
+	})
+}
+
+// Interest accrued by each tranche of a loan at asOfDate (YYYY-MM-DD or
+// RFC3339), now when empty
+func (s *SmartContract) GetTrancheInterest(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	asOfDate string,
+) (*TrancheInterest, error) {
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+	if len(loan.Tranches) == 0 {
+		return nil, fmt.Errorf("loan %s has not been disbursed in tranches", loanID)
+	}
+
+	asOf, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if asOfDate != "" {
+		asOf, err = parseDate(asOfDate)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	config, err := s.GetConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rounding := config.Rounding
+
+	report := TrancheInterest{
+		LoanID:      loanID,
+		AsOf:        asOf.Format(time.RFC3339),
+		Sanctioned:  loan.Amount,
+		Disbursed:   token.NewAmount(trancheTotal(loan)),
+		Undisbursed: token.NewAmount(ratSub(loan.Amount.Rat(), trancheTotal(loan))),
+		Interest:    token.NewAmount(interestAccrued(loan, asOf, rounding)),
+		BlendedRate: newRate(rounding.round(blendedRate(loan))),
+		Tranches:    []TrancheAccrual{},
+	}
+	if sanctioned := interestAt(loan, loan.InterestRate.Rat(), ratInt(1)); sanctioned.Sign() > 0 {
+		report.EffectiveRate = newRate(rounding.round(ratQuo(ratMul(loan.InterestRate.Rat(), interestOver(loan, ratInt(1))), sanctioned)))
+	}
+
+	elapsed := termElapsed(loan, asOf)
+	for i, tranche := range loan.Tranches {
+		accrual := TrancheAccrual{
+			Tranche:     i + 1,
+			Amount:      tranche.Amount,
+			Rate:        tranche.Rate,
+			DisbursedAt: tranche.DisbursedAt,
+		}
+		if fraction := ratSub(elapsed, trancheOffset(loan, tranche)); fraction.Sign() > 0 {
+			accrual.Interest = rounding.amount(interestOn(loan, tranche.Amount.Rat(), tranche.Rate.Rat(), fraction))
+		}
+		report.Tranches = append(report.Tranches, accrual)
+	}
+
+	return &report, nil
+}
+
+// Principal lent out so far, the tranches of a loan disbursed in tranches
+// and the sanctioned amount otherwise
+func disbursedPrincipal(loan *Loan) *big.Rat {
+	if len(loan.Tranches) == 0 {
+		return loan.Amount.Rat()
+	}
+	return trancheTotal(loan)
+}
+
+func trancheTotal(loan *Loan) *big.Rat {
+	total := new(big.Rat)
+	for _, tranche := range loan.Tranches {
+		total.Add(total, tranche.Amount.Rat())
+	}
+	return total
+}
+
+// Fraction of the loan term elapsed when a tranche was disbursed
+func trancheOffset(loan *Loan, tranche *Tranche) *big.Rat {
+	disbursedAt, err := time.Parse(time.RFC3339, tranche.DisbursedAt)
+	if err != nil {
+		return new(big.Rat)
+	}
+	return termElapsed(loan, disbursedAt)
+}
+
+// Tranche interest over a fraction of the loan term, each tranche accruing
+// from its own disbursement
+func trancheInterestOver(loan *Loan, fraction *big.Rat) *big.Rat {
+	interest := new(big.Rat)
+	for _, tranche := range loan.Tranches {
+		if accrued := ratSub(fraction, trancheOffset(loan, tranche)); accrued.Sign() > 0 {
+			interest.Add(interest, interestOn(loan, tranche.Amount.Rat(), tranche.Rate.Rat(), accrued))
+		}
+	}
+	return interest
+}
+
+// Rate of the tranches weighted by principal and the share of the term each
+// is out for, the effective rate on the money actually lent
+func blendedRate(loan *Loan) *big.Rat {
+	weighted, weights := new(big.Rat), new(big.Rat)
+	for _, tranche := range loan.Tranches {
+		weight := ratMul(tranche.Amount.Rat(), ratSub(ratInt(1), trancheOffset(loan, tranche)))
+		weighted.Add(weighted, ratMul(weight, tranche.Rate.Rat()))
+		weights.Add(weights, weight)
+	}
+	if weights.Sign() <= 0 {
+		return ratSub(loan.InterestRate.Rat(), loan.SubventionRate.Rat())
+	}
+	return ratQuo(weighted, weights)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Transaction context whose stub memoizes world state reads, so helpers can
+// fetch the same loan, configuration or balance key without another round
+// trip to the peer, and which numbers the records the transaction creates. It
+// extends the token ledger's context, which numbers the balance deltas. A new
+// context is created for every transaction.
+type TransactionContext struct {
+	token.TransactionContext
+	sequence int // records identified by nextRecordID so far
+}
+
+func (ctx *TransactionContext) SetStub(stub shim.ChaincodeStubInterface) {
+	ctx.TransactionContext.SetStub(&cachingStub{
+		ChaincodeStubInterface: stub,
+		state:                  map[string][]byte{},
+	})
+}
+
+// Fabric reads return the state as of the start of the transaction, never its
+// own writes, so a cached value stays valid after the key is written and
+// writes pass straight through
+type cachingStub struct {
+	shim.ChaincodeStubInterface
+	state map[string][]byte
+}
+
+func (stub *cachingStub) GetState(key string) ([]byte, error) {
+	if value, ok := stub.state[key]; ok {
+		return value, nil
+	}
+
+	value, err := stub.ChaincodeStubInterface.GetState(key)
+	if err != nil {
+		return nil, err
+	}
+
+	stub.state[key] = value
+	return value, nil
+}
+
+// Identifies the next record a transaction creates for itself, such as a
+// repayment's receipt, a charge, a tranche or an audit entry, as
+// "<txID>-<n>". Every endorser runs the transaction's calls in the same order,
+// so the IDs agree across endorsements without the client inventing keys.
+// The count is kept on the lending transaction context, any other context
+// could not tell the transaction's records apart.
+func nextRecordID(ctx contractapi.TransactionContextInterface) (string, error) {
+	txContext, ok := ctx.(*TransactionContext)
+	if !ok {
+		return "", fmt.Errorf("record IDs require the lending transaction context, got %T", ctx)
+	}
+	txContext.sequence++
+	return fmt.Sprintf("%s-%d", ctx.GetStub().GetTxID(), txContext.sequence), nil
+}
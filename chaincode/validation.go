@@ -0,0 +1,305 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Limits on loan arguments, those on every argument are the token ledger's.
+// Amounts are exact decimals and have no upper limit.
+const (
+	maxRate           = 100 // percent a year
+	maxDurationMonths = 600
+)
+
+// A named positional argument of a transaction and the check it must pass
+type argRule = token.ArgumentRule
+
+// Rules the lending transactions share with the token ledger's
+var (
+	id           = token.IDArg
+	optionalID   = token.OptionalIDArg
+	text         = token.TextArg
+	requiredText = token.RequiredTextArg
+	document     = token.JSONArg
+	bookmark     = token.BookmarkArg
+	amount       = token.AmountArg  // positive, in rupees to the paisa
+	nonNegative  = token.BalanceArg // an amount that may be zero
+)
+
+// Argument rules of each lending transaction, a rule for every parameter in
+// parameter order, those of the embedded token ledger's transactions are the
+// token package's. Every argument of every transaction also gets the general
+// checks of token.CheckArguments.
+var transactionArgs = map[string][]argRule{
+	// Loans
+	"RequestLoan": {id("loanID"), id("borrowerID"), amount("amount"), rate("interestRate"), months("duration"),
+		text("collateral"), optionalID("product"), optionalID("pslCategory"), optionalID("priorLoanID")},
+	"ApproveLoan":            {id("loanID"), id("lenderID")},
+	"RejectLoan":             {id("loanID"), id("lenderID"), id("reasonCode")},
+	"DisburseLoan":           {id("loanID")},
+	"DisburseTranche":        {id("loanID"), amount("amount")},
+	"RepayLoan":              {id("loanID"), amount("amount"), id("paymentReference")},
+	"PrepayLoan":             {id("loanID"), id("paymentReference")},
+	"MarkAsDefaulted":        {id("loanID"), id("reasonCode")},
+	"CancelWithinCoolingOff": {id("loanID")},
+	"ExpireApproval":         {id("loanID")},
+	"AddCollateral":          {id("loanID"), text("collateral")},
+	"AttachConsent":          {id("loanID"), id("consentID"), id("consentHash"), id("validFrom"), id("validUntil")},
+	"SetInterestMethod":      {id("loanID"), id("method"), wholeNumber("compoundingFrequency")},
+	"SetFloatingRate":        {id("loanID"), id("benchmark"), rate("spread")},
+	"ResetLoanRate":          {id("loanID")},
+	"SetLoanTag":             {id("loanID"), id("key"), text("value")},
+	"PutLoanAnnotation":      {id("loanID")},
+	"ArchiveLoan":            {id("loanID")},
+	"ConsolidateRepayments":  {id("loanID")},
+	"DistributeIncome":       {id("loanID"), id("period")},
+	"RaiseDispute":           {id("loanID"), requiredText("reason")},
+	"RespondToDispute":       {id("loanID"), requiredText("response")},
+	"ResolveDispute":         {id("loanID"), id("outcome"), text("resolution")},
+	"RegisterMandate":        {id("loanID"), id("umrn"), amount("maxAmount")},
+	"CancelMandate":          {id("loanID")},
+	"PostMargin":             {id("loanID"), amount("amount")},
+	"RestructureLoan":        {id("loanID"), id("newDueDate"), requiredText("reason")},
+	"GrantMoratorium":        {id("loanID"), months("months"), requiredText("reason")},
+	"TransferLoanClaim":      {id("loanID"), id("newOwner")},
+	"IssueParticipations":    {id("loanID"), count("totalUnits"), id("distribution")},
+	"TransferParticipations": {id("loanID"), id("from"), id("to"), count("units")},
+	"ProposeNovation":        {id("loanID"), id("newBorrowerID")},
+	"ConsentToNovation":      {id("loanID")},
+	"ApproveNovation":        {id("loanID")},
+	"RejectNovation":         {id("loanID"), requiredText("reason")},
+
+	// Approval authority
+	"SetOfficerLimit":       {id("officerID"), nonNegative("limit")},
+	"RemoveOfficerLimit":    {id("officerID")},
+	"GetOfficerLimit":       {id("orgMSP"), id("officerID")},
+	"GetEscalatedApprovals": {id("lenderID"), count("pageSize"), bookmark("bookmark")},
+
+	// Undrawn commitment
+	"CancelUndrawnCommitment":           {id("loanID"), amount("amount")},
+	"AcknowledgeCommitmentCancellation": {id("loanID")},
+
+	// Cross-channel settlement
+	"DisburseLoanCrossChannel": {id("loanID"), id("settlementChannel")},
+	"ConfirmSettlement":        {id("correlationID"), id("externalTxID")},
+
+	// Collateral
+	"RegisterCollateral":            {id("collateralID"), id("collateralType"), id("ownerID"), text("description")},
+	"ValueCollateral":               {id("collateralID"), amount("value")},
+	"PledgeCollateral":              {id("loanID"), id("collateralID")},
+	"ReleaseCollateralItem":         {id("loanID"), id("collateralID")},
+	"LiquidateCollateral":           {id("loanID"), id("collateralID"), amount("proceeds")},
+	"ProposeCollateralSubstitution": {id("loanID"), id("releaseID"), id("replacementID")},
+	"ApproveCollateralSubstitution": {id("loanID")},
+	"RejectCollateralSubstitution":  {id("loanID"), requiredText("reason")},
+	"SetGoldCollateral":             {id("loanID"), weight("weightGrams"), karats("purity")},
+	"SetGoldRate":                   {amount("ratePerGram")},
+	"RegisterProperty":              {id("propertyID"), id("surveyNumber"), id("ownerID"), text("description")},
+	"PledgeProperty":                {id("loanID"), id("propertyID")},
+	"PledgeVehicle":                 {id("loanID"), id("registrationNumber"), id("chassisNumber")},
+
+	// Invoice financing
+	"RegisterInvoice":    {id("invoiceID"), id("invoiceHash"), id("sellerID"), id("buyerID"), amount("amount"), id("dueDate")},
+	"RequestInvoiceLoan": {id("loanID"), id("invoiceID"), amount("amount"), rate("interestRate"), months("duration")},
+	"RepayInvoiceLoan":   {id("loanID"), amount("amount"), id("paymentReference")},
+
+	// Borrowers
+	"SetBorrowerProfile":       {id("borrowerID"), wholeNumber("creditScore"), wholeNumber("kycTier"), nonNegative("exposureLimit")},
+	"LinkBorrowerIdentity":     {id("borrowerID"), id("idType"), id("idHash")},
+	"SetBorrowerPrivateData":   {id("borrowerID")},
+	"PurgeBorrowerPrivateData": {id("borrowerID")},
+
+	// Subvention
+	"SetSubventionScheme":      {id("schemeID"), requiredText("name"), id("schemeAccount"), rate("subventionRate"), document("products"), boolean("active")},
+	"EnrollInSubventionScheme": {id("loanID"), id("schemeID")},
+	"ClaimSubvention":          {id("lenderID"), id("schemeID"), count("pageSize"), bookmark("bookmark")},
+
+	// Benchmarks
+	"SubmitBenchmarkRate": {id("benchmark"), rate("rate")},
+
+	// Operations
+	"UpdateConfig":         {document("configJSON")},
+	"ProcessDay":           {id("asOfDate"), count("pageSize"), bookmark("bookmark")},
+	"IndexActiveLoans":     {count("batchSize"), bookmark("bookmark")},
+	"CheckApplicationSLAs": {count("pageSize"), bookmark("bookmark")},
+	"NotifyUpcomingDues":   {wholeNumber("daysAhead"), count("pageSize"), bookmark("bookmark")},
+	"TakeSnapshot":         {id("label")},
+	"Reconcile":            {},
+	"VerifyInvariants":     {},
+
+	// Queries
+	"GetConfig":                 {},
+	"GetContractInfo":           {},
+	"Ping":                      {},
+	"GetGoldRate":               {},
+	"GetCreditExposure":         {count("pageSize"), bookmark("bookmark")},
+	"GetCapBreaches":            {count("pageSize"), bookmark("bookmark")},
+	"GetDisputedLoans":          {count("pageSize"), bookmark("bookmark")},
+	"ExportLoans":               {optionalID("cursor"), count("limit")},
+	"LoanExists":                {id("loanID")},
+	"GetLoan":                   {id("loanID")},
+	"GetLoanHistory":            {id("loanID"), count("pageSize"), bookmark("bookmark")},
+	"GetAuditTrailPage":         {id("loanID"), count("pageSize"), bookmark("bookmark")},
+	"CheckLoanStatus":           {id("loanID")},
+	"GetLoanArchive":            {id("loanID")},
+	"ExportAttestation":         {id("loanID")},
+	"GetLoanClaim":              {id("loanID")},
+	"GetClaimsByOwner":          {id("owner"), count("pageSize"), bookmark("bookmark")},
+	"GetRepaymentSchedule":      {id("loanID")},
+	"GetPrepaymentQuote":        {id("loanID")},
+	"SimulateSchedule":          {amount("amount"), rate("interestRate"), months("duration"), id("method"), wholeNumber("compoundingFrequency")},
+	"SimulateForeclosure":       {id("loanID"), id("asOfDate")},
+	"GetTrancheInterest":        {id("loanID"), optionalID("asOfDate")},
+	"GetApplicationHistory":     {id("loanID"), count("pageSize"), bookmark("bookmark")},
+	"GetDistributionHistory":    {id("loanID"), count("pageSize"), bookmark("bookmark")},
+	"GetParticipations":         {id("loanID")},
+	"GetParticipationsByHolder": {id("holder"), count("pageSize"), bookmark("bookmark")},
+	"GetStatement":              {id("loanID"), id("fromDate"), id("toDate")},
+	"GetLoansByLender":          {id("lenderID"), count("pageSize"), bookmark("bookmark")},
+	"GetPendingApplications":    {id("lenderID"), count("pageSize"), bookmark("bookmark")},
+	"GetLoansByBorrower":        {id("borrowerID"), count("pageSize"), bookmark("bookmark")},
+	"GetLoansByStatus":          {id("status"), count("pageSize"), bookmark("bookmark")},
+	"GetLoansCreatedBetween":    {id("from"), id("to"), count("pageSize"), bookmark("bookmark")},
+	"GetLoansDisbursedBetween":  {id("from"), id("to"), count("pageSize"), bookmark("bookmark")},
+	"GetLoansByCollateralType":  {id("collateralType"), count("pageSize"), bookmark("bookmark")},
+	"GetLoanByCollateralID":     {id("collateralID")},
+	"GetLoansByTag":             {id("key"), text("value"), count("pageSize"), bookmark("bookmark")},
+	"GetCollateral":             {id("collateralID")},
+	"GetCollateralByOwner":      {id("ownerID"), count("pageSize"), bookmark("bookmark")},
+	"GetEncumbrances":           {id("collateralID"), count("pageSize"), bookmark("bookmark")},
+	"GetProperty":               {id("propertyID")},
+	"GetPropertyLiens":          {id("propertyID"), count("pageSize"), bookmark("bookmark")},
+	"GetHypothecation":          {id("registrationNumber")},
+	"GetInvoice":                {id("invoiceID")},
+	"GetInvoices":               {id("account"), id("period"), count("pageSize"), bookmark("bookmark")},
+	"GetBenchmarkRate":          {id("benchmark")},
+	"GetBenchmarkHistory":       {id("benchmark"), id("period"), count("pageSize"), bookmark("bookmark")},
+	"GetRateResetReport":        {id("lenderID"), id("period")},
+	"GetSettlementInstruction":  {id("correlationID")},
+	"GetBorrowerProfile":        {id("borrowerID")},
+	"GetBorrowerPrivateData":    {id("borrowerID")},
+	"GetLoanAnnotation":         {id("loanID")},
+	"GetLinkedBorrowers":        {id("borrowerID"), count("pageSize"), bookmark("bookmark")},
+	"GetBorrowerVelocity":       {id("borrowerID")},
+	"GetSubventionScheme":       {id("schemeID")},
+	"GetReceipt":                {id("receiptID")},
+	"VerifyReceipt":             {id("receiptID"), id("hash")},
+	"GetRepaymentByReference":   {id("paymentReference")},
+	"GetRejectionCounts":        {id("lenderID"), count("pageSize"), bookmark("bookmark")},
+	"GetTDSCertificate":         {id("certificateID")},
+	"GetTDSLedger":              {id("account"), id("period"), count("pageSize"), bookmark("bookmark")},
+	"GetSnapshot":               {id("label")},
+	"GetPSLReport":              {id("lenderID"), id("quarter")},
+	"GenerateRegulatoryReturn":  {id("lenderID"), id("period"), id("returnType")},
+	"GenerateBureauReport":      {id("lenderID"), id("period")},
+	"GetPortfolioSummary":       {id("lenderID")},
+	"GetLenderStatement":        {id("lenderID"), id("period")},
+	"GetAccruedInterestReport":  {id("lenderID"), id("asOfDate")},
+	"GetDelinquencyBuckets":     {id("lenderID"), id("asOfDate")},
+}
+
+// ============== Input Validation ==============
+
+// Runs before every transaction, checking its arguments against their rules
+func validateArguments(ctx contractapi.TransactionContextInterface) error {
+	function, args := ctx.GetStub().GetFunctionAndParameters()
+	if separator := strings.LastIndex(function, ":"); separator >= 0 {
+		function = function[separator+1:]
+	}
+	rules, found := transactionArgs[function]
+	if !found {
+		rules = token.ArgumentRules(function)
+	}
+	return token.CheckArguments(function, args, rules)
+}
+
+// A rate in percent a year, to rateScale places
+func rate(name string) argRule {
+	return argRule{Name: name, Check: func(value string) string {
+		number, err := parseRate(value)
+		if err != nil {
+			return err.Error()
+		}
+		if number.Sign() < 0 || number.Cmp(ratInt(maxRate)) > 0 {
+			return fmt.Sprintf("must be between 0 and %d percent", maxRate)
+		}
+		return ""
+	}}
+}
+
+// A loan tenure in whole months
+func months(name string) argRule {
+	return argRule{Name: name, Check: func(value string) string {
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 1 || number > maxDurationMonths {
+			return fmt.Sprintf("must be a whole number of months between 1 and %d", maxDurationMonths)
+		}
+		return ""
+	}}
+}
+
+// A positive whole number of units
+func count(name string) argRule {
+	return argRule{Name: name, Check: func(value string) string {
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 1 {
+			return "must be a positive whole number"
+		}
+		return ""
+	}}
+}
+
+// A whole number that may be zero, such as a score or tier
+func wholeNumber(name string) argRule {
+	return argRule{Name: name, Check: func(value string) string {
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 0 {
+			return "must be a whole number of 0 or more"
+		}
+		return ""
+	}}
+}
+
+// A gold purity in karats, above 0 and at most 24
+func karats(name string) argRule {
+	return argRule{Name: name, Check: func(value string) string {
+		number, err := parseRate(value)
+		if err != nil {
+			return err.Error()
+		}
+		if number.Sign() <= 0 || number.Cmp(ratInt(24)) > 0 {
+			return "must be between 0 and 24 karats"
+		}
+		return ""
+	}}
+}
+
+// A positive weight in grams, to weightScale places
+func weight(name string) argRule {
+	return argRule{Name: name, Check: func(value string) string {
+		number, err := parseDecimal(value, weightScale)
+		if err != nil {
+			return err.Error()
+		}
+		if number.Sign() <= 0 {
+			return "must be greater than 0"
+		}
+		return ""
+	}}
+}
+
+// true or false
+func boolean(name string) argRule {
+	return argRule{Name: name, Check: func(value string) string {
+		if _, err := strconv.ParseBool(value); err != nil {
+			return "must be true or false"
+		}
+		return ""
+	}}
+}
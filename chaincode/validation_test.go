@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"lending/token"
+)
+
+// Every transaction of the contract, the embedded token ledger's included,
+// has a rule for each of its parameters, and every rule set belongs to a
+// transaction with that many parameters
+func TestTransactionArgs(t *testing.T) {
+	system := reflect.TypeOf(new(contractapi.Contract))
+	contract := reflect.TypeOf(new(SmartContract))
+	for i := 0; i < contract.NumMethod(); i++ {
+		method := contract.Method(i)
+		if _, found := system.MethodByName(method.Name); found {
+			continue
+		}
+
+		rules, found := transactionArgs[method.Name]
+		if !found {
+			rules = token.ArgumentRules(method.Name)
+		}
+		if rules == nil {
+			t.Errorf("%s has no argument rules", method.Name)
+			continue
+		}
+		// The receiver and the transaction context take no argument
+		if parameters := method.Type.NumIn() - 2; len(rules) != parameters {
+			t.Errorf("%s has %d argument rules for %d parameters", method.Name, len(rules), parameters)
+		}
+	}
+
+	for function := range transactionArgs {
+		if _, found := contract.MethodByName(function); !found {
+			t.Errorf("argument rules of %s match no transaction", function)
+		}
+	}
+}
+
+// Trailing arguments are checked like any other
+func TestTrailingArguments(t *testing.T) {
+	tests := []struct {
+		function string
+		args     []string
+		wantErr  string
+	}{
+		{"SetGoldCollateral", []string{"L1", "10", "22"}, ""},
+		{"SetGoldCollateral", []string{"L1", "10", "25"}, "invalid argument purity of SetGoldCollateral: must be between 0 and 24 karats"},
+		{"SetInterestMethod", []string{"L1", "COMPOUND", "-1"}, "invalid argument compoundingFrequency of SetInterestMethod: must be a whole number of 0 or more"},
+		{"GetLoansByLender", []string{"HDFC", "0", ""}, "invalid argument pageSize of GetLoansByLender: must be a positive whole number"},
+		{"GetLoansByLender", []string{"HDFC", "10", "a b"}, "invalid argument bookmark of GetLoansByLender: contains whitespace or control characters"},
+		{"UpdateConfig", []string{"{"}, "invalid argument configJSON of UpdateConfig: is not valid JSON"},
+	}
+
+	for _, tt := range tests {
+		err := token.CheckArguments(tt.function, tt.args, transactionArgs[tt.function])
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.wantErr {
+			t.Errorf("%s%q: error = %q, want %q", tt.function, tt.args, got, tt.wantErr)
+		}
+	}
+}
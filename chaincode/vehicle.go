@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Vehicle pledged against a loan
+type VehicleCollateral struct {
+	RegistrationNumber string `json:"registrationNumber"`
+	ChassisNumber      string `json:"chassisNumber"`
+	Status             string `json:"status"` // PLEDGED, HYPOTHECATED, RELEASED
+}
+
+// Registry entry of a vehicle hypothecated to a lender
+type Hypothecation struct {
+	RegistrationNumber string `json:"registrationNumber"`
+	ChassisNumber      string `json:"chassisNumber"`
+	LoanID             string `json:"loanId"`
+	LenderID           string `json:"lenderId"`
+	Status             string `json:"status"` // ACTIVE, RELEASED
+	CreatedAt          string `json:"createdAt"`
+	ReleasedAt         string `json:"releasedAt"`
+}
+
+const (
+	hypothecationObjectType = "hypothecation"
+	chassisIndex            = "chassis~vehicle"
+)
+
+// ============== Vehicle Hypothecation ==============
+
+// Pledge a vehicle against a pending loan, it is hypothecated to the lender
+// on approval
+func (s *SmartContract) PledgeVehicle(
+	ctx contractapi.TransactionContextInterface,
+	loanID string,
+	registrationNumber string,
+	chassisNumber string,
+) (*LoanResult, error) {
+	err := claimRequestID(ctx, "PledgeVehicle")
+	if err != nil {
+		return nil, err
+	}
+
+	loan, err := s.getLoan(ctx, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	if loan.Status != "PENDING" {
+		return nil, fmt.Errorf("collateral of loan %s cannot change in current status: %s", loanID, loan.Status)
+	}
+	if registrationNumber == "" || chassisNumber == "" {
+		return nil, fmt.Errorf("registration and chassis numbers are required")
+	}
+
+	err = s.checkVehicleFree(ctx, registrationNumber, chassisNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	previousID := ""
+	if loan.Vehicle != nil {
+		previousID = loan.Vehicle.RegistrationNumber
+	}
+	err = s.indexCollateral(ctx, loanID, collateralVehicle, previousID, registrationNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	loan.Vehicle = &VehicleCollateral{
+		RegistrationNumber: registrationNumber,
+		ChassisNumber:      chassisNumber,
+		Status:             "PLEDGED",
+	}
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Vehicle %s pledged (TxID: %s)",
+			registrationNumber,
+			ctx.GetStub().GetTxID()))
+
+	return s.putLoanResult(ctx, loan)
+}
+
+func (s *SmartContract) GetHypothecation(
+	ctx contractapi.TransactionContextInterface,
+	registrationNumber string,
+) (*Hypothecation, error) {
+	var hypothecation Hypothecation
+	exists, err := getRecord(ctx, hypothecationObjectType, []string{registrationNumber}, &hypothecation)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("vehicle %s has never been hypothecated", registrationNumber)
+	}
+	return &hypothecation, nil
+}
+
+// Registers the hypothecation of an approved loan's vehicle to its lender
+func (s *SmartContract) hypothecateVehicle(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+) error {
+	if loan.Vehicle == nil || loan.Vehicle.Status != "PLEDGED" {
+		return nil
+	}
+
+	err := s.checkVehicleFree(ctx, loan.Vehicle.RegistrationNumber, loan.Vehicle.ChassisNumber)
+	if err != nil {
+		return err
+	}
+
+	createdAt, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = putRecord(ctx, hypothecationObjectType, []string{loan.Vehicle.RegistrationNumber}, Hypothecation{
+		RegistrationNumber: loan.Vehicle.RegistrationNumber,
+		ChassisNumber:      loan.Vehicle.ChassisNumber,
+		LoanID:             loan.LoanID,
+		LenderID:           loan.LenderID,
+		Status:             "ACTIVE",
+		CreatedAt:          createdAt.Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.putIndex(ctx, chassisIndex, loan.Vehicle.ChassisNumber, loan.Vehicle.RegistrationNumber)
+	if err != nil {
+		return err
+	}
+
+	loan.Vehicle.Status = "HYPOTHECATED"
+	return nil
+}
+
+// Releases the hypothecation of a closed loan's vehicle
+func (s *SmartContract) releaseHypothecation(
+	ctx contractapi.TransactionContextInterface,
+	loan *Loan,
+) error {
+	if loan.Vehicle == nil || loan.Vehicle.Status != "HYPOTHECATED" {
+		return nil
+	}
+
+	hypothecation, err := s.GetHypothecation(ctx, loan.Vehicle.RegistrationNumber)
+	if err != nil {
+		return err
+	}
+
+	releasedAt, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	hypothecation.Status = "RELEASED"
+	hypothecation.ReleasedAt = releasedAt.Format(time.RFC3339)
+	err = putRecord(ctx, hypothecationObjectType, []string{hypothecation.RegistrationNumber}, hypothecation)
+	if err != nil {
+		return err
+	}
+
+	err = s.deleteIndex(ctx, chassisIndex, hypothecation.ChassisNumber, hypothecation.RegistrationNumber)
+	if err != nil {
+		return err
+	}
+
+	loan.Vehicle.Status = "RELEASED"
+	loan.AuditHistory = append(loan.AuditHistory,
+		fmt.Sprintf("Hypothecation of vehicle %s released (TxID: %s)",
+			hypothecation.RegistrationNumber,
+			ctx.GetStub().GetTxID()))
+	return nil
+}
+
+// Fails if the vehicle, by registration or chassis number, backs an active loan
+func (s *SmartContract) checkVehicleFree(
+	ctx contractapi.TransactionContextInterface,
+	registrationNumber string,
+	chassisNumber string,
+) error {
+	var hypothecation Hypothecation
+	exists, err := getRecord(ctx, hypothecationObjectType, []string{registrationNumber}, &hypothecation)
+	if err != nil {
+		return err
+	}
+	if exists && hypothecation.Status == "ACTIVE" {
+		return fmt.Errorf("vehicle %s is hypothecated to %s for loan %s", registrationNumber, hypothecation.LenderID, hypothecation.LoanID)
+	}
+
+	hypothecated, err := ctx.GetStub().GetStateByPartialCompositeKey(chassisIndex, []string{chassisNumber})
+	if err != nil {
+		return fmt.Errorf("failed to read from world state: %v", err)
+	}
+	defer hypothecated.Close()
+	if hypothecated.HasNext() {
+		return fmt.Errorf("chassis %s is hypothecated under another registration", chassisNumber)
+	}
+
+	return nil
+}
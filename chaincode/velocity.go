@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Limits on how fast a borrower may apply, a zero value disables a rule
+type VelocityPolicy struct {
+	MaxRequestsPerDay   int `json:"maxRequestsPerDay"`   // loan requests per borrower per UTC day
+	MinDaysAfterDefault int `json:"minDaysAfterDefault"` // days after the borrower's last default before a new request
+}
+
+// A borrower's recent application activity. A single record per borrower is
+// kept, the request count starting over on a new day.
+type BorrowerVelocity struct {
+	BorrowerID    string `json:"borrowerId"`
+	Day           string `json:"day"` // YYYY-MM-DD of the counted requests
+	Requests      int    `json:"requests"`
+	LastDefaultAt string `json:"lastDefaultAt,omitempty" metadata:",optional"` // RFC3339, defaults marked since velocity was tracked
+}
+
+const velocityObjectType = "velocity"
+
+// Counts a loan request of the borrower, failing when it breaks the velocity
+// policy
+func (s *SmartContract) checkVelocity(
+	ctx contractapi.TransactionContextInterface,
+	borrowerID string,
+	policy VelocityPolicy,
+) error {
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	velocity, err := s.velocityOf(ctx, borrowerID, now)
+	if err != nil {
+		return err
+	}
+
+	if policy.MaxRequestsPerDay > 0 && velocity.Requests >= policy.MaxRequestsPerDay {
+		return fmt.Errorf("borrower %s has reached the limit of %d loan requests on %s",
+			borrowerID, policy.MaxRequestsPerDay, velocity.Day)
+	}
+
+	if policy.MinDaysAfterDefault > 0 && velocity.LastDefaultAt != "" {
+		defaultedAt, err := time.Parse(time.RFC3339, velocity.LastDefaultAt)
+		if err != nil {
+			return err
+		}
+		allowedAt := defaultedAt.AddDate(0, 0, policy.MinDaysAfterDefault)
+		if now.Before(allowedAt) {
+			return fmt.Errorf("borrower %s defaulted on %s, new loans can be requested from %s",
+				borrowerID, defaultedAt.Format(time.RFC3339), allowedAt.Format(time.RFC3339))
+		}
+	}
+
+	velocity.Requests++
+	return putRecord(ctx, velocityObjectType, []string{borrowerID}, velocity)
+}
+
+// Records a default of the borrower for the velocity policy
+func (s *SmartContract) recordDefault(
+	ctx contractapi.TransactionContextInterface,
+	borrowerID string,
+) error {
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	velocity, err := s.velocityOf(ctx, borrowerID, now)
+	if err != nil {
+		return err
+	}
+
+	velocity.LastDefaultAt = now.Format(time.RFC3339)
+	return putRecord(ctx, velocityObjectType, []string{borrowerID}, velocity)
+}
+
+// The borrower's velocity record as of now
+func (s *SmartContract) velocityOf(
+	ctx contractapi.TransactionContextInterface,
+	borrowerID string,
+	now time.Time,
+) (*BorrowerVelocity, error) {
+	var velocity BorrowerVelocity
+	_, err := getRecord(ctx, velocityObjectType, []string{borrowerID}, &velocity)
+	if err != nil {
+		return nil, err
+	}
+
+	day := now.Format("2006-01-02")
+	if velocity.Day != day {
+		velocity.BorrowerID = borrowerID
+		velocity.Day = day
+		velocity.Requests = 0
+	}
+	return &velocity, nil
+}
+
+// ============== Velocity Queries ==============
+
+// A borrower's loan requests today and last default, regulator only
+func (s *SmartContract) GetBorrowerVelocity(
+	ctx contractapi.TransactionContextInterface,
+	borrowerID string,
+) (*BorrowerVelocity, error) {
+	err := requireRegulator(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.velocityOf(ctx, borrowerID, now)
+}
@@ -0,0 +1,706 @@
+// Package client is a typed Go client for the lending chaincode. It wraps a
+// Fabric Gateway contract, submitting state changes and evaluating queries
+// so callers work with Go structs instead of string arguments and JSON.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	gwclient "github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+type Client struct {
+	contract *gwclient.Contract
+}
+
+type requestIDKey struct{}
+
+// Attaches a request ID to the transactions submitted with ctx. The chaincode
+// rejects a request ID it already processed, so retrying a submit that timed
+// out with the same ID cannot apply it twice.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// Wraps a contract obtained from a connected gateway
+func New(contract *gwclient.Contract) *Client {
+	return &Client{contract: contract}
+}
+
+// ============== Loan Lifecycle ==============
+
+// Submits a loan application, the result carries the committed transaction ID
+func (c *Client) RequestLoan(ctx context.Context, request LoanRequest) (*LoanResult, error) {
+	var transient map[string][]byte
+	if request.BorrowerData != nil {
+		piiJSON, err := json.Marshal(request.BorrowerData)
+		if err != nil {
+			return nil, err
+		}
+		transient = map[string][]byte{"borrower_pii": piiJSON}
+	}
+
+	var result LoanResult
+	if err := c.submitTransient(ctx, &result, transient, "RequestLoan",
+		request.LoanID,
+		request.BorrowerID,
+		request.Amount,
+		request.InterestRate,
+		strconv.Itoa(request.Duration),
+		request.Collateral,
+		request.Product,
+		request.PSLCategory,
+		request.PriorLoanID); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Approves a loan, or escalates it to a second officer when the amount is
+// above the caller's approval limit
+func (c *Client) ApproveLoan(ctx context.Context, loanID string, lenderID string) (*LoanResult, error) {
+	var result LoanResult
+	if err := c.submitResult(ctx, &result, "ApproveLoan", loanID, lenderID); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Sets the largest loan an officer of the caller's organization may approve
+// alone, credit administrators only
+func (c *Client) SetOfficerLimit(ctx context.Context, officerID string, limit string) (string, error) {
+	return c.submit(ctx, "SetOfficerLimit", officerID, limit)
+}
+
+func (c *Client) RemoveOfficerLimit(ctx context.Context, officerID string) (string, error) {
+	return c.submit(ctx, "RemoveOfficerLimit", officerID)
+}
+
+func (c *Client) DisburseLoan(ctx context.Context, loanID string) (*LoanResult, error) {
+	var result LoanResult
+	if err := c.submitResult(ctx, &result, "DisburseLoan", loanID); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Disburses part of a loan, the first tranche disburses an approved loan
+func (c *Client) DisburseTranche(ctx context.Context, loanID string, amount string) (*LoanResult, error) {
+	var result LoanResult
+	if err := c.submitResult(ctx, &result, "DisburseTranche", loanID, amount); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Cancels undrawn principal of a tranche loan once the lender acknowledges
+func (c *Client) CancelUndrawnCommitment(ctx context.Context, loanID string, amount string) (*LoanResult, error) {
+	var result LoanResult
+	if err := c.submitResult(ctx, &result, "CancelUndrawnCommitment", loanID, amount); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) AcknowledgeCommitmentCancellation(ctx context.Context, loanID string) (*LoanResult, error) {
+	var result LoanResult
+	if err := c.submitResult(ctx, &result, "AcknowledgeCommitmentCancellation", loanID); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) RepayLoan(ctx context.Context, loanID string, amount string, paymentReference string) (*LoanResult, error) {
+	var result LoanResult
+	if err := c.submitResult(ctx, &result, "RepayLoan", loanID, amount, paymentReference); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Pledges part of the borrower's balance as cash margin against a loan
+func (c *Client) PostMargin(ctx context.Context, loanID string, amount string) (*LoanResult, error) {
+	var result LoanResult
+	if err := c.submitResult(ctx, &result, "PostMargin", loanID, amount); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Reschedules an active loan to a later due date, lender only
+func (c *Client) RestructureLoan(ctx context.Context, loanID string, newDueDate string, reason string) (*LoanResult, error) {
+	var result LoanResult
+	if err := c.submitResult(ctx, &result, "RestructureLoan", loanID, newDueDate, reason); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Defers an active loan's due date by a moratorium of months, lender only
+func (c *Client) GrantMoratorium(ctx context.Context, loanID string, months int, reason string) (*LoanResult, error) {
+	var result LoanResult
+	if err := c.submitResult(ctx, &result, "GrantMoratorium", loanID, strconv.Itoa(months), reason); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Expires the approval of a loan left undisbursed past the configured days,
+// keeper only
+func (c *Client) ExpireApproval(ctx context.Context, loanID string) (*LoanResult, error) {
+	var result LoanResult
+	if err := c.submitResult(ctx, &result, "ExpireApproval", loanID); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Links a pending loan's rate to a benchmark plus spread, in percent
+func (c *Client) SetFloatingRate(ctx context.Context, loanID string, benchmark string, spread string) (*LoanResult, error) {
+	var result LoanResult
+	if err := c.submitResult(ctx, &result, "SetFloatingRate", loanID, benchmark, spread); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Reprices a disbursed floating rate loan at its benchmark's current fixing,
+// keeper or lender only
+func (c *Client) ResetLoanRate(ctx context.Context, loanID string) (string, error) {
+	return c.submit(ctx, "ResetLoanRate", loanID)
+}
+
+// Quotes a benchmark rate, oracle organizations only
+func (c *Client) SubmitBenchmarkRate(ctx context.Context, benchmark string, rate string) (string, error) {
+	return c.submit(ctx, "SubmitBenchmarkRate", benchmark, rate)
+}
+
+// Defaults a loan past due for a reason code such as NON_PAYMENT or FRAUD
+func (c *Client) MarkAsDefaulted(ctx context.Context, loanID string, reasonCode string) (*LoanResult, error) {
+	var result LoanResult
+	if err := c.submitResult(ctx, &result, "MarkAsDefaulted", loanID, reasonCode); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) AddCollateral(ctx context.Context, loanID string, collateral string) (*LoanResult, error) {
+	var result LoanResult
+	if err := c.submitResult(ctx, &result, "AddCollateral", loanID, collateral); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) ReleaseCollateralItem(ctx context.Context, loanID string, collateralID string) (*LoanResult, error) {
+	var result LoanResult
+	if err := c.submitResult(ctx, &result, "ReleaseCollateralItem", loanID, collateralID); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) LiquidateCollateral(ctx context.Context, loanID string, collateralID string, proceeds string) (*LoanResult, error) {
+	var result LoanResult
+	if err := c.submitResult(ctx, &result, "LiquidateCollateral", loanID, collateralID, proceeds); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) ProposeCollateralSubstitution(ctx context.Context, loanID string, releaseID string, replacementID string) (*LoanResult, error) {
+	var result LoanResult
+	if err := c.submitResult(ctx, &result, "ProposeCollateralSubstitution", loanID, releaseID, replacementID); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) ApproveCollateralSubstitution(ctx context.Context, loanID string) (*LoanResult, error) {
+	var result LoanResult
+	if err := c.submitResult(ctx, &result, "ApproveCollateralSubstitution", loanID); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) RejectCollateralSubstitution(ctx context.Context, loanID string, reason string) (*LoanResult, error) {
+	var result LoanResult
+	if err := c.submitResult(ctx, &result, "RejectCollateralSubstitution", loanID, reason); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Transfers the loan to newBorrowerID once the new borrower consents and the
+// lender approves
+func (c *Client) ProposeNovation(ctx context.Context, loanID string, newBorrowerID string) (*LoanResult, error) {
+	var result LoanResult
+	if err := c.submitResult(ctx, &result, "ProposeNovation", loanID, newBorrowerID); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) ConsentToNovation(ctx context.Context, loanID string) (*LoanResult, error) {
+	var result LoanResult
+	if err := c.submitResult(ctx, &result, "ConsentToNovation", loanID); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) ApproveNovation(ctx context.Context, loanID string) (*LoanResult, error) {
+	var result LoanResult
+	if err := c.submitResult(ctx, &result, "ApproveNovation", loanID); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) RejectNovation(ctx context.Context, loanID string, reason string) (*LoanResult, error) {
+	var result LoanResult
+	if err := c.submitResult(ctx, &result, "RejectNovation", loanID, reason); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ============== Loan Queries ==============
+
+func (c *Client) GetLoan(ctx context.Context, loanID string) (*Loan, error) {
+	var loan Loan
+	if err := c.evaluate(ctx, &loan, "GetLoan", loanID); err != nil {
+		return nil, err
+	}
+	return &loan, nil
+}
+
+func (c *Client) GetLoanHistory(ctx context.Context, loanID string, pageSize int, bookmark string) (*AuditTrailPage, error) {
+	var page AuditTrailPage
+	if err := c.evaluate(ctx, &page, "GetLoanHistory", loanID, strconv.Itoa(pageSize), bookmark); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func (c *Client) GetAuditTrailPage(ctx context.Context, loanID string, pageSize int, bookmark string) (*AuditTrailPage, error) {
+	var page AuditTrailPage
+	if err := c.evaluate(ctx, &page, "GetAuditTrailPage", loanID, strconv.Itoa(pageSize), bookmark); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// Statement of account of a loan between two YYYY-MM-DD dates
+func (c *Client) GetStatement(ctx context.Context, loanID string, fromDate string, toDate string) (*LoanStatement, error) {
+	var statement LoanStatement
+	if err := c.evaluate(ctx, &statement, "GetStatement", loanID, fromDate, toDate); err != nil {
+		return nil, err
+	}
+	return &statement, nil
+}
+
+// The floating rate resets of a lender's loans over a YYYY-MM or YYYY-Qn period
+func (c *Client) GetRateResetReport(ctx context.Context, lenderID string, period string) (*RateResetReport, error) {
+	var report RateResetReport
+	if err := c.evaluate(ctx, &report, "GetRateResetReport", lenderID, period); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// Quotes the schedule of a loan before it is requested, compoundingFrequency
+// only applies to COMPOUND interest
+func (c *Client) SimulateSchedule(ctx context.Context, amount string, interestRate string, duration int, method string, compoundingFrequency int) (*ScheduleSimulation, error) {
+	var simulation ScheduleSimulation
+	if err := c.evaluate(ctx, &simulation, "SimulateSchedule", amount, interestRate, strconv.Itoa(duration), method, strconv.Itoa(compoundingFrequency)); err != nil {
+		return nil, err
+	}
+	return &simulation, nil
+}
+
+// Quotes the payoff of an active loan at a YYYY-MM-DD date
+func (c *Client) SimulateForeclosure(ctx context.Context, loanID string, asOfDate string) (*PrepaymentQuote, error) {
+	var quote PrepaymentQuote
+	if err := c.evaluate(ctx, &quote, "SimulateForeclosure", loanID, asOfDate); err != nil {
+		return nil, err
+	}
+	return &quote, nil
+}
+
+// Cash flows of a lender over a YYYY-MM or YYYY-Qn period
+func (c *Client) GetLenderStatement(ctx context.Context, lenderID string, period string) (*LenderStatement, error) {
+	var statement LenderStatement
+	if err := c.evaluate(ctx, &statement, "GetLenderStatement", lenderID, period); err != nil {
+		return nil, err
+	}
+	return &statement, nil
+}
+
+// Interest accrued and received on a lender's open loans at a YYYY-MM-DD date
+func (c *Client) GetAccruedInterestReport(ctx context.Context, lenderID string, asOfDate string) (*AccruedInterestReport, error) {
+	var report AccruedInterestReport
+	if err := c.evaluate(ctx, &report, "GetAccruedInterestReport", lenderID, asOfDate); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// Interest accrued by each tranche of a loan at a YYYY-MM-DD date, now when empty
+func (c *Client) GetTrancheInterest(ctx context.Context, loanID string, asOfDate string) (*TrancheInterest, error) {
+	var report TrancheInterest
+	if err := c.evaluate(ctx, &report, "GetTrancheInterest", loanID, asOfDate); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// Applications a lender can act on, a page at a time in loan ID order
+func (c *Client) GetPendingApplications(ctx context.Context, lenderID string, pageSize int32, bookmark string) (*PendingApplicationPage, error) {
+	var page PendingApplicationPage
+	if err := c.evaluate(ctx, &page, "GetPendingApplications", lenderID, strconv.Itoa(int(pageSize)), bookmark); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// Sanctioned credit outstanding in total and by sector against the lending
+// caps, a page of sectors at a time with the total first on the first page
+func (c *Client) GetCreditExposure(ctx context.Context, pageSize int32, bookmark string) (*CreditExposurePage, error) {
+	var page CreditExposurePage
+	if err := c.evaluate(ctx, &page, "GetCreditExposure", strconv.Itoa(int(pageSize)), bookmark); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// Approvals refused for breaching a lending cap, oldest first, a page at a
+// time, regulator only
+func (c *Client) GetCapBreaches(ctx context.Context, pageSize int32, bookmark string) (*CapBreachPage, error) {
+	var page CapBreachPage
+	if err := c.evaluate(ctx, &page, "GetCapBreaches", strconv.Itoa(int(pageSize)), bookmark); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// The current fixing of a benchmark with the submissions it is the median of
+func (c *Client) GetBenchmarkRate(ctx context.Context, benchmark string) (*BenchmarkFixing, error) {
+	var fixing BenchmarkFixing
+	if err := c.evaluate(ctx, &fixing, "GetBenchmarkRate", benchmark); err != nil {
+		return nil, err
+	}
+	return &fixing, nil
+}
+
+func (c *Client) GetLoansByBorrower(ctx context.Context, borrowerID string, pageSize int32, bookmark string) (*LoanPage, error) {
+	return c.loanPage(ctx, "GetLoansByBorrower", borrowerID, pageSize, bookmark)
+}
+
+func (c *Client) GetLoansByLender(ctx context.Context, lenderID string, pageSize int32, bookmark string) (*LoanPage, error) {
+	return c.loanPage(ctx, "GetLoansByLender", lenderID, pageSize, bookmark)
+}
+
+func (c *Client) GetLoansByStatus(ctx context.Context, status string, pageSize int32, bookmark string) (*LoanPage, error) {
+	return c.loanPage(ctx, "GetLoansByStatus", status, pageSize, bookmark)
+}
+
+func (c *Client) GetLoansByCollateralType(ctx context.Context, collateralType string, pageSize int32, bookmark string) (*LoanPage, error) {
+	return c.loanPage(ctx, "GetLoansByCollateralType", collateralType, pageSize, bookmark)
+}
+
+// Lists a lender's loans awaiting a second officer's approval
+func (c *Client) GetEscalatedApprovals(ctx context.Context, lenderID string, pageSize int32, bookmark string) (*LoanPage, error) {
+	return c.loanPage(ctx, "GetEscalatedApprovals", lenderID, pageSize, bookmark)
+}
+
+func (c *Client) GetOfficerLimit(ctx context.Context, orgMSP string, officerID string) (*OfficerLimit, error) {
+	var limit OfficerLimit
+	if err := c.evaluate(ctx, &limit, "GetOfficerLimit", orgMSP, officerID); err != nil {
+		return nil, err
+	}
+	return &limit, nil
+}
+
+// Exports loans in request order from cursor, empty for the first batch
+func (c *Client) ExportLoans(ctx context.Context, cursor string, limit int32) (*LoanExport, error) {
+	var export LoanExport
+	if err := c.evaluate(ctx, &export, "ExportLoans", cursor, strconv.Itoa(int(limit))); err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+func (c *Client) GetLoanByCollateralID(ctx context.Context, collateralID string) (*Loan, error) {
+	var loan Loan
+	if err := c.evaluate(ctx, &loan, "GetLoanByCollateralID", collateralID); err != nil {
+		return nil, err
+	}
+	return &loan, nil
+}
+
+func (c *Client) GetCollateral(ctx context.Context, collateralID string) (*CollateralAsset, error) {
+	var asset CollateralAsset
+	if err := c.evaluate(ctx, &asset, "GetCollateral", collateralID); err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+func (c *Client) GetEncumbrances(ctx context.Context, collateralID string, pageSize int32, bookmark string) (*EncumbrancePage, error) {
+	var page EncumbrancePage
+	if err := c.evaluate(ctx, &page, "GetEncumbrances", collateralID, strconv.Itoa(int(pageSize)), bookmark); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func (c *Client) GetRepaymentByReference(ctx context.Context, paymentReference string) (*Repayment, error) {
+	var repayment Repayment
+	if err := c.evaluate(ctx, &repayment, "GetRepaymentByReference", paymentReference); err != nil {
+		return nil, err
+	}
+	return &repayment, nil
+}
+
+// Returns the receipt of a repayment, its ID is the repayment's transaction ID
+func (c *Client) GetReceipt(ctx context.Context, receiptID string) (*Receipt, error) {
+	var receipt Receipt
+	if err := c.evaluate(ctx, &receipt, "GetReceipt", receiptID); err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+// Fee invoices an account issued or received in a YYYY-MM or YYYY-Qn period,
+// oldest first a page at a time
+func (c *Client) GetInvoices(ctx context.Context, account string, period string, pageSize int32, bookmark string) (*FeeInvoicePage, error) {
+	var page FeeInvoicePage
+	if err := c.evaluate(ctx, &page, "GetInvoices", account, period, strconv.Itoa(int(pageSize)), bookmark); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// Tax an account withheld or had withheld in a YYYY-MM or YYYY-Qn period, a
+// page of certificates at a time with the totals of the page
+func (c *Client) GetTDSLedger(ctx context.Context, account string, period string, pageSize int32, bookmark string) (*TDSLedger, error) {
+	var ledger TDSLedger
+	if err := c.evaluate(ctx, &ledger, "GetTDSLedger", account, period, strconv.Itoa(int(pageSize)), bookmark); err != nil {
+		return nil, err
+	}
+	return &ledger, nil
+}
+
+// Returns the transaction that processed one of the caller organization's request IDs
+func (c *Client) GetProcessedRequest(ctx context.Context, requestID string) (*ProcessedRequest, error) {
+	var processed ProcessedRequest
+	if err := c.evaluate(ctx, &processed, "GetProcessedRequest", requestID); err != nil {
+		return nil, err
+	}
+	return &processed, nil
+}
+
+// Returns the evidence bundle of a loan for auditors, archive it with the
+// endorsement of the response
+func (c *Client) ExportAttestation(ctx context.Context, loanID string) (*LoanAttestation, error) {
+	var attestation LoanAttestation
+	if err := c.evaluate(ctx, &attestation, "ExportAttestation", loanID); err != nil {
+		return nil, err
+	}
+	return &attestation, nil
+}
+
+// Returns the deployed chaincode's version, features and configuration, test
+// Features before calling functions newer deployments added
+func (c *Client) GetContractInfo(ctx context.Context) (*ContractInfo, error) {
+	var info ContractInfo
+	if err := c.evaluate(ctx, &info, "GetContractInfo"); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Evaluates the chaincode's health check on the gateway peer
+func (c *Client) Ping(ctx context.Context) (*PingResponse, error) {
+	var ping PingResponse
+	if err := c.evaluate(ctx, &ping, "Ping"); err != nil {
+		return nil, err
+	}
+	return &ping, nil
+}
+
+// ============== Tokens ==============
+
+// Returns the balance as an exact decimal string, such as "1500.25"
+func (c *Client) GetBalance(ctx context.Context, account string) (string, error) {
+	var balance json.Number
+	if err := c.evaluate(ctx, &balance, "GetBalance", account); err != nil {
+		return "", err
+	}
+	return balance.String(), nil
+}
+
+// Returns the balance less the funds earmarked for approved loans
+func (c *Client) GetAvailableBalance(ctx context.Context, account string) (string, error) {
+	var balance json.Number
+	if err := c.evaluate(ctx, &balance, "GetAvailableBalance", account); err != nil {
+		return "", err
+	}
+	return balance.String(), nil
+}
+
+// Returns a page of the credits and debits of a token account from fromDate
+// to toDate (YYYY-MM-DD) with the running balance
+func (c *Client) GetAccountStatement(ctx context.Context, account string, fromDate string, toDate string, pageSize int32, bookmark string) (*AccountStatement, error) {
+	var statement AccountStatement
+	if err := c.evaluate(ctx, &statement, "GetAccountStatement", account, fromDate, toDate, strconv.Itoa(int(pageSize)), bookmark); err != nil {
+		return nil, err
+	}
+	return &statement, nil
+}
+
+func (c *Client) GetAllAccounts(ctx context.Context, pageSize int32, bookmark string) (*AccountPage, error) {
+	var page AccountPage
+	if err := c.evaluate(ctx, &page, "GetAllAccounts", strconv.Itoa(int(pageSize)), bookmark); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// Exports accounts in account ID order from cursor, empty for the first batch
+func (c *Client) ExportAccounts(ctx context.Context, cursor string, limit int32) (*AccountExport, error) {
+	var export AccountExport
+	if err := c.evaluate(ctx, &export, "ExportAccounts", cursor, strconv.Itoa(int(limit))); err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// Onboards a token account, regulator only
+func (c *Client) CreateAccount(ctx context.Context, accountID string, accountType string, orgMSP string, metadata map[string]string) (string, error) {
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return "", err
+	}
+	return c.submit(ctx, "CreateAccount", accountID, accountType, orgMSP, string(metadataJSON))
+}
+
+// Mints a decimal amount with at most two places, such as "1500.25"
+func (c *Client) Mint(ctx context.Context, account string, amount string) (string, error) {
+	return c.submit(ctx, "Mint", account, amount)
+}
+
+// Transfers tokens with a reason code such as SETTLEMENT or REFUND and the
+// reference of the record the movement belongs to
+func (c *Client) TransferTokens(ctx context.Context, from string, to string, amount string, reason string, reference string) (string, error) {
+	return c.submit(ctx, "TransferTokens", from, to, amount, reason, reference)
+}
+
+// Holds part of an account's available balance for ref until it is captured
+// or released
+func (c *Client) HoldFunds(ctx context.Context, from string, amount string, ref string) (string, error) {
+	return c.submit(ctx, "HoldFunds", from, amount, ref)
+}
+
+// Settles a hold in full to the payee
+func (c *Client) CaptureHold(ctx context.Context, ref string, to string) (string, error) {
+	return c.submit(ctx, "CaptureHold", ref, to)
+}
+
+func (c *Client) ReleaseHold(ctx context.Context, ref string) (string, error) {
+	return c.submit(ctx, "ReleaseHold", ref)
+}
+
+func (c *Client) GetHold(ctx context.Context, ref string) (*Hold, error) {
+	var hold Hold
+	if err := c.evaluate(ctx, &hold, "GetHold", ref); err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// ============== Helpers ==============
+
+func (c *Client) loanPage(ctx context.Context, function string, key string, pageSize int32, bookmark string) (*LoanPage, error) {
+	var page LoanPage
+	if err := c.evaluate(ctx, &page, function, key, strconv.Itoa(int(pageSize)), bookmark); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// Endorses, orders and waits for the commit of a transaction
+func (c *Client) submit(ctx context.Context, function string, args ...string) (string, error) {
+	_, txID, err := c.submitPayload(ctx, nil, function, args...)
+	return txID, err
+}
+
+// Submits a transaction like submit and decodes its JSON result
+func (c *Client) submitResult(ctx context.Context, result interface{}, function string, args ...string) error {
+	return c.submitTransient(ctx, result, nil, function, args...)
+}
+
+// Submits a transaction like submitResult with private data in its transient
+// map, which is not recorded in the transaction
+func (c *Client) submitTransient(ctx context.Context, result interface{}, transient map[string][]byte, function string, args ...string) error {
+	payload, _, err := c.submitPayload(ctx, transient, function, args...)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(payload, result); err != nil {
+		return fmt.Errorf("unexpected %s result: %w", function, err)
+	}
+	return nil
+}
+
+func (c *Client) submitPayload(ctx context.Context, transient map[string][]byte, function string, args ...string) ([]byte, string, error) {
+	if requestID, ok := ctx.Value(requestIDKey{}).(string); ok && requestID != "" {
+		withID := map[string][]byte{"request_id": []byte(requestID)}
+		for key, value := range transient {
+			withID[key] = value
+		}
+		transient = withID
+	}
+
+	options := []gwclient.ProposalOption{gwclient.WithArguments(args...)}
+	if len(transient) > 0 {
+		options = append(options, gwclient.WithTransient(transient))
+	}
+
+	payload, commit, err := c.contract.SubmitAsyncWithContext(ctx, function, options...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	status, err := commit.StatusWithContext(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	if !status.Successful {
+		return nil, "", fmt.Errorf("transaction %s failed to commit with status %d", status.TransactionID, int32(status.Code))
+	}
+
+	return payload, status.TransactionID, nil
+}
+
+// Runs a query on the gateway peer without ordering and decodes its JSON result
+func (c *Client) evaluate(ctx context.Context, result interface{}, function string, args ...string) error {
+	payload, err := c.contract.EvaluateWithContext(ctx, function, gwclient.WithArguments(args...))
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(payload, result); err != nil {
+		return fmt.Errorf("unexpected %s result: %w", function, err)
+	}
+	return nil
+}
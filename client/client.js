@@ -36,7 +36,9 @@ app.post('/api/loans/request', async (req, res) => {
             req.body.amount.toString(), 
             req.body.interestRate.toString(), 
             req.body.duration.toString(), 
-            req.body.collateral || '');
+            req.body.collateral || '',
+            req.body.product || '',
+            req.body.pslCategory || '');
             
         res.json({ success: true });
     } catch (error) {
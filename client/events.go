@@ -0,0 +1,255 @@
+package client
+
+// Chaincode event names. Payloads of a version only gain optional fields, so
+// these structs decode events from later chaincode releases of the same version.
+// Version 2 of the loan events has amounts and rates as exact decimal strings.
+const (
+	EventLoanRequested = "LoanRequested.v2"
+	EventLoanApproved  = "LoanApproved.v2"
+	EventLoanRejected  = "LoanRejected.v1"
+	EventLoanDisbursed = "LoanDisbursed.v2"
+	EventLoanRepaid    = "LoanRepaid.v2"
+	EventLoanDefaulted = "LoanDefaulted.v2"
+
+	EventLoanApprovalExpired   = "LoanApprovalExpired.v2"
+	EventLoanTrancheDisbursed  = "LoanTrancheDisbursed.v2"
+	EventLoanClaimTransferred  = "LoanClaimTransferred.v1"
+	EventLoanNovated           = "LoanNovated.v2"
+	EventLoanApprovalEscalated = "LoanApprovalEscalated.v2"
+	EventLoanDuesUpcoming      = "LoanDuesUpcoming.v2"
+	EventLoanRateReset         = "LoanRateReset.v2"
+	EventDayProcessed          = "DayProcessed.v2"
+
+	EventApplicationSLABreached = "ApplicationSLABreached.v2"
+	EventReportGenerated        = "ReportGenerated.v1"
+
+	EventTokenTransfer = "TokenTransfer.v1"
+	EventTokenMint     = "TokenMint.v1"
+	EventTokenBurn     = "TokenBurn.v1"
+	EventTokenEscrow   = "TokenEscrow.v1"
+	EventTokenHold     = "TokenHold.v1"
+	EventAMLCase       = "AMLCase.v1"
+)
+
+// Fields common to every loan event payload
+type LoanEventHeader struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	LoanID        string `json:"loanId"`
+	TxID          string `json:"txId"`
+	Timestamp     string `json:"timestamp"`
+	SubmitterMSP  string `json:"submitterMsp"`
+	SubmitterID   string `json:"submitterId"`
+}
+
+type LoanRequestedEventV2 struct {
+	LoanEventHeader
+	BorrowerID   string `json:"borrowerId"`
+	Amount       string `json:"amount"`
+	InterestRate string `json:"interestRate"`
+	Duration     int    `json:"duration"`
+	Product      string `json:"product,omitempty"`
+}
+
+type LoanApprovedEventV2 struct {
+	LoanEventHeader
+	BorrowerID string `json:"borrowerId"`
+	LenderID   string `json:"lenderId"`
+	Amount     string `json:"amount"`
+}
+
+type LoanRejectedEventV1 struct {
+	LoanEventHeader
+	BorrowerID  string   `json:"borrowerId"`
+	LenderID    string   `json:"lenderId"`
+	FailedRules []string `json:"failedRules"`
+	ReasonCode  string   `json:"reasonCode,omitempty"`
+}
+
+type LoanDisbursedEventV2 struct {
+	LoanEventHeader
+	BorrowerID string        `json:"borrowerId"`
+	LenderID   string        `json:"lenderId"`
+	Amount     string        `json:"amount"`
+	DueDate    string        `json:"dueDate"`
+	Transfer   *TokenEventV1 `json:"transfer,omitempty"`
+}
+
+type LoanRepaidEventV2 struct {
+	LoanEventHeader
+	ReceiptID        string        `json:"receiptId"`
+	Amount           string        `json:"amount"`
+	PaymentReference string        `json:"paymentReference"`
+	RemainingBalance string        `json:"remainingBalance"`
+	Closed           bool          `json:"closed"`
+	Rebate           string        `json:"rebate,omitempty"`
+	Withheld         string        `json:"withheld,omitempty"`
+	Transfer         *TokenEventV1 `json:"transfer,omitempty"`
+}
+
+type LoanDefaultedEventV2 struct {
+	LoanEventHeader
+	BorrowerID       string `json:"borrowerId"`
+	LenderID         string `json:"lenderId"`
+	RemainingBalance string `json:"remainingBalance"`
+	ReasonCode       string `json:"reasonCode,omitempty"`
+	DaysPastDue      int    `json:"daysPastDue,omitempty"`
+}
+
+type LoanApprovalExpiredEventV2 struct {
+	LoanEventHeader
+	BorrowerID string `json:"borrowerId"`
+	LenderID   string `json:"lenderId"`
+	Amount     string `json:"amount"`
+}
+
+type LoanTrancheDisbursedEventV2 struct {
+	LoanEventHeader
+	BorrowerID   string        `json:"borrowerId"`
+	LenderID     string        `json:"lenderId"`
+	Tranche      int           `json:"tranche"`
+	TrancheID    string        `json:"trancheId"`
+	Amount       string        `json:"amount"`
+	Disbursed    string        `json:"disbursed"`
+	Sanctioned   string        `json:"sanctioned"`
+	BlendedRate  string        `json:"blendedRate"`
+	RepaymentDue string        `json:"repaymentDue"`
+	DueDate      string        `json:"dueDate"`
+	Transfer     *TokenEventV1 `json:"transfer,omitempty"`
+}
+
+type LoanClaimTransferredEventV1 struct {
+	LoanEventHeader
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type LoanNovatedEventV2 struct {
+	LoanEventHeader
+	FromBorrowerID   string `json:"fromBorrowerId"`
+	ToBorrowerID     string `json:"toBorrowerId"`
+	LenderID         string `json:"lenderId"`
+	RemainingBalance string `json:"remainingBalance"`
+}
+
+type LoanApprovalEscalatedEventV2 struct {
+	LoanEventHeader
+	LenderID   string `json:"lenderId"`
+	Amount     string `json:"amount"`
+	MakerID    string `json:"makerId"`
+	MakerLimit string `json:"makerLimit"`
+}
+
+type LoanRateResetEventV2 struct {
+	LoanEventHeader
+	BorrowerID       string `json:"borrowerId"`
+	LenderID         string `json:"lenderId"`
+	Benchmark        string `json:"benchmark"`
+	OldRate          string `json:"oldRate"`
+	NewRate          string `json:"newRate"`
+	OldInstallment   string `json:"oldInstallment"`
+	NewInstallment   string `json:"newInstallment"`
+	RemainingBalance string `json:"remainingBalance"`
+	Maturity         string `json:"maturity"`
+}
+
+type LoanDuesUpcomingEventV2 struct {
+	SchemaVersion int            `json:"schemaVersion"`
+	TxID          string         `json:"txId"`
+	Timestamp     string         `json:"timestamp"`
+	SubmitterMSP  string         `json:"submitterMsp"`
+	SubmitterID   string         `json:"submitterId"`
+	DaysAhead     int            `json:"daysAhead"`
+	Dues          []*UpcomingDue `json:"dues"`
+}
+
+type UpcomingDue struct {
+	LoanID       string `json:"loanId"`
+	BorrowerID   string `json:"borrowerId"`
+	LenderID     string `json:"lenderId"`
+	DueDate      string `json:"dueDate"`
+	DaysUntilDue int    `json:"daysUntilDue"`
+	AmountDue    string `json:"amountDue"`
+}
+
+type DayProcessedEventV2 struct {
+	SchemaVersion int                  `json:"schemaVersion"`
+	TxID          string               `json:"txId"`
+	Timestamp     string               `json:"timestamp"`
+	SubmitterMSP  string               `json:"submitterMsp"`
+	SubmitterID   string               `json:"submitterId"`
+	AsOfDate      string               `json:"asOfDate"`
+	Processed     int                  `json:"processed"`
+	Overdue       int                  `json:"overdue"`
+	PenalCharged  string               `json:"penalCharged"`
+	Collections   []*MandateCollection `json:"collections"`
+}
+
+type MandateCollection struct {
+	LoanID           string `json:"loanId"`
+	Amount           string `json:"amount"`
+	PaymentReference string `json:"paymentReference"`
+	RepaymentID      string `json:"repaymentId,omitempty"`
+	Status           string `json:"status"`
+}
+
+type ApplicationSLABreachedEventV2 struct {
+	SchemaVersion int                   `json:"schemaVersion"`
+	TxID          string                `json:"txId"`
+	Timestamp     string                `json:"timestamp"`
+	SubmitterMSP  string                `json:"submitterMsp"`
+	SubmitterID   string                `json:"submitterId"`
+	Breaches      []*PendingApplication `json:"breaches"`
+}
+
+// ReportHash is the hex SHA-256 of the JSON the report function returned
+type ReportGeneratedEventV1 struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	TxID          string            `json:"txId"`
+	Timestamp     string            `json:"timestamp"`
+	SubmitterMSP  string            `json:"submitterMsp"`
+	SubmitterID   string            `json:"submitterId"`
+	Report        string            `json:"report"`
+	Parameters    map[string]string `json:"parameters"`
+	ReportHash    string            `json:"reportHash"`
+}
+
+// Token movement, also carried by the loan events of the transaction settling it
+type TokenEventV1 struct {
+	SchemaVersion int     `json:"schemaVersion"`
+	Type          string  `json:"type"`
+	From          string  `json:"from"`
+	To            string  `json:"to"`
+	Amount        float64 `json:"amount"`
+	Reason        string  `json:"reason"`
+	LoanID        string  `json:"loanId"`
+	TxID          string  `json:"txId"`
+	Timestamp     string  `json:"timestamp"`
+	SubmitterMSP  string  `json:"submitterMsp"`
+	SubmitterID   string  `json:"submitterId"`
+	Value         string  `json:"value,omitempty"` // exact decimal amount
+	AMLCaseID     string  `json:"amlCaseId,omitempty"`
+}
+
+// Emitted when compliance closes an AML case, for FIU reporting
+type AMLCaseEventV1 struct {
+	SchemaVersion int      `json:"schemaVersion"`
+	Case          *AMLCase `json:"case"`
+}
+
+type AMLCase struct {
+	CaseID         string `json:"caseId"`
+	Rule           string `json:"rule"`
+	Account        string `json:"account"`
+	Counterparty   string `json:"counterparty"`
+	Amount         string `json:"amount"`
+	TransferReason string `json:"transferReason"`
+	LoanID         string `json:"loanId"`
+	Detail         string `json:"detail"`
+	TxID           string `json:"txId"`
+	OpenedAt       string `json:"openedAt"`
+	Status         string `json:"status"`
+	Disposition    string `json:"disposition,omitempty"`
+	Notes          string `json:"notes,omitempty"`
+	ClosedBy       string `json:"closedBy,omitempty"`
+	ClosedAt       string `json:"closedAt,omitempty"`
+}
@@ -0,0 +1,764 @@
+package client
+
+import "encoding/json"
+
+// Loan as stored by the lending chaincode. Amounts and rates, here and in the
+// other results, are exact decimal strings such as "1500.25" and "8.5000".
+type Loan struct {
+	LoanID               string                  `json:"loanId"`
+	BorrowerID           string                  `json:"borrowerId"`
+	LenderID             string                  `json:"lenderId"`
+	Amount               string                  `json:"amount"`
+	InterestRate         string                  `json:"interestRate"`
+	Duration             int                     `json:"duration"`
+	Status               string                  `json:"status"`
+	DisbursementDate     string                  `json:"disbursementDate"`
+	RepaymentDue         string                  `json:"repaymentDue"`
+	RemainingBalance     string                  `json:"remainingBalance"`
+	Collateral           string                  `json:"collateral"`
+	Defaulted            bool                    `json:"defaulted"`
+	AuditHistory         []string                `json:"auditHistory"`
+	CreatedAt            string                  `json:"createdAt"`
+	DueDate              string                  `json:"dueDate"`
+	PolicyResults        []PolicyRuleResult      `json:"policyResults,omitempty"`
+	ApprovedAt           string                  `json:"approvedAt,omitempty"`
+	Product              string                  `json:"product,omitempty"`
+	PSLCategory          string                  `json:"pslCategory,omitempty"`
+	Metadata             map[string]string       `json:"metadata,omitempty"`
+	ClosedAt             string                  `json:"closedAt,omitempty"`
+	DefaultedAt          string                  `json:"defaultedAt,omitempty"`
+	DefaultedBalance     string                  `json:"defaultedBalance,omitempty"`
+	DefaultReason        string                  `json:"defaultReason,omitempty"`
+	Reserved             string                  `json:"reserved,omitempty"`
+	Archived             bool                    `json:"archived,omitempty"`
+	SchemeID             string                  `json:"schemeId,omitempty"`
+	SubventionRate       string                  `json:"subventionRate,omitempty"`
+	SubventionClaimed    string                  `json:"subventionClaimed,omitempty"`
+	InvoiceID            string                  `json:"invoiceId,omitempty"`
+	Gold                 *GoldCollateral         `json:"gold,omitempty"`
+	Vehicle              *VehicleCollateral      `json:"vehicle,omitempty"`
+	Property             *PropertyCollateral     `json:"property,omitempty"`
+	Pledges              []*CollateralPledge     `json:"pledges,omitempty"`
+	Substitution         *CollateralSubstitution `json:"substitution,omitempty"`
+	Novation             *LoanNovation           `json:"novation,omitempty"`
+	Escalation           *ApprovalEscalation     `json:"escalation,omitempty"`
+	Consent              *ConsentArtifact        `json:"consent,omitempty"`
+	RejectionReason      string                  `json:"rejectionReason,omitempty"`
+	PriorApplicationID   string                  `json:"priorApplicationId,omitempty"`
+	InterestMethod       string                  `json:"interestMethod,omitempty"`
+	CompoundingFrequency int                     `json:"compoundingFrequency,omitempty"`
+	Dispute              *LoanDispute            `json:"dispute,omitempty"`
+	AmountBand           string                  `json:"amountBand,omitempty"` // principal range, in place of amounts when Redacted
+	Redacted             bool                    `json:"redacted,omitempty"`   // borrower and amounts withheld from a caller not party to the loan
+	Branch               string                  `json:"branch,omitempty"`
+	Mandate              *RepaymentMandate       `json:"mandate,omitempty"`
+	Margin               string                  `json:"margin,omitempty"`
+	Restructurings       []*LoanRestructuring    `json:"restructurings,omitempty"`
+	RateResets           []*RateReset            `json:"rateResets,omitempty"`
+	AccruedInterest      string                  `json:"accruedInterest,omitempty"`
+	DaysPastDue          int                     `json:"daysPastDue,omitempty"`
+	AssetClass           string                  `json:"assetClass,omitempty"`
+	PenalCharges         string                  `json:"penalCharges,omitempty"`
+	ProcessedThrough     string                  `json:"processedThrough,omitempty"`
+	Tranches             []*Tranche              `json:"tranches,omitempty"`
+	BlendedRate          string                  `json:"blendedRate,omitempty"`
+	Benchmark            string                  `json:"benchmark,omitempty"`
+	Spread               string                  `json:"spread,omitempty"`
+	Cancellation         *CommitmentCancellation `json:"cancellation,omitempty"`
+	CommitmentFees       string                  `json:"commitmentFees,omitempty"`
+	CommitmentFrom       string                  `json:"commitmentFrom,omitempty"`
+	BorrowerDataHash     string                  `json:"borrowerDataHash,omitempty"` // SHA-256 of the personal data given with the application
+}
+
+type Tranche struct {
+	TrancheID   string `json:"trancheId,omitempty"`
+	Amount      string `json:"amount"`
+	Rate        string `json:"rate"`
+	DisbursedAt string `json:"disbursedAt"`
+	TxID        string `json:"txId"`
+}
+
+// A floating rate reset, the rate applying from the fraction of the term run
+type RateReset struct {
+	PriorRate string `json:"priorRate"`
+	Rate      string `json:"rate"`
+	Elapsed   string `json:"elapsed"`
+	ResetAt   string `json:"resetAt"`
+	TxID      string `json:"txId"`
+}
+
+// A restructuring or moratorium deferring a loan's due date
+type LoanRestructuring struct {
+	Kind         string `json:"kind"` // RESTRUCTURED, MORATORIUM
+	PriorDueDate string `json:"priorDueDate"`
+	NewDueDate   string `json:"newDueDate"`
+	AssetClass   string `json:"assetClass"`
+	HeldUntil    string `json:"heldUntil"`
+	Reason       string `json:"reason"`
+	GrantedAt    string `json:"grantedAt"`
+}
+
+// Borrower's request to cancel undrawn principal of a tranche loan
+type CommitmentCancellation struct {
+	Amount         string `json:"amount"`
+	RequestedAt    string `json:"requestedAt"`
+	RequestedBy    string `json:"requestedBy"`
+	Status         string `json:"status"` // REQUESTED, ACKNOWLEDGED
+	AcknowledgedAt string `json:"acknowledgedAt,omitempty"`
+}
+
+type CollateralPledge struct {
+	CollateralID string `json:"collateralId"`
+	Type         string `json:"type"`
+	Status       string `json:"status"`
+	Value        string `json:"value"`
+	Proceeds     string `json:"proceeds,omitempty"`
+}
+
+// Proposal to swap a registry asset securing an active loan
+type CollateralSubstitution struct {
+	ReleaseID     string `json:"releaseId"`
+	ReplacementID string `json:"replacementId"`
+	Value         string `json:"value"`
+	ProposedAt    string `json:"proposedAt"`
+	ProposedBy    string `json:"proposedBy"`
+	Status        string `json:"status"` // PROPOSED, APPROVED, REJECTED
+	DecidedAt     string `json:"decidedAt,omitempty"`
+	Reason        string `json:"reason,omitempty"`
+}
+
+// Proposal to transfer a loan's obligation to another borrower
+type ApprovalEscalation struct {
+	LenderID    string `json:"lenderId"`
+	MakerID     string `json:"makerId"`
+	MakerLimit  string `json:"makerLimit"`
+	EscalatedAt string `json:"escalatedAt"`
+	Status      string `json:"status"` // ESCALATED, APPROVED, REJECTED
+	CheckerID   string `json:"checkerId,omitempty"`
+	DecidedAt   string `json:"decidedAt,omitempty"`
+}
+
+// Largest loan an officer may approve alone
+type OfficerLimit struct {
+	OrgMSP    string `json:"orgMsp"`
+	OfficerID string `json:"officerId"`
+	Limit     string `json:"limit"`
+	SetBy     string `json:"setBy"`
+	SetAt     string `json:"setAt"`
+}
+
+type LoanNovation struct {
+	FromBorrowerID string             `json:"fromBorrowerId"`
+	ToBorrowerID   string             `json:"toBorrowerId"`
+	ProposedAt     string             `json:"proposedAt"`
+	ProposedBy     string             `json:"proposedBy"`
+	Status         string             `json:"status"` // PROPOSED, CONSENTED, APPROVED, REJECTED
+	ConsentedAt    string             `json:"consentedAt,omitempty"`
+	ConsentedBy    string             `json:"consentedBy,omitempty"`
+	DecidedAt      string             `json:"decidedAt,omitempty"`
+	Reason         string             `json:"reason,omitempty"`
+	PolicyResults  []PolicyRuleResult `json:"policyResults,omitempty"`
+}
+
+// Asset of the collateral registry
+type CollateralAsset struct {
+	CollateralID string `json:"collateralId"`
+	Type         string `json:"type"`
+	OwnerID      string `json:"ownerId"`
+	Description  string `json:"description"`
+	Value        string `json:"value"`
+	ValuedAt     string `json:"valuedAt"`
+	ValuedBy     string `json:"valuedBy"`
+	RegisteredAt string `json:"registeredAt"`
+}
+
+type Encumbrance struct {
+	CollateralID string `json:"collateralId"`
+	LoanID       string `json:"loanId"`
+	LenderID     string `json:"lenderId"`
+	Status       string `json:"status"`
+	CreatedAt    string `json:"createdAt"`
+	ReleasedAt   string `json:"releasedAt"`
+}
+
+type EncumbrancePage struct {
+	Encumbrances []*Encumbrance `json:"encumbrances"`
+	Bookmark     string         `json:"bookmark"`
+}
+
+// NACH debit mandate the daily servicing collects repayments under
+type RepaymentMandate struct {
+	UMRN         string `json:"umrn"`
+	MaxAmount    string `json:"maxAmount"`
+	RegisteredAt string `json:"registeredAt"`
+}
+
+// Dispute raised by the borrower, the loan cannot be defaulted while it is unresolved
+type LoanDispute struct {
+	Reason      string `json:"reason"`
+	RaisedAt    string `json:"raisedAt"`
+	RaisedBy    string `json:"raisedBy"`
+	Status      string `json:"status"`
+	Response    string `json:"response,omitempty"`
+	RespondedAt string `json:"respondedAt,omitempty"`
+	Outcome     string `json:"outcome,omitempty"`
+	Resolution  string `json:"resolution,omitempty"`
+	ResolvedBy  string `json:"resolvedBy,omitempty"`
+	ResolvedAt  string `json:"resolvedAt,omitempty"`
+}
+
+type ConsentArtifact struct {
+	ConsentID   string `json:"consentId"`
+	ConsentHash string `json:"consentHash"`
+	ValidFrom   string `json:"validFrom"`
+	ValidUntil  string `json:"validUntil"`
+	AttachedAt  string `json:"attachedAt"`
+}
+
+type PropertyCollateral struct {
+	PropertyID string `json:"propertyId"`
+	Status     string `json:"status"`
+}
+
+type VehicleCollateral struct {
+	RegistrationNumber string `json:"registrationNumber"`
+	ChassisNumber      string `json:"chassisNumber"`
+	Status             string `json:"status"`
+}
+
+type GoldCollateral struct {
+	WeightGrams string `json:"weightGrams"`
+	Purity      string `json:"purity"`
+	Value       string `json:"value"`
+	ValuedAt    string `json:"valuedAt"`
+	LTVBreached bool   `json:"ltvBreached"`
+}
+
+// Transferable claim on a loan's repayments, Owner receives them
+type LoanClaim struct {
+	LoanID       string   `json:"loanId"`
+	Owner        string   `json:"owner"`
+	MintedAt     string   `json:"mintedAt"`
+	AuditHistory []string `json:"auditHistory"`
+}
+
+// Participation units issued against a loan, repayments are split by units
+type ParticipationTable struct {
+	LoanID       string         `json:"loanId"`
+	Issuer       string         `json:"issuer"`
+	TotalUnits   int            `json:"totalUnits"`
+	Holdings     map[string]int `json:"holdings"`
+	IssuedAt     string         `json:"issuedAt"`
+	AuditHistory []string       `json:"auditHistory"`
+	Distribution string         `json:"distribution,omitempty"`
+}
+
+// Interest of a loan received in one month and paid out to its unit holders
+type IncomeDistribution struct {
+	LoanID         string                `json:"loanId"`
+	Period         string                `json:"period"`
+	Interest       string                `json:"interest"`
+	Payments       []DistributionPayment `json:"payments"`
+	DistributedAt  string                `json:"distributedAt"`
+	DistributedBy  string                `json:"distributedBy"`
+	RepaymentCount int                   `json:"repaymentCount"`
+	TxID           string                `json:"txId"`
+}
+
+type DistributionPayment struct {
+	Holder string `json:"holder"`
+	Units  int    `json:"units"`
+	Amount string `json:"amount"`
+}
+
+// Evidence bundle of a loan, Digest covers the attestation with Digest empty
+type LoanAttestation struct {
+	LoanID           string               `json:"loanId"`
+	Loan             *Loan                `json:"loan"`
+	StateHash        string               `json:"stateHash"`
+	History          []LedgerModification `json:"history"`
+	AuditChain       []string             `json:"auditChain"`
+	ArchiveAuditHash string               `json:"archiveAuditHash,omitempty"`
+	AttestedFor      string               `json:"attestedFor"`
+	GeneratedAt      string               `json:"generatedAt"`
+	TxID             string               `json:"txId"`
+	Digest           string               `json:"digest"`
+}
+
+type LedgerModification struct {
+	TxID      string `json:"txId"`
+	Timestamp string `json:"timestamp"`
+	IsDelete  bool   `json:"isDelete"`
+	ValueHash string `json:"valueHash"`
+}
+
+// What a chaincode deployment supports. Config is kept raw, its parameters
+// change between versions.
+type ContractInfo struct {
+	Version     string          `json:"version"`
+	Features    []string        `json:"features"`
+	Events      []string        `json:"events"`
+	TokenLedger string          `json:"tokenLedger"`
+	Config      json.RawMessage `json:"config"`
+}
+
+// Has reports whether the deployment supports a feature
+func (i *ContractInfo) Has(feature string) bool {
+	for _, f := range i.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+type PingResponse struct {
+	Version   string `json:"version"`
+	ChannelID string `json:"channelId"`
+	TxID      string `json:"txId"`
+	Timestamp string `json:"timestamp"`
+	CallerMSP string `json:"callerMsp"`
+}
+
+// Outcome of one credit policy rule evaluated at approval
+type PolicyRuleResult struct {
+	Rule   string `json:"rule"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+}
+
+// A page of loans, Bookmark is empty on the last page
+type LoanPage struct {
+	Loans    []*Loan `json:"loans"`
+	Bookmark string  `json:"bookmark"`
+}
+
+// A batch of loans in request order, Cursor is empty after the last
+type LoanExport struct {
+	Loans  []*Loan `json:"loans"`
+	Cursor string  `json:"cursor"`
+}
+
+type AuditTrailPage struct {
+	LoanID   string   `json:"loanId"`
+	Start    int      `json:"start"`
+	Total    int      `json:"total"`
+	Entries  []string `json:"entries"`
+	Bookmark string   `json:"bookmark"`
+}
+
+type StatementEntry struct {
+	Date        string `json:"date"`
+	Type        string `json:"type"` // DISBURSEMENT, INTEREST, CHARGE, REPAYMENT
+	Description string `json:"description"`
+	Reference   string `json:"reference,omitempty"`
+	Debit       string `json:"debit"`
+	Credit      string `json:"credit"`
+	Balance     string `json:"balance"`
+}
+
+// Statement of account of a loan, interest shown as it accrues
+type LoanStatement struct {
+	LoanID         string            `json:"loanId"`
+	BorrowerID     string            `json:"borrowerId"`
+	LenderID       string            `json:"lenderId"`
+	FromDate       string            `json:"fromDate"`
+	ToDate         string            `json:"toDate"`
+	OpeningBalance string            `json:"openingBalance"`
+	TotalDebits    string            `json:"totalDebits"`
+	TotalCredits   string            `json:"totalCredits"`
+	ClosingBalance string            `json:"closingBalance"`
+	Entries        []*StatementEntry `json:"entries"`
+	GeneratedAt    string            `json:"generatedAt"`
+}
+
+type LenderStatementLine struct {
+	LoanID            string `json:"loanId"`
+	Disbursed         string `json:"disbursed"`
+	PrincipalReceived string `json:"principalReceived"`
+	InterestReceived  string `json:"interestReceived"`
+	RebatesGiven      string `json:"rebatesGiven"`
+	FeesEarned        string `json:"feesEarned"`
+	FeesPaid          string `json:"feesPaid"`
+	WrittenOff        string `json:"writtenOff"`
+}
+
+// A lender's cash flows and write-offs over a period
+type LenderStatement struct {
+	LenderID          string                 `json:"lenderId"`
+	Period            string                 `json:"period"`
+	From              string                 `json:"from"`
+	To                string                 `json:"to"`
+	LoansDisbursed    int                    `json:"loansDisbursed"`
+	Disbursed         string                 `json:"disbursed"`
+	PrincipalReceived string                 `json:"principalReceived"`
+	InterestReceived  string                 `json:"interestReceived"`
+	RebatesGiven      string                 `json:"rebatesGiven"`
+	FeesEarned        string                 `json:"feesEarned"`
+	FeesPaid          string                 `json:"feesPaid"`
+	LoansWrittenOff   int                    `json:"loansWrittenOff"`
+	WrittenOff        string                 `json:"writtenOff"`
+	NetCashFlow       string                 `json:"netCashFlow"`
+	Lines             []*LenderStatementLine `json:"lines"`
+	GeneratedAt       string                 `json:"generatedAt"`
+}
+
+type AccruedInterestLine struct {
+	LoanID            string `json:"loanId"`
+	AssetClass        string `json:"assetClass"`
+	Accrued           string `json:"accrued"`
+	Received          string `json:"received"`
+	AccruedUnreceived string `json:"accruedUnreceived"`
+	ReceivedInAdvance string `json:"receivedInAdvance"`
+}
+
+// A lender's interest income on an accrual basis, non-performing loans'
+// unreceived interest held apart as SuspendedInterest
+type AccruedInterestReport struct {
+	LenderID          string                 `json:"lenderId"`
+	AsOfDate          string                 `json:"asOfDate"`
+	Accrued           string                 `json:"accrued"`
+	Received          string                 `json:"received"`
+	AccruedUnreceived string                 `json:"accruedUnreceived"`
+	ReceivedInAdvance string                 `json:"receivedInAdvance"`
+	SuspendedInterest string                 `json:"suspendedInterest"`
+	Lines             []*AccruedInterestLine `json:"lines"`
+	GeneratedAt       string                 `json:"generatedAt"`
+}
+
+type TrancheAccrual struct {
+	Tranche     int    `json:"tranche"`
+	Amount      string `json:"amount"`
+	Rate        string `json:"rate"`
+	DisbursedAt string `json:"disbursedAt"`
+	Interest    string `json:"interest"`
+}
+
+// Interest of a loan disbursed in tranches, each accruing from its own date,
+// and the blended rate on the principal actually lent
+type TrancheInterest struct {
+	LoanID        string           `json:"loanId"`
+	AsOf          string           `json:"asOf"`
+	Sanctioned    string           `json:"sanctioned"`
+	Disbursed     string           `json:"disbursed"`
+	Undisbursed   string           `json:"undisbursed"`
+	Interest      string           `json:"interest"`
+	BlendedRate   string           `json:"blendedRate"`
+	EffectiveRate string           `json:"effectiveRate"`
+	Tranches      []TrancheAccrual `json:"tranches"`
+}
+
+// What a floating rate reset changed for the borrower, the maturity is kept
+type RateResetImpact struct {
+	LoanID          string `json:"loanId"`
+	LenderID        string `json:"lenderId"`
+	BorrowerID      string `json:"borrowerId"`
+	Benchmark       string `json:"benchmark"`
+	Fixing          string `json:"fixing"`
+	OldRate         string `json:"oldRate"`
+	NewRate         string `json:"newRate"`
+	OldInstallment  string `json:"oldInstallment"`
+	NewInstallment  string `json:"newInstallment"`
+	OldRepaymentDue string `json:"oldRepaymentDue"`
+	NewRepaymentDue string `json:"newRepaymentDue"`
+	Maturity        string `json:"maturity"`
+	ResetAt         string `json:"resetAt"`
+	TxID            string `json:"txId"`
+}
+
+type RateResetReport struct {
+	LenderID string             `json:"lenderId"`
+	Period   string             `json:"period"`
+	Resets   []*RateResetImpact `json:"resets"`
+}
+
+type ScheduleInstallment struct {
+	Installment int    `json:"installment"`
+	DueDate     string `json:"dueDate"`
+	Principal   string `json:"principal"`
+	Interest    string `json:"interest"`
+	Total       string `json:"total"`
+}
+
+// What a loan transaction left the loan as. Event holds the payload of the
+// event named EventName, e.g. a LoanRepaidEventV2 for LoanRepaid.v2.
+type LoanResult struct {
+	LoanID           string                `json:"loanId"`
+	TxID             string                `json:"txId"`
+	Status           string                `json:"status"`
+	RepaymentDue     string                `json:"repaymentDue"`
+	RemainingBalance string                `json:"remainingBalance"`
+	DueDate          string                `json:"dueDate,omitempty"`
+	ReceiptID        string                `json:"receiptId,omitempty"`
+	TrancheID        string                `json:"trancheId,omitempty"`
+	Schedule         []ScheduleInstallment `json:"schedule,omitempty"`
+	EventName        string                `json:"eventName,omitempty"`
+	Event            json.RawMessage       `json:"event,omitempty"`
+}
+
+// Schedule quoted for a loan that has not been requested
+type ScheduleSimulation struct {
+	Amount               string                `json:"amount"`
+	InterestRate         string                `json:"interestRate"`
+	Duration             int                   `json:"duration"`
+	InterestMethod       string                `json:"interestMethod"`
+	CompoundingFrequency int                   `json:"compoundingFrequency,omitempty"`
+	RepaymentDue         string                `json:"repaymentDue"`
+	TotalInterest        string                `json:"totalInterest"`
+	Installments         []ScheduleInstallment `json:"installments"`
+}
+
+// What it takes to close a loan early, the unaccrued interest being rebated
+type PrepaymentQuote struct {
+	LoanID           string `json:"loanId"`
+	AsOf             string `json:"asOf"`
+	RemainingBalance string `json:"remainingBalance"`
+	AccruedInterest  string `json:"accruedInterest"`
+	Payoff           string `json:"payoff"`
+	Rebate           string `json:"rebate"`
+}
+
+// An application awaiting a decision or disbursement, aged in whole hours
+type PendingApplication struct {
+	LoanID     string `json:"loanId"`
+	BorrowerID string `json:"borrowerId"`
+	LenderID   string `json:"lenderId,omitempty"`
+	Status     string `json:"status"`
+	Amount     string `json:"amount"`
+	CreatedAt  string `json:"createdAt"`
+	StageSince string `json:"stageSince"`
+	AgeHours   int    `json:"ageHours"`
+	StageHours int    `json:"stageHours"`
+	SLAHours   int    `json:"slaHours"`
+	Breached   bool   `json:"breached"`
+}
+
+// A page of an application queue, Bookmark is empty on the last page
+type PendingApplicationPage struct {
+	Applications []*PendingApplication `json:"applications"`
+	Bookmark     string                `json:"bookmark"`
+}
+
+// Sanctioned credit outstanding in a sector, TOTAL for all sectors, against its cap
+type CreditExposure struct {
+	Sector      string `json:"sector"`
+	Outstanding string `json:"outstanding"`
+	Loans       int    `json:"loans"`
+	Cap         string `json:"cap,omitempty"`
+}
+
+type CreditExposurePage struct {
+	Exposures []*CreditExposure `json:"exposures"`
+	Bookmark  string            `json:"bookmark"`
+}
+
+type CapBreach struct {
+	LoanID      string `json:"loanId"`
+	LenderID    string `json:"lenderId"`
+	Sector      string `json:"sector"`
+	Cap         string `json:"cap"`
+	Outstanding string `json:"outstanding"`
+	Requested   string `json:"requested"`
+	AttemptedAt string `json:"attemptedAt"`
+	TxID        string `json:"txId"`
+}
+
+// A page of refused approvals, Bookmark is empty on the last page
+type CapBreachPage struct {
+	Breaches []*CapBreach `json:"breaches"`
+	Bookmark string       `json:"bookmark"`
+}
+
+type BenchmarkSubmission struct {
+	Benchmark    string `json:"benchmark"`
+	Rate         string `json:"rate"`
+	SubmitterMSP string `json:"submitterMsp"`
+	SubmitterID  string `json:"submitterId"`
+	SubmittedAt  string `json:"submittedAt"`
+	TxID         string `json:"txId"`
+}
+
+// A benchmark rate, the median of the recent submissions it lists
+type BenchmarkFixing struct {
+	Benchmark   string                 `json:"benchmark"`
+	Rate        string                 `json:"rate"`
+	FixedAt     string                 `json:"fixedAt"`
+	TxID        string                 `json:"txId"`
+	Submissions []*BenchmarkSubmission `json:"submissions"`
+}
+
+type Repayment struct {
+	RepaymentID      string `json:"repaymentId"`
+	LoanID           string `json:"loanId"`
+	Amount           string `json:"amount"`
+	PaymentReference string `json:"paymentReference"`
+	PaidAt           string `json:"paidAt"`
+	TxID             string `json:"txId"`
+	Rebate           string `json:"rebate,omitempty"`
+}
+
+type ReceiptComponents struct {
+	Principal string `json:"principal"`
+	Interest  string `json:"interest"`
+	Rebate    string `json:"rebate,omitempty"`
+	TDS       string `json:"tds,omitempty"`
+}
+
+type Receipt struct {
+	ReceiptID        string            `json:"receiptId"`
+	LoanID           string            `json:"loanId"`
+	PayerID          string            `json:"payerId"`
+	Installment      int               `json:"installment"`
+	Amount           string            `json:"amount"`
+	Components       ReceiptComponents `json:"components"`
+	PaymentReference string            `json:"paymentReference"`
+	PaidAt           string            `json:"paidAt"`
+	TxID             string            `json:"txId"`
+	Hash             string            `json:"hash"`
+}
+
+// Tax withheld from the interest of a repayment
+type TDSCertificate struct {
+	CertificateID    string `json:"certificateId"`
+	LoanID           string `json:"loanId"`
+	Deductor         string `json:"deductor"`
+	Deductee         string `json:"deductee"`
+	TaxAccount       string `json:"taxAccount"`
+	Interest         string `json:"interest"`
+	Rate             string `json:"rate"`
+	Withheld         string `json:"withheld"`
+	PaymentReference string `json:"paymentReference"`
+	DeductedAt       string `json:"deductedAt"`
+	TxID             string `json:"txId"`
+}
+
+type TDSLedger struct {
+	Account        string            `json:"account"`
+	Period         string            `json:"period"`
+	Deducted       string            `json:"deducted"`
+	DeductedFrom   string            `json:"deductedFrom"`
+	InterestPaid   string            `json:"interestPaid"`
+	InterestEarned string            `json:"interestEarned"`
+	Certificates   []*TDSCertificate `json:"certificates"`
+	Bookmark       string            `json:"bookmark"`
+}
+
+// Tax invoice of a processing or platform fee collected at disbursement
+type FeeInvoice struct {
+	InvoiceNumber string `json:"invoiceNumber"`
+	Type          string `json:"type"` // PROCESSING, PLATFORM
+	LoanID        string `json:"loanId"`
+	Supplier      string `json:"supplier"`
+	Recipient     string `json:"recipient"`
+	TaxableValue  string `json:"taxableValue"`
+	GSTRate       string `json:"gstRate"`
+	CGST          string `json:"cgst"`
+	SGST          string `json:"sgst"`
+	IGST          string `json:"igst"`
+	Total         string `json:"total"`
+	IssuedAt      string `json:"issuedAt"`
+	TxID          string `json:"txId"`
+}
+
+// A page of an account's fee invoices, Bookmark is empty on the last page
+type FeeInvoicePage struct {
+	Invoices []*FeeInvoice `json:"invoices"`
+	Bookmark string        `json:"bookmark"`
+}
+
+// Parameters of a new loan application
+type LoanRequest struct {
+	LoanID       string
+	BorrowerID   string
+	Amount       string
+	InterestRate string // percent, such as "8.5"
+	Duration     int    // months
+	Collateral   string
+	Product      string
+	PSLCategory  string
+	PriorLoanID  string // rejected application this one re-applies for
+
+	// Personal data of the borrower, sent in the transient map and kept in a
+	// private data collection rather than in the loan
+	BorrowerData *BorrowerPII
+}
+
+type BorrowerPII struct {
+	BorrowerID string `json:"borrowerId"`
+	Name       string `json:"name"`
+	Address    string `json:"address"`
+	Phone      string `json:"phone"`
+	Email      string `json:"email"`
+}
+
+type ProcessedRequest struct {
+	RequestID   string `json:"requestId"`
+	Function    string `json:"function"`
+	CallerMSP   string `json:"callerMsp"`
+	TxID        string `json:"txId"`
+	ProcessedAt string `json:"processedAt"`
+}
+
+type AccountSummary struct {
+	AccountID string `json:"accountId"`
+	Type      string `json:"type"`
+	Balance   string `json:"balance"` // exact decimal
+}
+
+// A page of token accounts, Bookmark is empty on the last page
+type AccountPage struct {
+	Accounts []AccountSummary `json:"accounts"`
+	Bookmark string           `json:"bookmark"`
+}
+
+// Registry entry of a token account with its balance, as exported
+type ExportedAccount struct {
+	AccountID string            `json:"accountId"`
+	Type      string            `json:"type"`
+	OrgMSP    string            `json:"orgMsp"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	CreatedAt string            `json:"createdAt"`
+	Balance   string            `json:"balance"` // exact decimal
+}
+
+// A batch of accounts in account ID order, Cursor is empty after the last
+type AccountExport struct {
+	Accounts []ExportedAccount `json:"accounts"`
+	Cursor   string            `json:"cursor"`
+}
+
+// Funds held in an account for a reference until captured or released
+type Hold struct {
+	Reference  string `json:"reference"`
+	Account    string `json:"account"`
+	Amount     string `json:"amount"` // exact decimal
+	Status     string `json:"status"` // HELD, CAPTURED, RELEASED
+	CreatedAt  string `json:"createdAt"`
+	CapturedTo string `json:"capturedTo,omitempty"`
+	ClosedAt   string `json:"closedAt,omitempty"`
+}
+
+// A movement on a token account statement, amounts are exact decimals
+type AccountStatementEntry struct {
+	Date         string `json:"date"`
+	Counterparty string `json:"counterparty"`
+	Reference    string `json:"reference,omitempty"`
+	Reason       string `json:"reason"`
+	TxID         string `json:"txId"`
+	Debit        string `json:"debit"`
+	Credit       string `json:"credit"`
+	Balance      string `json:"balance"`
+}
+
+type AccountStatement struct {
+	Account        string                  `json:"account"`
+	FromDate       string                  `json:"fromDate"`
+	ToDate         string                  `json:"toDate"`
+	OpeningBalance string                  `json:"openingBalance"`
+	TotalDebits    string                  `json:"totalDebits"`
+	TotalCredits   string                  `json:"totalCredits"`
+	ClosingBalance string                  `json:"closingBalance"`
+	Entries        []AccountStatementEntry `json:"entries"`
+	GeneratedAt    string                  `json:"generatedAt"`
+	Bookmark       string                  `json:"bookmark"` // empty on the last page
+}
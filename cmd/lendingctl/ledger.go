@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+func newInitCommand(flags *connectionFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "init",
+		Short: "Initialize the ledger with the opening bank balances",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withContract(flags, func(contract *client.Contract) error {
+				return submit(contract, "InitLedger")
+			})
+		},
+	}
+}
+
+func newMintCommand(flags *connectionFlags) *cobra.Command {
+	return &cobra.Command{
+		Use:   "mint <account> <amount>",
+		Short: "Issue new tokens to an account (regulator only)",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withContract(flags, func(contract *client.Contract) error {
+				return submit(contract, "Mint", args[0], args[1])
+			})
+		},
+	}
+}
+
+func newAccountCommand(flags *connectionFlags) *cobra.Command {
+	account := &cobra.Command{
+		Use:   "account",
+		Short: "Manage token accounts",
+	}
+
+	var (
+		openingBalance string
+		accountType    string
+		orgMSP         string
+		metadata       map[string]string
+	)
+	create := &cobra.Command{
+		Use:   "create <account>...",
+		Short: "Onboard token accounts (regulator only)",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			metadataJSON, err := json.Marshal(metadata)
+			if err != nil {
+				return err
+			}
+			return withContract(flags, func(contract *client.Contract) error {
+				for _, id := range args {
+					if err := submit(contract, "CreateAccount", id, accountType, orgMSP, string(metadataJSON)); err != nil {
+						return err
+					}
+					if openingBalance == "" {
+						continue
+					}
+					if err := submit(contract, "Mint", id, openingBalance); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		},
+	}
+	create.Flags().StringVar(&accountType, "type", "BORROWER", "account type: BANK, BORROWER, REGULATOR or PLATFORM")
+	create.Flags().StringVar(&orgMSP, "org", "", "MSP ID of the organization operating the accounts")
+	create.Flags().StringToStringVar(&metadata, "meta", map[string]string{}, "account metadata as key=value pairs")
+	create.Flags().StringVar(&openingBalance, "opening-balance", "", "decimal amount of tokens minted to each new account")
+
+	balance := &cobra.Command{
+		Use:   "balance <account>",
+		Short: "Show an account balance",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withContract(flags, func(contract *client.Contract) error {
+				return evaluateAndPrint(cmd, contract, "GetBalance", args[0])
+			})
+		},
+	}
+
+	prune := &cobra.Command{
+		Use:   "prune <account>...",
+		Short: "Fold pending balance deltas into the accounts' base balances",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withContract(flags, func(contract *client.Contract) error {
+				for _, id := range args {
+					if err := submit(contract, "PruneBalance", id); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		},
+	}
+
+	var pageSize int32
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List every token account with its type and balance",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withContract(flags, func(contract *client.Contract) error {
+				return listAccounts(cmd, contract, pageSize)
+			})
+		},
+	}
+	list.Flags().Int32Var(&pageSize, "page-size", 100, "accounts fetched per query")
+
+	account.AddCommand(create, balance, prune, list)
+	return account
+}
+
+func listAccounts(cmd *cobra.Command, contract *client.Contract, pageSize int32) error {
+	var page struct {
+		Accounts []json.RawMessage `json:"accounts"`
+		Bookmark string            `json:"bookmark"`
+	}
+
+	encoder := json.NewEncoder(cmd.OutOrStdout())
+	bookmark := ""
+	for {
+		result, err := contract.EvaluateTransaction("GetAllAccounts", strconv.Itoa(int(pageSize)), bookmark)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(result, &page); err != nil {
+			return fmt.Errorf("unexpected GetAllAccounts result: %w", err)
+		}
+
+		for _, account := range page.Accounts {
+			if err := encoder.Encode(account); err != nil {
+				return err
+			}
+		}
+
+		if page.Bookmark == "" {
+			return nil
+		}
+		bookmark = page.Bookmark
+	}
+}
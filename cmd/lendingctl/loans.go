@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+func newLoansCommand(flags *connectionFlags) *cobra.Command {
+	loans := &cobra.Command{
+		Use:   "loans",
+		Short: "Inspect and service loans",
+	}
+
+	var pageSize int32
+	list := &cobra.Command{
+		Use:   "list <status>",
+		Short: "List every loan in a status, following bookmarks across pages",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withContract(flags, func(contract *client.Contract) error {
+				return listLoansByStatus(cmd, contract, args[0], pageSize)
+			})
+		},
+	}
+	list.Flags().Int32Var(&pageSize, "page-size", 100, "loans fetched per query")
+
+	forceDefault := &cobra.Command{
+		Use:   "force-default <loanID> <reasonCode>",
+		Short: "Mark an active loan past due as defaulted (NON_PAYMENT, WILFUL, FRAUD, INSOLVENCY, DECEASED)",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withContract(flags, func(contract *client.Contract) error {
+				return submit(contract, "MarkAsDefaulted", args[0], args[1])
+			})
+		},
+	}
+
+	loans.AddCommand(list, forceDefault)
+	return loans
+}
+
+func listLoansByStatus(cmd *cobra.Command, contract *client.Contract, status string, pageSize int32) error {
+	var page struct {
+		Loans    []json.RawMessage `json:"loans"`
+		Bookmark string            `json:"bookmark"`
+	}
+
+	encoder := json.NewEncoder(cmd.OutOrStdout())
+	bookmark := ""
+	for {
+		result, err := contract.EvaluateTransaction("GetLoansByStatus", status, strconv.Itoa(int(pageSize)), bookmark)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(result, &page); err != nil {
+			return fmt.Errorf("unexpected GetLoansByStatus result: %w", err)
+		}
+
+		// One loan per line so the output can be piped into line-based tools
+		for _, loan := range page.Loans {
+			if err := encoder.Encode(loan); err != nil {
+				return err
+			}
+		}
+
+		if page.Bookmark == "" {
+			return nil
+		}
+		bookmark = page.Bookmark
+	}
+}
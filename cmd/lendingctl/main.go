@@ -0,0 +1,97 @@
+// Command lendingctl is an operator CLI for the deployed lending chaincode
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/spf13/cobra"
+
+	"github.com/TSChallenges/npci-blockchain-assignment-9-Jagadeeswargoud/internal/gateway"
+)
+
+// Connection settings shared by every command
+type connectionFlags struct {
+	peerEndpoint  string
+	peerHostAlias string
+	tlsCert       string
+	mspID         string
+	mspDir        string
+	channel       string
+	chaincode     string
+}
+
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func newRootCommand() *cobra.Command {
+	flags := &connectionFlags{}
+
+	root := &cobra.Command{
+		Use:          "lendingctl",
+		Short:        "Operate the lending network",
+		SilenceUsage: true,
+	}
+
+	persistent := root.PersistentFlags()
+	persistent.StringVar(&flags.peerEndpoint, "peer-endpoint", "localhost:7051", "gateway peer endpoint")
+	persistent.StringVar(&flags.peerHostAlias, "peer-host-alias", "peer0.org1.example.com", "TLS server name of the peer")
+	persistent.StringVar(&flags.tlsCert, "tls-cert", "", "path to the peer TLS CA certificate")
+	persistent.StringVar(&flags.mspID, "msp-id", "", "MSP ID of the invoking identity, e.g. HDFCMSP")
+	persistent.StringVar(&flags.mspDir, "msp-dir", "", "MSP directory of the invoking identity")
+	persistent.StringVar(&flags.channel, "channel", "mychannel", "channel name")
+	persistent.StringVar(&flags.chaincode, "chaincode", "lending", "chaincode name")
+
+	root.AddCommand(
+		newInitCommand(flags),
+		newMintCommand(flags),
+		newAccountCommand(flags),
+		newLoansCommand(flags),
+		newReportCommand(flags),
+	)
+	return root
+}
+
+// Connects to the network and hands the lending contract to run
+func withContract(flags *connectionFlags, run func(contract *client.Contract) error) error {
+	if flags.tlsCert == "" || flags.mspID == "" || flags.mspDir == "" {
+		return fmt.Errorf("--tls-cert, --msp-id and --msp-dir are required")
+	}
+
+	connection, err := gateway.NewConnection(flags.peerEndpoint, flags.tlsCert, flags.peerHostAlias)
+	if err != nil {
+		return err
+	}
+	defer connection.Close()
+
+	gw, err := gateway.ConnectMSPDir(connection, flags.mspID, flags.mspDir)
+	if err != nil {
+		return err
+	}
+	defer gw.Close()
+
+	return run(gw.GetNetwork(flags.channel).GetContract(flags.chaincode))
+}
+
+// Submits a transaction and reports its ID once committed
+func submit(contract *client.Contract, function string, args ...string) error {
+	_, commit, err := contract.SubmitAsync(function, client.WithArguments(args...))
+	if err != nil {
+		return err
+	}
+
+	status, err := commit.Status()
+	if err != nil {
+		return err
+	}
+	if !status.Successful {
+		return fmt.Errorf("transaction %s failed to commit with status %d", status.TransactionID, int32(status.Code))
+	}
+
+	fmt.Printf("%s committed (TxID: %s)\n", function, status.TransactionID)
+	return nil
+}
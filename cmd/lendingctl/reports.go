@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+func newReportCommand(flags *connectionFlags) *cobra.Command {
+	var output string
+
+	report := &cobra.Command{
+		Use:   "report",
+		Short: "Export chaincode reports as JSON",
+	}
+	report.PersistentFlags().StringVarP(&output, "output", "o", "", "write the report to a file instead of stdout")
+
+	// Each report maps its positional arguments straight onto the chaincode
+	// function. Paged reports name the field holding each page's records and
+	// are fetched in full, following bookmarks.
+	reports := []struct {
+		use      string
+		short    string
+		function string
+		args     int
+		paged    string
+	}{
+		{"bureau <lenderID> <period>", "Credit bureau account records", "GenerateBureauReport", 2, ""},
+		{"psl <lenderID> <quarter>", "Priority sector lending achievement", "GetPSLReport", 2, ""},
+		{"regulatory <lenderID> <period> <returnType>", "Supervisory return aggregates (regulator only)", "GenerateRegulatoryReturn", 3, ""},
+		{"portfolio <lenderID>", "Portfolio summary by status", "GetPortfolioSummary", 1, ""},
+		{"applications <lenderID>", "Applications awaiting a decision or disbursement, in loan ID order", "GetPendingApplications", 1, "applications"},
+		{"delinquency <lenderID> <asOfDate>", "Days-past-due aging buckets", "GetDelinquencyBuckets", 2, ""},
+		{"exposure", "Sanctioned credit outstanding against the lending caps", "GetCreditExposure", 0, "exposures"},
+		{"cap-breaches", "Approvals refused for breaching a lending cap (regulator only)", "GetCapBreaches", 0, "breaches"},
+		{"account-statement <account> <fromDate> <toDate>", "Token account credits and debits with running balance", "GetAccountStatement", 3, "entries"},
+		{"rate-resets <lenderID> <period>", "Floating rate resets with installments before and after", "GetRateResetReport", 2, ""},
+	}
+
+	for _, r := range reports {
+		function, paged := r.function, r.paged
+		var pageSize int32
+		command := &cobra.Command{
+			Use:   r.use,
+			Short: r.short,
+			Args:  cobra.ExactArgs(r.args),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return withContract(flags, func(contract *client.Contract) error {
+					var result []byte
+					var err error
+					if paged == "" {
+						result, err = contract.EvaluateTransaction(function, args...)
+					} else {
+						result, err = evaluateAllPages(contract, function, paged, pageSize, args...)
+					}
+					if err != nil {
+						return err
+					}
+					return writeReport(cmd, output, result)
+				})
+			},
+		}
+		if paged != "" {
+			command.Flags().Int32Var(&pageSize, "page-size", 100, "records fetched per query")
+		}
+		report.AddCommand(command)
+	}
+
+	return report
+}
+
+func evaluateAndPrint(cmd *cobra.Command, contract *client.Contract, function string, args ...string) error {
+	result, err := contract.EvaluateTransaction(function, args...)
+	if err != nil {
+		return err
+	}
+	return writeReport(cmd, "", result)
+}
+
+// Every record of a paged query as one JSON array, the records being under
+// field in each page
+func evaluateAllPages(contract *client.Contract, function string, field string, pageSize int32, args ...string) ([]byte, error) {
+	records := []json.RawMessage{}
+	bookmark := ""
+	for {
+		pageArgs := append(append([]string{}, args...), strconv.Itoa(int(pageSize)), bookmark)
+		result, err := contract.EvaluateTransaction(function, pageArgs...)
+		if err != nil {
+			return nil, err
+		}
+
+		var page map[string]json.RawMessage
+		if err := json.Unmarshal(result, &page); err != nil {
+			return nil, fmt.Errorf("unexpected %s result: %w", function, err)
+		}
+		var pageRecords []json.RawMessage
+		if err := json.Unmarshal(page[field], &pageRecords); err != nil {
+			return nil, fmt.Errorf("unexpected %s result: %w", function, err)
+		}
+		records = append(records, pageRecords...)
+
+		if err := json.Unmarshal(page["bookmark"], &bookmark); err != nil {
+			return nil, fmt.Errorf("unexpected %s result: %w", function, err)
+		}
+		if bookmark == "" {
+			return json.Marshal(records)
+		}
+	}
+}
+
+func writeReport(cmd *cobra.Command, output string, result []byte) error {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, result, "", "  "); err != nil {
+		// Not JSON, such as a bare balance
+		indented.Reset()
+		indented.Write(result)
+	}
+	indented.WriteString("\n")
+
+	if output == "" {
+		_, err := cmd.OutOrStdout().Write(indented.Bytes())
+		return err
+	}
+
+	if err := os.WriteFile(output, indented.Bytes(), 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.ErrOrStderr(), "report written to %s\n", output)
+	return nil
+}
@@ -0,0 +1,106 @@
+// Package gateway holds the Fabric Gateway connection plumbing shared by the
+// off-chain tools: the REST API, the admin CLI and the Go client.
+package gateway
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-gateway/pkg/hash"
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Opens a TLS gRPC connection to a gateway peer
+func NewConnection(peerEndpoint string, tlsCertPath string, hostAlias string) (*grpc.ClientConn, error) {
+	certificatePEM, err := os.ReadFile(tlsCertPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read peer TLS certificate: %w", err)
+	}
+	certificate, err := identity.CertificateFromPEM(certificatePEM)
+	if err != nil {
+		return nil, err
+	}
+
+	certPool := x509.NewCertPool()
+	certPool.AddCert(certificate)
+	transportCredentials := credentials.NewClientTLSFromCert(certPool, hostAlias)
+
+	connection, err := grpc.NewClient(peerEndpoint, grpc.WithTransportCredentials(transportCredentials))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC connection: %w", err)
+	}
+	return connection, nil
+}
+
+// Connects as the identity in a Fabric MSP directory (signcerts/ and keystore/)
+func ConnectMSPDir(connection *grpc.ClientConn, mspID string, mspDir string) (*client.Gateway, error) {
+	return Connect(connection, mspID, filepath.Join(mspDir, "signcerts"), filepath.Join(mspDir, "keystore"))
+}
+
+// Connects as the identity with the given certificate and private key, each
+// path may be a file or a directory whose first file is used
+func Connect(connection *grpc.ClientConn, mspID string, certPath string, keyPath string) (*client.Gateway, error) {
+	certificatePEM, err := readFileOrFirstInDir(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+	certificate, err := identity.CertificateFromPEM(certificatePEM)
+	if err != nil {
+		return nil, err
+	}
+	id, err := identity.NewX509Identity(mspID, certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKeyPEM, err := readFileOrFirstInDir(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+	privateKey, err := identity.PrivateKeyFromPEM(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	sign, err := identity.NewPrivateKeySign(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Connect(
+		id,
+		client.WithSign(sign),
+		client.WithHash(hash.SHA256),
+		client.WithClientConnection(connection),
+		client.WithEvaluateTimeout(5*time.Second),
+		client.WithEndorseTimeout(15*time.Second),
+		client.WithSubmitTimeout(5*time.Second),
+		client.WithCommitStatusTimeout(1*time.Minute),
+	)
+}
+
+func readFileOrFirstInDir(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return os.ReadFile(path)
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			return os.ReadFile(filepath.Join(path, entry.Name()))
+		}
+	}
+	return nil, fmt.Errorf("no files in %s", path)
+}
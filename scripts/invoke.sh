@@ -26,4 +26,4 @@ peer chaincode invoke \
   --tlsRootCertFiles ${PWD}/organizations/peerOrganizations/org1.example.com/peers/peer0.org1.example.com/tls/ca.crt \
   --peerAddresses localhost:9051 \
   --tlsRootCertFiles ${PWD}/organizations/peerOrganizations/org2.example.com/peers/peer0.org2.example.com/tls/ca.crt \
-  -c '{"function":"RequestLoan","Args":["LOAN001","BORROWER001","1000","5","12","CAR"]}'
\ No newline at end of file
+  -c '{"function":"RequestLoan","Args":["LOAN001","BORROWER001","1000","5","12","CAR","VEHICLE","",""]}'
\ No newline at end of file